@@ -1,7 +1,10 @@
 package rest
 
 import (
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"strconv"
 	"time"
@@ -18,9 +21,36 @@ import (
 type Server struct {
 	storage      storage.Storage
 	tokenManager *auth.TokenManager
+	revocations  *auth.RevocationList
+	interfaces   []*ManagedInterface // перший - інтерфейс за замовчуванням
 	config       *Config
 }
 
+// ManagedInterface - WireGuard інтерфейс, яким керує сервер
+type ManagedInterface struct {
+	Name      string
+	Allocator IPAllocator
+	Syncer    PeerSyncer
+
+	// PersistentKeepalive - інтервал keepalive за замовчуванням для нових peer'ів
+	PersistentKeepalive int
+}
+
+// IPAllocator виділяє адреси новим peer'ам.
+// Реалізується InterfaceManager з internal/server.
+type IPAllocator interface {
+	AllocatePeerAddresses(peerID uuid.UUID, static net.IP) ([]string, error)
+	MovePeerAddress(peerID uuid.UUID, ip net.IP) (string, string, error)
+	ReleasePeerIP(peerID uuid.UUID) error
+	ReleaseAddresses(addresses []string)
+}
+
+// PeerSyncer застосовує зміни peer'ів до WireGuard пристрою.
+// Реалізується Reconciler з internal/server.
+type PeerSyncer interface {
+	Trigger()
+}
+
 // Config конфігурація для REST API
 type Config struct {
 	Port      int    `yaml:"port" json:"port"`
@@ -28,17 +58,77 @@ type Config struct {
 	TLSCert   string `yaml:"tls_cert" json:"tls_cert"`
 	TLSKey    string `yaml:"tls_key" json:"tls_key"`
 	SecretKey string `yaml:"secret_key" json:"secret_key"`
+
+	// Терміни дії токенів клієнта; 0 - значення за замовчуванням з пакета auth
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" json:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" json:"refresh_token_ttl"`
 }
 
-// NewServer створює новий REST API сервер
-func NewServer(storage storage.Storage, tokenManager *auth.TokenManager, config *Config) *Server {
+// NewServer створює новий REST API сервер для інтерфейсів interfaces
+func NewServer(storage storage.Storage, tokenManager *auth.TokenManager, interfaces []*ManagedInterface, config *Config) *Server {
 	return &Server{
 		storage:      storage,
 		tokenManager: tokenManager,
+		revocations:  auth.NewRevocationList(storage.ListRevocations, auth.DefaultRevocationCacheTTL),
+		interfaces:   interfaces,
 		config:       config,
 	}
 }
 
+// managedInterface повертає інтерфейс з назвою name або nil, якщо сервер
+// ним не керує. Порожня назва означає інтерфейс за замовчуванням.
+func (s *Server) managedInterface(name string) *ManagedInterface {
+	if name == "" {
+		return s.interfaces[0]
+	}
+	for _, iface := range s.interfaces {
+		if iface.Name == name {
+			return iface
+		}
+	}
+	return nil
+}
+
+// requestInterface повертає інтерфейс з параметра маршруту :interface;
+// маршрути без цього параметра працюють з інтерфейсом за замовчуванням.
+// Якщо інтерфейс невідомий, відправляє 404 і повертає false.
+func (s *Server) requestInterface(c *gin.Context) (*ManagedInterface, bool) {
+	iface := s.managedInterface(c.Param("interface"))
+	if iface == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Interface not found"})
+		return nil, false
+	}
+	return iface, true
+}
+
+// requestPeer завантажує peer'а з параметра маршруту :id разом з його інтерфейсом.
+// На маршрутах з :interface peer'и інших інтерфейсів вважаються відсутніми.
+// При помилці відправляє відповідь клієнту і повертає false.
+func (s *Server) requestPeer(c *gin.Context) (*wg.Peer, *ManagedInterface, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid peer ID"})
+		return nil, nil, false
+	}
+
+	peer, err := s.storage.GetPeer(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return nil, nil, false
+	}
+	if peer == nil || (c.Param("interface") != "" && peer.InterfaceName != c.Param("interface")) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Peer not found"})
+		return nil, nil, false
+	}
+
+	iface := s.managedInterface(peer.InterfaceName)
+	if iface == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Peer interface " + peer.InterfaceName + " is not managed by this server"})
+		return nil, nil, false
+	}
+	return peer, iface, true
+}
+
 // SetupRoutes налаштовує маршрути API
 func (s *Server) SetupRoutes() *gin.Engine {
 	r := gin.Default()
@@ -57,10 +147,14 @@ func (s *Server) SetupRoutes() *gin.Engine {
 		c.Next()
 	})
 
+	// Публічні ключі для перевірки токенів іншими сервісами
+	r.GET("/.well-known/jwks.json", s.handleJWKS)
+
 	// Публічні маршрути
 	public := r.Group("/api/v1")
 	{
 		public.POST("/enroll", s.handleEnroll)
+		public.POST("/refresh", s.handleRefresh)
 		public.GET("/health", s.handleHealth)
 	}
 
@@ -68,16 +162,33 @@ func (s *Server) SetupRoutes() *gin.Engine {
 	protected := r.Group("/api/v1")
 	protected.Use(s.authMiddleware())
 	{
-		// Peer management
-		protected.GET("/peers", s.handleListPeers)
-		protected.GET("/peers/:id", s.handleGetPeer)
-		protected.POST("/peers", s.handleCreatePeer)
-		protected.PUT("/peers/:id", s.handleUpdatePeer)
-		protected.DELETE("/peers/:id", s.handleDeletePeer)
+		readPeers := s.requirePermission(auth.PermReadPeers)
+		readPeer := s.requirePermission(auth.PermReadPeers, auth.PermReadOwnPeer)
+		writePeers := s.requirePermission(auth.PermWritePeers)
+
+		// Peer management; маршрути без інтерфейсу працюють з інтерфейсом за замовчуванням
+		protected.GET("/peers", readPeers, s.handleListPeers)
+		protected.GET("/peers/:id", readPeer, s.handleGetPeer)
+		protected.POST("/peers", writePeers, s.handleCreatePeer)
+		protected.PUT("/peers/:id", writePeers, s.handleUpdatePeer)
+		protected.DELETE("/peers/:id", writePeers, s.handleDeletePeer)
+
+		// Interfaces
+		protected.GET("/interfaces", s.requirePermission(auth.PermReadInterfaces), s.handleListInterfaces)
+		scoped := protected.Group("/interfaces/:interface")
+		{
+			scoped.GET("/peers", readPeers, s.handleListPeers)
+			scoped.GET("/peers/:id", readPeer, s.handleGetPeer)
+			scoped.POST("/peers", writePeers, s.handleCreatePeer)
+			scoped.PUT("/peers/:id", writePeers, s.handleUpdatePeer)
+			scoped.DELETE("/peers/:id", writePeers, s.handleDeletePeer)
+		}
 
 		// Configuration
-		protected.GET("/config/:peer_id", s.handleGetConfig)
-		protected.POST("/refresh-token", s.handleRefreshToken)
+		protected.GET("/config/:peer_id", s.requirePermission(auth.PermReadConfigs, auth.PermReadOwnPeer), s.handleGetConfig)
+
+		// Tokens
+		protected.DELETE("/tokens/:jti", s.requirePermission(auth.PermRevokeAnyTokens, auth.PermRevokeOwnToken), s.handleRevokeToken)
 	}
 
 	return r
@@ -107,13 +218,65 @@ func (s *Server) authMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		revoked, err := s.revocations.IsRevoked(claims)
+		if err != nil {
+			log.Printf("Failed to check token revocation: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			c.Abort()
+			return
+		}
+		if revoked {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
 		c.Set("user_id", claims.UserID)
 		c.Set("username", claims.Username)
 		c.Set("role", claims.Role)
+		c.Set("peer_id", claims.PeerID)
+		c.Set("token_id", claims.ID)
 		c.Next()
 	}
 }
 
+// requirePermission пропускає запит, якщо роль токена має хоча б один
+// з дозволів, інакше відповідає 403. Дозволи на власні ресурси
+// (напр. auth.PermReadOwnPeer) додатково перевіряє обробник.
+func (s *Server) requirePermission(permissions ...auth.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("role")
+		for _, permission := range permissions {
+			if auth.HasPermission(role, permission) {
+				c.Next()
+				return
+			}
+		}
+
+		log.Printf("Access denied: %s %s for role %q", c.Request.Method, c.FullPath(), role)
+		c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+		c.Abort()
+	}
+}
+
+// authorizePeer перевіряє доступ до peer'а з параметра маршруту param:
+// роль з дозволом permission має доступ до всіх peer'ів, решта - лише до
+// peer'а з claim peer_id. Інакше відповідає 403 і повертає false.
+func (s *Server) authorizePeer(c *gin.Context, permission auth.Permission, param string) bool {
+	if auth.HasPermission(c.GetString("role"), permission) {
+		return true
+	}
+
+	peerID, _ := c.Get("peer_id")
+	own, _ := peerID.(uuid.UUID)
+	if own != uuid.Nil && c.Param(param) == own.String() {
+		return true
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{"error": "Access to this peer is not allowed"})
+	return false
+}
+
 // handleHealth перевіряє стан сервера
 func (s *Server) handleHealth(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{
@@ -123,6 +286,13 @@ func (s *Server) handleHealth(c *gin.Context) {
 	})
 }
 
+// handleJWKS повертає публічні ключі підпису токенів, включно з ключами,
+// що після ротації ще перевіряють раніше видані токени
+func (s *Server) handleJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, s.tokenManager.JWKS())
+}
+
 // handleEnroll обробляє реєстрацію клієнта
 func (s *Server) handleEnroll(c *gin.Context) {
 	var req struct {
@@ -135,6 +305,10 @@ func (s *Server) handleEnroll(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if err := wg.ValidatePublicKey(req.PublicKey); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid public key: " + err.Error()})
+		return
+	}
 
 	// Логування для діагностики
 	log.Printf("Enrollment request: token=%s, client_name=%s, public_key=%s", req.Token[:20]+"...", req.ClientName, req.PublicKey[:20]+"...")
@@ -146,17 +320,27 @@ func (s *Server) handleEnroll(c *gin.Context) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid enrollment token"})
 		return
 	}
-	if claims.Role != "enrollment" {
+	if claims.Role != auth.RoleEnrollment {
 		log.Printf("Invalid token role: %s, expected: enrollment", claims.Role)
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid enrollment token"})
 		return
 	}
 
+	revoked, err := s.revocations.IsRevoked(claims)
+	if err != nil {
+		log.Printf("Failed to check token revocation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if revoked {
+		log.Printf("Enrollment token %s for user %s has been revoked", claims.ID, claims.Username)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid enrollment token"})
+		return
+	}
+
 	log.Printf("Token validated successfully for user: %s", claims.Username)
 
 	// Перевіряємо, чи не існує вже peer з таким ім'ям
-	// Тимчасово пропускаємо цю перевірку, оскільки GetPeerByName може не існувати
-	/*
 	existingPeer, err := s.storage.GetPeerByName(req.ClientName)
 	if err != nil {
 		log.Printf("Database error when checking existing peer: %v", err)
@@ -168,42 +352,242 @@ func (s *Server) handleEnroll(c *gin.Context) {
 		c.JSON(http.StatusConflict, gin.H{"error": "Peer with this name already exists"})
 		return
 	}
-	*/
 
-	// Створюємо нового peer'а
-	peer := &wg.Peer{
-		ID:         uuid.New(),
-		Name:       req.ClientName,
-		PublicKey:  req.PublicKey,
-		AllowedIPs: []string{"10.0.0.0/24"}, // TODO: Implement proper IPAM
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
-		IsActive:   true,
+	// Публічний ключ теж не може належати двом peer'ам
+	existingPeer, err = s.storage.GetPeerByPublicKey(req.PublicKey)
+	if err != nil {
+		log.Printf("Database error when checking existing peer: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if existingPeer != nil {
+		log.Printf("Public key of %s is already used by peer %s", req.ClientName, existingPeer.Name)
+		c.JSON(http.StatusConflict, gin.H{"error": "Peer with this public key already exists"})
+		return
 	}
 
-	if err := s.storage.SavePeer(peer); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save peer"})
+	// Клієнт підключається до інтерфейсу користувача, для якого видано токен
+	iface := s.interfaces[0]
+	owner, err := s.storage.GetPeerByName(claims.Username)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
 		return
 	}
+	if owner != nil {
+		if iface = s.managedInterface(owner.InterfaceName); iface == nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Interface " + owner.InterfaceName + " is not managed by this server"})
+			return
+		}
+	}
 
-	// Генеруємо постійний токен для клієнта
-	accessToken, err := s.tokenManager.GenerateToken(
-		claims.UserID, req.ClientName, "client", &peer.ID, 24*time.Hour)
+	// Enrollment токен одноразовий. Він позначається використаним до створення
+	// peer'а, щоб із паралельних запитів з тим самим токеном пройшов лише один,
+	// і знову стає дійсним, якщо peer'а створити не вдалося.
+	if err := s.storage.UseToken(claims.ID, auth.HashToken(req.Token)); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrTokenUsed):
+			log.Printf("Enrollment token %s for user %s has already been used", claims.ID, claims.Username)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Enrollment token has already been used"})
+		case errors.Is(err, storage.ErrTokenNotFound):
+			log.Printf("Enrollment token %s for user %s is not registered", claims.ID, claims.Username)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid enrollment token"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+
+	// Створюємо нового peer'а
+	peer := &wg.Peer{
+		ID:        uuid.New(),
+		Name:      req.ClientName,
+		PublicKey: req.PublicKey,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		IsActive:  true,
+
+		PersistentKeepalive: iface.PersistentKeepalive,
+		InterfaceName:       iface.Name,
+	}
+
+	// Генеруємо токени клієнта: refresh токен починає нову сім'ю
+	tokens, refreshToken, err := s.newTokenPair(peer, claims.UserID, uuid.Nil)
 	if err != nil {
+		log.Printf("Failed to generate tokens for peer %s: %v", peer.Name, err)
+		s.releaseToken(claims.ID)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"success":      true,
-		"message":      "Client enrolled successfully",
-		"peer_id":      peer.ID,
-		"access_token": accessToken,
-		"allowed_ips":  peer.AllowedIPs,
+	if !s.assignAddresses(c, iface, peer, nil) {
+		s.releaseToken(claims.ID)
+		return
+	}
+
+	// Peer без refresh токена не зберігається, інакше клієнт без токенів
+	// не зміг би ні оновити їх, ні зареєструватися з тим самим ім'ям
+	if err := s.storage.SavePeerWithRefreshToken(peer, refreshToken); err != nil {
+		log.Printf("Failed to save enrolled peer %s: %v", peer.Name, err)
+		s.releaseAddresses(iface, peer)
+		s.releaseToken(claims.ID)
+		s.respondSaveError(c, err, "Failed to save peer")
+		return
+	}
+	iface.Syncer.Trigger()
+
+	// Без конфігурації реєстрація все одно успішна: її можна отримати через /config
+	clientConfig, err := s.clientConfig(peer)
+	if err != nil {
+		log.Printf("Failed to build client config for peer %s: %v", peer.Name, err)
+	}
+
+	c.JSON(http.StatusCreated, wg.EnrollResponse{
+		Success:      true,
+		Message:      "Client enrolled successfully",
+		PeerID:       peer.ID,
+		AllowedIPs:   peer.AllowedIPs,
+		ClientConfig: clientConfig,
+		TokenPair:    *tokens,
 	})
 }
 
-// handleListPeers повертає список всіх peer'ів
+// newTokenPair генерує access токен і refresh токен клієнта peer'а.
+// familyID - сім'я refresh токена, що замінюється, або uuid.Nil для нової.
+// Запис refresh токена повертається незбереженим.
+func (s *Server) newTokenPair(peer *wg.Peer, userID, familyID uuid.UUID) (*wg.TokenPair, *wg.RefreshToken, error) {
+	accessTTL, refreshTTL := s.config.AccessTokenTTL, s.config.RefreshTokenTTL
+	if accessTTL == 0 {
+		accessTTL = auth.DefaultAccessTokenTTL
+	}
+	if refreshTTL == 0 {
+		refreshTTL = auth.DefaultRefreshTokenTTL
+	}
+
+	accessToken, err := s.tokenManager.GenerateToken(userID, peer.Name, auth.RoleClient, &peer.ID, accessTTL)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate access token: %w", err)
+	}
+	refreshToken, record, err := auth.GenerateRefreshToken(peer.ID, userID, familyID, refreshTTL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return &wg.TokenPair{
+		AccessToken:        accessToken,
+		TokenExpiry:        record.CreatedAt.Add(accessTTL),
+		RefreshToken:       refreshToken,
+		RefreshTokenExpiry: record.ExpiresAt,
+	}, record, nil
+}
+
+// assignAddresses виділяє peer'у адреси з пулу інтерфейсу, static - необов'язкова
+// статична адреса. При помилці відправляє відповідь клієнту і повертає false.
+func (s *Server) assignAddresses(c *gin.Context, iface *ManagedInterface, peer *wg.Peer, static net.IP) bool {
+	addresses, err := iface.Allocator.AllocatePeerAddresses(peer.ID, static)
+	if err != nil {
+		s.respondAddressError(c, peer, err)
+		return false
+	}
+
+	peer.AllowedIPs = addresses
+	return true
+}
+
+// respondAddressError відправляє клієнту відповідь на помилку виділення адреси
+func (s *Server) respondAddressError(c *gin.Context, peer *wg.Peer, err error) {
+	switch {
+	case errors.Is(err, wg.ErrPoolExhausted):
+		c.JSON(http.StatusInsufficientStorage, gin.H{"error": "No free addresses left in the pool"})
+	case errors.Is(err, wg.ErrAddressOutOfPool):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, wg.ErrAddressAllocated), errors.Is(err, storage.ErrAddressInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": "Address is already allocated"})
+	default:
+		log.Printf("Failed to allocate addresses for peer %s: %v", peer.Name, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to allocate address"})
+	}
+}
+
+// parseStaticIP розбирає необов'язкову статичну адресу з запиту.
+// При помилці відправляє відповідь клієнту і повертає false.
+func parseStaticIP(c *gin.Context, value string) (net.IP, bool) {
+	if value == "" {
+		return nil, true
+	}
+	ip := net.ParseIP(value)
+	if ip == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid IP address"})
+		return nil, false
+	}
+	return ip, true
+}
+
+// releaseAddresses повертає адреси peer'а в пул після невдалого збереження
+func (s *Server) releaseAddresses(iface *ManagedInterface, peer *wg.Peer) {
+	if err := iface.Allocator.ReleasePeerIP(peer.ID); err != nil {
+		log.Printf("Failed to release addresses of peer %s: %v", peer.Name, err)
+	}
+}
+
+// releaseToken повертає дійсність одноразовому токену після невдалої операції
+func (s *Server) releaseToken(id string) {
+	if err := s.storage.ReleaseToken(id); err != nil {
+		log.Printf("Failed to release token %s: %v", id, err)
+	}
+}
+
+// respondSaveError відправляє клієнту відповідь на помилку збереження peer'а
+func (s *Server) respondSaveError(c *gin.Context, err error, message string) {
+	switch {
+	case errors.Is(err, storage.ErrInterfaceNotFound):
+		c.JSON(http.StatusConflict, gin.H{"error": "Interface is not initialized"})
+		return
+	case errors.Is(err, storage.ErrPeerExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "Peer with this name or public key already exists"})
+		return
+	}
+	c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
+
+// handleListInterfaces повертає інтерфейси, якими керує сервер
+func (s *Server) handleListInterfaces(c *gin.Context) {
+	peers, err := s.storage.ListPeers()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch peers"})
+		return
+	}
+	counts := make(map[string]int)
+	for _, peer := range peers {
+		counts[peer.InterfaceName]++
+	}
+
+	interfaces := make([]gin.H, 0, len(s.interfaces))
+	for _, iface := range s.interfaces {
+		stored, err := s.storage.GetInterface(iface.Name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+
+		info := gin.H{
+			"name":        iface.Name,
+			"initialized": stored != nil,
+			"peers":       counts[iface.Name],
+		}
+		if stored != nil {
+			info["public_key"] = stored.PublicKey
+			info["listen_port"] = stored.ListenPort
+			info["address"] = stored.Address
+			info["mtu"] = stored.MTU
+		}
+		interfaces = append(interfaces, info)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"interfaces": interfaces})
+}
+
+// handleListPeers повертає список peer'ів: всіх або, на маршруті
+// з :interface, лише peer'ів цього інтерфейсу
 func (s *Server) handleListPeers(c *gin.Context) {
 	peers, err := s.storage.ListPeers()
 	if err != nil {
@@ -211,35 +595,64 @@ func (s *Server) handleListPeers(c *gin.Context) {
 		return
 	}
 
+	if name := c.Param("interface"); name != "" {
+		iface, ok := s.requestInterface(c)
+		if !ok {
+			return
+		}
+		scoped := make([]*wg.Peer, 0, len(peers))
+		for _, peer := range peers {
+			if peer.InterfaceName == iface.Name {
+				scoped = append(scoped, peer)
+			}
+		}
+		peers = scoped
+	}
+	s.applyStats(peers...)
+
 	c.JSON(http.StatusOK, gin.H{"peers": peers})
 }
 
 // handleGetPeer повертає інформацію про конкретний peer
 func (s *Server) handleGetPeer(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := uuid.Parse(idStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid peer ID"})
+	if !s.authorizePeer(c, auth.PermReadPeers, "id") {
 		return
 	}
 
-	peer, err := s.storage.GetPeer(id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		return
-	}
-	if peer == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Peer not found"})
+	peer, _, ok := s.requestPeer(c)
+	if !ok {
 		return
 	}
+	s.applyStats(peer)
 
 	c.JSON(http.StatusOK, peer)
 }
 
+// applyStats заповнює статус онлайн і накопичений трафік peer'ів.
+// Помилка читання статистики не заважає віддати самих peer'ів.
+func (s *Server) applyStats(peers ...*wg.Peer) {
+	all, err := s.storage.ListPeerStats()
+	if err != nil {
+		log.Printf("Failed to load peer stats: %v", err)
+	}
+
+	byPeer := make(map[uuid.UUID]*wg.PeerStats, len(all))
+	for _, stats := range all {
+		byPeer[stats.PeerID] = stats
+	}
+
+	for _, peer := range peers {
+		peer.ApplyStats(byPeer[peer.ID])
+	}
+}
+
 // handleCreatePeer створює новий peer
 func (s *Server) handleCreatePeer(c *gin.Context) {
 	var req struct {
 		Name string `json:"name" binding:"required"`
+		IP   string `json:"ip"` // необов'язкова статична адреса
+
+		PersistentKeepalive *int `json:"persistent_keepalive"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -247,39 +660,61 @@ func (s *Server) handleCreatePeer(c *gin.Context) {
 		return
 	}
 
+	iface, ok := s.requestInterface(c)
+	if !ok {
+		return
+	}
+
+	keepalive := iface.PersistentKeepalive
+	if req.PersistentKeepalive != nil {
+		keepalive = *req.PersistentKeepalive
+	}
+	if err := wg.ValidatePersistentKeepalive(keepalive); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	static, ok := parseStaticIP(c, req.IP)
+	if !ok {
+		return
+	}
+
+	existingPeer, err := s.storage.GetPeerByName(req.Name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if existingPeer != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Peer with this name already exists"})
+		return
+	}
+
 	peer, err := wg.NewPeer(req.Name)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create peer"})
 		return
 	}
+	peer.PersistentKeepalive = keepalive
+	peer.InterfaceName = iface.Name
 
-	// TODO: Implement proper IPAM
-	peer.AllowedIPs = []string{"10.0.0.0/32"}
+	if !s.assignAddresses(c, iface, peer, static) {
+		return
+	}
 
 	if err := s.storage.SavePeer(peer); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save peer"})
+		s.releaseAddresses(iface, peer)
+		s.respondSaveError(c, err, "Failed to save peer")
 		return
 	}
+	iface.Syncer.Trigger()
 
 	c.JSON(http.StatusCreated, peer)
 }
 
 // handleUpdatePeer оновлює peer
 func (s *Server) handleUpdatePeer(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := uuid.Parse(idStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid peer ID"})
-		return
-	}
-
-	peer, err := s.storage.GetPeer(id)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
-		return
-	}
-	if peer == nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Peer not found"})
+	peer, iface, ok := s.requestPeer(c)
+	if !ok {
 		return
 	}
 
@@ -287,12 +722,55 @@ func (s *Server) handleUpdatePeer(c *gin.Context) {
 		Name     *string `json:"name"`
 		IsActive *bool   `json:"is_active"`
 		Endpoint *string `json:"endpoint"`
+		IP       *string `json:"ip"` // нова адреса peer'а того ж сімейства
+
+		PersistentKeepalive *int `json:"persistent_keepalive"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.PersistentKeepalive != nil {
+		if err := wg.ValidatePersistentKeepalive(*req.PersistentKeepalive); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if req.Name != nil && *req.Name != peer.Name {
+		existingPeer, err := s.storage.GetPeerByName(*req.Name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+			return
+		}
+		if existingPeer != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Peer with this name already exists"})
+			return
+		}
+	}
+
+	// Переносимо peer'а на нову адресу до інших змін, щоб конфлікт
+	// адрес не залишив peer'а частково оновленим
+	var oldAddress, newAddress string
+	var err error
+	if req.IP != nil {
+		ip, ok := parseStaticIP(c, *req.IP)
+		if !ok {
+			return
+		}
+		if ip == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid IP address"})
+			return
+		}
+
+		oldAddress, newAddress, err = iface.Allocator.MovePeerAddress(peer.ID, ip)
+		if err != nil {
+			s.respondAddressError(c, peer, err)
+			return
+		}
+		peer.AllowedIPs = replaceAddress(peer.AllowedIPs, oldAddress, newAddress)
+	}
 
 	if req.Name != nil {
 		peer.Name = *req.Name
@@ -303,36 +781,78 @@ func (s *Server) handleUpdatePeer(c *gin.Context) {
 	if req.Endpoint != nil {
 		peer.Endpoint = *req.Endpoint
 	}
+	if req.PersistentKeepalive != nil {
+		peer.PersistentKeepalive = *req.PersistentKeepalive
+	}
 
 	peer.UpdatedAt = time.Now()
 
 	if err := s.storage.SavePeer(peer); err != nil {
+		if oldAddress != "" && oldAddress != newAddress {
+			s.restoreAddress(iface, peer, oldAddress)
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update peer"})
 		return
 	}
+	iface.Syncer.Trigger()
 
 	c.JSON(http.StatusOK, peer)
 }
 
+// replaceAddress замінює адресу old на new в AllowedIPs peer'а.
+// Якщо old порожня або відсутня, new додається в кінець.
+func replaceAddress(allowedIPs []string, old, new string) []string {
+	result := make([]string, 0, len(allowedIPs)+1)
+	replaced := false
+	for _, address := range allowedIPs {
+		if old != "" && address == old {
+			address = new
+			replaced = true
+		}
+		result = append(result, address)
+	}
+	if !replaced {
+		result = append(result, new)
+	}
+	return result
+}
+
+// restoreAddress повертає peer'у попередню адресу після невдалого збереження
+func (s *Server) restoreAddress(iface *ManagedInterface, peer *wg.Peer, address string) {
+	ip, _, err := net.ParseCIDR(address)
+	if err == nil {
+		_, _, err = iface.Allocator.MovePeerAddress(peer.ID, ip)
+	}
+	if err != nil {
+		log.Printf("Failed to restore address %s of peer %s: %v", address, peer.Name, err)
+	}
+}
+
 // handleDeletePeer видаляє peer
 func (s *Server) handleDeletePeer(c *gin.Context) {
-	idStr := c.Param("id")
-	id, err := uuid.Parse(idStr)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid peer ID"})
+	peer, iface, ok := s.requestPeer(c)
+	if !ok {
 		return
 	}
 
-	if err := s.storage.DeletePeer(id); err != nil {
+	// DeletePeer видаляє виділення адрес разом з peer'ом. Адреси звільняються
+	// в пулі лише після цього, щоб при помилці їх не отримав інший peer.
+	if err := s.storage.DeletePeer(peer.ID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete peer"})
 		return
 	}
+	iface.Allocator.ReleaseAddresses(peer.AllowedIPs)
+	iface.Syncer.Trigger()
 
 	c.JSON(http.StatusOK, gin.H{"message": "Peer deleted successfully"})
 }
 
 // handleGetConfig повертає WireGuard конфігурацію для клієнта
 func (s *Server) handleGetConfig(c *gin.Context) {
+	if !s.authorizePeer(c, auth.PermReadConfigs, "peer_id") {
+		return
+	}
+
 	peerIDStr := c.Param("peer_id")
 	peerID, err := uuid.Parse(peerIDStr)
 	if err != nil {
@@ -349,54 +869,187 @@ func (s *Server) handleGetConfig(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Peer not found"})
 		return
 	}
+	// Приватний ключ імпортованого або зареєстрованого peer'а є лише в клієнта,
+	// без нього конфігурація не встановить з'єднання
+	if peer.PrivateKey == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Peer was imported without a private key"})
+		return
+	}
 
-	// Отримуємо інформацію про сервер
-	serverInterface, err := s.storage.GetInterface("wg0")
-	if err != nil || serverInterface == nil {
+	clientConfig, err := s.clientConfig(peer)
+	if err != nil {
+		log.Printf("Failed to build client config for peer %s: %v", peer.Name, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Server interface not configured"})
 		return
 	}
 
-	// Створюємо конфігурацію для клієнта
-	clientConfig := &wg.ClientConfig{
+	c.JSON(http.StatusOK, gin.H{
+		"config":    clientConfig,
+		"config_wg": clientConfig.ToWireGuardConfig(),
+	})
+}
+
+// clientConfig створює WireGuard конфігурацію клієнта peer'а
+func (s *Server) clientConfig(peer *wg.Peer) (*wg.ClientConfig, error) {
+	// Отримуємо інформацію про інтерфейс сервера, до якого підключається peer
+	interfaceName := peer.InterfaceName
+	if interfaceName == "" {
+		interfaceName = s.interfaces[0].Name
+	}
+	serverInterface, err := s.storage.GetInterface(interfaceName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load interface %s: %w", interfaceName, err)
+	}
+	if serverInterface == nil {
+		return nil, fmt.Errorf("interface %s is not configured", interfaceName)
+	}
+
+	return &wg.ClientConfig{
 		Interface: wg.ClientInterface{
 			PrivateKey: peer.PrivateKey,
 			Address:    peer.AllowedIPs,
 			DNS:        []string{"8.8.8.8", "8.8.4.4"},
+			MTU:        serverInterface.MTU,
 		},
 		Peer: wg.ServerPeer{
 			PublicKey:  serverInterface.PublicKey,
 			Endpoint:   s.config.Host + ":" + strconv.Itoa(serverInterface.ListenPort),
-			AllowedIPs: []string{"0.0.0.0/0"},
+			AllowedIPs: wg.DefaultRoutes(peer.AllowedIPs),
+
+			PresharedKey:        peer.PresharedKey,
+			PersistentKeepalive: peer.PersistentKeepalive,
 		},
+	}, nil
+}
+
+// handleRefresh видає клієнту нову пару токенів за refresh токеном.
+// Refresh токен одноразовий: при використанні він замінюється новим з тієї ж
+// сім'ї. Повторне використання вже заміненого токена означає, що його
+// скопійовано, тому відкликається вся сім'я і клієнт має зареєструватися знову.
+func (s *Server) handleRefresh(c *gin.Context) {
+	var req wg.RefreshRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"config":    clientConfig,
-		"config_wg": clientConfig.ToWireGuardConfig(),
-	})
-}
+	stored, err := s.storage.GetRefreshToken(auth.HashToken(req.RefreshToken))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if stored == nil || stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	if stored.UsedAt != nil {
+		s.revokeRefreshFamily(c, stored)
+		return
+	}
 
-// handleRefreshToken оновлює токен
-func (s *Server) handleRefreshToken(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User ID not found in token"})
+	peer, err := s.storage.GetPeer(stored.PeerID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if peer == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+	// Вимкнений peer не отримує нових токенів; його сім'я відкликається,
+	// тож після повторного ввімкнення клієнт реєструється знову
+	if !peer.IsActive {
+		log.Printf("Peer %s is disabled, revoking refresh token family %s", peer.Name, stored.FamilyID)
+		if err := s.storage.RevokeRefreshTokens(stored.FamilyID, time.Now()); err != nil {
+			log.Printf("Failed to revoke refresh token family %s: %v", stored.FamilyID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke refresh tokens"})
+			return
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Peer is disabled"})
 		return
 	}
 
-	username, _ := c.Get("username")
-	role, _ := c.Get("role")
+	revoked, err := s.revocations.IsRevoked(auth.RefreshTokenClaims(stored, peer.Name))
+	if err != nil {
+		log.Printf("Failed to check token revocation: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	if revoked {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+		return
+	}
 
-	// Генеруємо новий токен
-	newToken, err := s.tokenManager.GenerateToken(
-		userID.(uuid.UUID), username.(string), role.(string), nil, 24*time.Hour)
+	tokens, next, err := s.newTokenPair(peer, stored.UserID, stored.FamilyID)
 	if err != nil {
+		log.Printf("Failed to generate tokens for peer %s: %v", peer.Name, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate new token"})
 		return
 	}
+	if err := s.storage.RotateRefreshToken(stored.ID, next); err != nil {
+		// Той самий токен щойно використано паралельним запитом
+		if errors.Is(err, storage.ErrTokenUsed) {
+			s.revokeRefreshFamily(c, stored)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save refresh token"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{"access_token": newToken})
+	log.Printf("Refreshed tokens for peer %s (client %q)", peer.Name, req.ClientName)
+	c.JSON(http.StatusOK, wg.RefreshResponse{
+		Success:   true,
+		Message:   "Token refreshed successfully",
+		TokenPair: *tokens,
+	})
+}
+
+// revokeRefreshFamily відкликає сім'ю повторно використаного refresh токена
+// і відповідає клієнту 401
+func (s *Server) revokeRefreshFamily(c *gin.Context, reused *wg.RefreshToken) {
+	log.Printf("Refresh token %s of peer %s reused, revoking token family %s", reused.ID, reused.PeerID, reused.FamilyID)
+	if err := s.storage.RevokeRefreshTokens(reused.FamilyID, time.Now()); err != nil {
+		log.Printf("Failed to revoke refresh token family %s: %v", reused.FamilyID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke refresh tokens"})
+		return
+	}
+	c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has already been used"})
+}
+
+// handleRevokeToken відкликає токен за його ID (jti). Відкликання діє
+// одразу в цьому процесі і зберігається в базі даних для інших.
+func (s *Server) handleRevokeToken(c *gin.Context) {
+	jti := c.Param("jti")
+	if err := auth.ValidateRevocation(auth.RevokeTokenID, jti); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	// Без права відкликати будь-які токени можна відкликати лише власний
+	if !auth.HasPermission(c.GetString("role"), auth.PermRevokeAnyTokens) && c.GetString("token_id") != jti {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only your own token can be revoked"})
+		return
+	}
+
+	revocation := &wg.TokenRevocation{
+		Kind:      auth.RevokeTokenID,
+		Value:     jti,
+		RevokedAt: time.Now(),
+	}
+	if err := s.storage.RevokeTokens(revocation); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke token"})
+		return
+	}
+	s.revocations.Add(revocation)
+
+	username, _ := c.Get("username")
+	log.Printf("Token %s revoked by %v", jti, username)
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Token revoked",
+		"jti":     jti,
+	})
 }
 
 // Start запускає сервер
@@ -0,0 +1,738 @@
+package rest
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/artem/wg-orbit/internal/auth"
+	"github.com/artem/wg-orbit/internal/client"
+	"github.com/artem/wg-orbit/internal/storage"
+	"github.com/artem/wg-orbit/internal/wg"
+)
+
+// testStore - SQLite storage, операції якого можна змусити повертати помилку
+type testStore struct {
+	storage.Storage
+
+	// failures - помилки, які повертають операції з назвою-ключем
+	failures map[string]error
+}
+
+func (s *testStore) SavePeer(peer *wg.Peer) error {
+	if err := s.failures["SavePeer"]; err != nil {
+		return err
+	}
+	return s.Storage.SavePeer(peer)
+}
+
+func (s *testStore) SavePeerWithRefreshToken(peer *wg.Peer, token *wg.RefreshToken) error {
+	if err := s.failures["SavePeerWithRefreshToken"]; err != nil {
+		return err
+	}
+	return s.Storage.SavePeerWithRefreshToken(peer, token)
+}
+
+func (s *testStore) DeletePeer(id uuid.UUID) error {
+	if err := s.failures["DeletePeer"]; err != nil {
+		return err
+	}
+	return s.Storage.DeletePeer(id)
+}
+
+// poolAllocator - IPAllocator у пам'яті поверх одного IPv4 пулу
+type poolAllocator struct {
+	pool  *wg.IPPool
+	peers map[uuid.UUID]net.IP
+}
+
+func (a *poolAllocator) AllocatePeerAddresses(peerID uuid.UUID, static net.IP) ([]string, error) {
+	ip := static
+	var err error
+	if ip != nil {
+		err = a.pool.AllocateSpecific(ip)
+	} else {
+		ip, err = a.pool.AllocateIP()
+	}
+	if err != nil {
+		return nil, err
+	}
+	a.peers[peerID] = ip
+	return []string{ip.String() + "/32"}, nil
+}
+
+func (a *poolAllocator) MovePeerAddress(peerID uuid.UUID, ip net.IP) (string, string, error) {
+	current := a.peers[peerID]
+	if current.Equal(ip) {
+		return ip.String() + "/32", ip.String() + "/32", nil
+	}
+	if err := a.pool.AllocateSpecific(ip); err != nil {
+		return "", "", err
+	}
+	a.pool.ReleaseIP(current)
+	a.peers[peerID] = ip
+	return current.String() + "/32", ip.String() + "/32", nil
+}
+
+func (a *poolAllocator) ReleasePeerIP(peerID uuid.UUID) error {
+	if ip, ok := a.peers[peerID]; ok {
+		a.pool.ReleaseIP(ip)
+		delete(a.peers, peerID)
+	}
+	return nil
+}
+
+func (a *poolAllocator) ReleaseAddresses(addresses []string) {
+	for _, address := range addresses {
+		ip, _, err := net.ParseCIDR(address)
+		if err != nil {
+			continue
+		}
+		a.pool.ReleaseIP(ip)
+		for peerID, allocated := range a.peers {
+			if allocated.Equal(ip) {
+				delete(a.peers, peerID)
+			}
+		}
+	}
+}
+
+// allocated повертає true, якщо адресу address (у форматі AllowedIPs) зайнято
+func (a *poolAllocator) allocated(address string) bool {
+	ip, _, err := net.ParseCIDR(address)
+	return err == nil && a.pool.Allocated[ip.String()]
+}
+
+// countingSyncer рахує запити на синхронізацію пристрою
+type countingSyncer struct {
+	triggers int
+}
+
+func (s *countingSyncer) Trigger() { s.triggers++ }
+
+// testEnv - REST API сервер з SQLite у тимчасовій директорії та одним
+// інтерфейсом wg0 з пулом network
+type testEnv struct {
+	store  *testStore
+	tokens *auth.TokenManager
+	alloc  *poolAllocator
+	syncer *countingSyncer
+	router *gin.Engine
+}
+
+func newTestEnv(t *testing.T, network string) *testEnv {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	sqlite, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage() error: %v", err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+
+	_, serverPublic, err := wg.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error: %v", err)
+	}
+	_, ipNet, err := net.ParseCIDR(network)
+	if err != nil {
+		t.Fatalf("ParseCIDR() error: %v", err)
+	}
+	gateway := ipNet.IP.To4()
+	gateway[3]++
+	prefix, _ := ipNet.Mask.Size()
+	if err := sqlite.SaveInterface(&wg.Interface{
+		Name:       "wg0",
+		PublicKey:  serverPublic,
+		PrivateKey: "server-private",
+		ListenPort: 51820,
+		Address:    fmt.Sprintf("%s/%d", gateway, prefix),
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}); err != nil {
+		t.Fatalf("SaveInterface() error: %v", err)
+	}
+
+	pool, err := wg.NewIPPoolWithOptions(network, wg.IPPoolOptions{Gateway: gateway.String()})
+	if err != nil {
+		t.Fatalf("NewIPPoolWithOptions() error: %v", err)
+	}
+
+	env := &testEnv{
+		store:  &testStore{Storage: sqlite, failures: make(map[string]error)},
+		tokens: auth.NewTokenManager([]byte("test-secret"), "wg-orbit"),
+		alloc:  &poolAllocator{pool: pool, peers: make(map[uuid.UUID]net.IP)},
+		syncer: &countingSyncer{},
+	}
+	srv := NewServer(env.store, env.tokens, []*ManagedInterface{{
+		Name:      "wg0",
+		Allocator: env.alloc,
+		Syncer:    env.syncer,
+	}}, &Config{Host: "vpn.example.com"})
+	env.router = srv.SetupRoutes()
+
+	return env
+}
+
+// do виконує запит до API; body кодується в JSON, token - необов'язковий
+func (e *testEnv) do(t *testing.T, method, path, token string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			t.Fatalf("json.Marshal() error: %v", err)
+		}
+	}
+
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	e.router.ServeHTTP(rec, req)
+	return rec
+}
+
+// staffToken генерує токен ролі role, не прив'язаний до peer'а
+func (e *testEnv) staffToken(t *testing.T, role string) string {
+	t.Helper()
+
+	token, err := e.tokens.GenerateToken(uuid.New(), "ops", role, nil, time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateToken() error: %v", err)
+	}
+	return token
+}
+
+// enrollmentToken генерує і реєструє enrollment токен користувача username
+func (e *testEnv) enrollmentToken(t *testing.T, username string) string {
+	t.Helper()
+
+	token, claims, err := e.tokens.GenerateEnrollmentToken(username, time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateEnrollmentToken() error: %v", err)
+	}
+	if err := e.store.SaveToken(&wg.Token{
+		ID:        claims.ID,
+		UserID:    claims.UserID,
+		Username:  username,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: claims.ExpiresAt.Time,
+		CreatedAt: claims.IssuedAt.Time,
+	}); err != nil {
+		t.Fatalf("SaveToken() error: %v", err)
+	}
+	return token
+}
+
+// enroll реєструє клієнта name з новим ключем
+func (e *testEnv) enroll(t *testing.T, token, name string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	_, publicKey, err := wg.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error: %v", err)
+	}
+	return e.do(t, http.MethodPost, "/api/v1/enroll", "", gin.H{
+		"token":       token,
+		"public_key":  publicKey,
+		"client_name": name,
+	})
+}
+
+// createPeer створює peer'а name від імені адміністратора
+func (e *testEnv) createPeer(t *testing.T, name, ip string) *wg.Peer {
+	t.Helper()
+
+	rec := e.do(t, http.MethodPost, "/api/v1/peers", e.staffToken(t, auth.RoleAdmin), gin.H{"name": name, "ip": ip})
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("POST /peers %s = %d %s, want 201", name, rec.Code, rec.Body)
+	}
+	var peer wg.Peer
+	decode(t, rec, &peer)
+	return &peer
+}
+
+func decode(t *testing.T, rec *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("json.Unmarshal(%s) error: %v", rec.Body, err)
+	}
+}
+
+func TestCreatePeer_AddressErrors(t *testing.T) {
+	// У /29 без адреси сервера залишається п'ять адрес
+	env := newTestEnv(t, "10.9.0.0/29")
+	admin := env.staffToken(t, auth.RoleAdmin)
+
+	first := env.createPeer(t, "first", "10.9.0.2")
+
+	tests := []struct {
+		name string
+		body gin.H
+		want int
+	}{
+		{"duplicate name", gin.H{"name": "first"}, http.StatusConflict},
+		{"taken address", gin.H{"name": "second", "ip": "10.9.0.2"}, http.StatusConflict},
+		{"address outside pool", gin.H{"name": "second", "ip": "10.8.0.2"}, http.StatusBadRequest},
+		{"server address", gin.H{"name": "second", "ip": "10.9.0.1"}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := env.do(t, http.MethodPost, "/api/v1/peers", admin, tt.body)
+			if rec.Code != tt.want {
+				t.Errorf("POST /peers = %d %s, want %d", rec.Code, rec.Body, tt.want)
+			}
+		})
+	}
+	if len(first.AllowedIPs) != 1 || !env.alloc.allocated(first.AllowedIPs[0]) {
+		t.Errorf("address of the first peer %v was released", first.AllowedIPs)
+	}
+
+	for i := 0; i < 4; i++ {
+		env.createPeer(t, fmt.Sprintf("peer-%d", i), "")
+	}
+	rec := env.do(t, http.MethodPost, "/api/v1/peers", admin, gin.H{"name": "overflow"})
+	if rec.Code != http.StatusInsufficientStorage {
+		t.Errorf("POST /peers with exhausted pool = %d %s, want 507", rec.Code, rec.Body)
+	}
+}
+
+func TestEnroll_AddressErrors(t *testing.T) {
+	// У /30 без адреси сервера залишається одна адреса
+	env := newTestEnv(t, "10.9.0.0/30")
+
+	if rec := env.enroll(t, env.enrollmentToken(t, "alice"), "laptop"); rec.Code != http.StatusCreated {
+		t.Fatalf("enroll = %d %s, want 201", rec.Code, rec.Body)
+	}
+
+	if rec := env.enroll(t, env.enrollmentToken(t, "alice"), "laptop"); rec.Code != http.StatusConflict {
+		t.Errorf("enroll with taken name = %d %s, want 409", rec.Code, rec.Body)
+	}
+	if rec := env.enroll(t, env.enrollmentToken(t, "alice"), "phone"); rec.Code != http.StatusInsufficientStorage {
+		t.Errorf("enroll with exhausted pool = %d %s, want 507", rec.Code, rec.Body)
+	}
+}
+
+func TestDeletePeer(t *testing.T) {
+	env := newTestEnv(t, "10.9.0.0/29")
+	admin := env.staffToken(t, auth.RoleAdmin)
+	peer := env.createPeer(t, "laptop", "")
+	path := "/api/v1/peers/" + peer.ID.String()
+
+	// Peer залишається в базі даних, тож його адресу не можна видати іншому
+	env.store.failures["DeletePeer"] = errors.New("disk I/O error")
+	if rec := env.do(t, http.MethodDelete, path, admin, nil); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("DELETE with failing storage = %d %s, want 500", rec.Code, rec.Body)
+	}
+	if !env.alloc.allocated(peer.AllowedIPs[0]) {
+		t.Errorf("address %s released although the peer was not deleted", peer.AllowedIPs[0])
+	}
+
+	delete(env.store.failures, "DeletePeer")
+	if rec := env.do(t, http.MethodDelete, path, admin, nil); rec.Code != http.StatusOK {
+		t.Fatalf("DELETE = %d %s, want 200", rec.Code, rec.Body)
+	}
+	if env.alloc.allocated(peer.AllowedIPs[0]) {
+		t.Errorf("address %s is still allocated after delete", peer.AllowedIPs[0])
+	}
+	if rec := env.do(t, http.MethodGet, path, admin, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("GET deleted peer = %d, want 404", rec.Code)
+	}
+}
+
+func TestUpdatePeer(t *testing.T) {
+	env := newTestEnv(t, "10.9.0.0/29")
+	admin := env.staffToken(t, auth.RoleAdmin)
+	laptop := env.createPeer(t, "laptop", "10.9.0.2")
+	env.createPeer(t, "phone", "10.9.0.3")
+	path := "/api/v1/peers/" + laptop.ID.String()
+
+	// Конфлікти не змінюють ні peer'а, ні його адресу
+	if rec := env.do(t, http.MethodPut, path, admin, gin.H{"name": "phone"}); rec.Code != http.StatusConflict {
+		t.Errorf("rename to taken name = %d %s, want 409", rec.Code, rec.Body)
+	}
+	if rec := env.do(t, http.MethodPut, path, admin, gin.H{"ip": "10.9.0.3"}); rec.Code != http.StatusConflict {
+		t.Errorf("move to taken address = %d %s, want 409", rec.Code, rec.Body)
+	}
+
+	rec := env.do(t, http.MethodPut, path, admin, gin.H{"name": "laptop-2", "ip": "10.9.0.4"})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("PUT = %d %s, want 200", rec.Code, rec.Body)
+	}
+	var updated wg.Peer
+	decode(t, rec, &updated)
+	if updated.Name != "laptop-2" || len(updated.AllowedIPs) != 1 || updated.AllowedIPs[0] != "10.9.0.4/32" {
+		t.Errorf("updated peer = %s %v, want laptop-2 [10.9.0.4/32]", updated.Name, updated.AllowedIPs)
+	}
+	if env.alloc.allocated("10.9.0.2/32") {
+		t.Error("old address 10.9.0.2 is still allocated after the move")
+	}
+
+	// Якщо peer'а не вдалося зберегти, він повертається на попередню адресу
+	env.store.failures["SavePeer"] = errors.New("disk I/O error")
+	if rec := env.do(t, http.MethodPut, path, admin, gin.H{"ip": "10.9.0.5"}); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("PUT with failing storage = %d %s, want 500", rec.Code, rec.Body)
+	}
+	if !env.alloc.allocated("10.9.0.4/32") || env.alloc.allocated("10.9.0.5/32") {
+		t.Errorf("allocations after failed save: 10.9.0.4=%v 10.9.0.5=%v, want true false",
+			env.alloc.allocated("10.9.0.4/32"), env.alloc.allocated("10.9.0.5/32"))
+	}
+	delete(env.store.failures, "SavePeer")
+
+	stored, err := env.store.GetPeer(laptop.ID)
+	if err != nil || stored == nil {
+		t.Fatalf("GetPeer() = %v, %v", stored, err)
+	}
+	if stored.Name != "laptop-2" || stored.AllowedIPs[0] != "10.9.0.4/32" {
+		t.Errorf("stored peer = %s %v, want laptop-2 [10.9.0.4/32]", stored.Name, stored.AllowedIPs)
+	}
+}
+
+func TestGetConfig(t *testing.T) {
+	env := newTestEnv(t, "10.9.0.0/29")
+	admin := env.staffToken(t, auth.RoleAdmin)
+
+	presharedKey, _, err := wg.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error: %v", err)
+	}
+	peer := env.createPeer(t, "laptop", "")
+	stored, err := env.store.GetPeer(peer.ID)
+	if err != nil || stored == nil {
+		t.Fatalf("GetPeer() = %v, %v", stored, err)
+	}
+	stored.PresharedKey = presharedKey
+	if err := env.store.SavePeer(stored); err != nil {
+		t.Fatalf("SavePeer() error: %v", err)
+	}
+
+	rec := env.do(t, http.MethodGet, "/api/v1/config/"+peer.ID.String(), admin, nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /config = %d %s, want 200", rec.Code, rec.Body)
+	}
+	var body struct {
+		Config   wg.ClientConfig `json:"config"`
+		ConfigWG string          `json:"config_wg"`
+	}
+	decode(t, rec, &body)
+	if body.Config.Interface.PrivateKey != stored.PrivateKey || body.Config.Peer.PresharedKey != presharedKey {
+		t.Errorf("GET /config = %+v, want peer private and preshared keys", body.Config)
+	}
+	if !strings.Contains(body.ConfigWG, "PresharedKey = "+presharedKey) {
+		t.Errorf("config_wg = %q, want PresharedKey", body.ConfigWG)
+	}
+
+	// Імпортований peer без приватного ключа не отримує неробочу конфігурацію
+	_, publicKey, err := wg.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error: %v", err)
+	}
+	imported := &wg.Peer{
+		ID:            uuid.New(),
+		Name:          "imported",
+		PublicKey:     publicKey,
+		PresharedKey:  presharedKey,
+		AllowedIPs:    []string{"10.9.0.6/32"},
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+		IsActive:      true,
+		InterfaceName: "wg0",
+	}
+	if err := env.store.SavePeer(imported); err != nil {
+		t.Fatalf("SavePeer() error: %v", err)
+	}
+	rec = env.do(t, http.MethodGet, "/api/v1/config/"+imported.ID.String(), admin, nil)
+	if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), "without a private key") {
+		t.Errorf("GET /config of imported peer = %d %s, want 409", rec.Code, rec.Body)
+	}
+}
+
+func TestEnroll_InvalidPublicKey(t *testing.T) {
+	env := newTestEnv(t, "10.9.0.0/29")
+	token := env.enrollmentToken(t, "alice")
+
+	for _, key := range []string{"not-a-key", "c2hvcnQ="} {
+		rec := env.do(t, http.MethodPost, "/api/v1/enroll", "", gin.H{
+			"token":       token,
+			"public_key":  key,
+			"client_name": "laptop",
+		})
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("enroll with public key %q = %d %s, want 400", key, rec.Code, rec.Body)
+		}
+	}
+
+	// Відхилений запит не використовує токен і не створює peer'а
+	if rec := env.enroll(t, token, "laptop"); rec.Code != http.StatusCreated {
+		t.Errorf("enroll with valid key = %d %s, want 201", rec.Code, rec.Body)
+	}
+}
+
+func TestEnroll_DuplicatePublicKey(t *testing.T) {
+	env := newTestEnv(t, "10.9.0.0/29")
+	victim := env.createPeer(t, "victim", "")
+
+	token := env.enrollmentToken(t, "mallory")
+	rec := env.do(t, http.MethodPost, "/api/v1/enroll", "", gin.H{
+		"token":       token,
+		"public_key":  victim.PublicKey,
+		"client_name": "laptop",
+	})
+	if rec.Code != http.StatusConflict {
+		t.Fatalf("enroll with taken public key = %d %s, want 409", rec.Code, rec.Body)
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	decode(t, rec, &body)
+	if body.Error != "Peer with this public key already exists" {
+		t.Errorf("enroll with taken public key error = %q", body.Error)
+	}
+
+	stored, err := env.store.GetPeer(victim.ID)
+	if err != nil || stored == nil || stored.PublicKey != victim.PublicKey {
+		t.Errorf("GetPeer() victim = %v, %v, want unchanged", stored, err)
+	}
+	if peer, err := env.store.GetPeerByName("laptop"); err != nil || peer != nil {
+		t.Errorf("GetPeerByName() laptop = %v, %v, want nil", peer, err)
+	}
+
+	// Відхилений запит не використовує токен
+	if rec := env.enroll(t, token, "laptop"); rec.Code != http.StatusCreated {
+		t.Errorf("enroll with own key = %d %s, want 201", rec.Code, rec.Body)
+	}
+}
+
+func TestEnroll_SingleUseToken(t *testing.T) {
+	// У /30 без адреси сервера залишається одна адреса
+	env := newTestEnv(t, "10.9.0.0/30")
+	admin := env.staffToken(t, auth.RoleAdmin)
+	token := env.enrollmentToken(t, "alice")
+
+	// Токен, не зареєстрований у базі даних, не приймається
+	unregistered, _, err := env.tokens.GenerateEnrollmentToken("alice", time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateEnrollmentToken() error: %v", err)
+	}
+	if rec := env.enroll(t, unregistered, "laptop"); rec.Code != http.StatusUnauthorized {
+		t.Errorf("enroll with unregistered token = %d %s, want 401", rec.Code, rec.Body)
+	}
+
+	// Якщо адресу виділити не вдалося, токен знову стає дійсним
+	blocker := env.createPeer(t, "blocker", "")
+	if rec := env.enroll(t, token, "laptop"); rec.Code != http.StatusInsufficientStorage {
+		t.Fatalf("enroll with exhausted pool = %d %s, want 507", rec.Code, rec.Body)
+	}
+	if rec := env.do(t, http.MethodDelete, "/api/v1/peers/"+blocker.ID.String(), admin, nil); rec.Code != http.StatusOK {
+		t.Fatalf("DELETE = %d %s, want 200", rec.Code, rec.Body)
+	}
+	if rec := env.enroll(t, token, "laptop"); rec.Code != http.StatusCreated {
+		t.Fatalf("enroll after failed attempt = %d %s, want 201", rec.Code, rec.Body)
+	}
+
+	// Повторна реєстрація з тим самим токеном відхиляється
+	rec := env.enroll(t, token, "phone")
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("enroll replay = %d %s, want 401", rec.Code, rec.Body)
+	}
+	var body struct {
+		Error string `json:"error"`
+	}
+	decode(t, rec, &body)
+	if body.Error != "Enrollment token has already been used" {
+		t.Errorf("enroll replay error = %q", body.Error)
+	}
+}
+
+func TestRoutes_Permissions(t *testing.T) {
+	env := newTestEnv(t, "10.9.0.0/29")
+	own := env.createPeer(t, "own", "")
+	other := env.createPeer(t, "other", "")
+
+	client, err := env.tokens.GenerateToken(own.ID, own.Name, auth.RoleClient, &own.ID, time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateToken() error: %v", err)
+	}
+	roles := []struct {
+		name  string
+		token string
+	}{
+		{auth.RoleAdmin, env.staffToken(t, auth.RoleAdmin)},
+		{auth.RoleOperator, env.staffToken(t, auth.RoleOperator)},
+		{auth.RoleClient, client},
+		{auth.RoleEnrollment, env.enrollmentToken(t, "alice")},
+	}
+
+	missing := uuid.New().String()
+	tests := []struct {
+		method string
+		path   string
+		body   interface{}
+		want   [4]int // admin, operator, client, enrollment
+	}{
+		{http.MethodGet, "/api/v1/peers", nil, [4]int{200, 200, 403, 403}},
+		{http.MethodGet, "/api/v1/peers/" + own.ID.String(), nil, [4]int{200, 200, 200, 403}},
+		{http.MethodGet, "/api/v1/peers/" + other.ID.String(), nil, [4]int{200, 200, 403, 403}},
+		{http.MethodGet, "/api/v1/interfaces/wg0/peers/" + own.ID.String(), nil, [4]int{200, 200, 200, 403}},
+		{http.MethodGet, "/api/v1/interfaces/wg0/peers/" + other.ID.String(), nil, [4]int{200, 200, 403, 403}},
+		{http.MethodGet, "/api/v1/config/" + own.ID.String(), nil, [4]int{200, 200, 200, 403}},
+		{http.MethodGet, "/api/v1/config/" + other.ID.String(), nil, [4]int{200, 200, 403, 403}},
+		{http.MethodGet, "/api/v1/interfaces", nil, [4]int{200, 200, 403, 403}},
+		{http.MethodPut, "/api/v1/peers/" + other.ID.String(), gin.H{"persistent_keepalive": 25}, [4]int{200, 200, 403, 403}},
+		{http.MethodPut, "/api/v1/peers/" + own.ID.String(), gin.H{"persistent_keepalive": 25}, [4]int{200, 200, 403, 403}},
+		{http.MethodDelete, "/api/v1/peers/" + missing, nil, [4]int{404, 404, 403, 403}},
+		{http.MethodDelete, "/api/v1/tokens/" + missing, nil, [4]int{200, 403, 403, 403}},
+	}
+	for _, tt := range tests {
+		for i, role := range roles {
+			rec := env.do(t, tt.method, tt.path, role.token, tt.body)
+			if rec.Code != tt.want[i] {
+				t.Errorf("%s %s as %s = %d %s, want %d", tt.method, tt.path, role.name, rec.Code, rec.Body, tt.want[i])
+			}
+		}
+	}
+
+	// Створення peer'ів доступне лише персоналу
+	for i, role := range roles {
+		want := http.StatusForbidden
+		if i < 2 {
+			want = http.StatusCreated
+		}
+		rec := env.do(t, http.MethodPost, "/api/v1/peers", role.token, gin.H{"name": "new-" + role.name})
+		if rec.Code != want {
+			t.Errorf("POST /peers as %s = %d %s, want %d", role.name, rec.Code, rec.Body, want)
+		}
+	}
+
+	if rec := env.do(t, http.MethodGet, "/api/v1/peers", "", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET /peers without token = %d, want 401", rec.Code)
+	}
+
+	// Клієнт може відкликати власний токен, після чого той не приймається
+	claims, err := env.tokens.ValidateToken(client)
+	if err != nil {
+		t.Fatalf("ValidateToken() error: %v", err)
+	}
+	if rec := env.do(t, http.MethodDelete, "/api/v1/tokens/"+claims.ID, client, nil); rec.Code != http.StatusOK {
+		t.Errorf("DELETE own token = %d %s, want 200", rec.Code, rec.Body)
+	}
+	if rec := env.do(t, http.MethodGet, "/api/v1/peers/"+own.ID.String(), client, nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("GET with revoked token = %d, want 401", rec.Code)
+	}
+}
+
+func TestEnroll_SaveFailure(t *testing.T) {
+	env := newTestEnv(t, "10.9.0.0/29")
+	token := env.enrollmentToken(t, "alice")
+
+	// Без refresh токена peer не зберігається, адреса і токен звільняються
+	env.store.failures["SavePeerWithRefreshToken"] = errors.New("disk I/O error")
+	if rec := env.enroll(t, token, "laptop"); rec.Code != http.StatusInternalServerError {
+		t.Fatalf("enroll with failing storage = %d %s, want 500", rec.Code, rec.Body)
+	}
+	if len(env.alloc.peers) != 0 {
+		t.Errorf("addresses left allocated after failed enroll: %v", env.alloc.peers)
+	}
+	delete(env.store.failures, "SavePeerWithRefreshToken")
+
+	rec := env.enroll(t, token, "laptop")
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("enroll retry = %d %s, want 201", rec.Code, rec.Body)
+	}
+	var resp wg.EnrollResponse
+	decode(t, rec, &resp)
+	if resp.AccessToken == "" || resp.RefreshToken == "" || resp.ClientConfig == nil {
+		t.Errorf("enroll response = %+v, want token pair and client config", resp)
+	}
+}
+
+func TestRefresh(t *testing.T) {
+	env := newTestEnv(t, "10.9.0.0/29")
+	api := httptest.NewServer(env.router)
+	defer api.Close()
+
+	config := &client.Config{Interface: "wg0", ConfigPath: filepath.Join(t.TempDir(), "client.json")}
+	c := client.NewClient(config)
+	if err := c.Enroll(api.URL, env.enrollmentToken(t, "alice"), "laptop"); err != nil {
+		t.Fatalf("Enroll() error: %v", err)
+	}
+	claims, err := env.tokens.ValidateToken(config.Token)
+	if err != nil {
+		t.Fatalf("ValidateToken() error: %v", err)
+	}
+	peerPath := "/api/v1/peers/" + claims.PeerID.String()
+
+	// Кожне оновлення видає нову пару токенів
+	first := config.RefreshToken
+	if err := c.RefreshToken(); err != nil {
+		t.Fatalf("RefreshToken() error: %v", err)
+	}
+	if config.RefreshToken == first || config.RefreshToken == "" {
+		t.Fatalf("refresh token was not rotated")
+	}
+	if rec := env.do(t, http.MethodGet, peerPath, config.Token, nil); rec.Code != http.StatusOK {
+		t.Errorf("GET own peer with refreshed token = %d %s, want 200", rec.Code, rec.Body)
+	}
+
+	// Повторне використання заміненого токена відкликає всю сім'ю
+	rec := env.do(t, http.MethodPost, "/api/v1/refresh", "", wg.RefreshRequest{RefreshToken: first})
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "already been used") {
+		t.Errorf("reused refresh token = %d %s, want 401 already used", rec.Code, rec.Body)
+	}
+	if err := c.RefreshToken(); err == nil || !strings.Contains(err.Error(), "Invalid refresh token") {
+		t.Errorf("RefreshToken() after reuse error = %v, want invalid refresh token", err)
+	}
+
+	for _, token := range []string{"", "unknown"} {
+		rec := env.do(t, http.MethodPost, "/api/v1/refresh", "", wg.RefreshRequest{RefreshToken: token})
+		if rec.Code == http.StatusOK {
+			t.Errorf("refresh with %q = %d, want error", token, rec.Code)
+		}
+	}
+
+	// Access токен не можна обміняти на новий в обхід refresh токенів
+	if rec := env.do(t, http.MethodPost, "/api/v1/refresh-token", config.Token, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("POST /refresh-token = %d, want 404", rec.Code)
+	}
+
+	// Вимкнений peer не оновлює токени, і його сім'я токенів відкликається
+	phoneConfig := &client.Config{Interface: "wg0", ConfigPath: filepath.Join(t.TempDir(), "phone.json")}
+	phone := client.NewClient(phoneConfig)
+	if err := phone.Enroll(api.URL, env.enrollmentToken(t, "alice"), "phone"); err != nil {
+		t.Fatalf("Enroll() phone error: %v", err)
+	}
+	phoneClaims, err := env.tokens.ValidateToken(phoneConfig.Token)
+	if err != nil {
+		t.Fatalf("ValidateToken() error: %v", err)
+	}
+	phonePath := "/api/v1/peers/" + phoneClaims.PeerID.String()
+	admin := env.staffToken(t, auth.RoleAdmin)
+	if rec := env.do(t, http.MethodPut, phonePath, admin, gin.H{"is_active": false}); rec.Code != http.StatusOK {
+		t.Fatalf("PUT is_active=false = %d %s, want 200", rec.Code, rec.Body)
+	}
+	if err := phone.RefreshToken(); err == nil || !strings.Contains(err.Error(), "Peer is disabled") {
+		t.Errorf("RefreshToken() of disabled peer error = %v, want peer is disabled", err)
+	}
+	if rec := env.do(t, http.MethodPut, phonePath, admin, gin.H{"is_active": true}); rec.Code != http.StatusOK {
+		t.Fatalf("PUT is_active=true = %d %s, want 200", rec.Code, rec.Body)
+	}
+	if err := phone.RefreshToken(); err == nil || !strings.Contains(err.Error(), "Invalid refresh token") {
+		t.Errorf("RefreshToken() after re-enable error = %v, want invalid refresh token", err)
+	}
+}
@@ -8,8 +8,13 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
+	"github.com/artem/wg-orbit/internal/auth"
 	"github.com/artem/wg-orbit/internal/server"
+	"github.com/artem/wg-orbit/internal/storage"
+	"github.com/artem/wg-orbit/internal/wg"
 	"github.com/spf13/cobra"
 	"gopkg.in/yaml.v3"
 )
@@ -24,10 +29,19 @@ JWT authentication, and centralized configuration.
 Available commands:
   init        - Initialize WireGuard interface
   run         - Start the server
+  status      - Show interface and egress status
+  teardown    - Delete WireGuard interface and firewall rules
+  import      - Import key and peers from a wg-quick config
   user        - User management
   user add    - Add new user
   user token  - Generate user token
-  user enroll-token - Generate enrollment token`,
+  user enroll-token - Generate enrollment token
+  token create - Generate admin or operator token
+  token revoke - Revoke issued tokens
+  token rotate-key - Rotate the JWT signing key
+  db migrate  - Apply pending database migrations
+  db status   - Show database schema version
+  db rekey    - Rotate the master key for encrypted private keys`,
 }
 
 // initCmd - команда для ініціалізації WireGuard інтерфейсу
@@ -40,15 +54,19 @@ var initCmd = &cobra.Command{
 This command creates a new WireGuard interface with the specified name,
 configures basic parameters, and prepares the system for server operation.
 
+When the configuration lists several interfaces under wireguard.interfaces,
+all of them are initialized unless --interface selects one.
+
+If a step fails, the steps already done are undone. Running init again on an
+existing, possibly half-configured interface completes its configuration.
+
 Example:
   wg-orbit-server init --interface wg0 --config /etc/wg-orbit/server.yaml`,
 	Run: func(cmd *cobra.Command, args []string) {
-		interface_name, _ := cmd.Flags().GetString("interface")
 		configPath, _ := cmd.Flags().GetString("config")
 
 		// Створюємо базову конфігурацію сервера
 		config := server.DefaultConfig()
-		config.Interface = interface_name
 
 		// Завантажуємо конфігурацію з файлу, якщо вказано шлях
 		if configPath != "" {
@@ -56,6 +74,7 @@ Example:
 				log.Printf("Warning: failed to load config from %s: %v", configPath, err)
 			}
 		}
+		interfaceName := interfaceFlag(cmd, config)
 
 		// Ініціалізуємо сервер з конфігурацією
 		srv, err := server.NewServer(config)
@@ -63,12 +82,12 @@ Example:
 			log.Fatalf("Failed to create server: %v", err)
 		}
 
-		// Ініціалізуємо WireGuard інтерфейс
-		if err := srv.Initialize(); err != nil {
+		// Ініціалізуємо WireGuard інтерфейси
+		if err := srv.Initialize(interfaceName); err != nil {
 			log.Fatalf("Failed to initialize interface: %v", err)
 		}
 
-		fmt.Printf("WireGuard interface %s initialized successfully\n", interface_name)
+		fmt.Printf("WireGuard interface %s initialized successfully\n", describeInterfaces(config, interfaceName))
 	},
 }
 
@@ -85,11 +104,15 @@ The server provides an HTTP REST API for:
 - Connection status monitoring
 - Automatic IP address allocation
 
+With auth.signing_algorithm HS256 the server refuses to start while the
+default JWT secret is configured, unless --dev is given.
+
 Example:
   wg-orbit-server run --port 8080 --config /etc/wg-orbit/server.yaml`,
 	Run: func(cmd *cobra.Command, args []string) {
 		port, _ := cmd.Flags().GetString("port")
 		configPath, _ := cmd.Flags().GetString("config")
+		devMode, _ := cmd.Flags().GetBool("dev")
 
 		// Створюємо базову конфігурацію сервера
 		config := server.DefaultConfig()
@@ -107,6 +130,9 @@ Example:
 				log.Fatalf("Invalid port format: %v", err)
 			}
 		}
+		if devMode {
+			config.DevMode = true
+		}
 
 		// Ініціалізуємо сервер
 		srv, err := server.NewServer(config)
@@ -121,6 +147,228 @@ Example:
 	},
 }
 
+// teardownCmd - команда, зворотна до init
+// Видаляє WireGuard інтерфейс і правила egress, за потреби - запис інтерфейсу в БД
+var teardownCmd = &cobra.Command{
+	Use:   "teardown",
+	Short: "Delete WireGuard interface and firewall rules",
+	Long: `Undoes init: removes the forward and NAT rules installed by wg-orbit
+for the interface (nftables and iptables), then brings down and deletes the
+WireGuard interface together with its addresses and routes.
+
+Kernel forwarding settings are left unchanged. Peers stay in the database.
+With --wipe the stored interface record, including the server key, is deleted
+as well, so the next init generates a new key and clients need new configs.
+
+The command is safe to run repeatedly. Stop a running server first: it
+reinstalls rules on start and owns the userspace interface. With several
+configured interfaces all of them are torn down unless --interface selects one.
+
+Example:
+  wg-orbit-server teardown --config /etc/wg-orbit/server.yaml
+  wg-orbit-server teardown --wipe --config /etc/wg-orbit/server.yaml`,
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config")
+		wipe, _ := cmd.Flags().GetBool("wipe")
+
+		// Створюємо базову конфігурацію сервера
+		config := server.DefaultConfig()
+
+		// Завантажуємо конфігурацію з файлу, якщо вказано
+		if configPath != "" {
+			if err := loadConfigFromFile(config, configPath); err != nil {
+				log.Printf("Warning: failed to load config from %s: %v", configPath, err)
+			}
+		}
+
+		interfaceName := interfaceFlag(cmd, config)
+
+		srv, err := server.NewServer(config)
+		if err != nil {
+			log.Fatalf("Failed to create server: %v", err)
+		}
+
+		if err := srv.Teardown(interfaceName, wipe); err != nil {
+			log.Fatalf("Failed to tear down interface: %v", err)
+		}
+
+		fmt.Printf("WireGuard interface %s torn down successfully\n", describeInterfaces(config, interfaceName))
+	},
+}
+
+// importCmd - команда для переходу з wg-quick
+// Переносить ключ сервера і peer'ів з існуючої конфігурації в базу даних
+var importCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import key and peers from a wg-quick config",
+	Long: `Imports an existing wg-quick configuration (e.g. /etc/wireguard/wg0.conf)
+into wg-orbit, so a running server can be migrated without reissuing
+client configs.
+
+The [Interface] private key becomes the server key of the interface, and
+ListenPort and Address must match the wg-orbit configuration. Each [Peer] is
+stored with its public key, preshared key and AllowedIPs; private keys of
+peers are unknown, so configs served for them contain no private key.
+Host addresses inside the IPAM networks are marked as allocated. Peer names
+are taken from comments such as "# Name = alice" before [Peer].
+
+Peers that conflict with the database or IPAM (used key, name or address)
+are skipped and reported; the command then exits with status 1. Peers that
+are already imported are skipped silently, so the import can be repeated.
+PostUp/PostDown and DNS are not imported: configure egress in server.yaml.
+
+The running interface is not changed. Afterwards stop wg-quick or run init
+directly: init adopts the existing interface and applies the imported peers,
+removing peers that were not imported.
+
+Example:
+  wg-orbit-server import --from /etc/wireguard/wg0.conf --dry-run
+  wg-orbit-server import --from /etc/wireguard/wg0.conf --interface wg0`,
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config")
+		from, _ := cmd.Flags().GetString("from")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		file, err := os.Open(from)
+		if err != nil {
+			log.Fatalf("Failed to open wg-quick config: %v", err)
+		}
+		quickConfig, err := wg.ParseQuickConfig(file)
+		file.Close()
+		if err != nil {
+			log.Fatalf("Failed to parse %s: %v", from, err)
+		}
+
+		// Створюємо базову конфігурацію сервера
+		config := server.DefaultConfig()
+
+		// Завантажуємо конфігурацію з файлу, якщо вказано
+		if configPath != "" {
+			if err := loadConfigFromFile(config, configPath); err != nil {
+				log.Printf("Warning: failed to load config from %s: %v", configPath, err)
+			}
+		}
+
+		interfaceName := interfaceFlag(cmd, config)
+
+		srv, err := server.NewServer(config)
+		if err != nil {
+			log.Fatalf("Failed to create server: %v", err)
+		}
+
+		report, err := srv.Import(interfaceName, quickConfig, dryRun)
+		if err != nil {
+			log.Fatalf("Failed to import %s: %v", from, err)
+		}
+
+		if dryRun {
+			fmt.Println("Dry run, nothing was changed")
+		}
+		if report.InterfaceCreated {
+			fmt.Printf("Server key of %s imported from %s\n", report.Interface, from)
+		}
+		fmt.Printf("Imported %d peer(s) to %s", len(report.Imported), report.Interface)
+		if len(report.Imported) > 0 {
+			fmt.Printf(": %s", strings.Join(report.Imported, ", "))
+		}
+		fmt.Println()
+		if len(report.Skipped) > 0 {
+			fmt.Printf("Already imported: %s\n", strings.Join(report.Skipped, ", "))
+		}
+		for _, warning := range report.Warnings {
+			fmt.Printf("Warning: %s\n", warning)
+		}
+		for _, conflict := range report.Conflicts {
+			fmt.Printf("Conflict at line %d, peer %s (%s): %s\n", conflict.Line, conflict.Name, conflict.PublicKey, conflict.Reason)
+		}
+		if len(report.Conflicts) > 0 {
+			fmt.Printf("%d peer(s) were not imported\n", len(report.Conflicts))
+			os.Exit(1)
+		}
+	},
+}
+
+// statusCmd - команда для перегляду стану сервера
+// Показує стан інтерфейсу, форвардингу і встановлені правила egress
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show interface and egress status",
+	Long: `Shows whether the WireGuard interface exists, the stored interface
+configuration, the kernel forwarding settings and the NAT and forward
+rules installed by wg-orbit for the interface. Every configured interface
+is shown unless --interface selects one.
+
+Example:
+  wg-orbit-server status --config /etc/wg-orbit/server.yaml
+  wg-orbit-server status --interface wg1 --config /etc/wg-orbit/server.yaml`,
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config")
+
+		// Створюємо базову конфігурацію сервера
+		config := server.DefaultConfig()
+
+		// Завантажуємо конфігурацію з файлу, якщо вказано
+		if configPath != "" {
+			if err := loadConfigFromFile(config, configPath); err != nil {
+				log.Printf("Warning: failed to load config from %s: %v", configPath, err)
+			}
+		}
+
+		interfaceName := interfaceFlag(cmd, config)
+
+		srv, err := server.NewServer(config)
+		if err != nil {
+			log.Fatalf("Failed to create server: %v", err)
+		}
+
+		statuses, err := srv.Status(interfaceName)
+		if err != nil {
+			log.Fatalf("Failed to read interface status: %v", err)
+		}
+
+		for i, iface := range statuses {
+			if i > 0 {
+				fmt.Println()
+			}
+
+			fmt.Printf("Interface:        %s\n", iface.Name)
+			fmt.Printf("Link present:     %t\n", iface.Exists)
+			if iface.Stored != nil {
+				fmt.Printf("Public key:       %s\n", iface.Stored.PublicKey)
+				fmt.Printf("Listen port:      %d\n", iface.Stored.ListenPort)
+				fmt.Printf("Address:          %s\n", iface.Stored.Address)
+			} else {
+				fmt.Println("Interface is not initialized, run wg-orbit-server init")
+			}
+			fmt.Printf("Peers:            %d\n", iface.Peers)
+
+			if iface.EgressError != nil {
+				fmt.Printf("Egress:           unavailable (%v)\n", iface.EgressError)
+				continue
+			}
+
+			status := iface.Egress
+			fmt.Printf("Egress enabled:   %t\n", config.EgressEnabled)
+			fmt.Printf("Egress uplink:    %s\n", status.Uplink)
+			fmt.Printf("Firewall backend: %s\n", status.Backend)
+			fmt.Printf("IPv4 forwarding:  %t\n", status.IPv4Forwarding)
+			fmt.Printf("IPv6 forwarding:  %t\n", status.IPv6Forwarding)
+			if len(status.Blockers) > 0 {
+				fmt.Printf("Forward dropped:  by %s (policy drop), clients may have no internet access\n",
+					strings.Join(status.Blockers, ", "))
+			}
+			if len(status.Rules) == 0 {
+				fmt.Println("No egress rules installed")
+				continue
+			}
+			fmt.Println("Installed rules:")
+			for _, rule := range status.Rules {
+				fmt.Printf("  %s\n", rule)
+			}
+		}
+	},
+}
+
 // userCmd - група команд для управління користувачами
 // Включає підкоманди для додавання користувачів та генерації токенів
 var userCmd = &cobra.Command{
@@ -147,12 +395,28 @@ To generate tokens, use 'token' or 'enroll-token' subcommands.
 Arguments:
   username - user name (required)
 
+Flags:
+  --ip - static address for the user (must be inside the IPAM network and unused)
+  --keepalive - PersistentKeepalive in seconds for the client config
+                (defaults to wireguard.persistent_keepalive, 0 disables it)
+  --interface - interface the user connects to (defaults to the first configured one)
+
 Example:
-  wg-orbit-server user add alice --config /etc/wg-orbit/server.yaml`,
+  wg-orbit-server user add alice --config /etc/wg-orbit/server.yaml
+  wg-orbit-server user add printer --ip 10.0.0.50 --config /etc/wg-orbit/server.yaml
+  wg-orbit-server user add laptop --keepalive 25 --config /etc/wg-orbit/server.yaml
+  wg-orbit-server user add guest --interface wg1 --config /etc/wg-orbit/server.yaml`,
 	Args: cobra.ExactArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
 		username := args[0]
 		configPath, _ := cmd.Flags().GetString("config")
+		staticIP, _ := cmd.Flags().GetString("ip")
+
+		var keepalive *int
+		if cmd.Flags().Changed("keepalive") {
+			value, _ := cmd.Flags().GetInt("keepalive")
+			keepalive = &value
+		}
 
 		// Створюємо базову конфігурацію сервера
 		config := server.DefaultConfig()
@@ -164,6 +428,8 @@ Example:
 			}
 		}
 
+		interfaceName := interfaceFlag(cmd, config)
+
 		// Ініціалізуємо сервер
 		srv, err := server.NewServer(config)
 		if err != nil {
@@ -171,7 +437,7 @@ Example:
 		}
 
 		// Додаємо користувача до системи
-		if err := srv.AddUser(username); err != nil {
+		if err := srv.AddUser(interfaceName, username, staticIP, keepalive); err != nil {
 			log.Fatalf("Failed to add user: %v", err)
 		}
 
@@ -275,6 +541,398 @@ Example:
 	},
 }
 
+// tokensCmd - група команд для керування виданими токенами
+var tokensCmd = &cobra.Command{
+	Use:   "token",
+	Short: "Issued token management",
+	Long: `Commands for managing issued JWT tokens.
+
+Available subcommands:
+  create      - Generate an admin or operator token
+  revoke      - Revoke a token, or all tokens of a user or peer
+  rotate-key  - Rotate the JWT signing key`,
+}
+
+// rotateKeyCmd - команда для позапланової ротації ключа підпису JWT,
+// напр. якщо ключ міг бути скомпрометований
+var rotateKeyCmd = &cobra.Command{
+	Use:   "rotate-key",
+	Short: "Rotate the JWT signing key",
+	Long: `Generates a new JWT signing key and makes it active.
+
+New tokens are signed with the new key. The previous key keeps validating
+already issued tokens for auth.signing_key_overlap and stays published on
+/.well-known/jwks.json until then. Running servers start signing with the
+new key within a minute. Keys are also rotated automatically every
+auth.signing_key_rotation while the server is running.
+
+To invalidate tokens signed with a compromised key at once, revoke them
+with "token revoke" as well.
+
+Example:
+  wg-orbit-server token rotate-key --config /etc/wg-orbit/server.yaml`,
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config")
+
+		// Створюємо базову конфігурацію сервера
+		config := server.DefaultConfig()
+
+		// Завантажуємо конфігурацію з файлу, якщо вказано
+		if configPath != "" {
+			if err := loadConfigFromFile(config, configPath); err != nil {
+				log.Printf("Warning: failed to load config from %s: %v", configPath, err)
+			}
+		}
+
+		// Ініціалізуємо сервер
+		srv, err := server.NewServer(config)
+		if err != nil {
+			log.Fatalf("Failed to create server: %v", err)
+		}
+
+		key, err := srv.RotateSigningKey()
+		if err != nil {
+			log.Fatalf("Failed to rotate signing key: %v", err)
+		}
+
+		fmt.Printf("New %s signing key: %s\n", key.Algorithm, key.ID)
+		fmt.Printf("Previous keys validate tokens until %s\n",
+			key.CreatedAt.Add(config.SigningKeyOverlap).Format(time.RFC3339))
+	},
+}
+
+// createTokenCmd - команда для генерації токену адміністратора або оператора
+// Такі токени не прив'язані до peer'а і використовуються для керування через REST API
+var createTokenCmd = &cobra.Command{
+	Use:   "create [name]",
+	Short: "Generate an admin or operator token",
+	Long: `Generates a JWT token for managing the server through the REST API.
+
+Roles:
+  admin     - full access, including revoking tokens of others
+  operator  - manage peers and interfaces, read any peer config
+
+Client tokens are limited to their own peer and are generated with
+"user token" or received on enrollment.
+
+Arguments:
+  name - token owner, recorded in the token and in logs (required)
+
+Example:
+  wg-orbit-server token create ci-deploy --role operator --ttl 720h`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := args[0]
+		configPath, _ := cmd.Flags().GetString("config")
+		role, _ := cmd.Flags().GetString("role")
+		ttl, _ := cmd.Flags().GetDuration("ttl")
+
+		// Створюємо базову конфігурацію сервера
+		config := server.DefaultConfig()
+
+		// Завантажуємо конфігурацію з файлу, якщо вказано
+		if configPath != "" {
+			if err := loadConfigFromFile(config, configPath); err != nil {
+				log.Printf("Warning: failed to load config from %s: %v", configPath, err)
+			}
+		}
+
+		// Ініціалізуємо сервер
+		srv, err := server.NewServer(config)
+		if err != nil {
+			log.Fatalf("Failed to create server: %v", err)
+		}
+
+		token, err := srv.GenerateStaffToken(name, role, ttl)
+		if err != nil {
+			log.Fatalf("Failed to generate token: %v", err)
+		}
+
+		fmt.Printf("%s token for %s: %s\n", role, name, token)
+	},
+}
+
+// revokeTokenCmd - команда для відкликання токенів
+// Зберігає відкликання в базі даних, звідки його читає запущений сервер
+var revokeTokenCmd = &cobra.Command{
+	Use:   "revoke",
+	Short: "Revoke a token, or all tokens of a user or peer",
+	Long: `Revokes issued JWT tokens before they expire.
+
+Exactly one of the flags selects what to revoke:
+  --jti   one token by its ID (the "jti" claim)
+  --user  all tokens of a user issued until now
+  --peer  all tokens of a peer (ID or name) issued until now
+
+Tokens issued after revoking a user or peer stay valid. Revocations are
+stored in the database; running servers apply them within 30 seconds.
+A client can also revoke its own token with DELETE /api/v1/tokens/:jti.
+
+Example:
+  wg-orbit-server token revoke --user alice --config /etc/wg-orbit/server.yaml
+  wg-orbit-server token revoke --jti 0b30eb4b-44fd-443f-8e9d-1410b4f88c4d`,
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config")
+
+		var kind, value string
+		for _, flag := range []string{auth.RevokeTokenID, auth.RevokeUser, auth.RevokePeer} {
+			if !cmd.Flags().Changed(flag) {
+				continue
+			}
+			if kind != "" {
+				log.Fatalf("Only one of --jti, --user and --peer can be given")
+			}
+			kind = flag
+			value, _ = cmd.Flags().GetString(flag)
+		}
+		if kind == "" {
+			log.Fatalf("One of --jti, --user or --peer is required")
+		}
+
+		// Створюємо базову конфігурацію сервера
+		config := server.DefaultConfig()
+
+		// Завантажуємо конфігурацію з файлу, якщо вказано
+		if configPath != "" {
+			if err := loadConfigFromFile(config, configPath); err != nil {
+				log.Printf("Warning: failed to load config from %s: %v", configPath, err)
+			}
+		}
+
+		// Ініціалізуємо сервер
+		srv, err := server.NewServer(config)
+		if err != nil {
+			log.Fatalf("Failed to create server: %v", err)
+		}
+
+		revocation, err := srv.RevokeTokens(kind, value)
+		if err != nil {
+			log.Fatalf("Failed to revoke tokens: %v", err)
+		}
+
+		if kind == auth.RevokeTokenID {
+			fmt.Printf("Token %s revoked\n", revocation.Value)
+		} else {
+			fmt.Printf("Tokens of %s %s issued before %s revoked\n",
+				kind, revocation.Value, revocation.RevokedAt.Format(time.RFC3339))
+		}
+	},
+}
+
+// dbCmd - група команд для обслуговування бази даних
+var dbCmd = &cobra.Command{
+	Use:   "db",
+	Short: "Database maintenance commands",
+	Long: `Commands for maintaining the WireGuard Orbit database.
+
+Available subcommands:
+  migrate     - Apply pending schema migrations
+  status      - Show current and latest schema version
+  rekey       - Rotate the master key for encrypted private keys`,
+}
+
+// dbMigrateCmd - команда для застосування міграцій схеми
+// Застосовує всі відсутні міграції в одній транзакції
+var dbMigrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Apply pending database migrations",
+	Long: `Applies all pending schema migrations to the configured database.
+
+Migrations are also applied automatically when the server starts,
+so this command is mainly useful before rolling out a new version.
+
+Example:
+  wg-orbit-server db migrate --config /etc/wg-orbit/server.yaml`,
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config")
+
+		// Створюємо базову конфігурацію сервера
+		config := server.DefaultConfig()
+
+		// Завантажуємо конфігурацію з файлу, якщо вказано
+		if configPath != "" {
+			if err := loadConfigFromFile(config, configPath); err != nil {
+				log.Printf("Warning: failed to load config from %s: %v", configPath, err)
+			}
+		}
+
+		store, err := storage.OpenStorage(&config.StorageConfig)
+		if err != nil {
+			log.Fatalf("Failed to open storage: %v", err)
+		}
+		defer store.Close()
+
+		applied, err := store.Migrate()
+		if err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+
+		if len(applied) == 0 {
+			fmt.Println("Database schema is up to date")
+			return
+		}
+		for _, migration := range applied {
+			fmt.Printf("Applied migration %d: %s\n", migration.Version, migration.Description)
+		}
+	},
+}
+
+// dbStatusCmd - команда для перегляду версії схеми
+// Показує поточну версію, останню відому бінарнику та відсутні міграції
+var dbStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show database schema version",
+	Long: `Shows the current database schema version, the latest version
+supported by this binary and the list of pending migrations.
+
+Example:
+  wg-orbit-server db status --config /etc/wg-orbit/server.yaml`,
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config")
+
+		// Створюємо базову конфігурацію сервера
+		config := server.DefaultConfig()
+
+		// Завантажуємо конфігурацію з файлу, якщо вказано
+		if configPath != "" {
+			if err := loadConfigFromFile(config, configPath); err != nil {
+				log.Printf("Warning: failed to load config from %s: %v", configPath, err)
+			}
+		}
+
+		store, err := storage.OpenStorage(&config.StorageConfig)
+		if err != nil {
+			log.Fatalf("Failed to open storage: %v", err)
+		}
+		defer store.Close()
+
+		status, err := store.SchemaStatus()
+		if err != nil {
+			log.Fatalf("Failed to read schema status: %v", err)
+		}
+
+		fmt.Printf("Current schema version: %d\n", status.Current)
+		fmt.Printf("Latest schema version:  %d\n", status.Latest)
+
+		if status.TooNew() {
+			fmt.Println("Database schema is newer than this binary, upgrade wg-orbit-server")
+			return
+		}
+		if len(status.Pending) == 0 {
+			fmt.Println("Database schema is up to date")
+			return
+		}
+		fmt.Println("Pending migrations:")
+		for _, migration := range status.Pending {
+			fmt.Printf("  %d: %s\n", migration.Version, migration.Description)
+		}
+	},
+}
+
+// dbRekeyCmd - команда для ротації master-ключа
+// Переобгортає ключі шифрування всіх приватних ключів у БД новим master-ключем
+var dbRekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "Rotate the master key for encrypted private keys",
+	Long: `Re-encrypts all interface and peer private keys with a new master key.
+
+The current master key is taken from WG_ORBIT_MASTER_KEY or storage.master_key_file.
+Values that are still stored in plaintext are encrypted with the new key.
+A master key is 32 random bytes encoded in base64, for example:
+  head -c 32 /dev/urandom | base64 > /etc/wg-orbit/master.key
+
+After a successful rekey, point storage.master_key_file to the new key.
+
+Example:
+  wg-orbit-server db rekey --new-key-file /etc/wg-orbit/master.key.new --config /etc/wg-orbit/server.yaml`,
+	Run: func(cmd *cobra.Command, args []string) {
+		configPath, _ := cmd.Flags().GetString("config")
+		newKeyFile, _ := cmd.Flags().GetString("new-key-file")
+
+		// Створюємо базову конфігурацію сервера
+		config := server.DefaultConfig()
+
+		// Завантажуємо конфігурацію з файлу, якщо вказано
+		if configPath != "" {
+			if err := loadConfigFromFile(config, configPath); err != nil {
+				log.Printf("Warning: failed to load config from %s: %v", configPath, err)
+			}
+		}
+
+		data, err := os.ReadFile(newKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to read new master key: %v", err)
+		}
+		next, err := storage.ParseMasterKey(string(data))
+		if err != nil {
+			log.Fatalf("Invalid new master key: %v", err)
+		}
+
+		store, err := storage.NewStorage(&config.StorageConfig)
+		if err != nil {
+			log.Fatalf("Failed to open storage: %v", err)
+		}
+		defer store.Close()
+
+		updated, err := store.Rekey(next)
+		if err != nil {
+			log.Fatalf("Failed to rekey database: %v", err)
+		}
+
+		fmt.Printf("Re-encrypted %d rows with master key %s\n", updated, next.KeyID())
+		fmt.Printf("Update storage.master_key_file to %s before restarting the server\n", newKeyFile)
+	},
+}
+
+// yamlInterface - елемент списку wireguard.interfaces у YAML файлі
+type yamlInterface struct {
+	Name                string `yaml:"name"`
+	Address             string `yaml:"address"`
+	IPv6Address         string `yaml:"ipv6_address"`
+	PrivateKeyFile      string `yaml:"private_key_file"`
+	ListenPort          int    `yaml:"listen_port"`
+	MTU                 int    `yaml:"mtu"`
+	FwMark              int    `yaml:"fwmark"`
+	Table               string `yaml:"table"`
+	PersistentKeepalive int    `yaml:"persistent_keepalive"`
+
+	IPAM struct {
+		Network     string   `yaml:"network"`
+		IPv6Network string   `yaml:"ipv6_network"`
+		StartIP     string   `yaml:"start_ip"`
+		EndIP       string   `yaml:"end_ip"`
+		Reserved    []string `yaml:"reserved"`
+	} `yaml:"ipam"`
+}
+
+// interfaceFlag повертає інтерфейс, вибраний прапорцем --interface, або
+// порожній рядок, якщо прапорець не задано. Без списку інтерфейсів у
+// конфігурації прапорець перейменовує єдиний інтерфейс, як і раніше.
+func interfaceFlag(cmd *cobra.Command, config *server.Config) string {
+	if !cmd.Flags().Changed("interface") {
+		return ""
+	}
+
+	name, _ := cmd.Flags().GetString("interface")
+	if len(config.Interfaces) == 0 {
+		config.Interface = name
+	}
+	return name
+}
+
+// describeInterfaces повертає назви інтерфейсів, з якими працює команда
+func describeInterfaces(config *server.Config, name string) string {
+	if name != "" {
+		return name
+	}
+
+	var names []string
+	for _, iface := range config.InterfaceConfigs() {
+		names = append(names, iface.Name)
+	}
+	return strings.Join(names, ", ")
+}
+
 // loadConfigFromFile завантажує конфігурацію з YAML файлу
 func loadConfigFromFile(config *server.Config, configPath string) error {
 	data, err := os.ReadFile(configPath)
@@ -285,16 +943,59 @@ func loadConfigFromFile(config *server.Config, configPath string) error {
 	// Створюємо структуру для парсингу YAML
 	var yamlConfig struct {
 		WireGuard struct {
-			Interface string `yaml:"interface"`
+			Interface   string `yaml:"interface"`
+			Address     string `yaml:"address"`
+			IPv6Address string `yaml:"ipv6_address"`
+			Backend     string `yaml:"backend"`
+
+			ResyncInterval string `yaml:"resync_interval"`
+			StatsInterval  string `yaml:"stats_interval"`
+			PrivateKeyFile string `yaml:"private_key_file"`
+
+			ListenPort          int    `yaml:"listen_port"`
+			MTU                 int    `yaml:"mtu"`
+			FwMark              int    `yaml:"fwmark"`
+			Table               string `yaml:"table"`
+			PersistentKeepalive int    `yaml:"persistent_keepalive"`
+
+			Interfaces []yamlInterface `yaml:"interfaces"`
 		} `yaml:"wireguard"`
+		Egress struct {
+			Enabled bool   `yaml:"enabled"`
+			Uplink  string `yaml:"uplink"`
+			Backend string `yaml:"backend"`
+		} `yaml:"egress"`
+		IPAM struct {
+			Network     string   `yaml:"network"`
+			IPv6Network string   `yaml:"ipv6_network"`
+			StartIP     string   `yaml:"start_ip"`
+			EndIP       string   `yaml:"end_ip"`
+			Reserved    []string `yaml:"reserved"`
+		} `yaml:"ipam"`
 		Storage struct {
 			Type     string `yaml:"type"`
 			Database string `yaml:"database"`
+			Host     string `yaml:"host"`
+			Port     int    `yaml:"port"`
+			Username string `yaml:"username"`
+			Password string `yaml:"password"`
+			SSLMode  string `yaml:"ssl_mode"`
+
+			MasterKeyFile string `yaml:"master_key_file"`
 		} `yaml:"storage"`
 		Server struct {
-			Host string `yaml:"host"`
-			Port int    `yaml:"port"`
+			Host      string `yaml:"host"`
+			Port      int    `yaml:"port"`
+			SecretKey string `yaml:"secret_key"`
 		} `yaml:"server"`
+		Auth struct {
+			AccessTokenDuration  string `yaml:"access_token_duration"`
+			RefreshTokenDuration string `yaml:"refresh_token_duration"`
+
+			SigningAlgorithm   string `yaml:"signing_algorithm"`
+			SigningKeyRotation string `yaml:"signing_key_rotation"`
+			SigningKeyOverlap  string `yaml:"signing_key_overlap"`
+		} `yaml:"auth"`
 	}
 
 	if err := yaml.Unmarshal(data, &yamlConfig); err != nil {
@@ -305,18 +1006,153 @@ func loadConfigFromFile(config *server.Config, configPath string) error {
 	if yamlConfig.WireGuard.Interface != "" {
 		config.Interface = yamlConfig.WireGuard.Interface
 	}
+	if yamlConfig.WireGuard.Address != "" {
+		config.Address = yamlConfig.WireGuard.Address
+	}
+	if yamlConfig.WireGuard.Backend != "" {
+		config.Backend = yamlConfig.WireGuard.Backend
+	}
+	if yamlConfig.WireGuard.PrivateKeyFile != "" {
+		config.PrivateKeyFile = yamlConfig.WireGuard.PrivateKeyFile
+	}
+	if yamlConfig.WireGuard.ListenPort != 0 {
+		config.ListenPort = yamlConfig.WireGuard.ListenPort
+	}
+	if yamlConfig.WireGuard.MTU != 0 {
+		config.MTU = yamlConfig.WireGuard.MTU
+	}
+	if yamlConfig.WireGuard.FwMark != 0 {
+		config.FwMark = yamlConfig.WireGuard.FwMark
+	}
+	if yamlConfig.WireGuard.Table != "" {
+		config.Table = yamlConfig.WireGuard.Table
+	}
+	if yamlConfig.WireGuard.PersistentKeepalive != 0 {
+		config.PersistentKeepalive = yamlConfig.WireGuard.PersistentKeepalive
+	}
+	if yamlConfig.WireGuard.ResyncInterval != "" {
+		interval, err := time.ParseDuration(yamlConfig.WireGuard.ResyncInterval)
+		if err != nil {
+			return fmt.Errorf("invalid wireguard.resync_interval: %w", err)
+		}
+		config.ResyncInterval = interval
+	}
+	if yamlConfig.WireGuard.StatsInterval != "" {
+		interval, err := time.ParseDuration(yamlConfig.WireGuard.StatsInterval)
+		if err != nil {
+			return fmt.Errorf("invalid wireguard.stats_interval: %w", err)
+		}
+		config.StatsInterval = interval
+	}
+	if yamlConfig.WireGuard.IPv6Address != "" {
+		config.Address6 = yamlConfig.WireGuard.IPv6Address
+	}
+	for _, iface := range yamlConfig.WireGuard.Interfaces {
+		config.Interfaces = append(config.Interfaces, server.InterfaceConfig{
+			Name:                iface.Name,
+			Address:             iface.Address,
+			Address6:            iface.IPv6Address,
+			IPAMNetwork:         iface.IPAM.Network,
+			IPAMStartIP:         iface.IPAM.StartIP,
+			IPAMEndIP:           iface.IPAM.EndIP,
+			IPAMReserved:        iface.IPAM.Reserved,
+			IPAMNetwork6:        iface.IPAM.IPv6Network,
+			PrivateKeyFile:      iface.PrivateKeyFile,
+			ListenPort:          iface.ListenPort,
+			MTU:                 iface.MTU,
+			FwMark:              iface.FwMark,
+			Table:               iface.Table,
+			PersistentKeepalive: iface.PersistentKeepalive,
+		})
+	}
+	if yamlConfig.Egress.Enabled {
+		config.EgressEnabled = true
+	}
+	if yamlConfig.Egress.Uplink != "" {
+		config.EgressUplink = yamlConfig.Egress.Uplink
+	}
+	if yamlConfig.Egress.Backend != "" {
+		config.EgressBackend = yamlConfig.Egress.Backend
+	}
+	if yamlConfig.IPAM.Network != "" {
+		config.IPAMNetwork = yamlConfig.IPAM.Network
+	}
+	if yamlConfig.IPAM.IPv6Network != "" {
+		config.IPAMNetwork6 = yamlConfig.IPAM.IPv6Network
+	}
+	if yamlConfig.IPAM.StartIP != "" {
+		config.IPAMStartIP = yamlConfig.IPAM.StartIP
+	}
+	if yamlConfig.IPAM.EndIP != "" {
+		config.IPAMEndIP = yamlConfig.IPAM.EndIP
+	}
+	if len(yamlConfig.IPAM.Reserved) > 0 {
+		config.IPAMReserved = yamlConfig.IPAM.Reserved
+	}
 	if yamlConfig.Storage.Type != "" {
 		config.StorageConfig.Type = yamlConfig.Storage.Type
 	}
 	if yamlConfig.Storage.Database != "" {
 		config.StorageConfig.Database = yamlConfig.Storage.Database
 	}
+	if yamlConfig.Storage.Host != "" {
+		config.StorageConfig.Host = yamlConfig.Storage.Host
+	}
+	if yamlConfig.Storage.Port != 0 {
+		config.StorageConfig.Port = yamlConfig.Storage.Port
+	}
+	if yamlConfig.Storage.Username != "" {
+		config.StorageConfig.Username = yamlConfig.Storage.Username
+	}
+	if yamlConfig.Storage.Password != "" {
+		config.StorageConfig.Password = yamlConfig.Storage.Password
+	}
+	if yamlConfig.Storage.SSLMode != "" {
+		config.StorageConfig.SSLMode = yamlConfig.Storage.SSLMode
+	}
+	if yamlConfig.Storage.MasterKeyFile != "" {
+		config.StorageConfig.MasterKeyFile = yamlConfig.Storage.MasterKeyFile
+	}
 	if yamlConfig.Server.Host != "" {
 		config.Host = yamlConfig.Server.Host
 	}
 	if yamlConfig.Server.Port != 0 {
 		config.Port = yamlConfig.Server.Port
 	}
+	if yamlConfig.Server.SecretKey != "" {
+		config.JWTSecret = yamlConfig.Server.SecretKey
+	}
+	if yamlConfig.Auth.AccessTokenDuration != "" {
+		duration, err := time.ParseDuration(yamlConfig.Auth.AccessTokenDuration)
+		if err != nil {
+			return fmt.Errorf("invalid auth.access_token_duration: %w", err)
+		}
+		config.AccessTokenTTL = duration
+	}
+	if yamlConfig.Auth.RefreshTokenDuration != "" {
+		duration, err := time.ParseDuration(yamlConfig.Auth.RefreshTokenDuration)
+		if err != nil {
+			return fmt.Errorf("invalid auth.refresh_token_duration: %w", err)
+		}
+		config.RefreshTokenTTL = duration
+	}
+	if yamlConfig.Auth.SigningAlgorithm != "" {
+		config.SigningAlgorithm = yamlConfig.Auth.SigningAlgorithm
+	}
+	if yamlConfig.Auth.SigningKeyRotation != "" {
+		duration, err := time.ParseDuration(yamlConfig.Auth.SigningKeyRotation)
+		if err != nil {
+			return fmt.Errorf("invalid auth.signing_key_rotation: %w", err)
+		}
+		config.SigningKeyRotation = duration
+	}
+	if yamlConfig.Auth.SigningKeyOverlap != "" {
+		duration, err := time.ParseDuration(yamlConfig.Auth.SigningKeyOverlap)
+		if err != nil {
+			return fmt.Errorf("invalid auth.signing_key_overlap: %w", err)
+		}
+		config.SigningKeyOverlap = duration
+	}
 
 	return nil
 }
@@ -329,13 +1165,49 @@ func init() {
 	// Run command flags
 	runCmd.Flags().StringP("port", "p", "8080", "Server port")
 	runCmd.Flags().StringP("config", "c", "/etc/wg-orbit/server.yaml", "Configuration file path")
+	runCmd.Flags().Bool("dev", false, "Development mode: allow the default JWT secret")
+
+	// Teardown command flags
+	teardownCmd.Flags().StringP("interface", "i", "wg0", "WireGuard interface name")
+	teardownCmd.Flags().StringP("config", "c", "/etc/wg-orbit/server.yaml", "Configuration file path")
+	teardownCmd.Flags().Bool("wipe", false, "Also delete the stored interface record and server key")
+
+	// Прапорці для import команди
+	importCmd.Flags().String("from", "/etc/wireguard/wg0.conf", "wg-quick config to import")
+	importCmd.Flags().StringP("interface", "i", "wg0", "WireGuard interface to import into")
+	importCmd.Flags().StringP("config", "c", "/etc/wg-orbit/server.yaml", "Configuration file path")
+	importCmd.Flags().Bool("dry-run", false, "Only report what would be imported")
+
+	// Status command flags
+	statusCmd.Flags().StringP("config", "c", "/etc/wg-orbit/server.yaml", "Configuration file path")
+	statusCmd.Flags().StringP("interface", "i", "wg0", "WireGuard interface name")
 
 	// User command flags
 	userCmd.PersistentFlags().StringP("config", "c", "/etc/wg-orbit/server.yaml", "Configuration file path")
+	addUserCmd.Flags().String("ip", "", "Static IP address for the user")
+	addUserCmd.Flags().Int("keepalive", 0, "PersistentKeepalive interval in seconds")
+	addUserCmd.Flags().StringP("interface", "i", "", "WireGuard interface the user connects to")
+
+	// DB command flags
+	dbCmd.PersistentFlags().StringP("config", "c", "/etc/wg-orbit/server.yaml", "Configuration file path")
+
+	// Прапорці для token команд
+	tokensCmd.PersistentFlags().StringP("config", "c", "/etc/wg-orbit/server.yaml", "Configuration file path")
+	createTokenCmd.Flags().String("role", auth.RoleOperator, "Token role: admin or operator")
+	createTokenCmd.Flags().Duration("ttl", 24*time.Hour, "Token lifetime")
+	revokeTokenCmd.Flags().String(auth.RevokeTokenID, "", "ID of the token to revoke")
+	revokeTokenCmd.Flags().String(auth.RevokeUser, "", "User whose tokens to revoke")
+	revokeTokenCmd.Flags().String(auth.RevokePeer, "", "Peer ID or name whose tokens to revoke")
+	dbRekeyCmd.Flags().String("new-key-file", "", "File with the new base64 master key (required)")
+	if err := dbRekeyCmd.MarkFlagRequired("new-key-file"); err != nil {
+		log.Fatalf("Failed to mark new-key-file flag as required: %v", err)
+	}
 
 	// Add subcommands
 	userCmd.AddCommand(addUserCmd, tokenCmd, enrollTokenCmd)
-	rootCmd.AddCommand(initCmd, runCmd, userCmd)
+	dbCmd.AddCommand(dbMigrateCmd, dbStatusCmd, dbRekeyCmd)
+	tokensCmd.AddCommand(createTokenCmd, revokeTokenCmd, rotateKeyCmd)
+	rootCmd.AddCommand(initCmd, teardownCmd, importCmd, runCmd, statusCmd, userCmd, tokensCmd, dbCmd)
 }
 
 func main() {
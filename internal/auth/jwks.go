@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"sort"
+)
+
+// JWK - публічний ключ підпису у форматі JSON Web Key (RFC 7517)
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	Y         string `json:"y,omitempty"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	Use       string `json:"use"`
+}
+
+// JWKSet - набір ключів, що публікується на /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS повертає публічні ключі, якими перевіряються токени. Для HS256
+// набір порожній: спільний секрет не публікується.
+func (tm *TokenManager) JWKS() *JWKSet {
+	keys := tm.keys.publicKeys()
+	if keys == nil {
+		keys = []JWK{}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].KeyID < keys[j].KeyID })
+	return &JWKSet{Keys: keys}
+}
+
+// newJWK перетворює публічний ключ на JWK
+func newJWK(key *ringKey) (JWK, error) {
+	jwk := JWK{
+		KeyID:     key.record.ID,
+		Algorithm: key.record.Algorithm,
+		Use:       "sig",
+	}
+
+	switch public := key.public.(type) {
+	case ed25519.PublicKey:
+		jwk.KeyType = "OKP"
+		jwk.Curve = "Ed25519"
+		jwk.X = base64.RawURLEncoding.EncodeToString(public)
+	case *ecdsa.PublicKey:
+		// Некомпресована точка: 0x04 || X || Y
+		point, err := public.ECDH()
+		if err != nil {
+			return JWK{}, err
+		}
+		raw := point.Bytes()
+		size := (len(raw) - 1) / 2
+		jwk.KeyType = "EC"
+		jwk.Curve = public.Curve.Params().Name
+		jwk.X = base64.RawURLEncoding.EncodeToString(raw[1 : 1+size])
+		jwk.Y = base64.RawURLEncoding.EncodeToString(raw[1+size:])
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", key.public)
+	}
+	return jwk, nil
+}
@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"time"
 
@@ -19,20 +21,63 @@ type Claims struct {
 
 // TokenManager керує JWT токенами
 type TokenManager struct {
-	secretKey []byte
-	issuer    string
+	keys   tokenKeys
+	issuer string
 }
 
-// NewTokenManager створює новий менеджер токенів
+// tokenKeys - ключі, якими TokenManager підписує і перевіряє токени
+type tokenKeys interface {
+	// signingKey повертає метод, kid (порожній, якщо не потрібен) і ключ для підпису
+	signingKey() (jwt.SigningMethod, string, interface{}, error)
+	// verificationKey повертає ключ для перевірки підпису токена
+	verificationKey(token *jwt.Token) (interface{}, error)
+	// publicKeys повертає ключі для публікації в JWKS
+	publicKeys() []JWK
+}
+
+// NewTokenManager створює менеджер токенів, що підписує їх HS256 спільним секретом
 func NewTokenManager(secretKey []byte, issuer string) *TokenManager {
 	return &TokenManager{
-		secretKey: secretKey,
-		issuer:    issuer,
+		keys:   sharedSecret(secretKey),
+		issuer: issuer,
+	}
+}
+
+// NewKeyRingTokenManager створює менеджер токенів, що підписує їх активним
+// ключем ring і перевіряє ключем з kid токена
+func NewKeyRingTokenManager(ring *KeyRing, issuer string) *TokenManager {
+	return &TokenManager{
+		keys:   ring,
+		issuer: issuer,
+	}
+}
+
+// sharedSecret - спільний секрет HS256
+type sharedSecret []byte
+
+func (s sharedSecret) signingKey() (jwt.SigningMethod, string, interface{}, error) {
+	return jwt.SigningMethodHS256, "", []byte(s), nil
+}
+
+func (s sharedSecret) verificationKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 	}
+	return []byte(s), nil
+}
+
+func (s sharedSecret) publicKeys() []JWK {
+	return nil
 }
 
 // GenerateToken генерує JWT токен для користувача
 func (tm *TokenManager) GenerateToken(userID uuid.UUID, username, role string, peerID *uuid.UUID, duration time.Duration) (string, error) {
+	token, _, err := tm.generateToken(userID, username, role, peerID, duration)
+	return token, err
+}
+
+// generateToken генерує JWT токен і повертає також його claims
+func (tm *TokenManager) generateToken(userID uuid.UUID, username, role string, peerID *uuid.UUID, duration time.Duration) (string, *Claims, error) {
 	now := time.Now()
 	claims := &Claims{
 		UserID:   userID,
@@ -53,18 +98,25 @@ func (tm *TokenManager) GenerateToken(userID uuid.UUID, username, role string, p
 		claims.PeerID = *peerID
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(tm.secretKey)
+	method, kid, key, err := tm.keys.signingKey()
+	if err != nil {
+		return "", nil, err
+	}
+	unsigned := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		unsigned.Header["kid"] = kid
+	}
+
+	token, err := unsigned.SignedString(key)
+	if err != nil {
+		return "", nil, err
+	}
+	return token, claims, nil
 }
 
 // ValidateToken валідує JWT токен і повертає claims
 func (tm *TokenManager) ValidateToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return tm.secretKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, tm.keys.verificationKey)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse token: %w", err)
@@ -78,10 +130,18 @@ func (tm *TokenManager) ValidateToken(tokenString string) (*Claims, error) {
 	return claims, nil
 }
 
-// GenerateEnrollmentToken генерує одноразовий токен для реєстрації
-func (tm *TokenManager) GenerateEnrollmentToken(username string, duration time.Duration) (string, error) {
+// GenerateEnrollmentToken генерує одноразовий токен для реєстрації.
+// Claims (jti, термін дії) повертаються, щоб токен можна було зареєструвати
+// в storage: одноразовість перевіряє сервер, а не сам JWT.
+func (tm *TokenManager) GenerateEnrollmentToken(username string, duration time.Duration) (string, *Claims, error) {
 	userID := uuid.New() // Тимчасовий ID для enrollment
-	return tm.GenerateToken(userID, username, "enrollment", nil, duration)
+	return tm.generateToken(userID, username, RoleEnrollment, nil, duration)
+}
+
+// HashToken повертає SHA-256 хеш токена для зберігання в базі даних
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 // RefreshToken оновлює токен з новим терміном дії
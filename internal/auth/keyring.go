@@ -0,0 +1,358 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/artem/wg-orbit/internal/wg"
+)
+
+// Алгоритми підпису JWT
+const (
+	AlgorithmEdDSA = "EdDSA" // Ed25519, за замовчуванням
+	AlgorithmES256 = "ES256" // ECDSA P-256
+	AlgorithmHS256 = "HS256" // спільний секрет, без ключів і ротації
+)
+
+// DefaultSecret - секрет HS256 у конфігурації за замовчуванням. Він
+// загальновідомий, тому сервер з ним запускається лише в режимі розробки.
+const DefaultSecret = "change-me-in-production"
+
+// Параметри ротації ключів підпису за замовчуванням
+const (
+	DefaultKeyRotation = 30 * 24 * time.Hour
+	DefaultKeyOverlap  = 7 * 24 * time.Hour
+)
+
+const (
+	// keyRingCacheTTL - як часто ключі перечитуються з бази даних, щоб
+	// побачити ротацію, виконану іншим процесом
+	keyRingCacheTTL = time.Minute
+	// keyRingReloadInterval - найменший інтервал між перечитуваннями через
+	// токен з невідомим kid, щоб такі токени не навантажували базу даних
+	keyRingReloadInterval = 10 * time.Second
+	// keyRotationCheckInterval - як часто KeyRing.Run перевіряє, чи настав час ротації
+	keyRotationCheckInterval = time.Hour
+)
+
+// KeyStore зберігає ключі підпису. Реалізується storage.Storage.
+type KeyStore interface {
+	ListSigningKeys() ([]*wg.SigningKey, error)
+	RotateSigningKey(next *wg.SigningKey, retireAt time.Time) error
+}
+
+// KeyRing - ключі підпису JWT, що розрізняються за kid. Новий токен
+// підписується активним ключем; після ротації попередні ключі ще overlap
+// перевіряють видані ними токени.
+type KeyRing struct {
+	store     KeyStore
+	algorithm string
+	rotation  time.Duration // 0 - без планової ротації
+	overlap   time.Duration
+
+	mu       sync.Mutex
+	keys     map[string]*ringKey
+	active   *ringKey
+	loadedAt time.Time
+}
+
+// ringKey - розібраний ключ підпису
+type ringKey struct {
+	record  *wg.SigningKey
+	method  jwt.SigningMethod
+	public  crypto.PublicKey
+	private crypto.Signer // лише в активного ключа
+}
+
+// ValidateSigningAlgorithm перевіряє назву алгоритму підпису
+func ValidateSigningAlgorithm(algorithm string) error {
+	switch algorithm {
+	case AlgorithmEdDSA, AlgorithmES256, AlgorithmHS256:
+		return nil
+	}
+	return fmt.Errorf("unknown signing algorithm %q: must be %s, %s or %s",
+		algorithm, AlgorithmEdDSA, AlgorithmES256, AlgorithmHS256)
+}
+
+// NewKeyRing завантажує ключі з store. Якщо активного ключа алгоритму
+// algorithm немає або настав час планової ротації, генерується новий ключ.
+func NewKeyRing(store KeyStore, algorithm string, rotation, overlap time.Duration) (*KeyRing, error) {
+	if algorithm != AlgorithmEdDSA && algorithm != AlgorithmES256 {
+		return nil, fmt.Errorf("key ring does not support signing algorithm %q", algorithm)
+	}
+	if overlap <= 0 {
+		return nil, fmt.Errorf("invalid signing key overlap %s", overlap)
+	}
+
+	ring := &KeyRing{
+		store:     store,
+		algorithm: algorithm,
+		rotation:  rotation,
+		overlap:   overlap,
+	}
+	if _, err := ring.RotateIfDue(); err != nil {
+		return nil, err
+	}
+	return ring, nil
+}
+
+// Overlap повертає, як довго ключ перевіряє токени після ротації
+func (r *KeyRing) Overlap() time.Duration {
+	return r.overlap
+}
+
+// Rotate генерує новий активний ключ і повертає його
+func (r *KeyRing) Rotate() (*wg.SigningKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.rotate()
+}
+
+// RotateIfDue генерує новий ключ, якщо активного ключа немає, він іншого
+// алгоритму або старший за період ротації. Повертає новий ключ або nil.
+func (r *KeyRing) RotateIfDue() (*wg.SigningKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case r.active == nil:
+		log.Printf("No active %s signing key, generating one", r.algorithm)
+	case r.active.record.Algorithm != r.algorithm:
+		log.Printf("Active signing key %s uses %s, rotating to %s", r.active.record.ID, r.active.record.Algorithm, r.algorithm)
+	case r.rotation > 0 && time.Since(r.active.record.CreatedAt) >= r.rotation:
+		log.Printf("Signing key %s is older than %s, rotating", r.active.record.ID, r.rotation)
+	default:
+		return nil, nil
+	}
+	return r.rotate()
+}
+
+// Run виконує планову ротацію, доки не закрито stop
+func (r *KeyRing) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(keyRotationCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if _, err := r.RotateIfDue(); err != nil {
+				log.Printf("Failed to rotate signing key: %v", err)
+			}
+		}
+	}
+}
+
+// rotate зберігає новий ключ і перечитує ключі; викликається під r.mu
+func (r *KeyRing) rotate() (*wg.SigningKey, error) {
+	key, err := generateSigningKey(r.algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.store.RotateSigningKey(key, key.CreatedAt.Add(r.overlap)); err != nil {
+		return nil, fmt.Errorf("failed to save signing key: %w", err)
+	}
+	log.Printf("Generated %s signing key %s", key.Algorithm, key.ID)
+
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// reload перечитує ключі з store; викликається під r.mu
+func (r *KeyRing) reload() error {
+	records, err := r.store.ListSigningKeys()
+	if err != nil {
+		return fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	keys := make(map[string]*ringKey, len(records))
+	var active *ringKey
+	for _, record := range records {
+		key, err := parseSigningKey(record)
+		if err != nil {
+			return err
+		}
+		keys[record.ID] = key
+
+		// Ключі впорядковані за часом створення, активний - найновіший
+		if record.ExpiresAt == nil {
+			active = key
+		}
+	}
+
+	if active != nil {
+		der, err := base64.StdEncoding.DecodeString(active.record.PrivateKey)
+		if err != nil {
+			return fmt.Errorf("invalid signing key %s: %w", active.record.ID, err)
+		}
+		private, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return fmt.Errorf("invalid signing key %s: %w", active.record.ID, err)
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("invalid signing key %s: unsupported key type %T", active.record.ID, private)
+		}
+		active.private = signer
+	}
+
+	r.keys = keys
+	r.active = active
+	r.loadedAt = time.Now()
+	return nil
+}
+
+// refresh перечитує ключі, якщо кеш застарів; викликається під r.mu.
+// Якщо база даних недоступна, використовуються вже завантажені ключі.
+func (r *KeyRing) refresh() {
+	if time.Since(r.loadedAt) <= keyRingCacheTTL {
+		return
+	}
+	if err := r.reload(); err != nil {
+		log.Printf("Using cached signing keys: %v", err)
+	}
+}
+
+// signingKey реалізує tokenKeys
+func (r *KeyRing) signingKey() (jwt.SigningMethod, string, interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.refresh()
+	if r.active == nil {
+		return nil, "", nil, fmt.Errorf("no active signing key")
+	}
+	return r.active.method, r.active.record.ID, r.active.private, nil
+}
+
+// verificationKey реалізує tokenKeys
+func (r *KeyRing) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, fmt.Errorf("token has no key ID")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.refresh()
+	key, ok := r.keys[kid]
+	if !ok && time.Since(r.loadedAt) > keyRingReloadInterval {
+		if err := r.reload(); err != nil {
+			return nil, err
+		}
+		key, ok = r.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s for key %s", token.Method.Alg(), kid)
+	}
+	if key.record.ExpiresAt != nil && time.Now().After(*key.record.ExpiresAt) {
+		return nil, fmt.Errorf("signing key %s has expired", kid)
+	}
+	return key.public, nil
+}
+
+// publicKeys реалізує tokenKeys
+func (r *KeyRing) publicKeys() []JWK {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.refresh()
+	var keys []JWK
+	for _, key := range r.keys {
+		if key.record.ExpiresAt != nil && time.Now().After(*key.record.ExpiresAt) {
+			continue
+		}
+		jwk, err := newJWK(key)
+		if err != nil {
+			log.Printf("Skipping signing key %s in JWKS: %v", key.record.ID, err)
+			continue
+		}
+		keys = append(keys, jwk)
+	}
+	return keys
+}
+
+// generateSigningKey генерує ключ підпису алгоритму algorithm.
+// kid - початок SHA-256 відбитка публічного ключа.
+func generateSigningKey(algorithm string) (*wg.SigningKey, error) {
+	var signer crypto.Signer
+	switch algorithm {
+	case AlgorithmEdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate Ed25519 key: %w", err)
+		}
+		signer = private
+	case AlgorithmES256:
+		private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate P-256 key: %w", err)
+		}
+		signer = private
+	default:
+		return nil, fmt.Errorf("cannot generate key for signing algorithm %q", algorithm)
+	}
+
+	privateDER, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode signing key: %w", err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public key: %w", err)
+	}
+	fingerprint := sha256.Sum256(publicDER)
+
+	return &wg.SigningKey{
+		ID:         hex.EncodeToString(fingerprint[:8]),
+		Algorithm:  algorithm,
+		PrivateKey: base64.StdEncoding.EncodeToString(privateDER),
+		PublicKey:  base64.StdEncoding.EncodeToString(publicDER),
+		CreatedAt:  time.Now(),
+	}, nil
+}
+
+// parseSigningKey розбирає публічну частину збереженого ключа
+func parseSigningKey(record *wg.SigningKey) (*ringKey, error) {
+	method := jwt.GetSigningMethod(record.Algorithm)
+	if method == nil || (record.Algorithm != AlgorithmEdDSA && record.Algorithm != AlgorithmES256) {
+		return nil, fmt.Errorf("signing key %s has unsupported algorithm %q", record.ID, record.Algorithm)
+	}
+
+	der, err := base64.StdEncoding.DecodeString(record.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key of signing key %s: %w", record.ID, err)
+	}
+	public, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key of signing key %s: %w", record.ID, err)
+	}
+
+	return &ringKey{record: record, method: method, public: public}, nil
+}
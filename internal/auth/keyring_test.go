@@ -0,0 +1,156 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/artem/wg-orbit/internal/wg"
+)
+
+// memoryKeyStore - KeyStore у пам'яті з тією ж семантикою, що й storage
+type memoryKeyStore struct {
+	keys []*wg.SigningKey
+}
+
+func (m *memoryKeyStore) ListSigningKeys() ([]*wg.SigningKey, error) {
+	var keys []*wg.SigningKey
+	for _, key := range m.keys {
+		if key.ExpiresAt == nil || key.ExpiresAt.After(time.Now()) {
+			copied := *key
+			keys = append(keys, &copied)
+		}
+	}
+	return keys, nil
+}
+
+func (m *memoryKeyStore) RotateSigningKey(next *wg.SigningKey, retireAt time.Time) error {
+	for _, key := range m.keys {
+		if key.ExpiresAt == nil {
+			key.ExpiresAt = &retireAt
+		}
+	}
+	m.keys = append(m.keys, next)
+	return nil
+}
+
+func TestKeyRing_Rotation(t *testing.T) {
+	for _, algorithm := range []string{AlgorithmEdDSA, AlgorithmES256} {
+		t.Run(algorithm, func(t *testing.T) {
+			store := &memoryKeyStore{}
+			ring, err := NewKeyRing(store, algorithm, DefaultKeyRotation, time.Hour)
+			if err != nil {
+				t.Fatalf("NewKeyRing() error: %v", err)
+			}
+			if len(store.keys) != 1 || store.keys[0].Algorithm != algorithm {
+				t.Fatalf("stored keys = %+v, want one %s key", store.keys, algorithm)
+			}
+			tm := NewKeyRingTokenManager(ring, "wg-orbit")
+
+			oldToken, err := tm.GenerateToken(uuid.New(), "alice", RoleClient, nil, time.Minute)
+			if err != nil {
+				t.Fatalf("GenerateToken() error: %v", err)
+			}
+
+			if _, err := ring.Rotate(); err != nil {
+				t.Fatalf("Rotate() error: %v", err)
+			}
+			newToken, err := tm.GenerateToken(uuid.New(), "alice", RoleClient, nil, time.Minute)
+			if err != nil {
+				t.Fatalf("GenerateToken() error: %v", err)
+			}
+
+			// Токени обох ключів перевіряються, обидва ключі опубліковано
+			for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+				if _, err := tm.ValidateToken(token); err != nil {
+					t.Errorf("ValidateToken(%s) error: %v", name, err)
+				}
+			}
+			jwks := tm.JWKS()
+			if len(jwks.Keys) != 2 || jwks.Keys[0].Algorithm != algorithm || jwks.Keys[0].X == "" {
+				t.Errorf("JWKS() = %+v, want 2 %s keys", jwks, algorithm)
+			}
+
+			// Після overlap старий ключ більше не перевіряє токени
+			expired := time.Now().Add(-time.Second)
+			store.keys[0].ExpiresAt = &expired
+			ring.mu.Lock()
+			err = ring.reload()
+			ring.mu.Unlock()
+			if err != nil {
+				t.Fatalf("reload() error: %v", err)
+			}
+			if _, err := tm.ValidateToken(oldToken); err == nil {
+				t.Error("ValidateToken(old) succeeded after overlap")
+			}
+			if _, err := tm.ValidateToken(newToken); err != nil {
+				t.Errorf("ValidateToken(new) error: %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyRing_RotateIfDue(t *testing.T) {
+	store := &memoryKeyStore{}
+	ring, err := NewKeyRing(store, AlgorithmEdDSA, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeyRing() error: %v", err)
+	}
+
+	if key, err := ring.RotateIfDue(); err != nil || key != nil {
+		t.Errorf("RotateIfDue() with fresh key = %v, %v, want no rotation", key, err)
+	}
+
+	store.keys[0].CreatedAt = time.Now().Add(-2 * time.Hour)
+	if key, err := ring.RotateIfDue(); err != nil || key == nil {
+		t.Errorf("RotateIfDue() with old key = %v, %v, want rotation", key, err)
+	}
+
+	// Зміна алгоритму в конфігурації одразу дає новий ключ
+	if _, err := NewKeyRing(store, AlgorithmES256, time.Hour, time.Hour); err != nil {
+		t.Fatalf("NewKeyRing(ES256) error: %v", err)
+	}
+	if last := store.keys[len(store.keys)-1]; last.Algorithm != AlgorithmES256 || len(store.keys) != 3 {
+		t.Errorf("keys after algorithm change: %d, last %s, want 3 with ES256 last", len(store.keys), last.Algorithm)
+	}
+}
+
+func TestKeyRing_RejectsSharedSecretTokens(t *testing.T) {
+	store := &memoryKeyStore{}
+	ring, err := NewKeyRing(store, AlgorithmEdDSA, 0, time.Hour)
+	if err != nil {
+		t.Fatalf("NewKeyRing() error: %v", err)
+	}
+	tm := NewKeyRingTokenManager(ring, "wg-orbit")
+
+	hs := NewTokenManager([]byte(DefaultSecret), "wg-orbit")
+	token, err := hs.GenerateToken(uuid.New(), "mallory", RoleAdmin, nil, time.Minute)
+	if err != nil {
+		t.Fatalf("GenerateToken() error: %v", err)
+	}
+	if _, err := tm.ValidateToken(token); err == nil || !strings.Contains(err.Error(), "key ID") {
+		t.Errorf("ValidateToken(HS256 without kid) error = %v, want missing key ID", err)
+	}
+
+	// HS256 з kid ключа кільця: публічний ключ не можна використати як секрет
+	key := store.keys[0]
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		Username: "mallory",
+		Role:     RoleAdmin,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "wg-orbit",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+	forged.Header["kid"] = key.ID
+	signed, err := forged.SignedString([]byte(key.PublicKey))
+	if err != nil {
+		t.Fatalf("SignedString() error: %v", err)
+	}
+	if _, err := tm.ValidateToken(signed); err == nil || !strings.Contains(err.Error(), "unexpected signing method") {
+		t.Errorf("ValidateToken(forged HS256) error = %v, want unexpected signing method", err)
+	}
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/artem/wg-orbit/internal/wg"
+)
+
+// Терміни дії токенів клієнта за замовчуванням
+const (
+	DefaultAccessTokenTTL  = 15 * time.Minute
+	DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// refreshTokenBytes - кількість випадкових байтів у refresh токені
+const refreshTokenBytes = 32
+
+// GenerateRefreshToken генерує непрозорий refresh токен. Повертається сам
+// токен, який віддається клієнту, і запис для storage з його хешем.
+// familyID - сім'я токена, що замінюється, або uuid.Nil для нового ланцюжка.
+func GenerateRefreshToken(peerID, userID, familyID uuid.UUID, ttl time.Duration) (string, *wg.RefreshToken, error) {
+	buf := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(buf)
+
+	now := time.Now()
+	record := &wg.RefreshToken{
+		ID:        uuid.New(),
+		FamilyID:  familyID,
+		PeerID:    peerID,
+		UserID:    userID,
+		TokenHash: HashToken(token),
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if record.FamilyID == uuid.Nil {
+		record.FamilyID = record.ID
+	}
+	return token, record, nil
+}
+
+// RefreshTokenClaims повертає claims, за якими refresh токен перевіряється
+// в RevocationList: ID - сім'я токена, тож "token revoke --jti" з ID сім'ї
+// відкликає весь ланцюжок, а відкликання користувача чи peer'а діє на
+// токени, видані до нього.
+func RefreshTokenClaims(token *wg.RefreshToken, username string) *Claims {
+	return &Claims{
+		UserID:   token.UserID,
+		Username: username,
+		Role:     RoleClient,
+		PeerID:   token.PeerID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:       token.FamilyID.String(),
+			IssuedAt: jwt.NewNumericDate(token.CreatedAt),
+		},
+	}
+}
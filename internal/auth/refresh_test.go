@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestGenerateRefreshToken(t *testing.T) {
+	peerID, userID := uuid.New(), uuid.New()
+
+	token, record, err := GenerateRefreshToken(peerID, userID, uuid.Nil, time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken() error: %v", err)
+	}
+	if record.TokenHash != HashToken(token) || record.PeerID != peerID || record.UserID != userID {
+		t.Errorf("record = %+v, want hash of %q", record, token)
+	}
+	// Перший токен починає сім'ю зі своїм ID
+	if record.FamilyID != record.ID {
+		t.Errorf("FamilyID = %s, want ID %s", record.FamilyID, record.ID)
+	}
+
+	next, nextRecord, err := GenerateRefreshToken(peerID, userID, record.FamilyID, time.Hour)
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken() error: %v", err)
+	}
+	if next == token || nextRecord.ID == record.ID || nextRecord.FamilyID != record.FamilyID {
+		t.Errorf("rotated record = %+v, want new token in family %s", nextRecord, record.FamilyID)
+	}
+}
@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/artem/wg-orbit/internal/wg"
+)
+
+// Види відкликання токенів
+const (
+	RevokeTokenID = "jti"  // один токен за його ID
+	RevokeUser    = "user" // усі токени користувача, видані до відкликання
+	RevokePeer    = "peer" // усі токени peer'а, видані до відкликання
+)
+
+// DefaultRevocationCacheTTL - як довго список відкликань використовується без
+// перечитування. Відкликання, зроблені іншим процесом (напр. CLI), починають
+// діяти не пізніше ніж через цей час.
+const DefaultRevocationCacheTTL = 30 * time.Second
+
+// RevocationList - кеш відкликаних токенів у пам'яті
+type RevocationList struct {
+	load func() ([]*wg.TokenRevocation, error)
+	ttl  time.Duration
+
+	mu       sync.Mutex
+	entries  map[string]time.Time // "вид:значення" -> час відкликання
+	loadedAt time.Time
+}
+
+// NewRevocationList створює кеш, що завантажує відкликання функцією load
+// (зазвичай Storage.ListRevocations) і перечитує їх кожні ttl
+func NewRevocationList(load func() ([]*wg.TokenRevocation, error), ttl time.Duration) *RevocationList {
+	return &RevocationList{
+		load: load,
+		ttl:  ttl,
+	}
+}
+
+// ValidateRevocation перевіряє вид і значення відкликання
+func ValidateRevocation(kind, value string) error {
+	switch kind {
+	case RevokeTokenID, RevokePeer:
+		if _, err := uuid.Parse(value); err != nil {
+			return fmt.Errorf("invalid %s %q: must be a UUID", kind, value)
+		}
+	case RevokeUser:
+		if value == "" {
+			return fmt.Errorf("user name cannot be empty")
+		}
+	default:
+		return fmt.Errorf("unknown revocation kind %q", kind)
+	}
+	return nil
+}
+
+// IsRevoked перевіряє, чи токен з claims відкликано. Помилка повертається,
+// якщо список відкликань не вдалося завантажити: тоді токен не можна вважати дійсним.
+func (l *RevocationList) IsRevoked(claims *Claims) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.entries == nil || time.Since(l.loadedAt) > l.ttl {
+		if err := l.reload(); err != nil {
+			return false, err
+		}
+	}
+
+	if _, ok := l.entries[RevokeTokenID+":"+claims.ID]; ok {
+		return true, nil
+	}
+	if revokedAt, ok := l.entries[RevokeUser+":"+claims.Username]; ok && issuedBefore(claims, revokedAt) {
+		return true, nil
+	}
+	if claims.PeerID != uuid.Nil {
+		if revokedAt, ok := l.entries[RevokePeer+":"+claims.PeerID.String()]; ok && issuedBefore(claims, revokedAt) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Add додає відкликання до кешу, не чекаючи наступного перечитування
+func (l *RevocationList) Add(revocation *wg.TokenRevocation) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.entries != nil {
+		l.entries[revocation.Kind+":"+revocation.Value] = revocation.RevokedAt
+	}
+}
+
+// reload перечитує відкликання; викликається під l.mu
+func (l *RevocationList) reload() error {
+	revocations, err := l.load()
+	if err != nil {
+		return fmt.Errorf("failed to load token revocations: %w", err)
+	}
+
+	entries := make(map[string]time.Time, len(revocations))
+	for _, revocation := range revocations {
+		entries[revocation.Kind+":"+revocation.Value] = revocation.RevokedAt
+	}
+	l.entries = entries
+	l.loadedAt = time.Now()
+	return nil
+}
+
+// issuedBefore перевіряє, чи токен видано до моменту t. Час видачі в JWT
+// має точність до секунди, тому токен, виданий у ту саму секунду, теж
+// вважається старішим. Токени без iat вважаються старими.
+func issuedBefore(claims *Claims, t time.Time) bool {
+	if claims.IssuedAt == nil {
+		return true
+	}
+	return claims.IssuedAt.Time.Before(t)
+}
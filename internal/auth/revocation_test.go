@@ -0,0 +1,81 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+
+	"github.com/artem/wg-orbit/internal/wg"
+)
+
+func TestRevocationList_IsRevoked(t *testing.T) {
+	now := time.Now()
+	peerID := uuid.New()
+	revokedID := uuid.New().String()
+
+	loads := 0
+	stored := []*wg.TokenRevocation{
+		{Kind: RevokeTokenID, Value: revokedID, RevokedAt: now},
+		{Kind: RevokeUser, Value: "alice", RevokedAt: now},
+		{Kind: RevokePeer, Value: peerID.String(), RevokedAt: now},
+	}
+	list := NewRevocationList(func() ([]*wg.TokenRevocation, error) {
+		loads++
+		return stored, nil
+	}, time.Hour)
+
+	claims := func(id, username string, peer uuid.UUID, issued time.Time) *Claims {
+		return &Claims{
+			Username: username,
+			PeerID:   peer,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:       id,
+				IssuedAt: jwt.NewNumericDate(issued),
+			},
+		}
+	}
+	before := now.Add(-time.Minute)
+	after := now.Add(time.Minute)
+
+	tests := []struct {
+		name   string
+		claims *Claims
+		want   bool
+	}{
+		{"revoked jti", claims(revokedID, "bob", uuid.Nil, after), true},
+		{"other token", claims(uuid.New().String(), "bob", uuid.New(), before), false},
+		{"user token issued before", claims(uuid.New().String(), "alice", uuid.Nil, before), true},
+		{"user token issued after", claims(uuid.New().String(), "alice", uuid.Nil, after), false},
+		{"peer token issued before", claims(uuid.New().String(), "laptop", peerID, before), true},
+		{"peer token issued after", claims(uuid.New().String(), "laptop", peerID, after), false},
+	}
+	for _, tt := range tests {
+		revoked, err := list.IsRevoked(tt.claims)
+		if err != nil || revoked != tt.want {
+			t.Errorf("%s: IsRevoked() = %v, %v, want %v", tt.name, revoked, err, tt.want)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("revocations loaded %d times, want 1 within TTL", loads)
+	}
+
+	// Локальне відкликання діє одразу, без перечитування
+	fresh := claims(uuid.New().String(), "carol", uuid.Nil, before)
+	list.Add(&wg.TokenRevocation{Kind: RevokeTokenID, Value: fresh.ID, RevokedAt: now})
+	if revoked, _ := list.IsRevoked(fresh); !revoked || loads != 1 {
+		t.Errorf("IsRevoked() after Add = %v (loads %d), want true without reload", revoked, loads)
+	}
+}
+
+func TestRevocationList_LoadError(t *testing.T) {
+	list := NewRevocationList(func() ([]*wg.TokenRevocation, error) {
+		return nil, errors.New("database is locked")
+	}, time.Hour)
+
+	if _, err := list.IsRevoked(&Claims{}); err == nil {
+		t.Error("IsRevoked() succeeded without revocations, want error")
+	}
+}
@@ -0,0 +1,58 @@
+package auth
+
+// Ролі, що записуються в claim "role"
+const (
+	RoleAdmin      = "admin"      // повний доступ, включно з відкликанням чужих токенів
+	RoleOperator   = "operator"   // керування peer'ами та інтерфейсами
+	RoleClient     = "client"     // клієнт: лише власний peer з claim peer_id
+	RoleEnrollment = "enrollment" // лише реєстрація через /enroll
+
+	// roleLegacyUser - роль токенів "user token" старих версій; це токени
+	// клієнтів з peer_id, тому вони мають права клієнта
+	roleLegacyUser = "user"
+)
+
+// Permission - дія, дозвіл на яку перевіряється перед обробкою запиту
+type Permission string
+
+// Дозволи REST API
+const (
+	PermReadPeers       Permission = "peers:read"      // список і дані будь-яких peer'ів
+	PermWritePeers      Permission = "peers:write"     // створення, зміна і видалення peer'ів
+	PermReadInterfaces  Permission = "interfaces:read" // список інтерфейсів
+	PermReadConfigs     Permission = "configs:read"    // конфігурації будь-яких peer'ів
+	PermReadOwnPeer     Permission = "peer:read:own"   // власний peer і його конфігурація
+	PermRevokeOwnToken  Permission = "token:revoke:own"
+	PermRevokeAnyTokens Permission = "tokens:revoke"
+)
+
+// rolePermissions - дозволи кожної ролі
+var rolePermissions = map[string][]Permission{
+	RoleAdmin: {
+		PermReadPeers, PermWritePeers, PermReadInterfaces, PermReadConfigs,
+		PermReadOwnPeer, PermRevokeOwnToken, PermRevokeAnyTokens,
+	},
+	RoleOperator: {
+		PermReadPeers, PermWritePeers, PermReadInterfaces, PermReadConfigs,
+		PermReadOwnPeer, PermRevokeOwnToken,
+	},
+	RoleClient:     {PermReadOwnPeer, PermRevokeOwnToken},
+	roleLegacyUser: {PermReadOwnPeer, PermRevokeOwnToken},
+	RoleEnrollment: {},
+}
+
+// HasPermission перевіряє, чи роль має дозвіл. Невідомі ролі не мають жодного.
+func HasPermission(role string, permission Permission) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// IsStaffRole перевіряє, чи роль належить адміністратору або оператору,
+// тобто токен видається не клієнту і не прив'язаний до peer'а
+func IsStaffRole(role string) bool {
+	return role == RoleAdmin || role == RoleOperator
+}
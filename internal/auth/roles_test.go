@@ -0,0 +1,33 @@
+package auth
+
+import "testing"
+
+func TestHasPermission(t *testing.T) {
+	tests := []struct {
+		role       string
+		permission Permission
+		want       bool
+	}{
+		{RoleAdmin, PermRevokeAnyTokens, true},
+		{RoleAdmin, PermWritePeers, true},
+		{RoleOperator, PermWritePeers, true},
+		{RoleOperator, PermReadConfigs, true},
+		{RoleOperator, PermRevokeAnyTokens, false},
+		{RoleClient, PermReadOwnPeer, true},
+		{RoleClient, PermRevokeOwnToken, true},
+		{RoleClient, PermReadPeers, false},
+		{RoleClient, PermReadConfigs, false},
+		{roleLegacyUser, PermReadOwnPeer, true},
+		{roleLegacyUser, PermWritePeers, false},
+		{RoleEnrollment, PermReadOwnPeer, false},
+		{RoleEnrollment, PermRevokeOwnToken, false},
+		{"", PermReadPeers, false},
+		{"root", PermReadPeers, false},
+	}
+
+	for _, tt := range tests {
+		if got := HasPermission(tt.role, tt.permission); got != tt.want {
+			t.Errorf("HasPermission(%q, %q) = %v, want %v", tt.role, tt.permission, got, tt.want)
+		}
+	}
+}
@@ -22,13 +22,17 @@ type Client struct {
 // Config містить конфігурацію клієнта
 type Config struct {
 	ServerURL   string    `json:"server_url"`
-	Token       string    `json:"token"`
+	Token       string    `json:"token"` // access токен
 	ClientName  string    `json:"client_name"`
 	ConfigPath  string    `json:"config_path"`
 	Interface   string    `json:"interface"`
 	TokenExpiry time.Time `json:"token_expiry"`
 	PrivateKey  string    `json:"private_key"`
 	PublicKey   string    `json:"public_key"`
+
+	// RefreshToken - одноразовий токен для отримання нової пари токенів
+	RefreshToken       string    `json:"refresh_token"`
+	RefreshTokenExpiry time.Time `json:"refresh_token_expiry"`
 }
 
 // EnrollRequest представляє запит на реєстрацію
@@ -39,12 +43,11 @@ type EnrollRequest struct {
 }
 
 // EnrollResponse представляє відповідь на реєстрацію
-type EnrollResponse struct {
-	Success      bool             `json:"success"`
-	Message      string           `json:"message"`
-	ClientConfig *wg.ClientConfig `json:"client_config,omitempty"`
-	RefreshToken string           `json:"refresh_token,omitempty"`
-	TokenExpiry  time.Time        `json:"token_expiry,omitempty"`
+type EnrollResponse = wg.EnrollResponse
+
+// errorResponse - тіло відповіді сервера з помилкою
+type errorResponse struct {
+	Error string `json:"error"`
 }
 
 // DefaultConfig повертає конфігурацію за замовчуванням
@@ -111,6 +114,10 @@ func (c *Client) Enroll(serverURL, token, clientName string) error {
 		return fmt.Errorf("failed to read response: %w", err)
 	}
 
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("enrollment failed: %s", responseError(resp, body))
+	}
+
 	var enrollResp EnrollResponse
 	if err := json.Unmarshal(body, &enrollResp); err != nil {
 		return fmt.Errorf("failed to unmarshal response: %w", err)
@@ -120,19 +127,17 @@ func (c *Client) Enroll(serverURL, token, clientName string) error {
 		return fmt.Errorf("enrollment failed: %s", enrollResp.Message)
 	}
 
-	// Оновлюємо токен та час його закінчення
-	if enrollResp.RefreshToken != "" {
-		c.config.Token = enrollResp.RefreshToken
-		c.config.TokenExpiry = enrollResp.TokenExpiry
-	}
+	// Enrollment токен одноразовий, далі клієнт працює з виданою парою токенів
+	c.setTokens(&enrollResp.TokenPair)
 
 	// Зберігаємо конфігурацію
 	if err := c.SaveConfig(); err != nil {
 		return fmt.Errorf("failed to save config: %w", err)
 	}
 
-	// Зберігаємо WireGuard конфігурацію
+	// Зберігаємо WireGuard конфігурацію; приватний ключ знає лише клієнт
 	if enrollResp.ClientConfig != nil {
+		enrollResp.ClientConfig.Interface.PrivateKey = privateKey
 		if err := c.SaveWireGuardConfig(enrollResp.ClientConfig); err != nil {
 			return fmt.Errorf("failed to save WireGuard config: %w", err)
 		}
@@ -144,7 +149,7 @@ func (c *Client) Enroll(serverURL, token, clientName string) error {
 // Up піднімає WireGuard інтерфейс
 func (c *Client) Up() error {
 	// Перевіряємо, чи потрібно оновити токен
-	if time.Now().After(c.config.TokenExpiry.Add(-1 * time.Hour)) {
+	if time.Now().After(c.config.TokenExpiry.Add(-1 * time.Minute)) {
 		if err := c.RefreshToken(); err != nil {
 			return fmt.Errorf("failed to refresh token: %w", err)
 		}
@@ -186,11 +191,19 @@ func (c *Client) Status() error {
 	return nil
 }
 
-// RefreshToken оновлює токен клієнта
+// RefreshToken отримує нову пару токенів за refresh токеном. Використаний
+// refresh токен більше не дійсний, тому нова пара одразу зберігається.
 func (c *Client) RefreshToken() error {
-	req := map[string]string{
-		"refresh_token": c.config.Token,
-		"client_name":   c.config.ClientName,
+	if c.config.RefreshToken == "" {
+		return fmt.Errorf("no refresh token, run 'enroll' first")
+	}
+	if time.Now().After(c.config.RefreshTokenExpiry) {
+		return fmt.Errorf("refresh token expired at %s, run 'enroll' again", c.config.RefreshTokenExpiry.Format(time.RFC3339))
+	}
+
+	req := wg.RefreshRequest{
+		RefreshToken: c.config.RefreshToken,
+		ClientName:   c.config.ClientName,
 	}
 
 	reqBody, err := json.Marshal(req)
@@ -213,13 +226,11 @@ func (c *Client) RefreshToken() error {
 		return fmt.Errorf("failed to read response: %w", err)
 	}
 
-	var refreshResp struct {
-		Success      bool      `json:"success"`
-		Message      string    `json:"message"`
-		RefreshToken string    `json:"refresh_token,omitempty"`
-		TokenExpiry  time.Time `json:"token_expiry,omitempty"`
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("token refresh failed: %s", responseError(resp, body))
 	}
 
+	var refreshResp wg.RefreshResponse
 	if err := json.Unmarshal(body, &refreshResp); err != nil {
 		return fmt.Errorf("failed to unmarshal response: %w", err)
 	}
@@ -228,14 +239,30 @@ func (c *Client) RefreshToken() error {
 		return fmt.Errorf("token refresh failed: %s", refreshResp.Message)
 	}
 
-	// Оновлюємо токен
-	c.config.Token = refreshResp.RefreshToken
-	c.config.TokenExpiry = refreshResp.TokenExpiry
+	// Оновлюємо токени
+	c.setTokens(&refreshResp.TokenPair)
 
 	// Зберігаємо конфігурацію
 	return c.SaveConfig()
 }
 
+// setTokens зберігає в конфігурації токени, видані сервером
+func (c *Client) setTokens(tokens *wg.TokenPair) {
+	c.config.Token = tokens.AccessToken
+	c.config.TokenExpiry = tokens.TokenExpiry
+	c.config.RefreshToken = tokens.RefreshToken
+	c.config.RefreshTokenExpiry = tokens.RefreshTokenExpiry
+}
+
+// responseError повертає опис помилки з відповіді сервера
+func responseError(resp *http.Response, body []byte) string {
+	var errResp errorResponse
+	if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error != "" {
+		return errResp.Error
+	}
+	return resp.Status
+}
+
 // SaveConfig зберігає конфігурацію клієнта
 func (c *Client) SaveConfig() error {
 	// Створюємо директорію, якщо не існує
@@ -0,0 +1,306 @@
+// Package egress відкриває клієнтам вихід в інтернет через сервер.
+//
+// Клієнти з повним тунелем (AllowedIPs 0.0.0.0/0) надсилають весь трафік
+// у WireGuard інтерфейс, тому сервер має форвардити пакети на uplink і
+// маскувати адреси тунельних мереж. Правила встановлюються через nftables,
+// а якщо він недоступний або ланцюжок FORWARD iptables відкидає пакети за
+// замовчуванням - через iptables.
+package egress
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotSupported повертається, коли firewall недоступний у системі
+var ErrNotSupported = errors.New("firewall is not supported on this host")
+
+// Rules описує правила egress для одного WireGuard інтерфейсу
+type Rules struct {
+	Interface string       // WireGuard інтерфейс
+	Uplink    string       // зовнішній інтерфейс, через який виходить трафік
+	Networks  []*net.IPNet // тунельні мережі, адреси яких маскуються
+}
+
+// hasIPv6 перевіряє, чи є серед мереж IPv6
+func (r Rules) hasIPv6() bool {
+	for _, network := range r.Networks {
+		if network.IP.To4() == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// tag позначає правила wg-orbit для інтерфейсу, щоб їх можна було знайти і видалити
+func (r Rules) tag() string {
+	return "wg-orbit:" + r.Interface
+}
+
+// TableName повертає назву таблиці nftables з правилами інтерфейсу iface.
+// Символи, недопустимі в назві, замінюються на '_', тому різні інтерфейси
+// можуть отримати ту саму таблицю; конфігурація сервера таке відхиляє.
+func TableName(iface string) string {
+	return "wg_orbit_" + strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, iface)
+}
+
+// Firewall встановлює правила форвардингу і маскування
+type Firewall interface {
+	// Name повертає назву backend'у для логів
+	Name() string
+	// Available перевіряє, чи можна керувати правилами
+	Available() error
+	// Apply встановлює правила; повторний виклик не дублює їх
+	Apply(rules Rules) error
+	// Remove видаляє правила; відсутні правила не є помилкою
+	Remove(rules Rules) error
+	// Installed повертає встановлені правила у вигляді тексту
+	Installed(rules Rules) ([]string, error)
+	// Blockers повертає чужі ланцюжки з політикою drop на хуку forward,
+	// які відкидають трафік інтерфейсу попри встановлені правила
+	Blockers(rules Rules) ([]string, error)
+}
+
+// Типи backend'ів
+const (
+	BackendAuto     = "auto"
+	BackendNftables = "nftables"
+	BackendIptables = "iptables"
+)
+
+// New створює firewall вказаного типу. Для "auto" або порожнього значення
+// використовується nftables, якщо він доступний, інакше iptables.
+func New(kind string) (Firewall, error) {
+	switch kind {
+	case "", BackendAuto:
+		if firewall, err := newNftables(); err == nil && firewall.Available() == nil {
+			// Accept в окремій таблиці nftables не скасовує політику DROP
+			// ланцюжка FORWARD iptables (Docker, ufw), а iptables вставляє
+			// свої правила на початок цього ланцюжка
+			if len(iptablesForwardDrops(runCommand)) == 0 {
+				return firewall, nil
+			}
+			if iptables := NewIptables(); iptables.Available() == nil {
+				return iptables, nil
+			}
+			return firewall, nil
+		}
+		return NewIptables(), nil
+	case BackendNftables:
+		return newNftables()
+	case BackendIptables:
+		return NewIptables(), nil
+	default:
+		return nil, fmt.Errorf("unknown firewall backend: %s", kind)
+	}
+}
+
+// Cleanup видаляє правила інтерфейсу з усіх доступних backend'ів.
+// Використовується при teardown, коли невідомо, яким backend'ом і з яким
+// uplink правила були встановлені. Повторний виклик нічого не змінює.
+func Cleanup(rules Rules) error {
+	for _, kind := range []string{BackendNftables, BackendIptables} {
+		firewall, err := New(kind)
+		if err != nil || firewall.Available() != nil {
+			continue
+		}
+		if err := firewall.Remove(rules); err != nil {
+			return fmt.Errorf("failed to remove %s rules: %w", firewall.Name(), err)
+		}
+	}
+	return nil
+}
+
+// Налаштування ядра, що вмикають форвардинг
+const (
+	ipv4Forwarding = "net/ipv4/ip_forward"
+	ipv6Forwarding = "net/ipv6/conf/all/forwarding"
+)
+
+// sysctlRoot - корінь дерева sysctl; змінюється в тестах
+var sysctlRoot = "/proc/sys"
+
+// Manager вмикає і вимикає egress для інтерфейсу
+type Manager struct {
+	firewall Firewall
+	rules    Rules
+	restore  map[string]string // sysctl, змінені Enable, і їх попередні значення
+}
+
+// Status описує поточний стан egress
+type Status struct {
+	Backend        string   `json:"backend"`
+	Interface      string   `json:"interface"`
+	Uplink         string   `json:"uplink"`
+	IPv4Forwarding bool     `json:"ipv4_forwarding"`
+	IPv6Forwarding bool     `json:"ipv6_forwarding"`
+	Rules          []string `json:"rules"`
+	// Blockers - чужі ланцюжки forward з політикою drop, що відкидають
+	// трафік клієнтів попри правила wg-orbit
+	Blockers []string `json:"blockers,omitempty"`
+}
+
+// NewManager створює менеджер egress
+func NewManager(firewall Firewall, rules Rules) *Manager {
+	return &Manager{
+		firewall: firewall,
+		rules:    rules,
+		restore:  make(map[string]string),
+	}
+}
+
+// Firewall повертає backend правил
+func (m *Manager) Firewall() Firewall {
+	return m.firewall
+}
+
+// Enable вмикає форвардинг і встановлює правила
+func (m *Manager) Enable() error {
+	if m.rules.Uplink == "" {
+		return fmt.Errorf("egress uplink interface is not configured")
+	}
+	if err := m.firewall.Available(); err != nil {
+		return fmt.Errorf("%s firewall is not available: %w", m.firewall.Name(), err)
+	}
+
+	keys := []string{ipv4Forwarding}
+	if m.rules.hasIPv6() {
+		keys = append(keys, ipv6Forwarding)
+	}
+	for _, key := range keys {
+		if err := m.enableSysctl(key); err != nil {
+			return err
+		}
+	}
+
+	if err := m.firewall.Apply(m.rules); err != nil {
+		return fmt.Errorf("failed to install %s rules: %w", m.firewall.Name(), err)
+	}
+	return nil
+}
+
+// Disable видаляє правила і повертає налаштування форвардингу,
+// які змінив Enable цього менеджера
+func (m *Manager) Disable() error {
+	if err := m.firewall.Remove(m.rules); err != nil {
+		return fmt.Errorf("failed to remove %s rules: %w", m.firewall.Name(), err)
+	}
+
+	for key, value := range m.restore {
+		if err := writeSysctl(key, value); err != nil {
+			return err
+		}
+		delete(m.restore, key)
+	}
+	return nil
+}
+
+// Status повертає стан форвардингу і встановлені правила
+func (m *Manager) Status() (*Status, error) {
+	status := &Status{
+		Backend:   m.firewall.Name(),
+		Interface: m.rules.Interface,
+		Uplink:    m.rules.Uplink,
+	}
+
+	value, err := readSysctl(ipv4Forwarding)
+	if err != nil {
+		return nil, err
+	}
+	status.IPv4Forwarding = value == "1"
+
+	// IPv6 може бути вимкнений у ядрі
+	if value, err := readSysctl(ipv6Forwarding); err == nil {
+		status.IPv6Forwarding = value == "1"
+	}
+
+	status.Rules, err = m.firewall.Installed(m.rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s rules: %w", m.firewall.Name(), err)
+	}
+
+	status.Blockers, err = m.Blockers()
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+// Blockers повертає чужі ланцюжки forward з політикою drop
+func (m *Manager) Blockers() ([]string, error) {
+	blockers, err := m.firewall.Blockers(m.rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list forward chains: %w", err)
+	}
+	return blockers, nil
+}
+
+// forwardBlockers відбирає з ланцюжків chains у форматі "сімейство таблиця
+// ланцюжок" ті, що стосуються трафіку rules, без дублікатів і без ланцюжків,
+// що починаються з одного з ignore
+func forwardBlockers(rules Rules, chains []string, ignore ...string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, chain := range chains {
+		if seen[chain] || strings.HasPrefix(chain, "ip6 ") && !rules.hasIPv6() {
+			continue
+		}
+		ignored := false
+		for _, prefix := range ignore {
+			if strings.HasPrefix(chain, prefix) {
+				ignored = true
+				break
+			}
+		}
+		if !ignored {
+			seen[chain] = true
+			result = append(result, chain)
+		}
+	}
+	return result
+}
+
+// enableSysctl встановлює key в 1, запам'ятовуючи попереднє значення
+func (m *Manager) enableSysctl(key string) error {
+	value, err := readSysctl(key)
+	if err != nil {
+		return err
+	}
+	if value == "1" {
+		return nil
+	}
+
+	if err := writeSysctl(key, "1"); err != nil {
+		return err
+	}
+	if _, ok := m.restore[key]; !ok {
+		m.restore[key] = value
+	}
+	return nil
+}
+
+// readSysctl читає значення налаштування ядра
+func readSysctl(key string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(sysctlRoot, key))
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", strings.ReplaceAll(key, "/", "."), err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// writeSysctl записує значення налаштування ядра
+func writeSysctl(key, value string) error {
+	if err := os.WriteFile(filepath.Join(sysctlRoot, key), []byte(value), 0644); err != nil {
+		return fmt.Errorf("failed to set %s: %w", strings.ReplaceAll(key, "/", "."), err)
+	}
+	return nil
+}
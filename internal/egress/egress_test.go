@@ -0,0 +1,189 @@
+package egress
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// stubRunner імітує iptables: зберігає додані правила і відповідає на -C та -S
+type stubRunner struct {
+	rules  map[string]bool // "команда таблиця ланцюжок spec"
+	policy string          // політика ланцюжків, порожня - ACCEPT
+}
+
+func (r *stubRunner) run(name string, args ...string) (string, error) {
+	// Аргументи мають вигляд -w -t <таблиця> <дія> <ланцюжок> spec...
+	table, action, chain := args[2], args[3], args[4]
+	prefix := name + " " + table + " " + chain
+	key := strings.Join(append([]string{prefix}, args[5:]...), " ")
+
+	switch action {
+	case "-C":
+		if !r.rules[key] {
+			return "iptables: Bad rule", errors.New("exit status 1")
+		}
+	case "-A", "-I":
+		r.rules[key] = true
+	case "-D":
+		if !r.rules[key] {
+			return "iptables: Bad rule", errors.New("exit status 1")
+		}
+		delete(r.rules, key)
+	case "-S":
+		policy := r.policy
+		if policy == "" {
+			policy = "ACCEPT"
+		}
+		lines := []string{"-P " + chain + " " + policy}
+		for rule := range r.rules {
+			if strings.HasPrefix(rule, prefix+" ") {
+				lines = append(lines, "-A "+chain+" "+strings.TrimPrefix(rule, prefix+" "))
+			}
+		}
+		return strings.Join(lines, "\n"), nil
+	}
+	return "", nil
+}
+
+func testRules(t *testing.T) Rules {
+	t.Helper()
+
+	var networks []*net.IPNet
+	for _, cidr := range []string{"10.0.0.0/24", "fd00:77::/64"} {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			t.Fatalf("ParseCIDR(%s) error: %v", cidr, err)
+		}
+		networks = append(networks, network)
+	}
+	return Rules{Interface: "wg0", Uplink: "eth0", Networks: networks}
+}
+
+func TestIptables_ApplyRemove(t *testing.T) {
+	runner := &stubRunner{rules: make(map[string]bool)}
+	firewall := &Iptables{run: runner.run}
+	rules := testRules(t)
+
+	// Повторне встановлення не дублює правила
+	for i := 0; i < 2; i++ {
+		if err := firewall.Apply(rules); err != nil {
+			t.Fatalf("Apply() error: %v", err)
+		}
+	}
+	if len(runner.rules) != 6 {
+		t.Fatalf("installed %d rules, want 6: %v", len(runner.rules), runner.rules)
+	}
+
+	want := "ip6tables nat POSTROUTING -s fd00:77::/64 -o eth0 -m comment --comment wg-orbit:wg0 -j MASQUERADE"
+	if !runner.rules[want] {
+		t.Errorf("missing rule %q in %v", want, runner.rules)
+	}
+
+	// Правила іншого інтерфейсу не враховуються і не видаляються
+	other := "iptables nat POSTROUTING -s 10.1.0.0/24 -o eth0 -m comment --comment wg-orbit:wg01 -j MASQUERADE"
+	runner.rules[other] = true
+
+	installed, err := firewall.Installed(rules)
+	if err != nil {
+		t.Fatalf("Installed() error: %v", err)
+	}
+	if len(installed) != 6 {
+		t.Errorf("Installed() returned %d rules, want 6: %q", len(installed), installed)
+	}
+
+	// Remove знаходить правила за коментарем, навіть якщо uplink змінився
+	rules.Uplink = "eth1"
+	for i := 0; i < 2; i++ {
+		if err := firewall.Remove(rules); err != nil {
+			t.Fatalf("Remove() error: %v", err)
+		}
+	}
+	if len(runner.rules) != 1 || !runner.rules[other] {
+		t.Errorf("rules left after Remove(): %v, want only %q", runner.rules, other)
+	}
+}
+
+func TestManager_Forwarding(t *testing.T) {
+	root := t.TempDir()
+	defer func(previous string) { sysctlRoot = previous }(sysctlRoot)
+	sysctlRoot = root
+
+	for key, value := range map[string]string{ipv4Forwarding: "0\n", ipv6Forwarding: "1\n"} {
+		path := filepath.Join(root, key)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("MkdirAll() error: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(value), 0644); err != nil {
+			t.Fatalf("WriteFile() error: %v", err)
+		}
+	}
+
+	runner := &stubRunner{rules: make(map[string]bool)}
+	manager := NewManager(&Iptables{run: runner.run}, testRules(t))
+
+	if err := manager.Enable(); err != nil {
+		t.Fatalf("Enable() error: %v", err)
+	}
+	status, err := manager.Status()
+	if err != nil {
+		t.Fatalf("Status() error: %v", err)
+	}
+	if !status.IPv4Forwarding || !status.IPv6Forwarding || status.Backend != BackendIptables {
+		t.Errorf("Status() = %+v, want forwarding enabled", status)
+	}
+
+	// Disable повертає лише ті налаштування, які змінив Enable
+	if err := manager.Disable(); err != nil {
+		t.Fatalf("Disable() error: %v", err)
+	}
+	if value, _ := readSysctl(ipv4Forwarding); value != "0" {
+		t.Errorf("ip_forward = %q after Disable(), want 0", value)
+	}
+	if value, _ := readSysctl(ipv6Forwarding); value != "1" {
+		t.Errorf("ipv6 forwarding = %q after Disable(), want 1", value)
+	}
+	if len(runner.rules) != 0 {
+		t.Errorf("rules left after Disable(): %v", runner.rules)
+	}
+}
+
+func TestForwardBlockers(t *testing.T) {
+	runner := &stubRunner{rules: make(map[string]bool), policy: "DROP"}
+	drops := iptablesForwardDrops(runner.run)
+	if strings.Join(drops, ",") != "ip filter FORWARD,ip6 filter FORWARD" {
+		t.Errorf("iptablesForwardDrops() = %q, want ip and ip6 filter FORWARD", drops)
+	}
+
+	chains := []string{
+		"ip filter FORWARD",
+		"inet firewalld filter_FORWARD",
+		"ip6 filter FORWARD",
+	}
+	rules := testRules(t)
+
+	// Дублікати з nftables та iptables-nft і ланцюжки ignore не повертаються
+	nftables := forwardBlockers(rules, append(chains, drops...), "inet firewalld ")
+	if got := strings.Join(nftables, ","); got != "ip filter FORWARD,ip6 filter FORWARD" {
+		t.Errorf("nftables blockers = %q", got)
+	}
+
+	// iptables вставляє правила на початок FORWARD, тож заважають лише інші таблиці
+	firewall := &Iptables{run: runner.run, forwardChains: func() ([]string, error) { return chains, nil }}
+	blockers, err := firewall.Blockers(rules)
+	if err != nil {
+		t.Fatalf("Blockers() error: %v", err)
+	}
+	if got := strings.Join(blockers, ","); got != "inet firewalld filter_FORWARD" {
+		t.Errorf("iptables blockers = %q", got)
+	}
+
+	// Ланцюжки ip6 не стосуються інтерфейсу без IPv6 мереж
+	rules.Networks = rules.Networks[:1]
+	if got := forwardBlockers(rules, chains); len(got) != 2 {
+		t.Errorf("IPv4-only blockers = %q, want 2 chains", got)
+	}
+}
@@ -0,0 +1,233 @@
+package egress
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// runFunc виконує команду і повертає її об'єднаний вивід stdout/stderr
+type runFunc func(name string, args ...string) (string, error)
+
+// runCommand запускає команду і збирає її вивід
+func runCommand(name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+	return strings.TrimSpace(output.String()), err
+}
+
+// Iptables керує правилами через утиліти iptables та ip6tables.
+// Правила позначаються коментарем wg-orbit:<інтерфейс>.
+type Iptables struct {
+	run runFunc
+	// forwardChains повертає ланцюжки nftables з політикою drop на хуку
+	// forward; nil - не перевіряти
+	forwardChains func() ([]string, error)
+}
+
+// NewIptables створює backend на основі iptables
+func NewIptables() *Iptables {
+	return &Iptables{run: runCommand, forwardChains: forwardDropChains}
+}
+
+// iptablesRule - одне правило iptables без дії (-A/-I/-C/-D)
+type iptablesRule struct {
+	command string // iptables або ip6tables
+	table   string
+	chain   string
+	insert  bool // вставити на початок ланцюжка, а не в кінець
+	spec    []string
+}
+
+// Name повертає назву backend'у
+func (f *Iptables) Name() string {
+	return BackendIptables
+}
+
+// Available перевіряє, що iptables встановлено і таблиця nat доступна
+func (f *Iptables) Available() error {
+	output, err := f.run("iptables", "-w", "-t", "nat", "-S", "POSTROUTING")
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return ErrNotSupported
+		}
+		return fmt.Errorf("iptables: %w: %s", err, output)
+	}
+	return nil
+}
+
+// Apply додає відсутні правила
+func (f *Iptables) Apply(rules Rules) error {
+	for _, rule := range iptablesRules(rules) {
+		if f.exists(rule) {
+			continue
+		}
+
+		action := "-A"
+		if rule.insert {
+			action = "-I"
+		}
+		if output, err := f.run(rule.command, rule.args(action)...); err != nil {
+			return fmt.Errorf("%s %s: %w: %s", rule.command, strings.Join(rule.args(action), " "), err, output)
+		}
+	}
+	return nil
+}
+
+// Remove видаляє всі правила з коментарем wg-orbit для інтерфейсу.
+// Правила шукаються за коментарем, тому видаляються і ті, що були
+// встановлені з іншим uplink або мережами.
+func (f *Iptables) Remove(rules Rules) error {
+	for _, command := range []string{"iptables", "ip6tables"} {
+		for _, chain := range iptablesChains {
+			tagged, err := f.tagged(command, chain.table, chain.name, rules.tag())
+			if errors.Is(err, exec.ErrNotFound) && command == "ip6tables" {
+				// Система без ip6tables не може мати IPv6 правил
+				break
+			}
+			if err != nil {
+				return err
+			}
+
+			for _, fields := range tagged {
+				// Рядок -S має вигляд "-A CHAIN spec..."
+				args := append([]string{"-w", "-t", chain.table, "-D"}, fields[1:]...)
+				if output, err := f.run(command, args...); err != nil {
+					return fmt.Errorf("%s %s: %w: %s", command, strings.Join(args, " "), err, output)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Installed повертає правила з коментарем wg-orbit для інтерфейсу
+func (f *Iptables) Installed(rules Rules) ([]string, error) {
+	commands := []string{"iptables"}
+	if rules.hasIPv6() {
+		commands = append(commands, "ip6tables")
+	}
+
+	var installed []string
+	for _, command := range commands {
+		for _, chain := range iptablesChains {
+			tagged, err := f.tagged(command, chain.table, chain.name, rules.tag())
+			if err != nil {
+				return nil, err
+			}
+			for _, fields := range tagged {
+				installed = append(installed, command+" -t "+chain.table+" "+strings.Join(fields, " "))
+			}
+		}
+	}
+	return installed, nil
+}
+
+// Blockers повертає ланцюжки nftables інших таблиць з політикою drop на
+// хуку forward. Ланцюжок FORWARD самого iptables не заважає: правила
+// вставляються на його початок.
+func (f *Iptables) Blockers(rules Rules) ([]string, error) {
+	if f.forwardChains == nil {
+		return nil, nil
+	}
+	chains, err := f.forwardChains()
+	if err != nil {
+		return nil, err
+	}
+	return forwardBlockers(rules, chains, "ip filter FORWARD", "ip6 filter FORWARD"), nil
+}
+
+// iptablesForwardDrops повертає ланцюжки FORWARD iptables і ip6tables з
+// політикою DROP у форматі "сімейство таблиця ланцюжок". Так видно і
+// iptables-legacy, правил якого nftables не показує. Недоступні утиліти
+// пропускаються.
+func iptablesForwardDrops(run runFunc) []string {
+	var result []string
+	for _, command := range []struct{ name, family string }{{"iptables", "ip"}, {"ip6tables", "ip6"}} {
+		output, err := run(command.name, "-w", "-t", "filter", "-S", "FORWARD")
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(output, "\n") {
+			if strings.TrimSpace(line) == "-P FORWARD DROP" {
+				result = append(result, command.family+" filter FORWARD")
+			}
+		}
+	}
+	return result
+}
+
+// iptablesChains - ланцюжки, в які wg-orbit додає правила
+var iptablesChains = []struct{ table, name string }{{"filter", "FORWARD"}, {"nat", "POSTROUTING"}}
+
+// tagged повертає поля правил ланцюжка, позначених коментарем tag
+func (f *Iptables) tagged(command, table, chain, tag string) ([][]string, error) {
+	output, err := f.run(command, "-w", "-t", table, "-S", chain)
+	if err != nil {
+		return nil, fmt.Errorf("%s -t %s -S %s: %w: %s", command, table, chain, err, output)
+	}
+
+	var result [][]string
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		for i := 0; i+1 < len(fields); i++ {
+			if fields[i] == "--comment" && strings.Trim(fields[i+1], `"`) == tag {
+				result = append(result, fields)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// exists перевіряє наявність правила через -C
+func (f *Iptables) exists(rule iptablesRule) bool {
+	_, err := f.run(rule.command, rule.args("-C")...)
+	return err == nil
+}
+
+// args формує аргументи команди для дії action
+func (r iptablesRule) args(action string) []string {
+	args := []string{"-w", "-t", r.table, action, r.chain}
+	return append(args, r.spec...)
+}
+
+// iptablesRules повертає правила egress для iptables та ip6tables
+func iptablesRules(rules Rules) []iptablesRule {
+	comment := []string{"-m", "comment", "--comment", rules.tag()}
+
+	commands := []string{"iptables"}
+	if rules.hasIPv6() {
+		commands = append(commands, "ip6tables")
+	}
+
+	var result []iptablesRule
+	for _, command := range commands {
+		// Правила FORWARD вставляються на початок, щоб випередити DROP інших систем
+		result = append(result,
+			iptablesRule{command: command, table: "filter", chain: "FORWARD", insert: true,
+				spec: append([]string{"-i", rules.Interface, "-o", rules.Uplink}, append(comment, "-j", "ACCEPT")...)},
+			iptablesRule{command: command, table: "filter", chain: "FORWARD", insert: true,
+				spec: append([]string{"-i", rules.Uplink, "-o", rules.Interface,
+					"-m", "conntrack", "--ctstate", "RELATED,ESTABLISHED"}, append(comment, "-j", "ACCEPT")...)},
+		)
+	}
+
+	for _, network := range rules.Networks {
+		command := "iptables"
+		if network.IP.To4() == nil {
+			command = "ip6tables"
+		}
+		result = append(result, iptablesRule{command: command, table: "nat", chain: "POSTROUTING",
+			spec: append([]string{"-s", network.String(), "-o", rules.Uplink}, append(comment, "-j", "MASQUERADE")...)})
+	}
+
+	return result
+}
@@ -0,0 +1,309 @@
+//go:build linux
+
+package egress
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/google/nftables"
+	"github.com/google/nftables/binaryutil"
+	"github.com/google/nftables/expr"
+	"github.com/google/nftables/userdata"
+	"golang.org/x/sys/unix"
+)
+
+// Nftables керує правилами через netlink API nftables. Усі правила
+// інтерфейсу живуть в окремій таблиці inet wg_orbit_<інтерфейс>,
+// тому встановлюються і видаляються однією атомарною транзакцією.
+type Nftables struct{}
+
+// NewNftables створює backend на основі nftables
+func NewNftables() *Nftables {
+	return &Nftables{}
+}
+
+// newNftables створює nftables backend для New
+func newNftables() (Firewall, error) {
+	return NewNftables(), nil
+}
+
+// Name повертає назву backend'у
+func (f *Nftables) Name() string {
+	return BackendNftables
+}
+
+// Available перевіряє, що ядро підтримує nftables
+func (f *Nftables) Available() error {
+	conn, err := nftables.New()
+	if err != nil {
+		return err
+	}
+
+	if _, err := conn.ListTables(); err != nil {
+		if errors.Is(err, unix.EPROTONOSUPPORT) || errors.Is(err, os.ErrNotExist) {
+			return ErrNotSupported
+		}
+		return err
+	}
+	return nil
+}
+
+// Apply замінює таблицю інтерфейсу новою в одній транзакції
+func (f *Nftables) Apply(rules Rules) error {
+	conn, err := nftables.New()
+	if err != nil {
+		return err
+	}
+
+	// Додавання перед видаленням робить видалення безпечним, якщо таблиці ще немає
+	table := nftablesTable(rules)
+	conn.AddTable(table)
+	conn.DelTable(table)
+	conn.AddTable(table)
+
+	forward := conn.AddChain(&nftables.Chain{
+		Name:     "forward",
+		Table:    table,
+		Type:     nftables.ChainTypeFilter,
+		Hooknum:  nftables.ChainHookForward,
+		Priority: nftables.ChainPriorityFilter,
+	})
+	postrouting := conn.AddChain(&nftables.Chain{
+		Name:     "postrouting",
+		Table:    table,
+		Type:     nftables.ChainTypeNAT,
+		Hooknum:  nftables.ChainHookPostrouting,
+		Priority: nftables.ChainPriorityNATSource,
+	})
+
+	for _, rule := range nftablesRules(rules) {
+		chain := forward
+		if rule.chain == postrouting.Name {
+			chain = postrouting
+		}
+		conn.AddRule(&nftables.Rule{
+			Table:    table,
+			Chain:    chain,
+			Exprs:    rule.exprs,
+			UserData: userdata.AppendString(nil, userdata.TypeComment, rule.comment),
+		})
+	}
+
+	return conn.Flush()
+}
+
+// Remove видаляє таблицю інтерфейсу, якщо вона існує
+func (f *Nftables) Remove(rules Rules) error {
+	conn, err := nftables.New()
+	if err != nil {
+		return err
+	}
+
+	table := nftablesTable(rules)
+	conn.AddTable(table)
+	conn.DelTable(table)
+	return conn.Flush()
+}
+
+// Installed повертає коментарі правил з таблиці інтерфейсу
+func (f *Nftables) Installed(rules Rules) ([]string, error) {
+	conn, err := nftables.New()
+	if err != nil {
+		return nil, err
+	}
+
+	table, err := conn.ListTableOfFamily(nftablesTable(rules).Name, nftables.TableFamilyINet)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, unix.ENOENT) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	chains, err := conn.ListChainsOfTableFamily(nftables.TableFamilyINet)
+	if err != nil {
+		return nil, err
+	}
+
+	var installed []string
+	for _, chain := range chains {
+		if chain.Table.Name != table.Name {
+			continue
+		}
+
+		nftRules, err := conn.GetRules(table, chain)
+		if err != nil {
+			return nil, err
+		}
+		for _, rule := range nftRules {
+			comment, _ := userdata.GetString(rule.UserData, userdata.TypeComment)
+			installed = append(installed, fmt.Sprintf("inet %s %s: %s", table.Name, chain.Name, comment))
+		}
+	}
+	return installed, nil
+}
+
+// Blockers повертає base chain'и інших таблиць з політикою drop на хуку
+// forward, включно з ланцюжками FORWARD iptables-legacy. Accept у таблиці
+// wg-orbit не скасовує drop іншого ланцюжка на тому ж хуку.
+func (f *Nftables) Blockers(rules Rules) ([]string, error) {
+	chains, err := forwardDropChains()
+	if err != nil {
+		return nil, err
+	}
+	chains = append(chains, iptablesForwardDrops(runCommand)...)
+	return forwardBlockers(rules, chains, "inet "+nftablesTable(rules).Name+" "), nil
+}
+
+// forwardDropChains повертає base chain'и хука forward з політикою drop
+// у форматі "сімейство таблиця ланцюжок"
+func forwardDropChains() ([]string, error) {
+	conn, err := nftables.New()
+	if err != nil {
+		return nil, err
+	}
+	chains, err := conn.ListChains()
+	if err != nil {
+		return nil, err
+	}
+
+	families := map[nftables.TableFamily]string{
+		nftables.TableFamilyIPv4: "ip",
+		nftables.TableFamilyIPv6: "ip6",
+		nftables.TableFamilyINet: "inet",
+	}
+	var result []string
+	for _, chain := range chains {
+		family, ok := families[chain.Table.Family]
+		if !ok || chain.Hooknum == nil || *chain.Hooknum != *nftables.ChainHookForward ||
+			chain.Policy == nil || *chain.Policy != nftables.ChainPolicyDrop {
+			continue
+		}
+		result = append(result, fmt.Sprintf("%s %s %s", family, chain.Table.Name, chain.Name))
+	}
+	return result, nil
+}
+
+// nftablesTable повертає таблицю правил інтерфейсу
+func nftablesTable(rules Rules) *nftables.Table {
+	return &nftables.Table{Name: TableName(rules.Interface), Family: nftables.TableFamilyINet}
+}
+
+// nftablesRule - правило ланцюжка з коментарем у синтаксисі nft
+type nftablesRule struct {
+	chain   string
+	comment string
+	exprs   []expr.Any
+}
+
+// nftablesRules повертає правила egress для таблиці інтерфейсу
+func nftablesRules(rules Rules) []nftablesRule {
+	result := []nftablesRule{
+		{
+			chain:   "forward",
+			comment: fmt.Sprintf("iifname %q oifname %q accept", rules.Interface, rules.Uplink),
+			exprs: concat(
+				matchInterface(expr.MetaKeyIIFNAME, rules.Interface),
+				matchInterface(expr.MetaKeyOIFNAME, rules.Uplink),
+				[]expr.Any{&expr.Verdict{Kind: expr.VerdictAccept}},
+			),
+		},
+		{
+			chain:   "forward",
+			comment: fmt.Sprintf("iifname %q oifname %q ct state established,related accept", rules.Uplink, rules.Interface),
+			exprs: concat(
+				matchInterface(expr.MetaKeyIIFNAME, rules.Uplink),
+				matchInterface(expr.MetaKeyOIFNAME, rules.Interface),
+				matchEstablished(),
+				[]expr.Any{&expr.Verdict{Kind: expr.VerdictAccept}},
+			),
+		},
+	}
+
+	for _, network := range rules.Networks {
+		family := "ip"
+		if network.IP.To4() == nil {
+			family = "ip6"
+		}
+		result = append(result, nftablesRule{
+			chain:   "postrouting",
+			comment: fmt.Sprintf("%s saddr %s oifname %q masquerade", family, network, rules.Uplink),
+			exprs: concat(
+				matchSource(network),
+				matchInterface(expr.MetaKeyOIFNAME, rules.Uplink),
+				[]expr.Any{&expr.Masq{}},
+			),
+		})
+	}
+
+	return result
+}
+
+// matchInterface порівнює назву вхідного або вихідного інтерфейсу
+func matchInterface(key expr.MetaKey, name string) []expr.Any {
+	return []expr.Any{
+		&expr.Meta{Key: key, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: interfaceName(name)},
+	}
+}
+
+// matchEstablished пропускає лише пакети встановлених з'єднань
+func matchEstablished() []expr.Any {
+	return []expr.Any{
+		&expr.Ct{Register: 1, Key: expr.CtKeySTATE},
+		&expr.Bitwise{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Len:            4,
+			Mask:           binaryutil.NativeEndian.PutUint32(expr.CtStateBitESTABLISHED | expr.CtStateBitRELATED),
+			Xor:            binaryutil.NativeEndian.PutUint32(0),
+		},
+		&expr.Cmp{Op: expr.CmpOpNeq, Register: 1, Data: binaryutil.NativeEndian.PutUint32(0)},
+	}
+}
+
+// matchSource порівнює адресу відправника з мережею
+func matchSource(network *net.IPNet) []expr.Any {
+	proto, offset, ip := byte(unix.NFPROTO_IPV4), uint32(12), network.IP.To4()
+	if ip == nil {
+		proto, offset, ip = unix.NFPROTO_IPV6, 8, network.IP.To16()
+	}
+
+	return []expr.Any{
+		&expr.Meta{Key: expr.MetaKeyNFPROTO, Register: 1},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: []byte{proto}},
+		&expr.Payload{
+			DestRegister: 1,
+			Base:         expr.PayloadBaseNetworkHeader,
+			Offset:       offset,
+			Len:          uint32(len(ip)),
+		},
+		&expr.Bitwise{
+			SourceRegister: 1,
+			DestRegister:   1,
+			Len:            uint32(len(ip)),
+			Mask:           network.Mask,
+			Xor:            make([]byte, len(ip)),
+		},
+		&expr.Cmp{Op: expr.CmpOpEq, Register: 1, Data: ip.Mask(network.Mask)},
+	}
+}
+
+// interfaceName доповнює назву інтерфейсу нулями до IFNAMSIZ
+func interfaceName(name string) []byte {
+	data := make([]byte, unix.IFNAMSIZ)
+	copy(data, name)
+	return data
+}
+
+// concat об'єднує послідовності виразів
+func concat(parts ...[]expr.Any) []expr.Any {
+	var result []expr.Any
+	for _, part := range parts {
+		result = append(result, part...)
+	}
+	return result
+}
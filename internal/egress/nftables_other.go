@@ -0,0 +1,15 @@
+//go:build !linux
+
+package egress
+
+import "fmt"
+
+// newNftables повертає ErrNotSupported: nftables доступний лише в Linux
+func newNftables() (Firewall, error) {
+	return nil, fmt.Errorf("nftables backend: %w", ErrNotSupported)
+}
+
+// forwardDropChains нічого не повертає: nftables доступний лише в Linux
+func forwardDropChains() ([]string, error) {
+	return nil, nil
+}
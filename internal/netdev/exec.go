@@ -0,0 +1,271 @@
+package netdev
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// runFunc виконує команду і повертає її об'єднаний вивід stdout/stderr
+type runFunc func(stdin string, name string, args ...string) (string, error)
+
+// ExecBackend керує інтерфейсами через утиліти ip, wg та modprobe
+type ExecBackend struct {
+	run runFunc
+}
+
+// NewExecBackend створює backend на основі зовнішніх команд
+func NewExecBackend() *ExecBackend {
+	return &ExecBackend{run: runCommand}
+}
+
+// runCommand запускає команду, передаючи stdin, і збирає її вивід
+func runCommand(stdin string, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := cmd.Run()
+	return strings.TrimSpace(output.String()), err
+}
+
+// Name повертає назву backend'у
+func (b *ExecBackend) Name() string {
+	return BackendExec
+}
+
+// Available перевіряє наявність модуля wireguard, за потреби завантажуючи його.
+// Модуль, вбудований у ядро, також відображається в /sys/module.
+func (b *ExecBackend) Available() error {
+	if wireGuardModuleLoaded() {
+		return nil
+	}
+
+	output, err := b.run("", "modprobe", "wireguard")
+	if err != nil || !wireGuardModuleLoaded() {
+		return &Error{Op: "load module", Link: "wireguard", Err: ErrNotSupported, Output: output}
+	}
+
+	return nil
+}
+
+// wireGuardModuleLoaded перевіряє, чи завантажений модуль wireguard
+func wireGuardModuleLoaded() bool {
+	_, err := os.Stat("/sys/module/wireguard")
+	return err == nil
+}
+
+// LinkExists перевіряє, чи існує інтерфейс
+func (b *ExecBackend) LinkExists(name string) (bool, error) {
+	output, err := b.run("", "ip", "link", "show", "dev", name)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(classifyOutput(output, err), ErrLinkNotFound) {
+		return false, nil
+	}
+	return false, &Error{Op: "show link", Link: name, Err: err, Output: output}
+}
+
+// CreateLink створює WireGuard інтерфейс
+func (b *ExecBackend) CreateLink(name string) error {
+	return b.exec("create link", name, "", "ip", "link", "add", "dev", name, "type", "wireguard")
+}
+
+// DeleteLink видаляє інтерфейс
+func (b *ExecBackend) DeleteLink(name string) error {
+	return b.exec("delete link", name, "", "ip", "link", "del", "dev", name)
+}
+
+// AddAddress призначає інтерфейсу адресу
+func (b *ExecBackend) AddAddress(name, cidr string) error {
+	err := b.exec("add address "+cidr, name, "", "ip", "addr", "add", cidr, "dev", name)
+
+	// "File exists" для ip addr add означає вже призначену адресу
+	var netErr *Error
+	if errors.As(err, &netErr) && errors.Is(netErr.Err, ErrLinkExists) {
+		netErr.Err = ErrAddressExists
+	}
+	return err
+}
+
+// DeleteAddress знімає з інтерфейсу адресу
+func (b *ExecBackend) DeleteAddress(name, cidr string) error {
+	return b.exec("delete address "+cidr, name, "", "ip", "addr", "del", cidr, "dev", name)
+}
+
+// SetLinkUp піднімає інтерфейс
+func (b *ExecBackend) SetLinkUp(name string) error {
+	return b.exec("set link up", name, "", "ip", "link", "set", "up", "dev", name)
+}
+
+// SetMTU встановлює MTU інтерфейсу
+func (b *ExecBackend) SetMTU(name string, mtu int) error {
+	return b.exec("set mtu", name, "", "ip", "link", "set", "dev", name, "mtu", strconv.Itoa(mtu))
+}
+
+// AddRoute додає або замінює маршрут через інтерфейс
+func (b *ExecBackend) AddRoute(name, cidr string, table int) error {
+	return b.exec("add route "+cidr, name, "", "ip", "route", "replace", cidr, "dev", name, "table", strconv.Itoa(table))
+}
+
+// ConfigureDevice встановлює приватний ключ, порт і fwmark через wg set
+func (b *ExecBackend) ConfigureDevice(name string, cfg DeviceConfig) error {
+	if cfg.PrivateKey != "" {
+		err := b.exec("set private key", name, cfg.PrivateKey, "wg", "set", name, "private-key", "/dev/stdin")
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.ListenPort != 0 {
+		err := b.exec("set listen port", name, "", "wg", "set", name, "listen-port", strconv.Itoa(cfg.ListenPort))
+		if err != nil {
+			return err
+		}
+	}
+
+	if cfg.FwMark != 0 {
+		err := b.exec("set fwmark", name, "", "wg", "set", name, "fwmark", strconv.Itoa(cfg.FwMark))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Peers розбирає вивід wg show <name> dump
+func (b *ExecBackend) Peers(name string) ([]Peer, error) {
+	output, err := b.run("", "wg", "show", name, "dump")
+	if err != nil {
+		return nil, &Error{Op: "show peers", Link: name, Err: classifyOutput(output, err), Output: output}
+	}
+
+	peers, err := parseDump(output)
+	if err != nil {
+		return nil, &Error{Op: "show peers", Link: name, Err: err}
+	}
+	return peers, nil
+}
+
+// parseDump розбирає формат wg show dump: перший рядок описує інтерфейс,
+// кожен наступний - peer'а, поля розділені табуляцією
+func parseDump(output string) ([]Peer, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) <= 1 {
+		return nil, nil
+	}
+
+	var peers []Peer
+	for _, line := range lines[1:] {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 8 {
+			return nil, fmt.Errorf("unexpected wg dump line: %q", line)
+		}
+
+		peer := Peer{
+			PublicKey:    fields[0],
+			PresharedKey: dumpValue(fields[1]),
+			Endpoint:     dumpValue(fields[2]),
+		}
+		if allowed := dumpValue(fields[3]); allowed != "" {
+			peer.AllowedIPs = strings.Split(allowed, ",")
+		}
+
+		handshake, err := strconv.ParseInt(fields[4], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid latest handshake %q: %w", fields[4], err)
+		}
+		if handshake > 0 {
+			peer.LastHandshake = time.Unix(handshake, 0)
+		}
+		if peer.ReceiveBytes, err = strconv.ParseInt(fields[5], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid transfer rx %q: %w", fields[5], err)
+		}
+		if peer.TransmitBytes, err = strconv.ParseInt(fields[6], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid transfer tx %q: %w", fields[6], err)
+		}
+
+		peers = append(peers, peer)
+	}
+
+	return peers, nil
+}
+
+// dumpValue перетворює "(none)" з wg dump на порожній рядок
+func dumpValue(value string) string {
+	if value == "(none)" {
+		return ""
+	}
+	return value
+}
+
+// ConfigurePeers застосовує зміни peer'ів командами wg set.
+// Preshared key передається через stdin, тому кожен peer налаштовується окремо.
+func (b *ExecBackend) ConfigurePeers(name string, peers []PeerConfig) error {
+	for _, peer := range peers {
+		op := "configure peer " + peer.PublicKey
+
+		if peer.Remove {
+			if err := b.exec(op, name, "", "wg", "set", name, "peer", peer.PublicKey, "remove"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		pskFile := "/dev/null"
+		if peer.PresharedKey != "" {
+			pskFile = "/dev/stdin"
+		}
+		err := b.exec(op, name, peer.PresharedKey, "wg", "set", name, "peer", peer.PublicKey,
+			"preshared-key", pskFile, "allowed-ips", strings.Join(peer.AllowedIPs, ","))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Close нічого не робить: exec backend не тримає ресурсів
+func (b *ExecBackend) Close() error {
+	return nil
+}
+
+// exec виконує команду і перетворює помилку на *Error
+func (b *ExecBackend) exec(op, link, stdin string, name string, args ...string) error {
+	output, err := b.run(stdin, name, args...)
+	if err != nil {
+		return &Error{Op: op, Link: link, Err: classifyOutput(output, err), Output: output}
+	}
+	return nil
+}
+
+// classifyOutput визначає відому причину помилки за виводом ip/wg.
+// "File exists" трактується як ErrLinkExists; AddAddress уточнює його сам.
+func classifyOutput(output string, err error) error {
+	switch {
+	case strings.Contains(output, "Unknown device type"),
+		strings.Contains(output, "Operation not supported"):
+		return ErrNotSupported
+	case strings.Contains(output, "Cannot find device"),
+		strings.Contains(output, "does not exist"),
+		strings.Contains(output, "No such device"):
+		return ErrLinkNotFound
+	case strings.Contains(output, "File exists"):
+		return ErrLinkExists
+	default:
+		return err
+	}
+}
@@ -0,0 +1,121 @@
+package netdev
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// stubRunner повертає заданий вивід для команд з певним префіксом
+// і записує всі виконані команди
+type stubRunner struct {
+	failures map[string]string
+	commands []string
+	stdin    []string
+}
+
+func (r *stubRunner) run(stdin string, name string, args ...string) (string, error) {
+	cmd := strings.Join(append([]string{name}, args...), " ")
+	r.commands = append(r.commands, cmd)
+	r.stdin = append(r.stdin, stdin)
+
+	for prefix, output := range r.failures {
+		if strings.HasPrefix(cmd, prefix) {
+			return output, errors.New("exit status 2")
+		}
+	}
+	return "", nil
+}
+
+func TestExecBackend_Commands(t *testing.T) {
+	runner := &stubRunner{}
+	backend := &ExecBackend{run: runner.run}
+
+	if err := backend.CreateLink("wg0"); err != nil {
+		t.Fatalf("CreateLink() error: %v", err)
+	}
+	err := backend.ConfigureDevice("wg0", DeviceConfig{PrivateKey: "private", ListenPort: 51820, FwMark: 51820})
+	if err != nil {
+		t.Fatalf("ConfigureDevice() error: %v", err)
+	}
+	if err := backend.SetMTU("wg0", 1380); err != nil {
+		t.Fatalf("SetMTU() error: %v", err)
+	}
+	if err := backend.AddRoute("wg0", "10.0.0.0/24", 1234); err != nil {
+		t.Fatalf("AddRoute() error: %v", err)
+	}
+	if err := backend.DeleteAddress("wg0", "10.0.0.1/24"); err != nil {
+		t.Fatalf("DeleteAddress() error: %v", err)
+	}
+
+	want := []string{
+		"ip link add dev wg0 type wireguard",
+		"wg set wg0 private-key /dev/stdin",
+		"wg set wg0 listen-port 51820",
+		"wg set wg0 fwmark 51820",
+		"ip link set dev wg0 mtu 1380",
+		"ip route replace 10.0.0.0/24 dev wg0 table 1234",
+		"ip addr del 10.0.0.1/24 dev wg0",
+	}
+	if strings.Join(runner.commands, "\n") != strings.Join(want, "\n") {
+		t.Errorf("commands = %q, want %q", runner.commands, want)
+	}
+	if runner.stdin[1] != "private" {
+		t.Errorf("private key must be passed via stdin, got %q", runner.stdin[1])
+	}
+}
+
+func TestExecBackend_StructuredErrors(t *testing.T) {
+	backend := &ExecBackend{run: (&stubRunner{failures: map[string]string{
+		"ip link add":  "RTNETLINK answers: File exists",
+		"ip addr add":  "RTNETLINK answers: File exists",
+		"ip link show": `Device "wg0" does not exist.`,
+		"ip link set":  `Cannot find device "wg0"`,
+	}}).run}
+
+	err := backend.CreateLink("wg0")
+	var netErr *Error
+	if !errors.As(err, &netErr) || !errors.Is(err, ErrLinkExists) || netErr.Output == "" {
+		t.Errorf("CreateLink() error = %v, want *Error wrapping ErrLinkExists", err)
+	}
+
+	if err := backend.AddAddress("wg0", "10.0.0.1/24"); !errors.Is(err, ErrAddressExists) {
+		t.Errorf("AddAddress() error = %v, want ErrAddressExists", err)
+	}
+
+	if err := backend.SetLinkUp("wg0"); !errors.Is(err, ErrLinkNotFound) {
+		t.Errorf("SetLinkUp() error = %v, want ErrLinkNotFound", err)
+	}
+
+	exists, err := backend.LinkExists("wg0")
+	if err != nil || exists {
+		t.Errorf("LinkExists() = %v, %v, want false, nil", exists, err)
+	}
+}
+
+func TestParseDump(t *testing.T) {
+	output := "cHJpdmF0ZQ==\tcHVibGlj\t51820\toff\n" +
+		"peerA=\t(none)\t203.0.113.5:51820\t10.0.0.2/32,fd00:77::2/128\t1700000000\t1024\t2048\toff\n" +
+		"peerB=\tpsk=\t(none)\t(none)\t0\t0\t0\t25\n"
+
+	peers, err := parseDump(output)
+	if err != nil {
+		t.Fatalf("parseDump() error: %v", err)
+	}
+	if len(peers) != 2 {
+		t.Fatalf("parseDump() returned %d peers, want 2", len(peers))
+	}
+
+	a := peers[0]
+	if a.PublicKey != "peerA=" || a.PresharedKey != "" || a.Endpoint != "203.0.113.5:51820" {
+		t.Errorf("peer A = %+v", a)
+	}
+	if len(a.AllowedIPs) != 2 || a.LastHandshake.Unix() != 1700000000 || a.ReceiveBytes != 1024 || a.TransmitBytes != 2048 {
+		t.Errorf("peer A = %+v", a)
+	}
+
+	b := peers[1]
+	if b.PresharedKey != "psk=" || b.Endpoint != "" || len(b.AllowedIPs) != 0 || !b.LastHandshake.IsZero() {
+		t.Errorf("peer B = %+v", b)
+	}
+}
@@ -0,0 +1,134 @@
+// Package netdev керує мережевими пристроями WireGuard.
+//
+// Backend приховує спосіб взаємодії з ядром: netlink backend працює через
+// rtnetlink та generic netlink API WireGuard напряму, exec backend викликає
+// утиліти ip, wg та modprobe і використовується як запасний варіант.
+// Userspace backend запускає wireguard-go з TUN пристроєм у процесі
+// сервера і не потребує модуля ядра.
+package netdev
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrNotSupported повертається, коли WireGuard недоступний у системі
+	ErrNotSupported = errors.New("wireguard is not supported on this host")
+	// ErrLinkExists повертається при спробі створити існуючий інтерфейс
+	ErrLinkExists = errors.New("link already exists")
+	// ErrLinkNotFound повертається, коли інтерфейс не знайдено
+	ErrLinkNotFound = errors.New("link not found")
+	// ErrAddressExists повертається, коли адреса вже призначена інтерфейсу
+	ErrAddressExists = errors.New("address already assigned")
+)
+
+// Backend керує WireGuard інтерфейсами
+type Backend interface {
+	// Name повертає назву backend'у для логів
+	Name() string
+	// Available перевіряє, чи може backend створювати WireGuard інтерфейси
+	Available() error
+	// LinkExists перевіряє, чи існує інтерфейс
+	LinkExists(name string) (bool, error)
+	// CreateLink створює WireGuard інтерфейс
+	CreateLink(name string) error
+	// DeleteLink видаляє інтерфейс
+	DeleteLink(name string) error
+	// AddAddress призначає інтерфейсу адресу у форматі CIDR
+	AddAddress(name, cidr string) error
+	// DeleteAddress знімає з інтерфейсу адресу у форматі CIDR
+	DeleteAddress(name, cidr string) error
+	// SetLinkUp піднімає інтерфейс
+	SetLinkUp(name string) error
+	// SetMTU встановлює MTU інтерфейсу
+	SetMTU(name string, mtu int) error
+	// AddRoute додає або замінює маршрут до мережі cidr через інтерфейс у таблиці table
+	AddRoute(name, cidr string, table int) error
+	// ConfigureDevice встановлює параметри WireGuard пристрою
+	ConfigureDevice(name string, cfg DeviceConfig) error
+	// Peers повертає поточних peer'ів пристрою
+	Peers(name string) ([]Peer, error)
+	// ConfigurePeers додає, оновлює або видаляє peer'ів пристрою
+	ConfigurePeers(name string, peers []PeerConfig) error
+	// Close звільняє ресурси backend'у
+	Close() error
+}
+
+// DeviceConfig описує параметри WireGuard пристрою
+type DeviceConfig struct {
+	PrivateKey string // приватний ключ у base64
+	ListenPort int    // 0 - не змінювати
+	FwMark     int    // 0 - не змінювати
+}
+
+// Peer описує peer'а, налаштованого на пристрої
+type Peer struct {
+	PublicKey     string
+	PresharedKey  string // порожній, якщо не встановлено
+	Endpoint      string
+	AllowedIPs    []string
+	LastHandshake time.Time // нульовий, якщо handshake не було
+	ReceiveBytes  int64
+	TransmitBytes int64
+}
+
+// PeerConfig описує зміну peer'а на пристрої.
+// AllowedIPs повністю замінюють поточний список peer'а.
+type PeerConfig struct {
+	PublicKey    string
+	PresharedKey string // порожній - видалити preshared key
+	AllowedIPs   []string
+	Remove       bool // видалити peer'а з пристрою
+}
+
+// Error описує помилку операції над інтерфейсом
+type Error struct {
+	Op     string // операція, напр. "create link"
+	Link   string // назва інтерфейсу
+	Err    error  // причина, часто одна з Err* змінних пакету
+	Output string // вивід команди для exec backend'у
+}
+
+// Error реалізує інтерфейс error
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s %s: %v", e.Op, e.Link, e.Err)
+	if e.Output != "" {
+		msg += ": " + e.Output
+	}
+	return msg
+}
+
+// Unwrap повертає причину помилки
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Типи backend'ів
+const (
+	BackendAuto      = "auto"
+	BackendNetlink   = "netlink"
+	BackendExec      = "exec"
+	BackendUserspace = "userspace"
+)
+
+// New створює backend вказаного типу. Для "auto" або порожнього значення
+// використовується netlink, якщо він доступний, інакше exec.
+func New(kind string) (Backend, error) {
+	switch kind {
+	case "", BackendAuto:
+		if backend, err := newNetlinkBackend(); err == nil {
+			return backend, nil
+		}
+		return NewExecBackend(), nil
+	case BackendNetlink:
+		return newNetlinkBackend()
+	case BackendExec:
+		return NewExecBackend(), nil
+	case BackendUserspace:
+		return newUserspaceBackend()
+	default:
+		return nil, fmt.Errorf("unknown network backend: %s", kind)
+	}
+}
@@ -0,0 +1,250 @@
+//go:build linux
+
+package netdev
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/mdlayher/genetlink"
+	mdnetlink "github.com/mdlayher/netlink"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// NetlinkBackend керує інтерфейсами через rtnetlink та generic netlink API WireGuard
+type NetlinkBackend struct {
+	mu     sync.Mutex
+	conn   *genetlink.Conn
+	family *genetlink.Family // nil, поки family "wireguard" не знайдено
+}
+
+// NewNetlinkBackend відкриває generic netlink сокет
+func NewNetlinkBackend() (*NetlinkBackend, error) {
+	conn, err := genetlink.Dial(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open generic netlink socket: %w", err)
+	}
+
+	return &NetlinkBackend{conn: conn}, nil
+}
+
+// newNetlinkBackend створює netlink backend для New
+func newNetlinkBackend() (Backend, error) {
+	backend, err := NewNetlinkBackend()
+	if err != nil {
+		return nil, err
+	}
+	return backend, nil
+}
+
+// Name повертає назву backend'у
+func (b *NetlinkBackend) Name() string {
+	return BackendNetlink
+}
+
+// Available перевіряє наявність generic netlink family WireGuard.
+// Запит family змушує ядро автоматично завантажити модуль wireguard.
+func (b *NetlinkBackend) Available() error {
+	_, err := b.wireGuardFamily()
+	return err
+}
+
+// wireGuardFamily повертає family WireGuard, запитуючи її лише один раз
+func (b *NetlinkBackend) wireGuardFamily() (*genetlink.Family, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.family != nil {
+		return b.family, nil
+	}
+
+	family, err := b.conn.GetFamily(wgGenlName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, &Error{Op: "get genetlink family", Link: wgGenlName, Err: ErrNotSupported}
+		}
+		return nil, &Error{Op: "get genetlink family", Link: wgGenlName, Err: err}
+	}
+
+	b.family = &family
+	return b.family, nil
+}
+
+// LinkExists перевіряє, чи існує інтерфейс
+func (b *NetlinkBackend) LinkExists(name string) (bool, error) {
+	return linkExists(name)
+}
+
+// CreateLink створює WireGuard інтерфейс
+func (b *NetlinkBackend) CreateLink(name string) error {
+	link := &netlink.Wireguard{LinkAttrs: netlink.LinkAttrs{Name: name}}
+	if err := netlink.LinkAdd(link); err != nil {
+		return &Error{Op: "create link", Link: name, Err: classifyErrno(err, ErrLinkExists)}
+	}
+	return nil
+}
+
+// DeleteLink видаляє інтерфейс
+func (b *NetlinkBackend) DeleteLink(name string) error {
+	return deleteLink(name)
+}
+
+// AddAddress призначає інтерфейсу адресу
+func (b *NetlinkBackend) AddAddress(name, cidr string) error {
+	return addAddress(name, cidr)
+}
+
+// DeleteAddress знімає з інтерфейсу адресу
+func (b *NetlinkBackend) DeleteAddress(name, cidr string) error {
+	return deleteAddress(name, cidr)
+}
+
+// SetLinkUp піднімає інтерфейс
+func (b *NetlinkBackend) SetLinkUp(name string) error {
+	return setLinkUp(name)
+}
+
+// SetMTU встановлює MTU інтерфейсу
+func (b *NetlinkBackend) SetMTU(name string, mtu int) error {
+	return setMTU(name, mtu)
+}
+
+// AddRoute додає або замінює маршрут через інтерфейс
+func (b *NetlinkBackend) AddRoute(name, cidr string, table int) error {
+	return addRoute(name, cidr, table)
+}
+
+// ConfigureDevice встановлює приватний ключ, порт і fwmark командою WG_CMD_SET_DEVICE
+func (b *NetlinkBackend) ConfigureDevice(name string, cfg DeviceConfig) error {
+	family, err := b.wireGuardFamily()
+	if err != nil {
+		return err
+	}
+
+	ae := mdnetlink.NewAttributeEncoder()
+	ae.String(wgDeviceAIfname, name)
+
+	if cfg.PrivateKey != "" {
+		key, err := decodeKey(cfg.PrivateKey)
+		if err != nil {
+			return &Error{Op: "set private key", Link: name, Err: err}
+		}
+		ae.Bytes(wgDeviceAPrivateKey, key)
+	}
+	if cfg.ListenPort != 0 {
+		ae.Uint16(wgDeviceAListenPort, uint16(cfg.ListenPort))
+	}
+	if cfg.FwMark != 0 {
+		ae.Uint32(wgDeviceAFwmark, uint32(cfg.FwMark))
+	}
+
+	data, err := ae.Encode()
+	if err != nil {
+		return &Error{Op: "configure device", Link: name, Err: err}
+	}
+
+	if _, err := b.execute(family, wgCmdSetDevice, mdnetlink.Acknowledge, data); err != nil {
+		return &Error{Op: "configure device", Link: name, Err: classifyErrno(err, ErrLinkExists)}
+	}
+
+	return nil
+}
+
+// Peers повертає peer'ів пристрою командою WG_CMD_GET_DEVICE
+func (b *NetlinkBackend) Peers(name string) ([]Peer, error) {
+	family, err := b.wireGuardFamily()
+	if err != nil {
+		return nil, err
+	}
+
+	ae := mdnetlink.NewAttributeEncoder()
+	ae.String(wgDeviceAIfname, name)
+	data, err := ae.Encode()
+	if err != nil {
+		return nil, &Error{Op: "get device", Link: name, Err: err}
+	}
+
+	msgs, err := b.execute(family, wgCmdGetDevice, mdnetlink.Dump, data)
+	if err != nil {
+		return nil, &Error{Op: "get device", Link: name, Err: classifyErrno(err, ErrLinkExists)}
+	}
+
+	peers, err := decodeDevicePeers(msgs)
+	if err != nil {
+		return nil, &Error{Op: "get device", Link: name, Err: err}
+	}
+	return peers, nil
+}
+
+// ConfigurePeers застосовує зміни peer'ів. Кожен peer надсилається окремим
+// повідомленням, щоб не перевищити розмір netlink повідомлення.
+func (b *NetlinkBackend) ConfigurePeers(name string, peers []PeerConfig) error {
+	family, err := b.wireGuardFamily()
+	if err != nil {
+		return err
+	}
+
+	for _, peer := range peers {
+		op := "configure peer " + peer.PublicKey
+
+		data, err := encodePeerConfig(name, peer)
+		if err != nil {
+			return &Error{Op: op, Link: name, Err: err}
+		}
+
+		if _, err := b.execute(family, wgCmdSetDevice, mdnetlink.Acknowledge, data); err != nil {
+			return &Error{Op: op, Link: name, Err: classifyErrno(err, ErrLinkExists)}
+		}
+	}
+
+	return nil
+}
+
+// execute надсилає команду WireGuard family і повертає відповіді
+func (b *NetlinkBackend) execute(family *genetlink.Family, cmd uint8, flags mdnetlink.HeaderFlags, data []byte) ([]genetlink.Message, error) {
+	msg := genetlink.Message{
+		Header: genetlink.Header{Command: cmd, Version: family.Version},
+		Data:   data,
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.conn.Execute(msg, family.ID, mdnetlink.Request|flags)
+}
+
+// Close закриває generic netlink сокет
+func (b *NetlinkBackend) Close() error {
+	return b.conn.Close()
+}
+
+// classifyErrno перетворює errno ядра на помилки пакету.
+// exists визначає, що означає EEXIST для конкретної операції.
+func classifyErrno(err error, exists error) error {
+	switch {
+	case errors.Is(err, unix.EEXIST):
+		return exists
+	case errors.Is(err, unix.ENODEV), errors.Is(err, unix.ENOENT):
+		return ErrLinkNotFound
+	case errors.Is(err, unix.EOPNOTSUPP):
+		return ErrNotSupported
+	default:
+		return err
+	}
+}
+
+// decodeKey розбирає WireGuard ключ у base64
+func decodeKey(key string) ([]byte, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key: %w", err)
+	}
+	if len(raw) != wgKeyLen {
+		return nil, fmt.Errorf("invalid key length %d, want %d", len(raw), wgKeyLen)
+	}
+	return raw, nil
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package netdev
+
+import "fmt"
+
+// newNetlinkBackend повертає ErrNotSupported: netlink доступний лише в Linux
+func newNetlinkBackend() (Backend, error) {
+	return nil, fmt.Errorf("netlink backend: %w", ErrNotSupported)
+}
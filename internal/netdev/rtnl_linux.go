@@ -0,0 +1,140 @@
+//go:build linux
+
+package netdev
+
+import (
+	"errors"
+	"net"
+
+	"github.com/vishvananda/netlink"
+)
+
+// Операції над інтерфейсами через rtnetlink, спільні для netlink
+// та userspace backend'ів
+
+// linkExists перевіряє, чи існує інтерфейс
+func linkExists(name string) (bool, error) {
+	_, err := netlink.LinkByName(name)
+	if err == nil {
+		return true, nil
+	}
+
+	var notFound netlink.LinkNotFoundError
+	if errors.As(err, &notFound) {
+		return false, nil
+	}
+	return false, &Error{Op: "get link", Link: name, Err: err}
+}
+
+// deleteLink видаляє інтерфейс
+func deleteLink(name string) error {
+	link, err := lookupLink("delete link", name)
+	if err != nil {
+		return err
+	}
+
+	if err := netlink.LinkDel(link); err != nil {
+		return &Error{Op: "delete link", Link: name, Err: classifyErrno(err, ErrLinkExists)}
+	}
+	return nil
+}
+
+// addAddress призначає інтерфейсу адресу
+func addAddress(name, cidr string) error {
+	op := "add address " + cidr
+
+	addr, err := netlink.ParseAddr(cidr)
+	if err != nil {
+		return &Error{Op: op, Link: name, Err: err}
+	}
+
+	link, err := lookupLink(op, name)
+	if err != nil {
+		return err
+	}
+
+	if err := netlink.AddrAdd(link, addr); err != nil {
+		return &Error{Op: op, Link: name, Err: classifyErrno(err, ErrAddressExists)}
+	}
+	return nil
+}
+
+// deleteAddress знімає з інтерфейсу адресу
+func deleteAddress(name, cidr string) error {
+	op := "delete address " + cidr
+
+	addr, err := netlink.ParseAddr(cidr)
+	if err != nil {
+		return &Error{Op: op, Link: name, Err: err}
+	}
+
+	link, err := lookupLink(op, name)
+	if err != nil {
+		return err
+	}
+
+	if err := netlink.AddrDel(link, addr); err != nil {
+		return &Error{Op: op, Link: name, Err: classifyErrno(err, ErrAddressExists)}
+	}
+	return nil
+}
+
+// setLinkUp піднімає інтерфейс
+func setLinkUp(name string) error {
+	link, err := lookupLink("set link up", name)
+	if err != nil {
+		return err
+	}
+
+	if err := netlink.LinkSetUp(link); err != nil {
+		return &Error{Op: "set link up", Link: name, Err: classifyErrno(err, ErrLinkExists)}
+	}
+	return nil
+}
+
+// setMTU встановлює MTU інтерфейсу
+func setMTU(name string, mtu int) error {
+	link, err := lookupLink("set mtu", name)
+	if err != nil {
+		return err
+	}
+
+	if err := netlink.LinkSetMTU(link, mtu); err != nil {
+		return &Error{Op: "set mtu", Link: name, Err: classifyErrno(err, ErrLinkExists)}
+	}
+	return nil
+}
+
+// addRoute додає або замінює маршрут до мережі cidr у таблиці table
+func addRoute(name, cidr string, table int) error {
+	op := "add route " + cidr
+
+	_, dst, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return &Error{Op: op, Link: name, Err: err}
+	}
+
+	link, err := lookupLink(op, name)
+	if err != nil {
+		return err
+	}
+
+	route := &netlink.Route{LinkIndex: link.Attrs().Index, Dst: dst, Table: table}
+	if err := netlink.RouteReplace(route); err != nil {
+		return &Error{Op: op, Link: name, Err: classifyErrno(err, ErrAddressExists)}
+	}
+	return nil
+}
+
+// lookupLink знаходить інтерфейс за назвою
+func lookupLink(op, name string) (netlink.Link, error) {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		var notFound netlink.LinkNotFoundError
+		if errors.As(err, &notFound) {
+			return nil, &Error{Op: op, Link: name, Err: ErrLinkNotFound}
+		}
+		return nil, &Error{Op: op, Link: name, Err: err}
+	}
+	return link, nil
+}
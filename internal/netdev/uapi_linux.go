@@ -0,0 +1,166 @@
+//go:build linux
+
+package netdev
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Текстовий протокол конфігурації wireguard-go (UAPI): рядки key=value,
+// ключі кодуються в hex, параметри peer'а йдуть після його public_key.
+
+// encodeUAPIDevice кодує параметри пристрою
+func encodeUAPIDevice(cfg DeviceConfig) (string, error) {
+	var b strings.Builder
+
+	if cfg.PrivateKey != "" {
+		key, err := uapiKey(cfg.PrivateKey)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "private_key=%s\n", key)
+	}
+	if cfg.ListenPort != 0 {
+		fmt.Fprintf(&b, "listen_port=%d\n", cfg.ListenPort)
+	}
+	if cfg.FwMark != 0 {
+		fmt.Fprintf(&b, "fwmark=%d\n", cfg.FwMark)
+	}
+
+	return b.String(), nil
+}
+
+// encodeUAPIPeers кодує зміни peer'ів. Порожній preshared key кодується
+// нулями, що видаляє ключ; allowed IPs повністю замінюються.
+func encodeUAPIPeers(peers []PeerConfig) (string, error) {
+	var b strings.Builder
+
+	for _, peer := range peers {
+		publicKey, err := uapiKey(peer.PublicKey)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "public_key=%s\n", publicKey)
+
+		if peer.Remove {
+			b.WriteString("remove=true\n")
+			continue
+		}
+
+		presharedKey := strings.Repeat("0", 2*wgKeyLen)
+		if peer.PresharedKey != "" {
+			if presharedKey, err = uapiKey(peer.PresharedKey); err != nil {
+				return "", err
+			}
+		}
+		fmt.Fprintf(&b, "preshared_key=%s\n", presharedKey)
+
+		b.WriteString("replace_allowed_ips=true\n")
+		for _, allowedIP := range peer.AllowedIPs {
+			fmt.Fprintf(&b, "allowed_ip=%s\n", strings.TrimSpace(allowedIP))
+		}
+	}
+
+	return b.String(), nil
+}
+
+// parseUAPIPeers розбирає peer'ів з відповіді на запит get=1
+func parseUAPIPeers(data string) ([]Peer, error) {
+	var (
+		peers       []Peer
+		peer        *Peer
+		handshakeS  int64
+		handshakeNs int64
+	)
+
+	finish := func() {
+		if peer == nil {
+			return
+		}
+		if handshakeS != 0 || handshakeNs != 0 {
+			peer.LastHandshake = time.Unix(handshakeS, handshakeNs)
+		}
+		peers = append(peers, *peer)
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("malformed uapi line %q", line)
+		}
+
+		if key == "public_key" {
+			finish()
+			publicKey, err := base64Key(value)
+			if err != nil {
+				return nil, err
+			}
+			peer = &Peer{PublicKey: publicKey}
+			handshakeS, handshakeNs = 0, 0
+			continue
+		}
+		if peer == nil {
+			// Параметри пристрою нас не цікавлять
+			continue
+		}
+
+		var err error
+		switch key {
+		case "preshared_key":
+			if strings.Trim(value, "0") != "" {
+				peer.PresharedKey, err = base64Key(value)
+			}
+		case "endpoint":
+			peer.Endpoint = value
+		case "allowed_ip":
+			peer.AllowedIPs = append(peer.AllowedIPs, value)
+		case "last_handshake_time_sec":
+			handshakeS, err = strconv.ParseInt(value, 10, 64)
+		case "last_handshake_time_nsec":
+			handshakeNs, err = strconv.ParseInt(value, 10, 64)
+		case "rx_bytes":
+			peer.ReceiveBytes, err = strconv.ParseInt(value, 10, 64)
+		case "tx_bytes":
+			peer.TransmitBytes, err = strconv.ParseInt(value, 10, 64)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid uapi value %s=%s: %w", key, value, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	finish()
+
+	return peers, nil
+}
+
+// uapiKey перекодовує ключ з base64 у hex
+func uapiKey(key string) (string, error) {
+	raw, err := decodeKey(key)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// base64Key перекодовує ключ з hex у base64
+func base64Key(key string) (string, error) {
+	raw, err := hex.DecodeString(key)
+	if err != nil || len(raw) != wgKeyLen {
+		return "", fmt.Errorf("invalid uapi key %q", key)
+	}
+	return base64.StdEncoding.EncodeToString(raw), nil
+}
@@ -0,0 +1,87 @@
+//go:build linux
+
+package netdev
+
+import (
+	"testing"
+
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/tun/tuntest"
+
+	"github.com/artem/wg-orbit/internal/wg"
+)
+
+func TestUAPI_RoundTrip(t *testing.T) {
+	// wireguard-go на канальному TUN: не потребує привілеїв
+	dev := device.NewDevice(tuntest.NewChannelTUN().TUN(), conn.NewDefaultBind(), device.NewLogger(device.LogLevelSilent, ""))
+	defer dev.Close()
+
+	privateKey, _, err := wg.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error: %v", err)
+	}
+	_, kept, err := wg.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error: %v", err)
+	}
+	_, removed, err := wg.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error: %v", err)
+	}
+	presharedKey, _, err := wg.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error: %v", err)
+	}
+
+	config, err := encodeUAPIDevice(DeviceConfig{PrivateKey: privateKey})
+	if err != nil {
+		t.Fatalf("encodeUAPIDevice() error: %v", err)
+	}
+	if err := dev.IpcSet(config); err != nil {
+		t.Fatalf("IpcSet(device) error: %v", err)
+	}
+
+	changes := [][]PeerConfig{
+		{
+			{PublicKey: kept, AllowedIPs: []string{"10.0.0.9/32"}},
+			{PublicKey: removed, AllowedIPs: []string{"10.0.0.3/32"}},
+		},
+		{
+			{PublicKey: kept, PresharedKey: presharedKey, AllowedIPs: []string{"10.0.0.2/32", "fd00:77::2/128"}},
+			{PublicKey: removed, Remove: true},
+		},
+	}
+	for _, change := range changes {
+		config, err := encodeUAPIPeers(change)
+		if err != nil {
+			t.Fatalf("encodeUAPIPeers() error: %v", err)
+		}
+		if err := dev.IpcSet(config); err != nil {
+			t.Fatalf("IpcSet(peers) error: %v", err)
+		}
+	}
+
+	data, err := dev.IpcGet()
+	if err != nil {
+		t.Fatalf("IpcGet() error: %v", err)
+	}
+	peers, err := parseUAPIPeers(data)
+	if err != nil {
+		t.Fatalf("parseUAPIPeers() error: %v", err)
+	}
+
+	if len(peers) != 1 {
+		t.Fatalf("parseUAPIPeers() returned %d peers, want 1", len(peers))
+	}
+	peer := peers[0]
+	if peer.PublicKey != kept || peer.PresharedKey != presharedKey {
+		t.Errorf("decoded keys = %q, %q", peer.PublicKey, peer.PresharedKey)
+	}
+	if !peer.LastHandshake.IsZero() {
+		t.Errorf("LastHandshake = %v, want zero", peer.LastHandshake)
+	}
+	if len(peer.AllowedIPs) != 2 {
+		t.Errorf("AllowedIPs = %v, want the replaced pair", peer.AllowedIPs)
+	}
+}
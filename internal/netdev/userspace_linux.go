@@ -0,0 +1,259 @@
+//go:build linux
+
+package netdev
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"golang.zx2c4.com/wireguard/conn"
+	"golang.zx2c4.com/wireguard/device"
+	"golang.zx2c4.com/wireguard/ipc"
+	"golang.zx2c4.com/wireguard/tun"
+)
+
+// tunPath - символьний пристрій, через який створюються TUN інтерфейси
+const tunPath = "/dev/net/tun"
+
+// UserspaceBackend реалізує WireGuard у процесі сервера через wireguard-go
+// і TUN пристрій. Не потребує модуля ядра, лише /dev/net/tun та
+// CAP_NET_ADMIN. Інтерфейси існують, поки працює процес.
+type UserspaceBackend struct {
+	mu      sync.Mutex
+	devices map[string]*userspaceDevice
+}
+
+// userspaceDevice - запущений wireguard-go пристрій
+type userspaceDevice struct {
+	device *device.Device
+	uapi   net.Listener // сокет для утиліти wg
+}
+
+// NewUserspaceBackend створює userspace backend
+func NewUserspaceBackend() *UserspaceBackend {
+	return &UserspaceBackend{devices: make(map[string]*userspaceDevice)}
+}
+
+// newUserspaceBackend створює userspace backend для New
+func newUserspaceBackend() (Backend, error) {
+	return NewUserspaceBackend(), nil
+}
+
+// Name повертає назву backend'у
+func (b *UserspaceBackend) Name() string {
+	return BackendUserspace
+}
+
+// Available перевіряє, чи можна відкрити TUN пристрій
+func (b *UserspaceBackend) Available() error {
+	file, err := os.OpenFile(tunPath, os.O_RDWR, 0)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &Error{Op: "open tun", Link: tunPath, Err: ErrNotSupported}
+		}
+		return &Error{Op: "open tun", Link: tunPath, Err: err}
+	}
+	return file.Close()
+}
+
+// LinkExists перевіряє, чи існує інтерфейс
+func (b *UserspaceBackend) LinkExists(name string) (bool, error) {
+	return linkExists(name)
+}
+
+// CreateLink створює TUN інтерфейс і запускає на ньому wireguard-go
+func (b *UserspaceBackend) CreateLink(name string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.devices[name]; ok {
+		return &Error{Op: "create link", Link: name, Err: ErrLinkExists}
+	}
+	if exists, err := linkExists(name); err != nil {
+		return err
+	} else if exists {
+		return &Error{Op: "create link", Link: name, Err: ErrLinkExists}
+	}
+
+	tunDevice, err := tun.CreateTUN(name, device.DefaultMTU)
+	if err != nil {
+		return &Error{Op: "create tun", Link: name, Err: err}
+	}
+
+	logger := device.NewLogger(device.LogLevelError, fmt.Sprintf("(%s) ", name))
+	dev := device.NewDevice(tunDevice, conn.NewDefaultBind(), logger)
+
+	uapi, err := listenUAPI(name, dev)
+	if err != nil {
+		dev.Close()
+		return &Error{Op: "listen uapi", Link: name, Err: err}
+	}
+
+	b.devices[name] = &userspaceDevice{device: dev, uapi: uapi}
+	return nil
+}
+
+// listenUAPI відкриває сокет /var/run/wireguard/<name>.sock, щоб
+// пристрій можна було переглядати і змінювати утилітою wg
+func listenUAPI(name string, dev *device.Device) (net.Listener, error) {
+	file, err := ipc.UAPIOpen(name)
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := ipc.UAPIListen(name, file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go dev.IpcHandle(conn)
+		}
+	}()
+
+	return listener, nil
+}
+
+// DeleteLink зупиняє пристрій; TUN інтерфейс зникає разом з ним
+func (b *UserspaceBackend) DeleteLink(name string) error {
+	b.mu.Lock()
+	dev, ok := b.devices[name]
+	delete(b.devices, name)
+	b.mu.Unlock()
+
+	if !ok {
+		// Інтерфейс не належить цьому процесу
+		return deleteLink(name)
+	}
+
+	dev.close()
+	return nil
+}
+
+// AddAddress призначає інтерфейсу адресу
+func (b *UserspaceBackend) AddAddress(name, cidr string) error {
+	return addAddress(name, cidr)
+}
+
+// DeleteAddress знімає з інтерфейсу адресу
+func (b *UserspaceBackend) DeleteAddress(name, cidr string) error {
+	return deleteAddress(name, cidr)
+}
+
+// SetLinkUp піднімає інтерфейс
+func (b *UserspaceBackend) SetLinkUp(name string) error {
+	return setLinkUp(name)
+}
+
+// SetMTU встановлює MTU інтерфейсу; wireguard-go підхоплює зміну з TUN
+func (b *UserspaceBackend) SetMTU(name string, mtu int) error {
+	return setMTU(name, mtu)
+}
+
+// AddRoute додає або замінює маршрут через інтерфейс
+func (b *UserspaceBackend) AddRoute(name, cidr string, table int) error {
+	return addRoute(name, cidr, table)
+}
+
+// ConfigureDevice встановлює приватний ключ, порт і fwmark
+func (b *UserspaceBackend) ConfigureDevice(name string, cfg DeviceConfig) error {
+	dev, err := b.device("configure device", name)
+	if err != nil {
+		return err
+	}
+
+	config, err := encodeUAPIDevice(cfg)
+	if err != nil {
+		return &Error{Op: "configure device", Link: name, Err: err}
+	}
+
+	if err := dev.IpcSet(config); err != nil {
+		return &Error{Op: "configure device", Link: name, Err: err}
+	}
+	return nil
+}
+
+// Peers повертає peer'ів пристрою
+func (b *UserspaceBackend) Peers(name string) ([]Peer, error) {
+	dev, err := b.device("get device", name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := dev.IpcGet()
+	if err != nil {
+		return nil, &Error{Op: "get device", Link: name, Err: err}
+	}
+
+	peers, err := parseUAPIPeers(data)
+	if err != nil {
+		return nil, &Error{Op: "get device", Link: name, Err: err}
+	}
+	return peers, nil
+}
+
+// ConfigurePeers застосовує зміни peer'ів однією транзакцією UAPI
+func (b *UserspaceBackend) ConfigurePeers(name string, peers []PeerConfig) error {
+	if len(peers) == 0 {
+		return nil
+	}
+
+	dev, err := b.device("configure peers", name)
+	if err != nil {
+		return err
+	}
+
+	config, err := encodeUAPIPeers(peers)
+	if err != nil {
+		return &Error{Op: "configure peers", Link: name, Err: err}
+	}
+
+	if err := dev.IpcSet(config); err != nil {
+		return &Error{Op: "configure peers", Link: name, Err: err}
+	}
+	return nil
+}
+
+// Close зупиняє всі пристрої, створені backend'ом
+func (b *UserspaceBackend) Close() error {
+	b.mu.Lock()
+	devices := b.devices
+	b.devices = make(map[string]*userspaceDevice)
+	b.mu.Unlock()
+
+	for _, dev := range devices {
+		dev.close()
+	}
+	return nil
+}
+
+// device повертає запущений пристрій за назвою
+func (b *UserspaceBackend) device(op, name string) (*device.Device, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	dev, ok := b.devices[name]
+	if !ok {
+		// Інтерфейс з такою назвою може існувати, але належати ядру або іншому процесу
+		if exists, err := linkExists(name); err == nil && exists {
+			return nil, &Error{Op: op, Link: name, Err: fmt.Errorf("%w and is not managed by this process", ErrLinkExists)}
+		}
+		return nil, &Error{Op: op, Link: name, Err: ErrLinkNotFound}
+	}
+	return dev.device, nil
+}
+
+// close закриває UAPI сокет і зупиняє пристрій
+func (d *userspaceDevice) close() {
+	d.uapi.Close()
+	d.device.Close()
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+
+package netdev
+
+import "fmt"
+
+// newUserspaceBackend повертає ErrNotSupported: userspace backend
+// керує адресами TUN інтерфейсу через rtnetlink і доступний лише в Linux
+func newUserspaceBackend() (Backend, error) {
+	return nil, fmt.Errorf("userspace backend: %w", ErrNotSupported)
+}
@@ -0,0 +1,251 @@
+//go:build linux
+
+package netdev
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/mdlayher/genetlink"
+	mdnetlink "github.com/mdlayher/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// Константи generic netlink API WireGuard з include/uapi/linux/wireguard.h
+const (
+	wgGenlName = "wireguard"
+	wgKeyLen   = 32
+
+	wgCmdGetDevice = 0
+	wgCmdSetDevice = 1
+
+	wgDeviceAIfname     = 2
+	wgDeviceAPrivateKey = 3
+	wgDeviceAListenPort = 6
+	wgDeviceAFwmark     = 7
+	wgDeviceAPeers      = 8
+
+	wgPeerAPublicKey         = 1
+	wgPeerAPresharedKey      = 2
+	wgPeerAFlags             = 3
+	wgPeerAEndpoint          = 4
+	wgPeerALastHandshakeTime = 6
+	wgPeerARxBytes           = 7
+	wgPeerATxBytes           = 8
+	wgPeerAAllowedIPs        = 9
+
+	wgPeerFRemoveMe          = 1 << 0
+	wgPeerFReplaceAllowedIPs = 1 << 1
+
+	wgAllowedIPAFamily   = 1
+	wgAllowedIPAIPAddr   = 2
+	wgAllowedIPACidrMask = 3
+)
+
+// encodePeerConfig кодує WG_CMD_SET_DEVICE для одного peer'а
+func encodePeerConfig(name string, peer PeerConfig) ([]byte, error) {
+	publicKey, err := decodeKey(peer.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var presharedKey []byte
+	if !peer.Remove {
+		// Нульовий ключ видаляє preshared key peer'а
+		presharedKey = make([]byte, wgKeyLen)
+		if peer.PresharedKey != "" {
+			if presharedKey, err = decodeKey(peer.PresharedKey); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	allowedIPs := make([]*net.IPNet, 0, len(peer.AllowedIPs))
+	for _, cidr := range peer.AllowedIPs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allowed IP %q: %w", cidr, err)
+		}
+		allowedIPs = append(allowedIPs, ipNet)
+	}
+
+	ae := mdnetlink.NewAttributeEncoder()
+	ae.String(wgDeviceAIfname, name)
+	ae.Nested(wgDeviceAPeers, func(nae *mdnetlink.AttributeEncoder) error {
+		nae.Nested(0, func(pae *mdnetlink.AttributeEncoder) error {
+			pae.Bytes(wgPeerAPublicKey, publicKey)
+			if peer.Remove {
+				pae.Uint32(wgPeerAFlags, wgPeerFRemoveMe)
+				return nil
+			}
+
+			pae.Uint32(wgPeerAFlags, wgPeerFReplaceAllowedIPs)
+			pae.Bytes(wgPeerAPresharedKey, presharedKey)
+			pae.Nested(wgPeerAAllowedIPs, func(aae *mdnetlink.AttributeEncoder) error {
+				for i, ipNet := range allowedIPs {
+					aae.Nested(uint16(i), func(iae *mdnetlink.AttributeEncoder) error {
+						encodeAllowedIP(iae, ipNet)
+						return nil
+					})
+				}
+				return nil
+			})
+			return nil
+		})
+		return nil
+	})
+
+	return ae.Encode()
+}
+
+// encodeAllowedIP кодує одну дозволену мережу
+func encodeAllowedIP(ae *mdnetlink.AttributeEncoder, ipNet *net.IPNet) {
+	ones, _ := ipNet.Mask.Size()
+	if ip4 := ipNet.IP.To4(); ip4 != nil {
+		ae.Uint16(wgAllowedIPAFamily, unix.AF_INET)
+		ae.Bytes(wgAllowedIPAIPAddr, ip4)
+	} else {
+		ae.Uint16(wgAllowedIPAFamily, unix.AF_INET6)
+		ae.Bytes(wgAllowedIPAIPAddr, ipNet.IP.To16())
+	}
+	ae.Uint8(wgAllowedIPACidrMask, uint8(ones))
+}
+
+// decodeDevicePeers розбирає відповідь WG_CMD_GET_DEVICE.
+// Ядро може розбити список peer'ів (і навіть allowed IPs одного peer'а)
+// на кілька повідомлень, тому peer з тим самим ключем поспіль об'єднується.
+func decodeDevicePeers(msgs []genetlink.Message) ([]Peer, error) {
+	var peers []Peer
+	for _, msg := range msgs {
+		ad, err := mdnetlink.NewAttributeDecoder(msg.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		for ad.Next() {
+			if ad.Type() != wgDeviceAPeers {
+				continue
+			}
+			ad.Nested(func(nad *mdnetlink.AttributeDecoder) error {
+				for nad.Next() {
+					var peer Peer
+					nad.Nested(func(pad *mdnetlink.AttributeDecoder) error {
+						return decodePeer(pad, &peer)
+					})
+
+					last := len(peers) - 1
+					if last >= 0 && peers[last].PublicKey == peer.PublicKey {
+						peers[last].AllowedIPs = append(peers[last].AllowedIPs, peer.AllowedIPs...)
+						continue
+					}
+					peers = append(peers, peer)
+				}
+				return nil
+			})
+		}
+		if err := ad.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	return peers, nil
+}
+
+// decodePeer розбирає атрибути одного peer'а
+func decodePeer(ad *mdnetlink.AttributeDecoder, peer *Peer) error {
+	for ad.Next() {
+		switch ad.Type() {
+		case wgPeerAPublicKey:
+			peer.PublicKey = base64.StdEncoding.EncodeToString(ad.Bytes())
+		case wgPeerAPresharedKey:
+			if key := ad.Bytes(); !isZeroKey(key) {
+				peer.PresharedKey = base64.StdEncoding.EncodeToString(key)
+			}
+		case wgPeerAEndpoint:
+			peer.Endpoint = decodeSockaddr(ad.Bytes())
+		case wgPeerALastHandshakeTime:
+			peer.LastHandshake = decodeTimespec(ad.Bytes())
+		case wgPeerARxBytes:
+			peer.ReceiveBytes = int64(ad.Uint64())
+		case wgPeerATxBytes:
+			peer.TransmitBytes = int64(ad.Uint64())
+		case wgPeerAAllowedIPs:
+			ad.Nested(func(nad *mdnetlink.AttributeDecoder) error {
+				for nad.Next() {
+					nad.Nested(func(iad *mdnetlink.AttributeDecoder) error {
+						if cidr := decodeAllowedIP(iad); cidr != "" {
+							peer.AllowedIPs = append(peer.AllowedIPs, cidr)
+						}
+						return nil
+					})
+				}
+				return nil
+			})
+		}
+	}
+	return ad.Err()
+}
+
+// decodeAllowedIP розбирає одну дозволену мережу у формат CIDR
+func decodeAllowedIP(ad *mdnetlink.AttributeDecoder) string {
+	var ip net.IP
+	var mask uint8
+	for ad.Next() {
+		switch ad.Type() {
+		case wgAllowedIPAIPAddr:
+			ip = net.IP(ad.Bytes())
+		case wgAllowedIPACidrMask:
+			mask = ad.Uint8()
+		}
+	}
+	if ip == nil {
+		return ""
+	}
+	return ip.String() + "/" + strconv.Itoa(int(mask))
+}
+
+// decodeSockaddr перетворює sockaddr_in/sockaddr_in6 на "host:port"
+func decodeSockaddr(b []byte) string {
+	if len(b) < 4 {
+		return ""
+	}
+
+	family := binary.NativeEndian.Uint16(b[0:2])
+	port := int(binary.BigEndian.Uint16(b[2:4]))
+	switch {
+	case family == unix.AF_INET && len(b) >= 8:
+		return net.JoinHostPort(net.IP(b[4:8]).String(), strconv.Itoa(port))
+	case family == unix.AF_INET6 && len(b) >= 24:
+		return net.JoinHostPort(net.IP(b[8:24]).String(), strconv.Itoa(port))
+	default:
+		return ""
+	}
+}
+
+// decodeTimespec перетворює __kernel_timespec на час; нуль означає відсутність handshake
+func decodeTimespec(b []byte) time.Time {
+	if len(b) < 16 {
+		return time.Time{}
+	}
+
+	sec := int64(binary.NativeEndian.Uint64(b[0:8]))
+	nsec := int64(binary.NativeEndian.Uint64(b[8:16]))
+	if sec == 0 && nsec == 0 {
+		return time.Time{}
+	}
+	return time.Unix(sec, nsec)
+}
+
+// isZeroKey перевіряє, чи ключ складається з нулів
+func isZeroKey(key []byte) bool {
+	for _, b := range key {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
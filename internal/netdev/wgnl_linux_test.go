@@ -0,0 +1,59 @@
+//go:build linux
+
+package netdev
+
+import (
+	"testing"
+
+	"github.com/mdlayher/genetlink"
+
+	"github.com/artem/wg-orbit/internal/wg"
+)
+
+func TestPeerConfig_RoundTrip(t *testing.T) {
+	_, publicKey, err := wg.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error: %v", err)
+	}
+	presharedKey, _, err := wg.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error: %v", err)
+	}
+
+	data, err := encodePeerConfig("wg0", PeerConfig{
+		PublicKey:    publicKey,
+		PresharedKey: presharedKey,
+		AllowedIPs:   []string{"10.0.0.2/32", "fd00:77::2/128"},
+	})
+	if err != nil {
+		t.Fatalf("encodePeerConfig() error: %v", err)
+	}
+
+	// Ядро ділить великі відповіді: той самий peer у двох повідомленнях
+	second, err := encodePeerConfig("wg0", PeerConfig{PublicKey: publicKey, AllowedIPs: []string{"192.168.1.0/24"}})
+	if err != nil {
+		t.Fatalf("encodePeerConfig() error: %v", err)
+	}
+
+	peers, err := decodeDevicePeers([]genetlink.Message{{Data: data}, {Data: second}})
+	if err != nil {
+		t.Fatalf("decodeDevicePeers() error: %v", err)
+	}
+	if len(peers) != 1 {
+		t.Fatalf("decodeDevicePeers() returned %d peers, want 1", len(peers))
+	}
+
+	peer := peers[0]
+	if peer.PublicKey != publicKey || peer.PresharedKey != presharedKey {
+		t.Errorf("decoded keys = %q, %q", peer.PublicKey, peer.PresharedKey)
+	}
+	want := []string{"10.0.0.2/32", "fd00:77::2/128", "192.168.1.0/24"}
+	if len(peer.AllowedIPs) != len(want) {
+		t.Fatalf("AllowedIPs = %v, want %v", peer.AllowedIPs, want)
+	}
+	for i := range want {
+		if peer.AllowedIPs[i] != want[i] {
+			t.Errorf("AllowedIPs[%d] = %s, want %s", i, peer.AllowedIPs[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/artem/wg-orbit/internal/netdev"
+)
+
+// fakeBackend - мережевий backend у пам'яті, що записує всі виклики.
+// Поводиться як справжні backend'и: повертає ErrLinkExists, ErrLinkNotFound
+// і ErrAddressExists, тому на ньому можна перевіряти обробку помилок.
+type fakeBackend struct {
+	links map[string]*fakeLink
+
+	// calls - виклики у форматі "Операція аргументи", напр. "AddAddress wg0 10.0.0.1/24"
+	calls []string
+	// failures - помилки, які повертають операції з назвою-ключем
+	failures map[string]error
+	// unavailable - помилка Available, напр. відсутній модуль ядра
+	unavailable error
+}
+
+// fakeLink - стан одного інтерфейсу
+type fakeLink struct {
+	device    netdev.DeviceConfig
+	mtu       int
+	addresses []string
+	routes    []string // "cidr table N"
+	up        bool
+	peers     map[string]netdev.Peer
+}
+
+func newFakeBackend() *fakeBackend {
+	return &fakeBackend{
+		links:    make(map[string]*fakeLink),
+		failures: make(map[string]error),
+	}
+}
+
+// call записує виклик і повертає налаштовану для операції помилку
+func (b *fakeBackend) call(op string, args ...interface{}) error {
+	parts := []string{op}
+	for _, arg := range args {
+		parts = append(parts, fmt.Sprint(arg))
+	}
+	b.calls = append(b.calls, strings.Join(parts, " "))
+
+	if err, ok := b.failures[op]; ok {
+		return &netdev.Error{Op: op, Link: fmt.Sprint(args[0]), Err: err}
+	}
+	return nil
+}
+
+// link повертає інтерфейс або netdev.ErrLinkNotFound
+func (b *fakeBackend) link(op, name string) (*fakeLink, error) {
+	link, ok := b.links[name]
+	if !ok {
+		return nil, &netdev.Error{Op: op, Link: name, Err: netdev.ErrLinkNotFound}
+	}
+	return link, nil
+}
+
+// mutations повертає виклики, що змінюють стан, без перевірок LinkExists і Peers
+func (b *fakeBackend) mutations() []string {
+	var calls []string
+	for _, call := range b.calls {
+		if !strings.HasPrefix(call, "LinkExists ") && !strings.HasPrefix(call, "Peers ") && call != "Available" {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+func (b *fakeBackend) Name() string { return "fake" }
+
+func (b *fakeBackend) Available() error {
+	b.calls = append(b.calls, "Available")
+	return b.unavailable
+}
+
+func (b *fakeBackend) LinkExists(name string) (bool, error) {
+	if err := b.call("LinkExists", name); err != nil {
+		return false, err
+	}
+	_, ok := b.links[name]
+	return ok, nil
+}
+
+func (b *fakeBackend) CreateLink(name string) error {
+	if err := b.call("CreateLink", name); err != nil {
+		return err
+	}
+	if _, ok := b.links[name]; ok {
+		return &netdev.Error{Op: "create link", Link: name, Err: netdev.ErrLinkExists}
+	}
+	b.links[name] = &fakeLink{peers: make(map[string]netdev.Peer)}
+	return nil
+}
+
+func (b *fakeBackend) DeleteLink(name string) error {
+	if err := b.call("DeleteLink", name); err != nil {
+		return err
+	}
+	if _, err := b.link("delete link", name); err != nil {
+		return err
+	}
+	delete(b.links, name)
+	return nil
+}
+
+func (b *fakeBackend) AddAddress(name, cidr string) error {
+	if err := b.call("AddAddress", name, cidr); err != nil {
+		return err
+	}
+	link, err := b.link("add address", name)
+	if err != nil {
+		return err
+	}
+	for _, address := range link.addresses {
+		if address == cidr {
+			return &netdev.Error{Op: "add address", Link: name, Err: netdev.ErrAddressExists}
+		}
+	}
+	link.addresses = append(link.addresses, cidr)
+	return nil
+}
+
+func (b *fakeBackend) DeleteAddress(name, cidr string) error {
+	if err := b.call("DeleteAddress", name, cidr); err != nil {
+		return err
+	}
+	link, err := b.link("delete address", name)
+	if err != nil {
+		return err
+	}
+	for i, address := range link.addresses {
+		if address == cidr {
+			link.addresses = append(link.addresses[:i], link.addresses[i+1:]...)
+			return nil
+		}
+	}
+	return &netdev.Error{Op: "delete address", Link: name, Err: errors.New("address not assigned")}
+}
+
+func (b *fakeBackend) SetLinkUp(name string) error {
+	if err := b.call("SetLinkUp", name); err != nil {
+		return err
+	}
+	link, err := b.link("set link up", name)
+	if err != nil {
+		return err
+	}
+	link.up = true
+	return nil
+}
+
+func (b *fakeBackend) SetMTU(name string, mtu int) error {
+	if err := b.call("SetMTU", name, mtu); err != nil {
+		return err
+	}
+	link, err := b.link("set mtu", name)
+	if err != nil {
+		return err
+	}
+	link.mtu = mtu
+	return nil
+}
+
+func (b *fakeBackend) AddRoute(name, cidr string, table int) error {
+	if err := b.call("AddRoute", name, cidr, table); err != nil {
+		return err
+	}
+	link, err := b.link("add route", name)
+	if err != nil {
+		return err
+	}
+	route := fmt.Sprintf("%s table %d", cidr, table)
+	for _, existing := range link.routes {
+		if existing == route {
+			return nil
+		}
+	}
+	link.routes = append(link.routes, route)
+	return nil
+}
+
+func (b *fakeBackend) ConfigureDevice(name string, cfg netdev.DeviceConfig) error {
+	if err := b.call("ConfigureDevice", name, cfg.ListenPort, cfg.FwMark); err != nil {
+		return err
+	}
+	link, err := b.link("configure device", name)
+	if err != nil {
+		return err
+	}
+	link.device = cfg
+	return nil
+}
+
+func (b *fakeBackend) Peers(name string) ([]netdev.Peer, error) {
+	if err := b.call("Peers", name); err != nil {
+		return nil, err
+	}
+	link, err := b.link("list peers", name)
+	if err != nil {
+		return nil, err
+	}
+
+	var peers []netdev.Peer
+	for _, peer := range link.peers {
+		peers = append(peers, peer)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].PublicKey < peers[j].PublicKey })
+	return peers, nil
+}
+
+func (b *fakeBackend) ConfigurePeers(name string, changes []netdev.PeerConfig) error {
+	if err := b.call("ConfigurePeers", name, len(changes)); err != nil {
+		return err
+	}
+	link, err := b.link("configure peers", name)
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		if change.Remove {
+			delete(link.peers, change.PublicKey)
+			continue
+		}
+		link.peers[change.PublicKey] = netdev.Peer{
+			PublicKey:    change.PublicKey,
+			PresharedKey: change.PresharedKey,
+			AllowedIPs:   change.AllowedIPs,
+		}
+	}
+	return nil
+}
+
+func (b *fakeBackend) Close() error { return nil }
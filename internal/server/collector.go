@@ -0,0 +1,127 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/artem/wg-orbit/internal/netdev"
+	"github.com/artem/wg-orbit/internal/storage"
+	"github.com/artem/wg-orbit/internal/wg"
+)
+
+// DefaultStatsInterval - період опитування handshake і трафіку за замовчуванням
+const DefaultStatsInterval = 30 * time.Second
+
+// StatsCollector періодично читає з пристрою час останнього handshake
+// і лічильники трафіку peer'ів, оновлює last_seen і накопичений трафік
+type StatsCollector struct {
+	interfaceName string
+	backend       netdev.Backend
+	storage       storage.Storage
+	interval      time.Duration
+}
+
+// NewStatsCollector створює collector для інтерфейсу
+func NewStatsCollector(interfaceName string, backend netdev.Backend, store storage.Storage, interval time.Duration) *StatsCollector {
+	if interval <= 0 {
+		interval = DefaultStatsInterval
+	}
+
+	return &StatsCollector{
+		interfaceName: interfaceName,
+		backend:       backend,
+		storage:       store,
+		interval:      interval,
+	}
+}
+
+// Run опитує пристрій, поки не закрито stop
+func (c *StatsCollector) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if err := c.Collect(); err != nil {
+				log.Printf("Failed to collect peer stats on %s: %v", c.interfaceName, err)
+			}
+		}
+	}
+}
+
+// Collect виконує одне опитування пристрою
+func (c *StatsCollector) Collect() error {
+	devicePeers, err := c.backend.Peers(c.interfaceName)
+	if err != nil {
+		return fmt.Errorf("failed to read device peers: %w", err)
+	}
+
+	peers, err := c.storage.ListPeers()
+	if err != nil {
+		return fmt.Errorf("failed to list peers: %w", err)
+	}
+
+	byKey := make(map[string]*wg.Peer, len(peers))
+	for _, peer := range peers {
+		if peer.InterfaceName == c.interfaceName {
+			byKey[peer.PublicKey] = peer
+		}
+	}
+
+	now := time.Now()
+	for _, devicePeer := range devicePeers {
+		peer, ok := byKey[devicePeer.PublicKey]
+		if !ok {
+			continue
+		}
+
+		info := &wg.HandshakeInfo{
+			PeerID:        peer.ID,
+			LastHandshake: devicePeer.LastHandshake,
+			RxBytes:       devicePeer.ReceiveBytes,
+			TxBytes:       devicePeer.TransmitBytes,
+		}
+		if err := c.record(peer, info, now); err != nil {
+			log.Printf("Failed to record stats of peer %s: %v", peer.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// record зберігає handshake і трафік одного peer'а
+func (c *StatsCollector) record(peer *wg.Peer, info *wg.HandshakeInfo, now time.Time) error {
+	if info.IsOnline(wg.OnlineTimeout) && !peer.IsOnline(wg.OnlineTimeout) {
+		log.Printf("Peer %s is online", peer.Name)
+	}
+
+	// last_seen оновлюється лише при новому handshake
+	if !info.LastHandshake.IsZero() && (peer.LastSeen == nil || info.LastHandshake.After(*peer.LastSeen)) {
+		if err := c.storage.UpdatePeerLastSeen(peer.ID, info.LastHandshake); err != nil {
+			return fmt.Errorf("failed to update last seen: %w", err)
+		}
+	}
+
+	stats, err := c.storage.GetPeerStats(peer.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load stats: %w", err)
+	}
+	if stats == nil {
+		stats = &wg.PeerStats{PeerID: peer.ID}
+	}
+	if stats.RxCounter == info.RxBytes && stats.TxCounter == info.TxBytes {
+		return nil
+	}
+
+	stats.Observe(info)
+	stats.UpdatedAt = now
+	if err := c.storage.SavePeerStats(stats); err != nil {
+		return fmt.Errorf("failed to save stats: %w", err)
+	}
+
+	return nil
+}
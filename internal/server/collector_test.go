@@ -0,0 +1,58 @@
+package server
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/artem/wg-orbit/internal/netdev"
+	"github.com/artem/wg-orbit/internal/storage"
+)
+
+func TestStatsCollector_Collect(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage() error: %v", err)
+	}
+	defer store.Close()
+
+	peer := newReconcilerPeer(t, store, "alice", true, "10.0.0.2/32")
+	handshake := time.Now().Add(-time.Minute).Truncate(time.Second)
+
+	device := &peerDevice{peers: map[string]netdev.Peer{
+		peer.PublicKey: {PublicKey: peer.PublicKey, LastHandshake: handshake, ReceiveBytes: 1000, TransmitBytes: 500},
+		"unknown=":     {PublicKey: "unknown=", ReceiveBytes: 1},
+	}}
+	collector := NewStatsCollector("wg0", device, store, 0)
+
+	if err := collector.Collect(); err != nil {
+		t.Fatalf("Collect() error: %v", err)
+	}
+
+	// Інтерфейс перестворено: лічильники почались з нуля
+	device.peers[peer.PublicKey] = netdev.Peer{PublicKey: peer.PublicKey, LastHandshake: handshake, ReceiveBytes: 200, TransmitBytes: 100}
+	if err := collector.Collect(); err != nil {
+		t.Fatalf("Collect() error: %v", err)
+	}
+
+	got, err := store.GetPeer(peer.ID)
+	if err != nil || got == nil {
+		t.Fatalf("GetPeer() = %v, %v", got, err)
+	}
+	if got.LastSeen == nil || !got.LastSeen.Equal(handshake) {
+		t.Errorf("LastSeen = %v, want %v", got.LastSeen, handshake)
+	}
+
+	stats, err := store.GetPeerStats(peer.ID)
+	if err != nil || stats == nil {
+		t.Fatalf("GetPeerStats() = %v, %v", stats, err)
+	}
+	if stats.RxBytes != 1200 || stats.TxBytes != 600 {
+		t.Errorf("stats = %d/%d, want 1200/600", stats.RxBytes, stats.TxBytes)
+	}
+
+	got.ApplyStats(stats)
+	if !got.Online || got.RxBytes != 1200 {
+		t.Errorf("ApplyStats() = online %v, rx %d", got.Online, got.RxBytes)
+	}
+}
@@ -0,0 +1,311 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/artem/wg-orbit/internal/wg"
+	"github.com/google/uuid"
+)
+
+// ImportReport - результат імпорту конфігурації wg-quick
+type ImportReport struct {
+	Interface string
+	// InterfaceCreated - запис інтерфейсу створено з ключем із конфігурації
+	InterfaceCreated bool
+
+	// Imported - назви імпортованих peer'ів
+	Imported []string
+	// Skipped - назви peer'ів, що вже є на цьому інтерфейсі з тим самим ключем
+	Skipped []string
+	// Conflicts - peer'и, які не імпортовано
+	Conflicts []ImportConflict
+	// Warnings - налаштування, які не перенесено або перенесено не повністю
+	Warnings []string
+}
+
+// ImportConflict описує peer'а, якого не вдалося імпортувати
+type ImportConflict struct {
+	Line      int
+	Name      string
+	PublicKey string
+	Reason    string
+}
+
+// Import переносить інтерфейс і peer'ів з конфігурації wg-quick на інтерфейс
+// name (порожня назва - інтерфейс за замовчуванням).
+//
+// Ключ сервера з конфігурації зберігається як ключ інтерфейсу, тому клієнтам
+// не потрібно нічого змінювати. Приватних ключів peer'ів сервер не знає,
+// тому peer'и імпортуються лише з публічними ключами, а їхні адреси
+// позначаються в IPAM як зайняті. Peer'и, що конфліктують з базою даних
+// або IPAM, пропускаються і потрапляють у звіт. Якщо dryRun, нічого не змінюється.
+//
+// Інтерфейс у системі не змінюється: нові peer'и застосовуються при
+// наступному init або run, які переймають запущений wg-quick інтерфейс.
+func (s *Server) Import(name string, config *wg.QuickConfig, dryRun bool) (*ImportReport, error) {
+	iface, err := s.lookupInterface(name)
+	if err != nil {
+		return nil, err
+	}
+	name = iface.config.Name
+	report := &ImportReport{Interface: name}
+
+	existing, err := s.storage.GetInterface(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load interface config: %w", err)
+	}
+	if err := checkImportInterface(iface, existing, &config.Interface); err != nil {
+		return nil, err
+	}
+	report.Warnings = importInterfaceWarnings(iface, &config.Interface)
+
+	// Запис інтерфейсу потрібен до peer'ів: вони посилаються на нього
+	if existing == nil {
+		if err := iface.manager.AdoptKey(config.Interface.PrivateKey); err != nil {
+			return nil, err
+		}
+		if !dryRun {
+			if err := s.storage.SaveInterface(iface.record(nil)); err != nil {
+				return nil, fmt.Errorf("failed to save interface config: %w", err)
+			}
+			log.Printf("Imported server key for %s, public key: %s", name, iface.manager.PublicKey())
+		}
+		report.InterfaceCreated = true
+	}
+
+	peers, err := s.storage.ListPeers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list peers: %w", err)
+	}
+	byKey := make(map[string]*wg.Peer)
+	byName := make(map[string]bool)
+	for _, peer := range peers {
+		byKey[peer.PublicKey] = peer
+		byName[peer.Name] = true
+	}
+
+	// Ключі і адреси попередніх peer'ів файлу; при dry run адреси не
+	// виділяються в IPAM, тому дублікати всередині файлу перевіряються окремо
+	fileKeys := make(map[string]string)
+	usedAddresses := make(map[string]string)
+
+	for i, quickPeer := range config.Peers {
+		peerName := quickPeer.Name
+		if peerName == "" {
+			peerName = fmt.Sprintf("%s-peer-%d", name, i+1)
+		}
+		conflict := func(format string, args ...interface{}) {
+			report.Conflicts = append(report.Conflicts, ImportConflict{
+				Line:      quickPeer.Line,
+				Name:      peerName,
+				PublicKey: quickPeer.PublicKey,
+				Reason:    fmt.Sprintf(format, args...),
+			})
+		}
+
+		if err := wg.ValidatePublicKey(quickPeer.PublicKey); err != nil {
+			conflict("invalid public key: %v", err)
+			continue
+		}
+		if quickPeer.PresharedKey != "" && wg.ValidatePrivateKey(quickPeer.PresharedKey) != nil {
+			conflict("invalid preshared key")
+			continue
+		}
+		if quickPeer.PublicKey == iface.manager.PublicKey() {
+			conflict("public key is the server key of %s", name)
+			continue
+		}
+		if owner, ok := fileKeys[quickPeer.PublicKey]; ok {
+			conflict("public key is already used by %s in the file", owner)
+			continue
+		}
+		fileKeys[quickPeer.PublicKey] = peerName
+
+		if stored, ok := byKey[quickPeer.PublicKey]; ok {
+			if stored.InterfaceName == name {
+				report.Skipped = append(report.Skipped, stored.Name)
+			} else {
+				conflict("public key belongs to peer %s on interface %s", stored.Name, stored.InterfaceName)
+			}
+			continue
+		}
+		if byName[peerName] {
+			conflict("name %s is already used", peerName)
+			continue
+		}
+
+		reserve, reason := importAddresses(iface, peerName, quickPeer.AllowedIPs, usedAddresses, report)
+		if reason != "" {
+			conflict("%s", reason)
+			continue
+		}
+
+		// Назву і адреси займає і peer, якого при dry run не збережено
+		byName[peerName] = true
+		for _, ip := range reserve {
+			usedAddresses[ip.String()] = peerName
+		}
+
+		if dryRun {
+			report.Imported = append(report.Imported, peerName)
+			continue
+		}
+
+		now := time.Now()
+		peer := &wg.Peer{
+			ID:            uuid.New(),
+			Name:          peerName,
+			PublicKey:     quickPeer.PublicKey,
+			PresharedKey:  quickPeer.PresharedKey,
+			Endpoint:      quickPeer.Endpoint,
+			AllowedIPs:    quickPeer.AllowedIPs,
+			CreatedAt:     now,
+			UpdatedAt:     now,
+			IsActive:      true,
+			InterfaceName: name,
+
+			// Keepalive у файлі сервера - з боку сервера; клієнту дістається
+			// інтервал інтерфейсу, як і новим peer'ам
+			PersistentKeepalive: iface.config.PersistentKeepalive,
+		}
+
+		if err := iface.manager.ReservePeerAddresses(peer.ID, reserve); err != nil {
+			conflict("%v", err)
+			continue
+		}
+		if err := s.storage.SavePeer(peer); err != nil {
+			if releaseErr := iface.manager.ReleasePeerIP(peer.ID); releaseErr != nil {
+				log.Printf("Failed to release IP %v: %v", reserve, releaseErr)
+			}
+			return report, fmt.Errorf("failed to save peer %s: %w", peerName, err)
+		}
+		report.Imported = append(report.Imported, peerName)
+	}
+
+	return report, nil
+}
+
+// checkImportInterface перевіряє, що секція [Interface] описує саме
+// налаштований інтерфейс: ключ, порт і адреси мають збігатися
+func checkImportInterface(iface *serverInterface, existing *wg.Interface, quick *wg.QuickInterface) error {
+	name := iface.config.Name
+	var problems []string
+
+	publicKey, err := wg.PublicKeyFromPrivate(quick.PrivateKey)
+	switch {
+	case err != nil:
+		problems = append(problems, fmt.Sprintf("invalid PrivateKey: %v", err))
+	case existing != nil && existing.PublicKey != publicKey:
+		problems = append(problems, fmt.Sprintf("PrivateKey does not match key %s already stored for %s", existing.PublicKey, name))
+	case iface.manager.PublicKey() != "" && iface.manager.PublicKey() != publicKey:
+		problems = append(problems, fmt.Sprintf("PrivateKey does not match private_key_file of %s", name))
+	}
+
+	if quick.ListenPort != 0 && quick.ListenPort != iface.manager.ListenPort() {
+		problems = append(problems, fmt.Sprintf("ListenPort %d differs from configured listen_port %d",
+			quick.ListenPort, iface.manager.ListenPort()))
+	}
+
+	configured := make(map[string]bool)
+	for _, address := range iface.manager.Addresses() {
+		configured[canonicalCIDR(address)] = true
+	}
+	for _, address := range quick.Address {
+		if !configured[canonicalCIDR(address)] {
+			problems = append(problems, fmt.Sprintf("Address %s is not configured for %s (configured: %s)",
+				address, name, strings.Join(iface.manager.Addresses(), ", ")))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("config does not match interface %s:\n  %s", name, strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// importInterfaceWarnings повертає налаштування [Interface], які не переносяться
+func importInterfaceWarnings(iface *serverInterface, quick *wg.QuickInterface) []string {
+	var warnings []string
+	if quick.MTU != 0 && quick.MTU != iface.manager.MTU() {
+		warnings = append(warnings, fmt.Sprintf("MTU %d differs from configured mtu %d", quick.MTU, iface.manager.MTU()))
+	}
+	if quick.FwMark != iface.manager.FwMark() {
+		warnings = append(warnings, fmt.Sprintf("FwMark %#x differs from configured fwmark %#x", quick.FwMark, iface.manager.FwMark()))
+	}
+	if quick.Table != "" && quick.Table != iface.manager.Table() {
+		warnings = append(warnings, fmt.Sprintf("Table %s differs from configured table %q", quick.Table, iface.manager.Table()))
+	}
+	if len(quick.DNS) > 0 {
+		warnings = append(warnings, fmt.Sprintf("DNS %s is not imported", strings.Join(quick.DNS, ", ")))
+	}
+	for _, ignored := range quick.Ignored {
+		if strings.HasPrefix(ignored, "SaveConfig") {
+			warnings = append(warnings, fmt.Sprintf("%s is not imported", ignored))
+			continue
+		}
+		warnings = append(warnings, fmt.Sprintf("%s is not imported, use the egress section for NAT", ignored))
+	}
+	return warnings
+}
+
+// importAddresses розбирає AllowedIPs peer'а і повертає адреси хостів, які
+// треба виділити в IPAM, або причину конфлікту. Адреси поза мережами IPAM
+// і маршрутизовані підмережі залишаються в AllowedIPs без виділення.
+func importAddresses(iface *serverInterface, peerName string, allowedIPs []string, used map[string]string, report *ImportReport) ([]net.IP, string) {
+	var reserve []net.IP
+	for _, allowedIP := range allowedIPs {
+		ip, network, err := net.ParseCIDR(allowedIP)
+		if err != nil {
+			return nil, fmt.Sprintf("invalid AllowedIPs entry %s", allowedIP)
+		}
+
+		ones, bits := network.Mask.Size()
+		if ones != bits {
+			for _, managed := range iface.manager.Networks() {
+				if managed.Contains(network.IP) || network.Contains(managed.IP) {
+					return nil, fmt.Sprintf("route %s overlaps IPAM network %s", allowedIP, managed)
+				}
+			}
+			continue
+		}
+
+		if owner, ok := used[ip.String()]; ok {
+			return nil, fmt.Sprintf("address %s is already used by %s in the file", ip, owner)
+		}
+		if err := iface.manager.CheckPeerAddress(ip); err != nil {
+			if errors.Is(err, wg.ErrAddressOutOfPool) && !ipInNetworks(ip, iface.manager.Networks()) {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("%s: address %s is outside of the IPAM networks and is not tracked",
+					peerName, ip))
+				continue
+			}
+			return nil, fmt.Sprintf("address %s: %v", ip, err)
+		}
+		reserve = append(reserve, ip)
+	}
+	return reserve, ""
+}
+
+// ipInNetworks перевіряє, чи адреса належить одній з мереж
+func ipInNetworks(ip net.IP, networks []*net.IPNet) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalCIDR повертає адресу з префіксом у канонічному записі для порівняння
+func canonicalCIDR(value string) string {
+	ip, network, err := net.ParseCIDR(strings.TrimSpace(value))
+	if err != nil {
+		return value
+	}
+	ones, _ := network.Mask.Size()
+	return fmt.Sprintf("%s/%d", ip, ones)
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/artem/wg-orbit/internal/storage"
+	"github.com/artem/wg-orbit/internal/wg"
+)
+
+// newImportTestConfig повертає конфігурацію wg-quick для інтерфейсу wg0 за замовчуванням
+func newImportTestConfig(t *testing.T) *wg.QuickConfig {
+	t.Helper()
+
+	serverKey, _, err := wg.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error: %v", err)
+	}
+	config := &wg.QuickConfig{
+		Interface: wg.QuickInterface{
+			PrivateKey: serverKey,
+			ListenPort: DefaultListenPort,
+			Address:    []string{"10.0.0.1/24"},
+			Ignored:    []string{"PostUp = iptables -t nat -A POSTROUTING -o eth0 -j MASQUERADE"},
+		},
+	}
+
+	peers := []struct {
+		name       string
+		allowedIPs []string
+	}{
+		{"alice", []string{"10.0.0.2/32"}},
+		{"bob", []string{"10.0.0.3/32", "192.168.10.0/24"}},
+		{"", []string{"10.0.0.4/32"}},
+		{"same-address", []string{"10.0.0.2/32"}},
+		{"gateway", []string{"10.0.0.1/32"}},
+		{"whole-network", []string{"10.0.0.0/16"}},
+	}
+	for i, peer := range peers {
+		_, publicKey, err := wg.GenerateKeyPair()
+		if err != nil {
+			t.Fatalf("GenerateKeyPair() error: %v", err)
+		}
+		config.Peers = append(config.Peers, wg.QuickPeer{
+			Name:       peer.name,
+			PublicKey:  publicKey,
+			AllowedIPs: peer.allowedIPs,
+			Line:       10 + i*4,
+		})
+	}
+	return config
+}
+
+func TestServer_Import(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage() error: %v", err)
+	}
+	defer store.Close()
+
+	backend := newFakeBackend()
+	srv, err := newServer(DefaultConfig(), store, backend)
+	if err != nil {
+		t.Fatalf("newServer() error: %v", err)
+	}
+	config := newImportTestConfig(t)
+	wantImported := "alice,bob,wg0-peer-3"
+
+	// Dry run лише звітує
+	report, err := srv.Import("", config, true)
+	if err != nil {
+		t.Fatalf("Import(dry run) error: %v", err)
+	}
+	if got := strings.Join(report.Imported, ","); got != wantImported || !report.InterfaceCreated {
+		t.Errorf("dry run imported %q (interface created: %v), want %q", got, report.InterfaceCreated, wantImported)
+	}
+	if iface, _ := store.GetInterface("wg0"); iface != nil {
+		t.Errorf("dry run saved interface %+v", iface)
+	}
+	if peers, _ := store.ListPeers(); len(peers) != 0 {
+		t.Errorf("dry run saved %d peer(s)", len(peers))
+	}
+
+	report, err = srv.Import("", config, false)
+	if err != nil {
+		t.Fatalf("Import() error: %v", err)
+	}
+	if got := strings.Join(report.Imported, ","); got != wantImported {
+		t.Errorf("imported %q, want %q", got, wantImported)
+	}
+	var conflicts []string
+	for _, conflict := range report.Conflicts {
+		conflicts = append(conflicts, conflict.Name+": "+conflict.Reason)
+	}
+	wantConflicts := []string{
+		"same-address: address 10.0.0.2 is already used by alice in the file",
+		"gateway: address 10.0.0.1: address is outside of the pool: 10.0.0.1 cannot be assigned to a peer",
+		"whole-network: route 10.0.0.0/16 overlaps IPAM network 10.0.0.0/24",
+	}
+	if strings.Join(conflicts, "\n") != strings.Join(wantConflicts, "\n") {
+		t.Errorf("conflicts:\n%s\nwant:\n%s", strings.Join(conflicts, "\n"), strings.Join(wantConflicts, "\n"))
+	}
+	if len(report.Warnings) != 1 || !strings.Contains(report.Warnings[0], "PostUp") {
+		t.Errorf("warnings = %q, want PostUp", report.Warnings)
+	}
+
+	// Інтерфейс зберігається з ключем із файлу
+	serverPublicKey, _ := wg.PublicKeyFromPrivate(config.Interface.PrivateKey)
+	iface, err := store.GetInterface("wg0")
+	if err != nil || iface == nil || iface.PublicKey != serverPublicKey {
+		t.Fatalf("GetInterface() = %+v, %v, want public key %s", iface, err, serverPublicKey)
+	}
+
+	bob, err := store.GetPeerByName("bob")
+	if err != nil || bob == nil {
+		t.Fatalf("GetPeerByName(bob) = %v, %v", bob, err)
+	}
+	if bob.PrivateKey != "" || bob.InterfaceName != "wg0" || strings.Join(bob.AllowedIPs, ",") != "10.0.0.3/32,192.168.10.0/24" {
+		t.Errorf("bob = %+v", bob)
+	}
+
+	// Адреси імпортованих peer'ів зайняті в IPAM
+	if err := srv.AddUser("", "dave", "", nil); err != nil {
+		t.Fatalf("AddUser() error: %v", err)
+	}
+	dave, _ := store.GetPeerByName("dave")
+	if dave == nil || strings.Join(dave.AllowedIPs, ",") != "10.0.0.5/32" {
+		t.Errorf("dave = %+v, want 10.0.0.5/32", dave)
+	}
+
+	// Повторний імпорт нічого не дублює
+	report, err = srv.Import("", config, false)
+	if err != nil {
+		t.Fatalf("repeated Import() error: %v", err)
+	}
+	if len(report.Imported) != 0 || strings.Join(report.Skipped, ",") != wantImported || report.InterfaceCreated {
+		t.Errorf("repeated import: imported %q, skipped %q", report.Imported, report.Skipped)
+	}
+
+	// init переймає інтерфейс з імпортованим ключем і застосовує peer'ів
+	if err := srv.Initialize(""); err != nil {
+		t.Fatalf("Initialize() error: %v", err)
+	}
+	link := backend.links["wg0"]
+	if link.device.PrivateKey != config.Interface.PrivateKey || len(link.peers) != 4 {
+		t.Errorf("device key match: %v, peers: %d, want imported key and 4 peers",
+			link.device.PrivateKey == config.Interface.PrivateKey, len(link.peers))
+	}
+}
+
+func TestServer_ImportMismatch(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage() error: %v", err)
+	}
+	defer store.Close()
+
+	srv, err := newServer(DefaultConfig(), store, newFakeBackend())
+	if err != nil {
+		t.Fatalf("newServer() error: %v", err)
+	}
+	if err := srv.Initialize(""); err != nil {
+		t.Fatalf("Initialize() error: %v", err)
+	}
+
+	// Ключ інтерфейсу вже згенеровано, порт і адреса відрізняються
+	config := newImportTestConfig(t)
+	config.Interface.ListenPort = 51000
+	config.Interface.Address = []string{"10.9.0.1/24"}
+
+	_, err = srv.Import("", config, false)
+	if err == nil {
+		t.Fatal("Import() succeeded, want mismatch error")
+	}
+	for _, want := range []string{"PrivateKey does not match", "ListenPort 51000", "Address 10.9.0.1/24"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Import() error = %v, want %q", err, want)
+		}
+	}
+	if peers, _ := store.ListPeers(); len(peers) != 0 {
+		t.Errorf("failed import saved %d peer(s)", len(peers))
+	}
+}
@@ -1,133 +1,424 @@
 package server
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net"
-	"os/exec"
+	"os"
 	"strconv"
 	"strings"
+	"sync"
 
+	"github.com/artem/wg-orbit/internal/netdev"
+	"github.com/artem/wg-orbit/internal/storage"
 	"github.com/artem/wg-orbit/internal/wg"
 )
 
+const (
+	// DefaultListenPort - стандартний UDP порт WireGuard
+	DefaultListenPort = 51820
+
+	// minMTU - мінімальне MTU, з яким працює IPv6 (RFC 8200)
+	minMTU = 1280
+
+	// mainRouteTable - номер основної таблиці маршрутів Linux
+	mainRouteTable = 254
+)
+
 // InterfaceManager керує WireGuard інтерфейсом
 type InterfaceManager struct {
 	interfaceName string
+	address       string
+	address6      string
 	privateKey    string
 	publicKey     string
 	listenPort    int
+	mtu           int // 0 - MTU за замовчуванням
+	fwMark        int // 0 - не встановлено
+	table         string
+	routeTable    int // 0 - маршрути лише в основній таблиці
 	ipPool        *wg.IPPool
+	ipPool6       *wg.IPPool // nil, якщо IPv6 не налаштовано
+	backend       netdev.Backend
+	storage       storage.Storage
+	mu            sync.Mutex
 }
 
-// NewInterfaceManager створює новий менеджер інтерфейсу
-func NewInterfaceManager(interfaceName, network string) (*InterfaceManager, error) {
-	// Генеруємо ключі для інтерфейсу
-	privateKey, publicKey, err := wg.GenerateKeyPair()
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate keys: %w", err)
+// InterfaceOptions описує налаштування WireGuard інтерфейсу та його пулу адрес
+type InterfaceOptions struct {
+	Name     string   // назва інтерфейсу, напр. wg0
+	Address  string   // адреса сервера в тунелі, напр. 10.0.0.1/24
+	Network  string   // мережа, з якої видаються адреси peer'ам
+	StartIP  string   // перша адреса діапазону для peer'ів
+	EndIP    string   // остання адреса діапазону для peer'ів
+	Reserved []string // адреси (IPv4 або IPv6), які не видаються автоматично
+	Network6 string   // необов'язковий IPv6 ULA префікс для dual-stack, напр. fd00:77::/64
+	Address6 string   // IPv6 адреса сервера в тунелі, напр. fd00:77::1/64
+
+	ListenPort int    // UDP порт, 0 - стандартний 51820
+	MTU        int    // MTU інтерфейсу, 0 - значення за замовчуванням
+	FwMark     int    // fwmark для вихідних пакетів WireGuard, 0 - не встановлено
+	Table      string // таблиця для маршрутів до тунельних мереж: "", auto, main або номер
+
+	// PrivateKeyFile - необов'язковий файл з приватним ключем сервера
+	PrivateKeyFile string
+
+	// Backend керує мережевим пристроєм; nil - вибрати автоматично
+	Backend netdev.Backend
+}
+
+// NewInterfaceManager створює новий менеджер інтерфейсу.
+// Ключ сервера і пул адрес відновлюються з бази даних, тому ідентичність
+// сервера і виділені раніше адреси зберігаються між перезапусками.
+func NewInterfaceManager(opts InterfaceOptions, store storage.Storage) (*InterfaceManager, error) {
+	var err error
+
+	// Адреса сервера за замовчуванням - перша адреса мережі
+	address := opts.Address
+	if address == "" {
+		address, err = defaultInterfaceAddress(opts.Network)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	// Створюємо IP пул
-	ipPool, err := wg.NewIPPool(network)
+	reserved4, reserved6 := splitByFamily(opts.Reserved)
+
+	// Створюємо IP пул, виключаючи адресу сервера
+	ipPool, err := wg.NewIPPoolWithOptions(opts.Network, wg.IPPoolOptions{
+		StartIP:  opts.StartIP,
+		EndIP:    opts.EndIP,
+		Gateway:  address,
+		Reserved: reserved4,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create IP pool: %w", err)
 	}
 
-	return &InterfaceManager{
-		interfaceName: interfaceName,
-		privateKey:    privateKey,
-		publicKey:     publicKey,
-		listenPort:    51820, // Стандартний порт WireGuard
+	listenPort := opts.ListenPort
+	if listenPort == 0 {
+		listenPort = DefaultListenPort
+	}
+	if listenPort < 0 || listenPort > 65535 {
+		return nil, fmt.Errorf("invalid listen port: %d", listenPort)
+	}
+	if opts.MTU < 0 || (opts.MTU > 0 && opts.MTU < minMTU) {
+		return nil, fmt.Errorf("invalid MTU: %d, must be at least %d", opts.MTU, minMTU)
+	}
+	if opts.FwMark < 0 {
+		return nil, fmt.Errorf("invalid fwmark: %d", opts.FwMark)
+	}
+	routeTable, err := parseRouteTable(opts.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	backend := opts.Backend
+	if backend == nil {
+		backend, err = netdev.New(netdev.BackendAuto)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create network backend: %w", err)
+		}
+	}
+
+	im := &InterfaceManager{
+		interfaceName: opts.Name,
+		address:       address,
+		listenPort:    listenPort,
+		mtu:           opts.MTU,
+		fwMark:        opts.FwMark,
+		table:         opts.Table,
+		routeTable:    routeTable,
 		ipPool:        ipPool,
-	}, nil
+		backend:       backend,
+		storage:       store,
+	}
+
+	// Необов'язковий IPv6 пул для dual-stack
+	if opts.Network6 != "" {
+		im.address6 = opts.Address6
+		if im.address6 == "" {
+			// Адреса сервера за замовчуванням - prefix::1
+			im.address6, err = defaultInterfaceAddress(opts.Network6)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		im.ipPool6, err = wg.NewIPPoolWithOptions(opts.Network6, wg.IPPoolOptions{
+			Gateway:  im.address6,
+			Reserved: reserved6,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to create IPv6 pool: %w", err)
+		}
+	}
+
+	if err := im.loadKey(opts.PrivateKeyFile); err != nil {
+		return nil, fmt.Errorf("failed to load server key: %w", err)
+	}
+
+	if err := im.loadAllocations(); err != nil {
+		return nil, fmt.Errorf("failed to load IP allocations: %w", err)
+	}
+
+	return im, nil
 }
 
-// CreateInterface створює WireGuard інтерфейс
+// loadKey завантажує ключ сервера з бази даних або з privateKeyFile.
+// Якщо ключа немає ніде, він буде згенерований при першій ініціалізації.
+func (im *InterfaceManager) loadKey(privateKeyFile string) error {
+	stored, err := im.storage.GetInterface(im.interfaceName)
+	if err != nil {
+		return fmt.Errorf("failed to load interface: %w", err)
+	}
+
+	var fileKey string
+	if privateKeyFile != "" {
+		data, err := os.ReadFile(privateKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read private key file: %w", err)
+		}
+		fileKey = strings.TrimSpace(string(data))
+		if err := wg.ValidatePrivateKey(fileKey); err != nil {
+			return fmt.Errorf("invalid private key in %s: %w", privateKeyFile, err)
+		}
+	}
+
+	switch {
+	case stored != nil && fileKey != "" && stored.PrivateKey != fileKey:
+		return fmt.Errorf("private key in %s does not match the key stored for interface %s", privateKeyFile, im.interfaceName)
+	case stored != nil:
+		im.privateKey = stored.PrivateKey
+	case fileKey != "":
+		im.privateKey = fileKey
+	default:
+		return nil
+	}
+
+	im.publicKey, err = wg.PublicKeyFromPrivate(im.privateKey)
+	if err != nil {
+		return fmt.Errorf("invalid server private key: %w", err)
+	}
+	if stored != nil && stored.PublicKey != im.publicKey {
+		return fmt.Errorf("stored public key of interface %s does not match its private key", im.interfaceName)
+	}
+
+	return nil
+}
+
+// EnsureKey генерує ключ сервера, якщо його ще немає.
+// Повертає true, якщо ключ щойно згенеровано.
+func (im *InterfaceManager) EnsureKey() (bool, error) {
+	if im.privateKey != "" {
+		return false, nil
+	}
+
+	privateKey, publicKey, err := wg.GenerateKeyPair()
+	if err != nil {
+		return false, fmt.Errorf("failed to generate keys: %w", err)
+	}
+
+	im.privateKey = privateKey
+	im.publicKey = publicKey
+	return true, nil
+}
+
+// AdoptKey встановлює наявний ключ сервера, наприклад з імпортованої
+// конфігурації wg-quick. Вже відомий менеджеру ключ не замінюється іншим.
+func (im *InterfaceManager) AdoptKey(privateKey string) error {
+	publicKey, err := wg.PublicKeyFromPrivate(privateKey)
+	if err != nil {
+		return fmt.Errorf("invalid server private key: %w", err)
+	}
+	if im.privateKey != "" && im.privateKey != privateKey {
+		return fmt.Errorf("interface %s already has server key %s", im.interfaceName, im.publicKey)
+	}
+
+	im.privateKey = privateKey
+	im.publicKey = publicKey
+	return nil
+}
+
+// CreateInterface створює і налаштовує WireGuard інтерфейс.
+//
+// Кожен крок, який можна скасувати, записує дію відкату; якщо наступний
+// крок не вдався, виконані кроки скасовуються у зворотному порядку, тому
+// створений інтерфейс і додані адреси не залишаються в системі.
+// Інтерфейс, що вже існує (наприклад, після перерваного init), переймається:
+// відсутні налаштування доповнюються, а сам інтерфейс при відкаті не видаляється.
 func (im *InterfaceManager) CreateInterface() error {
+	if im.privateKey == "" {
+		return fmt.Errorf("server key for %s is not initialized", im.interfaceName)
+	}
+
+	// Спочатку перевіряємо, чи доступний WireGuard
+	if err := im.backend.Available(); err != nil {
+		if im.backend.Name() == netdev.BackendUserspace {
+			return fmt.Errorf("TUN device is not available (%s backend): %w. Make sure /dev/net/tun is present and the process has CAP_NET_ADMIN", im.backend.Name(), err)
+		}
+		return fmt.Errorf("WireGuard kernel module is not available (%s backend): %w. This is common on macOS Docker Desktop and in containers; consider the userspace backend, a Linux VM or native Linux", im.backend.Name(), err)
+	}
+
 	// Перевіряємо, чи інтерфейс вже існує
-	if im.interfaceExists() {
-		return fmt.Errorf("interface %s already exists", im.interfaceName)
+	exists, err := im.backend.LinkExists(im.interfaceName)
+	if err != nil {
+		return fmt.Errorf("failed to check interface: %w", err)
+	}
+	if exists {
+		log.Printf("Interface %s already exists, adopting and repairing it", im.interfaceName)
 	}
 
-	// Спочатку перевіряємо, чи доступний WireGuard модуль
-	if !im.isWireGuardAvailable() {
-		return fmt.Errorf("WireGuard kernel module is not available. This is common on macOS Docker Desktop. For development, consider using Linux VM or native Linux")
+	var undo undoStack
+	if err := im.setupLink(!exists, &undo); err != nil {
+		if rollbackErr := undo.unwind(); rollbackErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rollbackErr)
+		}
+		return err
 	}
+	return nil
+}
+
+// setupLink виконує кроки створення інтерфейсу, записуючи дії відкату в undo.
+// Кроки ідемпотентні, тому повторюються і для вже існуючого інтерфейсу.
+func (im *InterfaceManager) setupLink(create bool, undo *undoStack) error {
+	name := im.interfaceName
 
-	// Створюємо інтерфейс
-	cmd := exec.Command("ip", "link", "add", "dev", im.interfaceName, "type", "wireguard")
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to create interface: %w", err)
+	// Створюємо інтерфейс; його видалення скасовує і всі наступні кроки
+	if create {
+		if err := im.backend.CreateLink(name); err != nil {
+			return fmt.Errorf("failed to create interface: %w", err)
+		}
+		undo.push("delete interface "+name, func() error {
+			return im.backend.DeleteLink(name)
+		})
 	}
 
-	// Встановлюємо приватний ключ
-	cmd = exec.Command("wg", "set", im.interfaceName, "private-key", "/dev/stdin")
-	cmd.Stdin = strings.NewReader(im.privateKey)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to set private key: %w", err)
+	// Встановлюємо приватний ключ, порт і fwmark. Попередні значення
+	// пристрою невідомі, тому цей і наступні кроки без зміни складу
+	// інтерфейсу не скасовуються
+	err := im.backend.ConfigureDevice(name, netdev.DeviceConfig{
+		PrivateKey: im.privateKey,
+		ListenPort: im.listenPort,
+		FwMark:     im.fwMark,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to configure device: %w", err)
 	}
 
-	// Встановлюємо порт
-	cmd = exec.Command("wg", "set", im.interfaceName, "listen-port", strconv.Itoa(im.listenPort))
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to set listen port: %w", err)
+	if im.mtu > 0 {
+		if err := im.backend.SetMTU(name, im.mtu); err != nil {
+			return fmt.Errorf("failed to set MTU: %w", err)
+		}
 	}
 
-	// Встановлюємо IP адресу інтерфейсу
-	networkIP := im.ipPool.Network.IP.String()
-	mask, _ := im.ipPool.Network.Mask.Size()
-	interfaceAddr := fmt.Sprintf("%s/%d", networkIP, mask)
+	// Встановлюємо IP адреси інтерфейсу; вже призначені адреси залишаються як є
+	for _, address := range im.Addresses() {
+		err := im.backend.AddAddress(name, address)
+		if errors.Is(err, netdev.ErrAddressExists) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to set interface address: %w", err)
+		}
 
-	cmd = exec.Command("ip", "addr", "add", interfaceAddr, "dev", im.interfaceName)
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("failed to set interface address: %w", err)
+		undo.push("delete address "+address, func() error {
+			return im.backend.DeleteAddress(name, address)
+		})
 	}
 
 	// Піднімаємо інтерфейс
-	cmd = exec.Command("ip", "link", "set", "up", "dev", im.interfaceName)
-	if err := cmd.Run(); err != nil {
+	if err := im.backend.SetLinkUp(name); err != nil {
 		return fmt.Errorf("failed to bring up interface: %w", err)
 	}
 
+	// Дублюємо маршрути до тунельних мереж в окрему таблицю.
+	// Маршрут замінюється, якщо вже існує, і зникає разом з інтерфейсом
+	if im.routeTable > 0 {
+		for _, address := range im.Addresses() {
+			_, network, err := net.ParseCIDR(address)
+			if err != nil {
+				return fmt.Errorf("invalid interface address %s: %w", address, err)
+			}
+			if err := im.backend.AddRoute(name, network.String(), im.routeTable); err != nil {
+				return fmt.Errorf("failed to add route to table %d: %w", im.routeTable, err)
+			}
+		}
+	}
+
 	return nil
 }
 
-// interfaceExists перевіряє, чи існує інтерфейс
-func (im *InterfaceManager) interfaceExists() bool {
-	cmd := exec.Command("ip", "link", "show", im.interfaceName)
-	return cmd.Run() == nil
+// undoStack накопичує дії, що скасовують виконані кроки
+type undoStack struct {
+	steps []undoStep
 }
 
-// isWireGuardAvailable перевіряє, чи доступний WireGuard модуль
-func (im *InterfaceManager) isWireGuardAvailable() bool {
-	// Спробуємо завантажити модуль
-	cmd := exec.Command("modprobe", "wireguard")
-	if err := cmd.Run(); err != nil {
-		return false
-	}
+// undoStep - дія відкату з описом для повідомлення про помилку
+type undoStep struct {
+	name string
+	undo func() error
+}
+
+// push додає дію відкату для щойно виконаного кроку
+func (u *undoStack) push(name string, undo func() error) {
+	u.steps = append(u.steps, undoStep{name: name, undo: undo})
+}
 
-	// Перевіряємо, чи можемо створити тестовий інтерфейс
-	testInterface := "wg-test-" + im.interfaceName
-	cmd = exec.Command("ip", "link", "add", "dev", testInterface, "type", "wireguard")
-	if err := cmd.Run(); err != nil {
-		return false
+// unwind виконує дії відкату у зворотному порядку. Помилка одного кроку
+// не зупиняє відкат решти; повертаються всі помилки разом.
+func (u *undoStack) unwind() error {
+	var errs []error
+	for i := len(u.steps) - 1; i >= 0; i-- {
+		step := u.steps[i]
+		if err := step.undo(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", step.name, err))
+		}
 	}
+	u.steps = nil
+	return errors.Join(errs...)
+}
 
-	// Видаляємо тестовий інтерфейс
-	cmd = exec.Command("ip", "link", "del", "dev", testInterface)
-	cmd.Run() // Ігноруємо помилку видалення
+// DeleteInterface видаляє WireGuard інтерфейс. Разом з ним ядро видаляє
+// його адреси і маршрути, в тому числі з окремої таблиці маршрутів.
+// Повертає false, якщо інтерфейсу вже не було.
+func (im *InterfaceManager) DeleteInterface() (bool, error) {
+	exists, err := im.backend.LinkExists(im.interfaceName)
+	if err != nil {
+		return false, fmt.Errorf("failed to check interface: %w", err)
+	}
+	if !exists {
+		return false, nil
+	}
 
-	return true
+	if err := im.backend.DeleteLink(im.interfaceName); err != nil {
+		// Інтерфейс міг зникнути між перевіркою і видаленням
+		if errors.Is(err, netdev.ErrLinkNotFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to delete interface: %w", err)
+	}
+	return true, nil
 }
 
-// AllocateIP виділяє нову IP адресу
-func (im *InterfaceManager) AllocateIP() (net.IP, error) {
-	return im.ipPool.AllocateIP()
-}
+// parseRouteTable розбирає налаштування таблиці маршрутів.
+// Порожнє значення, auto і main означають основну таблицю, де ядро
+// вже створює маршрути до мереж адрес інтерфейсу; для них повертається 0.
+func parseRouteTable(table string) (int, error) {
+	switch table {
+	case "", "auto", "main":
+		return 0, nil
+	}
 
-// ReleaseIP звільняє IP адресу
-func (im *InterfaceManager) ReleaseIP(ip net.IP) {
-	im.ipPool.ReleaseIP(ip)
+	id, err := strconv.ParseUint(table, 10, 32)
+	if err != nil || id == 0 {
+		return 0, fmt.Errorf("invalid routing table %q: must be auto, main or a table number", table)
+	}
+	if id == mainRouteTable {
+		return 0, nil
+	}
+	return int(id), nil
 }
 
 // PublicKey повертає публічний ключ інтерфейсу
@@ -140,7 +431,49 @@ func (im *InterfaceManager) PrivateKey() string {
 	return im.privateKey
 }
 
+// Address повертає IPv4 адресу інтерфейсу з префіксом мережі
+func (im *InterfaceManager) Address() string {
+	return im.address
+}
+
+// Addresses повертає всі адреси інтерфейсу (IPv4 та, якщо налаштовано, IPv6)
+func (im *InterfaceManager) Addresses() []string {
+	if im.address6 == "" {
+		return []string{im.address}
+	}
+	return []string{im.address, im.address6}
+}
+
+// Backend повертає мережевий backend інтерфейсу
+func (im *InterfaceManager) Backend() netdev.Backend {
+	return im.backend
+}
+
 // ListenPort повертає порт прослуховування
 func (im *InterfaceManager) ListenPort() int {
 	return im.listenPort
 }
+
+// MTU повертає MTU інтерфейсу, 0 - значення за замовчуванням
+func (im *InterfaceManager) MTU() int {
+	return im.mtu
+}
+
+// FwMark повертає fwmark інтерфейсу, 0 - не встановлено
+func (im *InterfaceManager) FwMark() int {
+	return im.fwMark
+}
+
+// Table повертає налаштування таблиці маршрутів
+func (im *InterfaceManager) Table() string {
+	return im.table
+}
+
+// Networks повертає тунельні мережі інтерфейсу (IPv4 та, якщо налаштовано, IPv6)
+func (im *InterfaceManager) Networks() []*net.IPNet {
+	networks := []*net.IPNet{im.ipPool.Network}
+	if im.ipPool6 != nil {
+		networks = append(networks, im.ipPool6.Network)
+	}
+	return networks
+}
@@ -0,0 +1,324 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/artem/wg-orbit/internal/netdev"
+	"github.com/artem/wg-orbit/internal/storage"
+	"github.com/artem/wg-orbit/internal/wg"
+)
+
+func TestInterfaceManager_ReusesStoredKey(t *testing.T) {
+	dir := t.TempDir()
+	store, err := storage.NewSQLiteStorage(filepath.Join(dir, "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage() error: %v", err)
+	}
+	defer store.Close()
+
+	opts := InterfaceOptions{Name: "wg0", Network: "10.0.0.0/24", Backend: &peerDevice{}}
+
+	// Перший запуск: ключа ще немає, він генерується при ініціалізації
+	im, err := NewInterfaceManager(opts, store)
+	if err != nil {
+		t.Fatalf("NewInterfaceManager() error: %v", err)
+	}
+	if im.PrivateKey() != "" {
+		t.Fatalf("PrivateKey() = %q before init, want empty", im.PrivateKey())
+	}
+	if generated, err := im.EnsureKey(); err != nil || !generated {
+		t.Fatalf("EnsureKey() = %v, %v, want generated", generated, err)
+	}
+	if err := store.SaveInterface(&wg.Interface{
+		Name:       "wg0",
+		PrivateKey: im.PrivateKey(),
+		PublicKey:  im.PublicKey(),
+		ListenPort: im.ListenPort(),
+		Address:    im.Address(),
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}); err != nil {
+		t.Fatalf("SaveInterface() error: %v", err)
+	}
+
+	// Перезапуск: ключ береться з бази даних
+	restarted, err := NewInterfaceManager(opts, store)
+	if err != nil {
+		t.Fatalf("NewInterfaceManager() after restart error: %v", err)
+	}
+	if restarted.PublicKey() != im.PublicKey() {
+		t.Errorf("PublicKey() = %q after restart, want %q", restarted.PublicKey(), im.PublicKey())
+	}
+	if generated, err := restarted.EnsureKey(); err != nil || generated {
+		t.Errorf("EnsureKey() after restart = %v, %v, want existing key", generated, err)
+	}
+
+	// Файл з іншим ключем не може тихо замінити збережений
+	otherKey, _, err := wg.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error: %v", err)
+	}
+	keyFile := filepath.Join(dir, "server.key")
+	if err := os.WriteFile(keyFile, []byte(otherKey+"\n"), 0600); err != nil {
+		t.Fatalf("WriteFile() error: %v", err)
+	}
+	opts.PrivateKeyFile = keyFile
+	if _, err := NewInterfaceManager(opts, store); err == nil {
+		t.Error("NewInterfaceManager() with mismatching key file succeeded, want error")
+	}
+}
+
+func TestInterfaceManager_ReleasesDeletedPeerAddresses(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage() error: %v", err)
+	}
+	defer store.Close()
+
+	// Адреса залишилась за peer'ом, якого вже немає в базі даних
+	if err := store.SaveAllocation(&wg.IPAllocation{
+		InterfaceName: "wg0",
+		Address:       "10.0.0.2",
+		PeerID:        uuid.New(),
+		CreatedAt:     time.Now(),
+	}); err != nil {
+		t.Fatalf("SaveAllocation() error: %v", err)
+	}
+
+	im, err := NewInterfaceManager(InterfaceOptions{Name: "wg0", Network: "10.0.0.0/24", Backend: &peerDevice{}}, store)
+	if err != nil {
+		t.Fatalf("NewInterfaceManager() error: %v", err)
+	}
+	if allocations, err := store.ListAllocations("wg0"); err != nil || len(allocations) != 0 {
+		t.Errorf("ListAllocations() = %v, %v, want orphaned address released", allocations, err)
+	}
+
+	addresses, err := im.AllocatePeerAddresses(uuid.New(), net.ParseIP("10.0.0.2"))
+	if err != nil || len(addresses) != 1 || addresses[0] != "10.0.0.2/32" {
+		t.Errorf("AllocatePeerAddresses() = %v, %v, want released address", addresses, err)
+	}
+}
+
+func TestInterfaceManager_CreateInterface(t *testing.T) {
+	backend := newFakeBackend()
+	im := newCreateTestManager(t, backend)
+
+	if err := im.CreateInterface(); err != nil {
+		t.Fatalf("CreateInterface() error: %v", err)
+	}
+
+	want := []string{
+		"CreateLink wg0",
+		"ConfigureDevice wg0 51821 51820",
+		"SetMTU wg0 1380",
+		"AddAddress wg0 10.0.0.1/24",
+		"AddAddress wg0 fd00:77::1/64",
+		"SetLinkUp wg0",
+		"AddRoute wg0 10.0.0.0/24 1234",
+		"AddRoute wg0 fd00:77::/64 1234",
+	}
+	if got := backend.mutations(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calls = %q, want %q", got, want)
+	}
+
+	link := backend.links["wg0"]
+	if link == nil || !link.up {
+		t.Fatalf("link = %+v, want wg0 up", link)
+	}
+	if link.device.PrivateKey != im.PrivateKey() {
+		t.Errorf("device private key was not set to the server key")
+	}
+}
+
+func TestInterfaceManager_CreateInterfaceAdopt(t *testing.T) {
+	backend := newFakeBackend()
+	im := newCreateTestManager(t, backend)
+
+	// Попередній init перервався: інтерфейс є, але без ключа, IPv6 адреси і не піднятий
+	if err := backend.CreateLink("wg0"); err != nil {
+		t.Fatalf("CreateLink() error: %v", err)
+	}
+	if err := backend.AddAddress("wg0", "10.0.0.1/24"); err != nil {
+		t.Fatalf("AddAddress() error: %v", err)
+	}
+	backend.calls = nil
+
+	if err := im.CreateInterface(); err != nil {
+		t.Fatalf("CreateInterface() over half-configured interface error: %v", err)
+	}
+
+	for _, call := range backend.mutations() {
+		if strings.HasPrefix(call, "CreateLink") || strings.HasPrefix(call, "Delete") {
+			t.Errorf("unexpected call %q while adopting", call)
+		}
+	}
+	link := backend.links["wg0"]
+	if link == nil || !link.up || link.device.PrivateKey != im.PrivateKey() || link.mtu != 1380 {
+		t.Fatalf("link = %+v, want repaired wg0", link)
+	}
+	if strings.Join(link.addresses, ",") != "10.0.0.1/24,fd00:77::1/64" {
+		t.Errorf("addresses = %v, want both addresses once", link.addresses)
+	}
+	if len(link.routes) != 2 {
+		t.Errorf("routes = %v, want both tunnel networks", link.routes)
+	}
+
+	// Повторний виклик на готовому інтерфейсі нічого не ламає
+	if err := im.CreateInterface(); err != nil {
+		t.Fatalf("second CreateInterface() error: %v", err)
+	}
+	if len(link.addresses) != 2 || len(link.routes) != 2 {
+		t.Errorf("link = %+v after repeated init, want no duplicates", link)
+	}
+}
+
+func TestInterfaceManager_CreateInterfaceAdoptRollback(t *testing.T) {
+	backend := newFakeBackend()
+	im := newCreateTestManager(t, backend)
+	if err := backend.CreateLink("wg0"); err != nil {
+		t.Fatalf("CreateLink() error: %v", err)
+	}
+	if err := backend.AddAddress("wg0", "10.0.0.1/24"); err != nil {
+		t.Fatalf("AddAddress() error: %v", err)
+	}
+	backend.failures["AddRoute"] = errors.New("operation not permitted")
+
+	if err := im.CreateInterface(); err == nil {
+		t.Fatal("CreateInterface() succeeded, want route error")
+	}
+
+	// Перейнятий інтерфейс залишається; знімається лише додана адреса
+	link := backend.links["wg0"]
+	if link == nil {
+		t.Fatal("adopted interface was deleted on rollback")
+	}
+	if strings.Join(link.addresses, ",") != "10.0.0.1/24" {
+		t.Errorf("addresses = %v, want only the address that existed before", link.addresses)
+	}
+}
+
+func TestInterfaceManager_CreateInterfaceUnavailable(t *testing.T) {
+	backend := newFakeBackend()
+	backend.unavailable = netdev.ErrNotSupported
+	im := newCreateTestManager(t, backend)
+
+	err := im.CreateInterface()
+	if !errors.Is(err, netdev.ErrNotSupported) {
+		t.Fatalf("CreateInterface() error = %v, want ErrNotSupported", err)
+	}
+	if !strings.Contains(err.Error(), "kernel module") {
+		t.Errorf("CreateInterface() error = %q, want a hint about the kernel module", err)
+	}
+	if got := backend.mutations(); len(got) != 0 {
+		t.Errorf("calls = %q, want none", got)
+	}
+}
+
+func TestInterfaceManager_CreateInterfaceRollback(t *testing.T) {
+	for _, op := range []string{"ConfigureDevice", "SetMTU", "AddAddress", "SetLinkUp", "AddRoute"} {
+		t.Run(op, func(t *testing.T) {
+			backend := newFakeBackend()
+			im := newCreateTestManager(t, backend)
+			cause := errors.New("operation not permitted")
+			backend.failures[op] = cause
+
+			err := im.CreateInterface()
+			if !errors.Is(err, cause) {
+				t.Fatalf("CreateInterface() error = %v, want %v", err, cause)
+			}
+
+			// Напівналаштований інтерфейс видалено
+			if backend.links["wg0"] != nil {
+				t.Error("interface left behind after failed configuration")
+			}
+			calls := backend.mutations()
+			if calls[len(calls)-1] != "DeleteLink wg0" {
+				t.Errorf("last call = %q, want DeleteLink wg0", calls[len(calls)-1])
+			}
+
+			// Після усунення причини ініціалізація проходить з нуля
+			delete(backend.failures, op)
+			if err := im.CreateInterface(); err != nil {
+				t.Fatalf("CreateInterface() after fix error: %v", err)
+			}
+		})
+	}
+}
+
+func TestInterfaceManager_CreateInterfaceRollbackFails(t *testing.T) {
+	backend := newFakeBackend()
+	im := newCreateTestManager(t, backend)
+	backend.failures["SetLinkUp"] = errors.New("no buffer space available")
+	backend.failures["DeleteLink"] = errors.New("device or resource busy")
+
+	err := im.CreateInterface()
+	if err == nil || !strings.Contains(err.Error(), "rollback failed") {
+		t.Fatalf("CreateInterface() error = %v, want rollback failure", err)
+	}
+}
+
+// newCreateTestManager створює менеджер dual-stack інтерфейсу wg0 з
+// окремою таблицею маршрутів і згенерованим ключем
+func newCreateTestManager(t *testing.T, backend netdev.Backend) *InterfaceManager {
+	t.Helper()
+
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage() error: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	im, err := NewInterfaceManager(InterfaceOptions{
+		Name:       "wg0",
+		Network:    "10.0.0.0/24",
+		Network6:   "fd00:77::/64",
+		ListenPort: 51821,
+		MTU:        1380,
+		FwMark:     51820,
+		Table:      "1234",
+		Backend:    backend,
+	}, store)
+	if err != nil {
+		t.Fatalf("NewInterfaceManager() error: %v", err)
+	}
+	if _, err := im.EnsureKey(); err != nil {
+		t.Fatalf("EnsureKey() error: %v", err)
+	}
+	return im
+}
+
+func TestParseRouteTable(t *testing.T) {
+	tests := []struct {
+		table   string
+		want    int
+		wantErr bool
+	}{
+		{table: "", want: 0},
+		{table: "auto", want: 0},
+		{table: "main", want: 0},
+		{table: "254", want: 0},
+		{table: "1234", want: 1234},
+		{table: "off", wantErr: true},
+		{table: "0", wantErr: true},
+		{table: "-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRouteTable(tt.table)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRouteTable(%q) error = %v, wantErr %v", tt.table, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseRouteTable(%q) = %d, want %d", tt.table, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/artem/wg-orbit/internal/egress"
+)
+
+// InterfaceConfig описує один WireGuard інтерфейс сервера.
+// Кожен інтерфейс має власний пул адрес, порт і ключ.
+type InterfaceConfig struct {
+	Name         string   `yaml:"name" json:"name"`
+	Address      string   `yaml:"address" json:"address"`
+	Address6     string   `yaml:"address6" json:"address6"`
+	IPAMNetwork  string   `yaml:"ipam_network" json:"ipam_network"`
+	IPAMStartIP  string   `yaml:"ipam_start_ip" json:"ipam_start_ip"`
+	IPAMEndIP    string   `yaml:"ipam_end_ip" json:"ipam_end_ip"`
+	IPAMReserved []string `yaml:"ipam_reserved" json:"ipam_reserved"`
+	IPAMNetwork6 string   `yaml:"ipam_network6" json:"ipam_network6"`
+
+	PrivateKeyFile string `yaml:"private_key_file" json:"private_key_file"`
+	ListenPort     int    `yaml:"listen_port" json:"listen_port"`
+	MTU            int    `yaml:"mtu" json:"mtu"`
+	FwMark         int    `yaml:"fwmark" json:"fwmark"`
+	Table          string `yaml:"table" json:"table"`
+
+	// PersistentKeepalive - інтервал keepalive за замовчуванням для нових peer'ів
+	PersistentKeepalive int `yaml:"persistent_keepalive" json:"persistent_keepalive"`
+}
+
+// InterfaceConfigs повертає налаштування всіх інтерфейсів сервера.
+// Без списку Interfaces сервер керує одним інтерфейсом, описаним полями
+// верхнього рівня. Не задані для інтерфейсу MTU, fwmark, таблиця маршрутів
+// і keepalive успадковуються з верхнього рівня.
+func (c *Config) InterfaceConfigs() []InterfaceConfig {
+	if len(c.Interfaces) == 0 {
+		return []InterfaceConfig{{
+			Name:                c.Interface,
+			Address:             c.Address,
+			Address6:            c.Address6,
+			IPAMNetwork:         c.IPAMNetwork,
+			IPAMStartIP:         c.IPAMStartIP,
+			IPAMEndIP:           c.IPAMEndIP,
+			IPAMReserved:        c.IPAMReserved,
+			IPAMNetwork6:        c.IPAMNetwork6,
+			PrivateKeyFile:      c.PrivateKeyFile,
+			ListenPort:          c.ListenPort,
+			MTU:                 c.MTU,
+			FwMark:              c.FwMark,
+			Table:               c.Table,
+			PersistentKeepalive: c.PersistentKeepalive,
+		}}
+	}
+
+	configs := make([]InterfaceConfig, len(c.Interfaces))
+	for i, iface := range c.Interfaces {
+		if iface.ListenPort == 0 {
+			iface.ListenPort = DefaultListenPort
+		}
+		if iface.MTU == 0 {
+			iface.MTU = c.MTU
+		}
+		if iface.FwMark == 0 {
+			iface.FwMark = c.FwMark
+		}
+		if iface.Table == "" {
+			iface.Table = c.Table
+		}
+		if iface.PersistentKeepalive == 0 {
+			iface.PersistentKeepalive = c.PersistentKeepalive
+		}
+		configs[i] = iface
+	}
+	return configs
+}
+
+// validateInterfaces перевіряє, що інтерфейси не конфліктують між собою:
+// назви і порти унікальні, а мережі не перетинаються
+func validateInterfaces(configs []InterfaceConfig) error {
+	names := make(map[string]bool)
+	tables := make(map[string]string)
+	ports := make(map[int]string)
+	var networks []*net.IPNet
+	owners := make(map[*net.IPNet]string)
+
+	for _, iface := range configs {
+		if iface.Name == "" {
+			return fmt.Errorf("interface name is required")
+		}
+		if names[iface.Name] {
+			return fmt.Errorf("interface %s is configured more than once", iface.Name)
+		}
+		names[iface.Name] = true
+
+		// Інакше правила egress одного інтерфейсу замінювали б правила іншого
+		table := egress.TableName(iface.Name)
+		if other, ok := tables[table]; ok {
+			return fmt.Errorf("interfaces %s and %s share the firewall table %s, rename one of them", other, iface.Name, table)
+		}
+		tables[table] = iface.Name
+
+		if other, ok := ports[iface.ListenPort]; ok {
+			return fmt.Errorf("interfaces %s and %s use the same listen port %d", other, iface.Name, iface.ListenPort)
+		}
+		ports[iface.ListenPort] = iface.Name
+
+		for _, cidr := range []string{iface.IPAMNetwork, iface.IPAMNetwork6} {
+			if cidr == "" {
+				continue
+			}
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return fmt.Errorf("invalid network %q of interface %s: %w", cidr, iface.Name, err)
+			}
+			for _, other := range networks {
+				if other.Contains(network.IP) || network.Contains(other.IP) {
+					return fmt.Errorf("network %s of interface %s overlaps %s of interface %s",
+						network, iface.Name, other, owners[other])
+				}
+			}
+			networks = append(networks, network)
+			owners[network] = iface.Name
+		}
+	}
+
+	return nil
+}
+
+// serverInterface об'єднує компоненти, що обслуговують один WireGuard інтерфейс
+type serverInterface struct {
+	config     InterfaceConfig
+	manager    *InterfaceManager
+	reconciler *Reconciler
+	collector  *StatsCollector
+	egress     *egress.Manager // nil, якщо egress вимкнено
+}
+
+// selectInterfaces повертає інтерфейс з назвою name або всі інтерфейси, якщо name порожня
+func (s *Server) selectInterfaces(name string) ([]*serverInterface, error) {
+	if name == "" {
+		return s.interfaces, nil
+	}
+
+	for _, iface := range s.interfaces {
+		if iface.config.Name == name {
+			return []*serverInterface{iface}, nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s is not configured", name)
+}
+
+// lookupInterface повертає інтерфейс з назвою name; порожня назва означає
+// інтерфейс за замовчуванням - перший у конфігурації
+func (s *Server) lookupInterface(name string) (*serverInterface, error) {
+	if name == "" {
+		return s.interfaces[0], nil
+	}
+
+	selected, err := s.selectInterfaces(name)
+	if err != nil {
+		return nil, err
+	}
+	return selected[0], nil
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestConfig_InterfaceConfigs(t *testing.T) {
+	config := DefaultConfig()
+	config.MTU = 1380
+	config.PersistentKeepalive = 25
+
+	// Без списку - один інтерфейс з полів верхнього рівня
+	single := config.InterfaceConfigs()
+	if len(single) != 1 || single[0].Name != config.Interface || single[0].IPAMNetwork != config.IPAMNetwork {
+		t.Fatalf("InterfaceConfigs() = %+v, want the top-level interface", single)
+	}
+
+	config.Interfaces = []InterfaceConfig{
+		{Name: "wg0", IPAMNetwork: "10.0.0.0/24"},
+		{Name: "wg1", IPAMNetwork: "10.1.0.0/24", ListenPort: 51821, MTU: 1280},
+	}
+	configs := config.InterfaceConfigs()
+	if len(configs) != 2 {
+		t.Fatalf("InterfaceConfigs() returned %d interfaces, want 2", len(configs))
+	}
+	if configs[0].ListenPort != DefaultListenPort || configs[0].MTU != 1380 || configs[0].PersistentKeepalive != 25 {
+		t.Errorf("wg0 = %+v, want inherited port, MTU and keepalive", configs[0])
+	}
+	if configs[1].ListenPort != 51821 || configs[1].MTU != 1280 {
+		t.Errorf("wg1 = %+v, want its own port and MTU", configs[1])
+	}
+	if err := validateInterfaces(configs); err != nil {
+		t.Errorf("validateInterfaces() error: %v", err)
+	}
+}
+
+func TestValidateInterfaces(t *testing.T) {
+	tests := []struct {
+		name    string
+		configs []InterfaceConfig
+		wantErr string
+	}{
+		{
+			name: "duplicate name",
+			configs: []InterfaceConfig{
+				{Name: "wg0", ListenPort: 51820},
+				{Name: "wg0", ListenPort: 51821},
+			},
+			wantErr: "more than once",
+		},
+		{
+			name: "colliding firewall tables",
+			configs: []InterfaceConfig{
+				{Name: "wg-ci", ListenPort: 51820},
+				{Name: "wg_ci", ListenPort: 51821},
+			},
+			wantErr: "share the firewall table wg_orbit_wg_ci",
+		},
+		{
+			name: "duplicate port",
+			configs: []InterfaceConfig{
+				{Name: "wg0", ListenPort: 51820},
+				{Name: "wg1", ListenPort: 51820},
+			},
+			wantErr: "same listen port",
+		},
+		{
+			name: "overlapping networks",
+			configs: []InterfaceConfig{
+				{Name: "wg0", ListenPort: 51820, IPAMNetwork: "10.0.0.0/16"},
+				{Name: "wg1", ListenPort: 51821, IPAMNetwork: "10.0.5.0/24"},
+			},
+			wantErr: "overlaps",
+		},
+		{
+			name: "overlapping IPv6 networks",
+			configs: []InterfaceConfig{
+				{Name: "wg0", ListenPort: 51820, IPAMNetwork6: "fd00::/64"},
+				{Name: "wg1", ListenPort: 51821, IPAMNetwork6: "fd00::/48"},
+			},
+			wantErr: "overlaps",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateInterfaces(tt.configs)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateInterfaces() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/artem/wg-orbit/internal/storage"
+	"github.com/artem/wg-orbit/internal/wg"
+)
+
+// pools повертає налаштовані пули адрес: IPv4 і, для dual-stack, IPv6
+func (im *InterfaceManager) pools() []*wg.IPPool {
+	if im.ipPool6 == nil {
+		return []*wg.IPPool{im.ipPool}
+	}
+	return []*wg.IPPool{im.ipPool, im.ipPool6}
+}
+
+// poolFor повертає пул, мережі якого належить адреса, або nil
+func (im *InterfaceManager) poolFor(ip net.IP) *wg.IPPool {
+	if ip == nil {
+		return nil
+	}
+	for _, pool := range im.pools() {
+		if pool.Network.Contains(ip) {
+			return pool
+		}
+	}
+	return nil
+}
+
+// loadAllocations відновлює пули адрес з таблиці ip_allocations.
+// Адреси peer'ів, створених до появи таблиці, додаються в неї автоматично,
+// а адреси видалених peer'ів звільняються.
+func (im *InterfaceManager) loadAllocations() error {
+	allocations, err := im.storage.ListAllocations(im.interfaceName)
+	if err != nil {
+		return err
+	}
+
+	peers, err := im.storage.ListPeers()
+	if err != nil {
+		return err
+	}
+	existingPeers := make(map[uuid.UUID]bool, len(peers))
+	for _, peer := range peers {
+		existingPeers[peer.ID] = true
+	}
+
+	allocatedPeers := make(map[uuid.UUID]bool)
+	for _, alloc := range allocations {
+		if !existingPeers[alloc.PeerID] {
+			log.Printf("Releasing address %s of deleted peer %s on %s", alloc.Address, alloc.PeerID, im.interfaceName)
+			if err := im.storage.DeleteAllocations(alloc.PeerID); err != nil {
+				return fmt.Errorf("failed to release addresses of deleted peer %s: %w", alloc.PeerID, err)
+			}
+			continue
+		}
+
+		ip := net.ParseIP(alloc.Address)
+		if pool := im.poolFor(ip); pool != nil {
+			pool.MarkAllocated(ip)
+		}
+		allocatedPeers[alloc.PeerID] = true
+	}
+
+	for _, peer := range peers {
+		// Peer'и без інтерфейсу ще не прив'язані і можуть належати цьому
+		if allocatedPeers[peer.ID] || (peer.InterfaceName != "" && peer.InterfaceName != im.interfaceName) {
+			continue
+		}
+
+		for _, allowedIP := range peer.AllowedIPs {
+			ip, ipNet, err := net.ParseCIDR(allowedIP)
+			if err != nil {
+				continue
+			}
+			pool := im.poolFor(ip)
+			if ones, bits := ipNet.Mask.Size(); ones != bits || pool == nil || !pool.MarkAllocated(ip) {
+				continue
+			}
+
+			alloc := &wg.IPAllocation{
+				InterfaceName: im.interfaceName,
+				Address:       ip.String(),
+				PeerID:        peer.ID,
+				CreatedAt:     peer.CreatedAt,
+			}
+			if err := im.storage.SaveAllocation(alloc); err != nil {
+				log.Printf("Warning: failed to record address %s of peer %s: %v", ip, peer.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// defaultInterfaceAddress повертає першу адресу мережі з її префіксом
+func defaultInterfaceAddress(network string) (string, error) {
+	_, ipNet, err := net.ParseCIDR(network)
+	if err != nil {
+		return "", fmt.Errorf("invalid network %q: %w", network, err)
+	}
+
+	ip := make(net.IP, len(ipNet.IP))
+	copy(ip, ipNet.IP)
+	ip[len(ip)-1]++
+
+	ones, _ := ipNet.Mask.Size()
+	return fmt.Sprintf("%s/%d", ip, ones), nil
+}
+
+// splitByFamily розділяє адреси на IPv4 та IPv6
+func splitByFamily(addresses []string) (v4, v6 []string) {
+	for _, address := range addresses {
+		ip := net.ParseIP(address)
+		if ip == nil {
+			ip, _, _ = net.ParseCIDR(address)
+		}
+		if ip != nil && ip.To4() == nil {
+			v6 = append(v6, address)
+		} else {
+			// Некоректні адреси потрапляють у IPv4 пул, який поверне помилку
+			v4 = append(v4, address)
+		}
+	}
+	return v4, v6
+}
+
+// AllocatePeerIP виділяє peer'у IPv4 адресу і фіксує її в базі даних
+func (im *InterfaceManager) AllocatePeerIP(peerID uuid.UUID) (net.IP, error) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	return im.allocateFromPool(im.ipPool, peerID)
+}
+
+// allocateFromPool виділяє адресу з пулу і фіксує її в базі даних.
+// Якщо адресу вже зайняв інший процес, пошук продовжується з наступної.
+// Викликається під im.mu.
+func (im *InterfaceManager) allocateFromPool(pool *wg.IPPool, peerID uuid.UUID) (net.IP, error) {
+	for {
+		ip, err := pool.AllocateIP()
+		if err != nil {
+			return nil, err
+		}
+
+		alloc := &wg.IPAllocation{
+			InterfaceName: im.interfaceName,
+			Address:       ip.String(),
+			PeerID:        peerID,
+			CreatedAt:     time.Now(),
+		}
+		err = im.storage.SaveAllocation(alloc)
+		if errors.Is(err, storage.ErrAddressInUse) {
+			// Адреса залишається позначеною в пулі як зайнята
+			continue
+		}
+		if err != nil {
+			pool.ReleaseIP(ip)
+			return nil, fmt.Errorf("failed to save IP allocation: %w", err)
+		}
+
+		return ip, nil
+	}
+}
+
+// AllocatePeerAddresses виділяє peer'у адресу з кожного пулу і повертає їх
+// у форматі AllowedIPs (/32 для IPv4, /128 для IPv6).
+// Якщо задано static, для її сімейства видається саме ця адреса,
+// для решти пулів - наступна вільна.
+// Якщо одну з адрес виділити не вдалося, вже виділені звільняються.
+func (im *InterfaceManager) AllocatePeerAddresses(peerID uuid.UUID, static net.IP) ([]string, error) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	staticPool := im.poolFor(static)
+	if static != nil && staticPool == nil {
+		return nil, fmt.Errorf("%w: %s", wg.ErrAddressOutOfPool, static)
+	}
+
+	var addresses []string
+	for _, pool := range im.pools() {
+		var ip net.IP
+		var err error
+		if pool == staticPool {
+			ip, err = static, im.reserveInPool(pool, static, peerID)
+		} else {
+			ip, err = im.allocateFromPool(pool, peerID)
+		}
+		if err != nil {
+			if releaseErr := im.releasePeer(peerID); releaseErr != nil {
+				log.Printf("Warning: failed to release addresses of peer %s: %v", peerID, releaseErr)
+			}
+			return nil, err
+		}
+		addresses = append(addresses, hostAddress(pool, ip))
+	}
+
+	return addresses, nil
+}
+
+// ReservePeerAddresses виділяє peer'у саме адреси ips, наприклад при імпорті
+// існуючої конфігурації. Якщо одну з адрес виділити не вдалося, вже
+// виділені звільняються.
+func (im *InterfaceManager) ReservePeerAddresses(peerID uuid.UUID, ips []net.IP) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	for _, ip := range ips {
+		var err error
+		if pool := im.poolFor(ip); pool == nil {
+			err = fmt.Errorf("%w: %s", wg.ErrAddressOutOfPool, ip)
+		} else {
+			err = im.reserveInPool(pool, ip, peerID)
+		}
+		if err != nil {
+			if releaseErr := im.releasePeer(peerID); releaseErr != nil {
+				log.Printf("Warning: failed to release addresses of peer %s: %v", peerID, releaseErr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckPeerAddress перевіряє, чи можна виділити peer'у адресу ip, не виділяючи її
+func (im *InterfaceManager) CheckPeerAddress(ip net.IP) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	pool := im.poolFor(ip)
+	if pool == nil {
+		return fmt.Errorf("%w: %s", wg.ErrAddressOutOfPool, ip)
+	}
+	if err := pool.AllocateSpecific(ip); err != nil {
+		return err
+	}
+	pool.ReleaseIP(ip)
+	return nil
+}
+
+// reserveInPool виділяє peer'у конкретну адресу і фіксує її в базі даних.
+// Викликається під im.mu.
+func (im *InterfaceManager) reserveInPool(pool *wg.IPPool, ip net.IP, peerID uuid.UUID) error {
+	if err := pool.AllocateSpecific(ip); err != nil {
+		return err
+	}
+
+	alloc := &wg.IPAllocation{
+		InterfaceName: im.interfaceName,
+		Address:       ip.String(),
+		PeerID:        peerID,
+		CreatedAt:     time.Now(),
+	}
+	err := im.storage.SaveAllocation(alloc)
+	if errors.Is(err, storage.ErrAddressInUse) {
+		// Адресу зайняв інший процес - вона залишається позначеною в пулі
+		return err
+	}
+	if err != nil {
+		pool.ReleaseIP(ip)
+		return fmt.Errorf("failed to save IP allocation: %w", err)
+	}
+
+	return nil
+}
+
+// MovePeerAddress переносить peer'а на адресу ip. Замінюється адреса того ж
+// сімейства (IPv4 або IPv6); повертаються стара і нова адреси у форматі
+// AllowedIPs. Стара адреса порожня, якщо peer не мав адреси з цього пулу.
+func (im *InterfaceManager) MovePeerAddress(peerID uuid.UUID, ip net.IP) (string, string, error) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	pool := im.poolFor(ip)
+	if pool == nil {
+		return "", "", fmt.Errorf("%w: %s", wg.ErrAddressOutOfPool, ip)
+	}
+
+	allocations, err := im.storage.ListAllocations(im.interfaceName)
+	if err != nil {
+		return "", "", err
+	}
+
+	var current net.IP
+	for _, alloc := range allocations {
+		allocIP := net.ParseIP(alloc.Address)
+		if alloc.PeerID == peerID && im.poolFor(allocIP) == pool {
+			current = allocIP
+			break
+		}
+	}
+
+	if current == nil {
+		if err := im.reserveInPool(pool, ip, peerID); err != nil {
+			return "", "", err
+		}
+		return "", hostAddress(pool, ip), nil
+	}
+
+	if current.Equal(ip) {
+		address := hostAddress(pool, ip)
+		return address, address, nil
+	}
+
+	if err := pool.AllocateSpecific(ip); err != nil {
+		return "", "", err
+	}
+	if err := im.storage.MoveAllocation(im.interfaceName, current.String(), ip.String()); err != nil {
+		if !errors.Is(err, storage.ErrAddressInUse) {
+			pool.ReleaseIP(ip)
+		}
+		return "", "", err
+	}
+	pool.ReleaseIP(current)
+
+	return hostAddress(pool, current), hostAddress(pool, ip), nil
+}
+
+// hostAddress форматує адресу peer'а для AllowedIPs
+func hostAddress(pool *wg.IPPool, ip net.IP) string {
+	return fmt.Sprintf("%s/%d", ip, pool.HostPrefix())
+}
+
+// ReleasePeerIP звільняє всі адреси peer'а в пулах та базі даних
+func (im *InterfaceManager) ReleasePeerIP(peerID uuid.UUID) error {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	return im.releasePeer(peerID)
+}
+
+// ReleaseAddresses звільняє адреси addresses (у форматі AllowedIPs) лише в
+// пулах. Викликається після видалення peer'а, коли його виділення в базі
+// даних вже видалено разом з ним.
+func (im *InterfaceManager) ReleaseAddresses(addresses []string) {
+	im.mu.Lock()
+	defer im.mu.Unlock()
+
+	for _, address := range addresses {
+		ip, network, err := net.ParseCIDR(address)
+		if err != nil {
+			continue
+		}
+		pool := im.poolFor(ip)
+		if pool == nil {
+			continue
+		}
+		if ones, _ := network.Mask.Size(); ones == pool.HostPrefix() {
+			pool.ReleaseIP(ip)
+		}
+	}
+}
+
+// releasePeer звільняє адреси peer'а. Викликається під im.mu.
+func (im *InterfaceManager) releasePeer(peerID uuid.UUID) error {
+	allocations, err := im.storage.ListAllocations(im.interfaceName)
+	if err != nil {
+		return err
+	}
+
+	for _, alloc := range allocations {
+		if alloc.PeerID != peerID {
+			continue
+		}
+		ip := net.ParseIP(alloc.Address)
+		if pool := im.poolFor(ip); pool != nil {
+			pool.ReleaseIP(ip)
+		}
+	}
+
+	return im.storage.DeleteAllocations(peerID)
+}
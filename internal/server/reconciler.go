@@ -0,0 +1,187 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/artem/wg-orbit/internal/netdev"
+	"github.com/artem/wg-orbit/internal/storage"
+	"github.com/artem/wg-orbit/internal/wg"
+)
+
+// DefaultResyncInterval - період повної синхронізації peer'ів за замовчуванням
+const DefaultResyncInterval = time.Minute
+
+// Reconciler приводить peer'ів WireGuard пристрою у відповідність до бази даних.
+// Джерелом істини є storage: активні peer'и додаються або оновлюються,
+// решта peer'ів на пристрої видаляються.
+type Reconciler struct {
+	interfaceName string
+	backend       netdev.Backend
+	storage       storage.Storage
+	interval      time.Duration
+	trigger       chan struct{}
+	mu            sync.Mutex
+}
+
+// NewReconciler створює reconciler для інтерфейсу
+func NewReconciler(interfaceName string, backend netdev.Backend, store storage.Storage, interval time.Duration) *Reconciler {
+	if interval <= 0 {
+		interval = DefaultResyncInterval
+	}
+
+	return &Reconciler{
+		interfaceName: interfaceName,
+		backend:       backend,
+		storage:       store,
+		interval:      interval,
+		trigger:       make(chan struct{}, 1),
+	}
+}
+
+// Trigger просить Run виконати синхронізацію якомога швидше.
+// Не блокується: кілька викликів поспіль об'єднуються в одну синхронізацію.
+func (r *Reconciler) Trigger() {
+	select {
+	case r.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run синхронізує peer'ів при старті, після кожного Trigger
+// і періодично, поки не закрито stop
+func (r *Reconciler) Run(stop <-chan struct{}) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	r.reconcileAndLog()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-r.trigger:
+			r.reconcileAndLog()
+		case <-ticker.C:
+			r.reconcileAndLog()
+		}
+	}
+}
+
+// reconcileAndLog виконує синхронізацію і логує результат
+func (r *Reconciler) reconcileAndLog() {
+	if err := r.Reconcile(); err != nil {
+		log.Printf("Failed to reconcile peers on %s: %v", r.interfaceName, err)
+	}
+}
+
+// Reconcile обчислює різницю між базою даних і пристроєм та застосовує її.
+// Повторний виклик без змін у базі нічого не змінює на пристрої.
+func (r *Reconciler) Reconcile() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	peers, err := r.storage.ListPeers()
+	if err != nil {
+		return fmt.Errorf("failed to list peers: %w", err)
+	}
+
+	current, err := r.backend.Peers(r.interfaceName)
+	if err != nil {
+		return fmt.Errorf("failed to read device peers: %w", err)
+	}
+
+	desired := make(map[string]netdev.PeerConfig)
+	for _, peer := range peers {
+		if peer.InterfaceName != r.interfaceName || !peer.IsActive || peer.PublicKey == "" {
+			continue
+		}
+		// Пристрій відхиляє весь набір змін через один невалідний ключ,
+		// тому такий peer пропускається, а решта синхронізуються
+		if err := wg.ValidatePublicKey(peer.PublicKey); err != nil {
+			log.Printf("Skipping peer %s on %s: invalid public key: %v", peer.Name, r.interfaceName, err)
+			continue
+		}
+		desired[peer.PublicKey] = netdev.PeerConfig{
+			PublicKey:    peer.PublicKey,
+			PresharedKey: peer.PresharedKey,
+			AllowedIPs:   peer.AllowedIPs,
+		}
+	}
+
+	changes := diffPeers(desired, current)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	if err := r.backend.ConfigurePeers(r.interfaceName, changes); err != nil {
+		return fmt.Errorf("failed to configure peers: %w", err)
+	}
+
+	log.Printf("Reconciled %d peer(s) on %s", len(changes), r.interfaceName)
+	return nil
+}
+
+// diffPeers повертає зміни, які переводять пристрій зі стану current у desired
+func diffPeers(desired map[string]netdev.PeerConfig, current []netdev.Peer) []netdev.PeerConfig {
+	var changes []netdev.PeerConfig
+
+	seen := make(map[string]bool)
+	for _, peer := range current {
+		seen[peer.PublicKey] = true
+
+		want, ok := desired[peer.PublicKey]
+		if !ok {
+			changes = append(changes, netdev.PeerConfig{PublicKey: peer.PublicKey, Remove: true})
+			continue
+		}
+		if want.PresharedKey != peer.PresharedKey || !sameNetworks(want.AllowedIPs, peer.AllowedIPs) {
+			changes = append(changes, want)
+		}
+	}
+
+	var missing []string
+	for publicKey := range desired {
+		if !seen[publicKey] {
+			missing = append(missing, publicKey)
+		}
+	}
+	sort.Strings(missing)
+	for _, publicKey := range missing {
+		changes = append(changes, desired[publicKey])
+	}
+
+	return changes
+}
+
+// sameNetworks порівнює списки мереж без урахування порядку і запису адрес
+func sameNetworks(a, b []string) bool {
+	na, nb := canonicalNetworks(a), canonicalNetworks(b)
+	if len(na) != len(nb) {
+		return false
+	}
+	for i := range na {
+		if na[i] != nb[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// canonicalNetworks приводить мережі до канонічного вигляду і сортує їх
+func canonicalNetworks(cidrs []string) []string {
+	result := make([]string, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		if _, ipNet, err := net.ParseCIDR(strings.TrimSpace(cidr)); err == nil {
+			result = append(result, ipNet.String())
+		} else {
+			result = append(result, cidr)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
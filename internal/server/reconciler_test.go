@@ -0,0 +1,146 @@
+package server
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/artem/wg-orbit/internal/netdev"
+	"github.com/artem/wg-orbit/internal/storage"
+	"github.com/artem/wg-orbit/internal/wg"
+)
+
+// peerDevice - мінімальний backend, що зберігає peer'ів у пам'яті
+type peerDevice struct {
+	netdev.Backend
+	peers   map[string]netdev.Peer
+	applied [][]netdev.PeerConfig
+}
+
+func (d *peerDevice) Peers(name string) ([]netdev.Peer, error) {
+	var peers []netdev.Peer
+	for _, peer := range d.peers {
+		peers = append(peers, peer)
+	}
+	return peers, nil
+}
+
+// ConfigurePeers, як і справжні backend'и, не застосовує нічого, якщо
+// хоча б один ключ невалідний
+func (d *peerDevice) ConfigurePeers(name string, changes []netdev.PeerConfig) error {
+	for _, change := range changes {
+		if err := wg.ValidatePublicKey(change.PublicKey); err != nil && !change.Remove {
+			return fmt.Errorf("peer %q: %w", change.PublicKey, err)
+		}
+	}
+	d.applied = append(d.applied, changes)
+	for _, change := range changes {
+		if change.Remove {
+			delete(d.peers, change.PublicKey)
+			continue
+		}
+		d.peers[change.PublicKey] = netdev.Peer{
+			PublicKey:    change.PublicKey,
+			PresharedKey: change.PresharedKey,
+			AllowedIPs:   change.AllowedIPs,
+		}
+	}
+	return nil
+}
+
+func TestReconciler_Reconcile(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage() error: %v", err)
+	}
+	defer store.Close()
+
+	active := newReconcilerPeer(t, store, "active", true, "10.0.0.2/32")
+	inactive := newReconcilerPeer(t, store, "inactive", false, "10.0.0.3/32")
+	added := newReconcilerPeer(t, store, "added", true, "10.0.0.4/32")
+
+	// Peer іншого інтерфейсу не потрапляє на wg0
+	other := newReconcilerPeer(t, store, "other", true, "10.1.0.2/32")
+	saveTestInterface(t, store, "wg1")
+	other.InterfaceName = "wg1"
+	if err := store.SavePeer(other); err != nil {
+		t.Fatalf("SavePeer() error: %v", err)
+	}
+
+	// Peer з невалідним ключем пропускається і не заважає решті
+	invalid := newReconcilerPeer(t, store, "invalid", true, "10.0.0.5/32")
+	invalid.PublicKey = "not-a-key"
+	if err := store.SavePeer(invalid); err != nil {
+		t.Fatalf("SavePeer() error: %v", err)
+	}
+
+	device := &peerDevice{peers: map[string]netdev.Peer{
+		// Дрейф: неправильні allowed IPs, вимкнений і невідомий peer
+		active.PublicKey:   {PublicKey: active.PublicKey, AllowedIPs: []string{"10.0.0.99/32"}},
+		inactive.PublicKey: {PublicKey: inactive.PublicKey, AllowedIPs: inactive.AllowedIPs},
+		"stale=":           {PublicKey: "stale="},
+	}}
+
+	reconciler := NewReconciler("wg0", device, store, 0)
+	if err := reconciler.Reconcile(); err != nil {
+		t.Fatalf("Reconcile() error: %v", err)
+	}
+
+	if len(device.peers) != 2 {
+		t.Fatalf("device peers = %v, want active and added", device.peers)
+	}
+	for _, peer := range []*wg.Peer{active, added} {
+		got, ok := device.peers[peer.PublicKey]
+		if !ok || !sameNetworks(got.AllowedIPs, peer.AllowedIPs) {
+			t.Errorf("device peer %s = %+v, want allowed IPs %v", peer.Name, got, peer.AllowedIPs)
+		}
+	}
+
+	// Повторна синхронізація без змін нічого не застосовує
+	if err := reconciler.Reconcile(); err != nil {
+		t.Fatalf("second Reconcile() error: %v", err)
+	}
+	if len(device.applied) != 1 {
+		t.Errorf("ConfigurePeers() called %d times, want 1", len(device.applied))
+	}
+}
+
+// newReconcilerPeer зберігає peer'а інтерфейсу wg0 з однією адресою
+func newReconcilerPeer(t *testing.T, store storage.Storage, name string, active bool, address string) *wg.Peer {
+	t.Helper()
+
+	peer, err := wg.NewPeer(name)
+	if err != nil {
+		t.Fatalf("NewPeer() error: %v", err)
+	}
+	peer.IsActive = active
+	peer.AllowedIPs = []string{address}
+	peer.InterfaceName = "wg0"
+	saveTestInterface(t, store, peer.InterfaceName)
+
+	if err := store.SavePeer(peer); err != nil {
+		t.Fatalf("SavePeer() error: %v", err)
+	}
+	return peer
+}
+
+// saveTestInterface зберігає запис інтерфейсу, до якого прив'язуються peer'и
+func saveTestInterface(t *testing.T, store storage.Storage, name string) {
+	t.Helper()
+
+	privateKey, publicKey, err := wg.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error: %v", err)
+	}
+	if err := store.SaveInterface(&wg.Interface{
+		Name:       name,
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+		ListenPort: DefaultListenPort,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}); err != nil {
+		t.Fatalf("SaveInterface() error: %v", err)
+	}
+}
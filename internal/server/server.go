@@ -1,27 +1,35 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/artem/wg-orbit/api/rest"
 	"github.com/artem/wg-orbit/internal/auth"
+	"github.com/artem/wg-orbit/internal/egress"
+	"github.com/artem/wg-orbit/internal/netdev"
 	"github.com/artem/wg-orbit/internal/storage"
 	"github.com/artem/wg-orbit/internal/wg"
+	"github.com/google/uuid"
 )
 
 // Server представляє WireGuard Orbit сервер
 type Server struct {
-	storage      storage.Storage
-	tokenMgr     *auth.TokenManager
-	restServer   *rest.Server
-	interfaceMgr *InterfaceManager
-	config       *Config
+	storage    storage.Storage
+	tokenMgr   *auth.TokenManager
+	keyRing    *auth.KeyRing // nil для HS256
+	restServer *rest.Server
+	backend    netdev.Backend
+	interfaces []*serverInterface // у порядку конфігурації, перший - за замовчуванням
+	config     *Config
 }
 
 // Config представляє конфігурацію сервера
@@ -33,7 +41,50 @@ type Config struct {
 	StorageConfig storage.Config `yaml:"storage" json:"storage"`
 	JWTSecret     string         `yaml:"jwt_secret" json:"jwt_secret"`
 	TokenTTL      time.Duration  `yaml:"token_ttl" json:"token_ttl"`
-	IPAMNetwork   string         `yaml:"ipam_network" json:"ipam_network"`
+
+	// Підпис JWT: EdDSA або ES256 з ключами в базі даних і плановою ротацією,
+	// або HS256 зі спільним секретом JWTSecret. Після ротації попередній ключ
+	// ще SigningKeyOverlap перевіряє видані ним токени.
+	SigningAlgorithm   string        `yaml:"signing_algorithm" json:"signing_algorithm"`
+	SigningKeyRotation time.Duration `yaml:"signing_key_rotation" json:"signing_key_rotation"`
+	SigningKeyOverlap  time.Duration `yaml:"signing_key_overlap" json:"signing_key_overlap"`
+
+	// DevMode дозволяє запуск з секретом HS256 за замовчуванням
+	DevMode bool `yaml:"dev_mode" json:"dev_mode"`
+
+	// Терміни дії access і refresh токенів клієнтів; 0 - значення за замовчуванням
+	AccessTokenTTL  time.Duration `yaml:"access_token_ttl" json:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" json:"refresh_token_ttl"`
+
+	Address      string   `yaml:"address" json:"address"`
+	IPAMNetwork  string   `yaml:"ipam_network" json:"ipam_network"`
+	IPAMStartIP  string   `yaml:"ipam_start_ip" json:"ipam_start_ip"`
+	IPAMEndIP    string   `yaml:"ipam_end_ip" json:"ipam_end_ip"`
+	IPAMReserved []string `yaml:"ipam_reserved" json:"ipam_reserved"`
+	Address6     string   `yaml:"address6" json:"address6"`
+	IPAMNetwork6 string   `yaml:"ipam_network6" json:"ipam_network6"`
+	Backend      string   `yaml:"backend" json:"backend"`
+
+	PrivateKeyFile string `yaml:"private_key_file" json:"private_key_file"`
+	ListenPort     int    `yaml:"listen_port" json:"listen_port"`
+	MTU            int    `yaml:"mtu" json:"mtu"`
+	FwMark         int    `yaml:"fwmark" json:"fwmark"`
+	Table          string `yaml:"table" json:"table"`
+
+	// PersistentKeepalive - інтервал keepalive за замовчуванням для нових peer'ів
+	PersistentKeepalive int `yaml:"persistent_keepalive" json:"persistent_keepalive"`
+
+	// Interfaces - інтерфейси, якими керує сервер. Якщо список порожній,
+	// єдиний інтерфейс описується полями Interface, Address, IPAM* тощо.
+	Interfaces []InterfaceConfig `yaml:"interfaces" json:"interfaces"`
+
+	// Egress: форвардинг і маскування трафіку клієнтів через uplink
+	EgressEnabled bool   `yaml:"egress_enabled" json:"egress_enabled"`
+	EgressUplink  string `yaml:"egress_uplink" json:"egress_uplink"`
+	EgressBackend string `yaml:"egress_backend" json:"egress_backend"`
+
+	ResyncInterval time.Duration `yaml:"resync_interval" json:"resync_interval"`
+	StatsInterval  time.Duration `yaml:"stats_interval" json:"stats_interval"`
 }
 
 // DefaultConfig повертає конфігурацію за замовчуванням
@@ -47,77 +98,377 @@ func DefaultConfig() *Config {
 			Type:     "sqlite",
 			Database: "wg-orbit.db",
 		},
-		JWTSecret:   "change-me-in-production",
+		JWTSecret:   auth.DefaultSecret,
 		TokenTTL:    24 * time.Hour,
 		IPAMNetwork: "10.0.0.0/24",
+		ListenPort:  DefaultListenPort,
+
+		ResyncInterval: DefaultResyncInterval,
+		StatsInterval:  DefaultStatsInterval,
+
+		SigningAlgorithm:   auth.AlgorithmEdDSA,
+		SigningKeyRotation: auth.DefaultKeyRotation,
+		SigningKeyOverlap:  auth.DefaultKeyOverlap,
 	}
 }
 
 // NewServer створює новий сервер
 func NewServer(config *Config) (*Server, error) {
 	// Ініціалізація storage
+	if config.StorageConfig.MasterKeyFile == "" && os.Getenv(storage.MasterKeyEnv) == "" {
+		log.Printf("Warning: no master key configured, private keys are stored unencrypted")
+	}
+
 	store, err := storage.NewStorage(&config.StorageConfig)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize storage: %w", err)
 	}
 
+	// Ініціалізація мережевого backend'у
+	backend, err := netdev.New(config.Backend)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize network backend: %w", err)
+	}
+	log.Printf("Using %s network backend", backend.Name())
+
+	return newServer(config, store, backend)
+}
+
+// newServer створює сервер з готовими storage і мережевим backend'ом.
+// Тести передають сюди SQLite у тимчасовому каталозі і fake backend.
+func newServer(config *Config, store storage.Storage, backend netdev.Backend) (*Server, error) {
+	// Інтерфейси, якими керує сервер
+	configs := config.InterfaceConfigs()
+	if err := validateInterfaces(configs); err != nil {
+		return nil, err
+	}
+
+	srv := &Server{
+		storage: store,
+		backend: backend,
+		config:  config,
+	}
+
 	// Ініціалізація token manager
-	tokenMgr := auth.NewTokenManager([]byte(config.JWTSecret), "wg-orbit")
+	if err := srv.initTokenManager(); err != nil {
+		return nil, err
+	}
 
-	// Ініціалізація interface manager
-	interfaceMgr, err := NewInterfaceManager(config.Interface, config.IPAMNetwork)
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize interface manager: %w", err)
+	var managed []*rest.ManagedInterface
+	for _, ifaceConfig := range configs {
+		iface, err := newServerInterface(config, ifaceConfig, backend, store)
+		if err != nil {
+			return nil, err
+		}
+		srv.interfaces = append(srv.interfaces, iface)
+
+		managed = append(managed, &rest.ManagedInterface{
+			Name:      ifaceConfig.Name,
+			Allocator: iface.manager,
+			Syncer:    iface.reconciler,
+
+			PersistentKeepalive: ifaceConfig.PersistentKeepalive,
+		})
 	}
 
 	// Ініціалізація REST API
 	restConfig := &rest.Config{
 		Host: config.Host,
 		Port: config.Port,
+
+		AccessTokenTTL:  config.AccessTokenTTL,
+		RefreshTokenTTL: config.RefreshTokenTTL,
 	}
-	restServer := rest.NewServer(store, tokenMgr, restConfig)
+	srv.restServer = rest.NewServer(store, srv.tokenMgr, managed, restConfig)
 
-	return &Server{
-		storage:      store,
-		tokenMgr:     tokenMgr,
-		restServer:   restServer,
-		interfaceMgr: interfaceMgr,
-		config:       config,
-	}, nil
+	return srv, nil
 }
 
-// Initialize ініціалізує WireGuard інтерфейс
-func (s *Server) Initialize() error {
-	log.Printf("Initializing WireGuard interface: %s", s.config.Interface)
+// initTokenManager створює token manager для налаштованого алгоритму підпису.
+// Для EdDSA і ES256 ключі завантажуються з бази даних, перший ключ
+// генерується при першому запуску.
+func (s *Server) initTokenManager() error {
+	if err := auth.ValidateSigningAlgorithm(s.config.SigningAlgorithm); err != nil {
+		return err
+	}
 
-	// Створюємо інтерфейс якщо він не існує
-	if err := s.interfaceMgr.CreateInterface(); err != nil {
-		return fmt.Errorf("failed to create interface: %w", err)
+	if s.config.SigningAlgorithm == auth.AlgorithmHS256 {
+		if s.config.JWTSecret == "" {
+			return fmt.Errorf("jwt secret cannot be empty with %s signing", auth.AlgorithmHS256)
+		}
+		s.tokenMgr = auth.NewTokenManager([]byte(s.config.JWTSecret), "wg-orbit")
+		return nil
 	}
 
-	// Зберігаємо конфігурацію інтерфейсу в БД
-	interfaceConfig := &wg.Interface{
-		Name:       s.config.Interface,
-		PublicKey:  s.interfaceMgr.PublicKey(),
-		PrivateKey: s.interfaceMgr.PrivateKey(),
-		ListenPort: s.interfaceMgr.ListenPort(),
-		Address:    s.config.IPAMNetwork,
-		CreatedAt:  time.Now(),
-		UpdatedAt:  time.Now(),
+	ring, err := auth.NewKeyRing(s.storage, s.config.SigningAlgorithm, s.config.SigningKeyRotation, s.config.SigningKeyOverlap)
+	if err != nil {
+		return fmt.Errorf("failed to initialize signing keys: %w", err)
+	}
+	s.keyRing = ring
+	s.tokenMgr = auth.NewKeyRingTokenManager(ring, "wg-orbit")
+	return nil
+}
+
+// checkJWTSecret не дає запустити сервер, що приймає токени, підписані
+// загальновідомим секретом за замовчуванням: такі токени може підробити будь-хто
+func (s *Server) checkJWTSecret() error {
+	if s.config.SigningAlgorithm != auth.AlgorithmHS256 || s.config.JWTSecret != auth.DefaultSecret {
+		return nil
+	}
+	if s.config.DevMode {
+		log.Printf("Warning: using the default JWT secret, tokens can be forged by anyone (dev mode)")
+		return nil
+	}
+	return fmt.Errorf("refusing to start with the default JWT secret %q: set server.secret_key, "+
+		"switch auth.signing_algorithm to %s or %s, or pass --dev for development",
+		auth.DefaultSecret, auth.AlgorithmEdDSA, auth.AlgorithmES256)
+}
+
+// RotateSigningKey генерує новий ключ підпису JWT. Попередній ключ ще
+// SigningKeyOverlap перевіряє видані ним токени.
+func (s *Server) RotateSigningKey() (*wg.SigningKey, error) {
+	if s.keyRing == nil {
+		return nil, fmt.Errorf("signing key rotation is not available with %s signing", auth.AlgorithmHS256)
+	}
+	return s.keyRing.Rotate()
+}
+
+// newServerInterface створює компоненти, що обслуговують один інтерфейс
+func newServerInterface(config *Config, ifaceConfig InterfaceConfig, backend netdev.Backend, store storage.Storage) (*serverInterface, error) {
+	// Ініціалізація interface manager
+	interfaceMgr, err := NewInterfaceManager(InterfaceOptions{
+		Name:     ifaceConfig.Name,
+		Address:  ifaceConfig.Address,
+		Network:  ifaceConfig.IPAMNetwork,
+		StartIP:  ifaceConfig.IPAMStartIP,
+		EndIP:    ifaceConfig.IPAMEndIP,
+		Reserved: ifaceConfig.IPAMReserved,
+		Network6: ifaceConfig.IPAMNetwork6,
+		Address6: ifaceConfig.Address6,
+		Backend:  backend,
+
+		ListenPort:     ifaceConfig.ListenPort,
+		MTU:            ifaceConfig.MTU,
+		FwMark:         ifaceConfig.FwMark,
+		Table:          ifaceConfig.Table,
+		PrivateKeyFile: ifaceConfig.PrivateKeyFile,
+	}, store)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize interface manager for %s: %w", ifaceConfig.Name, err)
+	}
+
+	iface := &serverInterface{
+		config:  ifaceConfig,
+		manager: interfaceMgr,
+
+		// Синхронізація peer'ів з бази даних у пристрій
+		reconciler: NewReconciler(ifaceConfig.Name, backend, store, config.ResyncInterval),
+		collector:  NewStatsCollector(ifaceConfig.Name, backend, store, config.StatsInterval),
+	}
+
+	// Ініціалізація egress
+	if config.EgressEnabled {
+		iface.egress, err = newEgressManager(config, ifaceConfig.Name, interfaceMgr)
+		if err != nil {
+			return nil, err
+		}
 	}
 
+	return iface, nil
+}
+
+// newEgressManager створює менеджер egress для тунельних мереж інтерфейсу
+func newEgressManager(config *Config, name string, interfaceMgr *InterfaceManager) (*egress.Manager, error) {
+	firewall, err := egress.New(config.EgressBackend)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize egress firewall: %w", err)
+	}
+
+	return egress.NewManager(firewall, egress.Rules{
+		Interface: name,
+		Uplink:    config.EgressUplink,
+		Networks:  interfaceMgr.Networks(),
+	}), nil
+}
+
+// Initialize ініціалізує WireGuard інтерфейс з назвою name або, якщо name
+// порожня, всі налаштовані інтерфейси.
+// Ключ сервера генерується лише при першій ініціалізації; збережений
+// запис інтерфейсу з іншим ключем ніколи не перезаписується.
+func (s *Server) Initialize(name string) error {
+	selected, err := s.selectInterfaces(name)
+	if err != nil {
+		return err
+	}
+
+	for _, iface := range selected {
+		if err := s.initializeInterface(iface); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// initializeInterface створює і налаштовує один інтерфейс
+func (s *Server) initializeInterface(iface *serverInterface) error {
+	name := iface.config.Name
+	log.Printf("Initializing WireGuard interface: %s", name)
+
+	existing, err := s.storage.GetInterface(name)
+	if err != nil {
+		return fmt.Errorf("failed to load interface config: %w", err)
+	}
+
+	generated, err := iface.manager.EnsureKey()
+	if err != nil {
+		return err
+	}
+	if existing != nil && existing.PublicKey != iface.manager.PublicKey() {
+		return fmt.Errorf("interface %s is already stored with public key %s, refusing to overwrite it",
+			name, existing.PublicKey)
+	}
+
+	// Створюємо інтерфейс якщо він не існує
+	if err := iface.manager.CreateInterface(); err != nil {
+		return fmt.Errorf("failed to create interface %s: %w", name, err)
+	}
+
+	// Зберігаємо конфігурацію інтерфейсу в БД
+	interfaceConfig := iface.record(existing)
 	if err := s.storage.SaveInterface(interfaceConfig); err != nil {
 		return fmt.Errorf("failed to save interface config: %w", err)
 	}
+	if generated {
+		log.Printf("Generated new server key for %s, public key: %s", name, interfaceConfig.PublicKey)
+	}
+
+	// Peer'и, створені до появи кількох інтерфейсів, належать інтерфейсу за замовчуванням
+	if iface == s.interfaces[0] {
+		adopted, err := s.storage.AdoptPeers(name)
+		if err != nil {
+			return fmt.Errorf("failed to assign peers to %s: %w", name, err)
+		}
+		if adopted > 0 {
+			log.Printf("Assigned %d existing peer(s) to %s", adopted, name)
+		}
+	}
+
+	// Додаємо в інтерфейс peer'ів, що вже є в базі даних
+	if err := iface.reconciler.Reconcile(); err != nil {
+		return fmt.Errorf("failed to apply peers: %w", err)
+	}
+
+	if err := s.enableEgress(iface); err != nil {
+		return err
+	}
+
+	log.Printf("WireGuard interface %s initialized successfully", name)
+	return nil
+}
+
+// record повертає запис інтерфейсу для бази даних з поточними налаштуваннями
+// і ключем менеджера; existing - попередній запис або nil
+func (iface *serverInterface) record(existing *wg.Interface) *wg.Interface {
+	now := time.Now()
+	record := &wg.Interface{
+		Name:       iface.config.Name,
+		PublicKey:  iface.manager.PublicKey(),
+		PrivateKey: iface.manager.PrivateKey(),
+		ListenPort: iface.manager.ListenPort(),
+		Address:    strings.Join(iface.manager.Addresses(), ","),
+		MTU:        iface.manager.MTU(),
+		FwMark:     iface.manager.FwMark(),
+		Table:      iface.manager.Table(),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	if existing != nil {
+		record.CreatedAt = existing.CreatedAt
+	}
+	return record
+}
+
+// Teardown видаляє правила egress і WireGuard інтерфейс з назвою name
+// (або всі налаштовані інтерфейси, якщо name порожня), створені Initialize.
+// Якщо wipe = true, видаляється також запис інтерфейсу з ключем сервера,
+// і наступний init згенерує новий ключ; інтерфейс з peer'ами не видаляється.
+// Налаштування форвардингу ядра не змінюються: невідомо, чи вмикав їх wg-orbit.
+// Повторний виклик не є помилкою.
+func (s *Server) Teardown(name string, wipe bool) error {
+	selected, err := s.selectInterfaces(name)
+	if err != nil {
+		return err
+	}
+
+	for _, iface := range selected {
+		if err := s.teardownInterface(iface, wipe); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// teardownInterface видаляє один інтерфейс і його правила
+func (s *Server) teardownInterface(iface *serverInterface, wipe bool) error {
+	name := iface.config.Name
+	log.Printf("Tearing down WireGuard interface: %s", name)
+
+	// Правила шукаються в усіх backend'ах, навіть якщо egress вже вимкнено в конфігурації
+	err := egress.Cleanup(egress.Rules{
+		Interface: name,
+		Uplink:    s.config.EgressUplink,
+		Networks:  iface.manager.Networks(),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to remove egress rules: %w", err)
+	}
+
+	deleted, err := iface.manager.DeleteInterface()
+	if err != nil {
+		return err
+	}
+	if deleted {
+		log.Printf("Interface %s deleted", name)
+	} else {
+		log.Printf("Interface %s does not exist, skipping", name)
+	}
+
+	if wipe {
+		err := s.storage.DeleteInterface(name)
+		if errors.Is(err, storage.ErrInterfaceInUse) {
+			return fmt.Errorf("interface %s still has peers, delete them before wiping the interface", name)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to delete interface config: %w", err)
+		}
+		log.Printf("Interface %s removed from the database", name)
+	}
 
-	log.Printf("WireGuard interface %s initialized successfully", s.config.Interface)
 	return nil
 }
 
 // Run запускає сервер
 func (s *Server) Run() error {
+	if err := s.checkJWTSecret(); err != nil {
+		return err
+	}
+
 	log.Printf("Starting WireGuard Orbit server on %s:%d", s.config.Host, s.config.Port)
 
+	// Userspace інтерфейси існують лише всередині процесу, тому піднімаємо їх при старті.
+	// Kernel інтерфейси створює init, а правила egress встановлюються тут.
+	if s.backend.Name() == netdev.BackendUserspace {
+		if err := s.Initialize(""); err != nil {
+			return fmt.Errorf("failed to start userspace interfaces: %w", err)
+		}
+	} else {
+		for _, iface := range s.interfaces {
+			if err := s.enableEgress(iface); err != nil {
+				return err
+			}
+		}
+	}
+
 	// Запускаємо REST API сервер
 	go func() {
 		if err := s.restServer.Start(); err != nil && err != http.ErrServerClosed {
@@ -125,16 +476,43 @@ func (s *Server) Run() error {
 		}
 	}()
 
+	// Для кожного інтерфейсу синхронізуємо peer'ів при старті, після змін
+	// і періодично, а також збираємо handshake і трафік peer'ів
+	stop := make(chan struct{})
+	for _, iface := range s.interfaces {
+		go iface.reconciler.Run(stop)
+		go iface.collector.Run(stop)
+	}
+
+	// Планова ротація ключів підпису JWT
+	if s.keyRing != nil {
+		go s.keyRing.Run(stop)
+	}
+
 	// Graceful shutdown
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
 	<-quit
 
 	log.Println("Shutting down server...")
+	close(stop)
 
 	// REST server не має методу Shutdown, тому просто логуємо
 	log.Println("REST server shutdown not implemented")
 
+	for _, iface := range s.interfaces {
+		if iface.egress == nil {
+			continue
+		}
+		if err := iface.egress.Disable(); err != nil {
+			log.Printf("Error removing egress rules of %s: %v", iface.config.Name, err)
+		}
+	}
+
+	if err := s.backend.Close(); err != nil {
+		log.Printf("Error closing network backend: %v", err)
+	}
+
 	if err := s.storage.Close(); err != nil {
 		log.Printf("Error closing storage: %v", err)
 	}
@@ -143,34 +521,155 @@ func (s *Server) Run() error {
 	return nil
 }
 
-// AddUser додає нового користувача
-func (s *Server) AddUser(username string) error {
-	log.Printf("Adding user: %s", username)
+// enableEgress вмикає форвардинг і встановлює правила egress інтерфейсу, якщо вони налаштовані
+func (s *Server) enableEgress(iface *serverInterface) error {
+	if iface.egress == nil {
+		return nil
+	}
+
+	if err := iface.egress.Enable(); err != nil {
+		return fmt.Errorf("failed to enable egress for %s: %w", iface.config.Name, err)
+	}
+	log.Printf("Egress enabled for %s via %s (%s)", iface.config.Name, s.config.EgressUplink, iface.egress.Firewall().Name())
+
+	blockers, err := iface.egress.Blockers()
+	if err != nil {
+		log.Printf("Warning: %v", err)
+	} else if len(blockers) > 0 {
+		log.Printf("Warning: forwarded traffic of %s may be dropped by chains with drop policy: %s",
+			iface.config.Name, strings.Join(blockers, ", "))
+	}
+	return nil
+}
+
+// InterfaceStatus описує стан одного інтерфейсу
+type InterfaceStatus struct {
+	Name   string
+	Stored *wg.Interface // nil, якщо інтерфейс ще не ініціалізовано
+	Exists bool          // інтерфейс існує в системі
+	Peers  int
+
+	Egress      *egress.Status
+	EgressError error // egress недоступний у цій системі
+}
+
+// Status повертає стан інтерфейсу з назвою name або всіх інтерфейсів.
+// Якщо egress вимкнено в конфігурації, правила шукаються backend'ом за замовчуванням.
+func (s *Server) Status(name string) ([]*InterfaceStatus, error) {
+	selected, err := s.selectInterfaces(name)
+	if err != nil {
+		return nil, err
+	}
+
+	peers, err := s.storage.ListPeers()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list peers: %w", err)
+	}
+
+	var result []*InterfaceStatus
+	for _, iface := range selected {
+		status := &InterfaceStatus{Name: iface.config.Name}
+
+		status.Stored, err = s.storage.GetInterface(iface.config.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load interface config: %w", err)
+		}
+		status.Exists, err = s.backend.LinkExists(iface.config.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check interface %s: %w", iface.config.Name, err)
+		}
+		for _, peer := range peers {
+			if peer.InterfaceName == iface.config.Name {
+				status.Peers++
+			}
+		}
+
+		manager := iface.egress
+		if manager == nil {
+			manager, status.EgressError = newEgressManager(s.config, iface.config.Name, iface.manager)
+		}
+		if manager != nil {
+			status.Egress, status.EgressError = manager.Status()
+		}
+
+		result = append(result, status)
+	}
+	return result, nil
+}
+
+// AddUser додає нового користувача до інтерфейсу interfaceName
+// (порожня назва - інтерфейс за замовчуванням).
+// Якщо staticIP не порожній, користувачу призначається саме ця адреса.
+// keepalive перевизначає інтервал keepalive з конфігурації, якщо не nil.
+func (s *Server) AddUser(interfaceName, username, staticIP string, keepalive *int) error {
+	iface, err := s.lookupInterface(interfaceName)
+	if err != nil {
+		return err
+	}
+	log.Printf("Adding user %s to %s", username, iface.config.Name)
+
+	persistentKeepalive := iface.config.PersistentKeepalive
+	if keepalive != nil {
+		persistentKeepalive = *keepalive
+	}
+	if err := wg.ValidatePersistentKeepalive(persistentKeepalive); err != nil {
+		return err
+	}
+
+	var static net.IP
+	if staticIP != "" {
+		static = net.ParseIP(staticIP)
+		if static == nil {
+			return fmt.Errorf("invalid IP address %q", staticIP)
+		}
+	}
+
+	// Перевіряємо, чи не існує вже peer з таким ім'ям
+	existingPeer, err := s.storage.GetPeerByName(username)
+	if err != nil {
+		return fmt.Errorf("failed to check existing peer: %w", err)
+	}
+	if existingPeer != nil {
+		return fmt.Errorf("user %s already exists", username)
+	}
 
 	// Створюємо нового peer'а
 	peer, err := wg.NewPeer(username)
 	if err != nil {
 		return fmt.Errorf("failed to create peer: %w", err)
 	}
+	peer.PersistentKeepalive = persistentKeepalive
+	peer.InterfaceName = iface.config.Name
 
 	// Виділяємо IP адресу
-	ip, err := s.interfaceMgr.AllocateIP()
+	addresses, err := iface.manager.AllocatePeerAddresses(peer.ID, static)
 	if err != nil {
 		return fmt.Errorf("failed to allocate IP: %w", err)
 	}
 
-	peer.AllowedIPs = []string{ip.String() + "/32"}
+	peer.AllowedIPs = addresses
 
 	// Зберігаємо peer'а в БД
 	if err := s.storage.SavePeer(peer); err != nil {
+		if releaseErr := iface.manager.ReleasePeerIP(peer.ID); releaseErr != nil {
+			log.Printf("Failed to release IP %v: %v", addresses, releaseErr)
+		}
+		if errors.Is(err, storage.ErrInterfaceNotFound) {
+			return fmt.Errorf("interface %s is not initialized yet, run init first", iface.config.Name)
+		}
 		return fmt.Errorf("failed to save peer: %w", err)
 	}
 
-	log.Printf("User %s added successfully with IP %s", username, ip.String())
+	// Сервер також підхопить peer'а при наступній періодичній синхронізації
+	if err := iface.reconciler.Reconcile(); err != nil {
+		log.Printf("Warning: peer %s is not applied to %s yet: %v", username, iface.config.Name, err)
+	}
+
+	log.Printf("User %s added successfully with IP %s", username, strings.Join(addresses, ", "))
 	return nil
 }
 
-// GenerateToken генерує токен для користувача
+// GenerateToken генерує клієнтський токен користувача з доступом лише до його peer'а
 func (s *Server) GenerateToken(username string) (string, error) {
 	log.Printf("Generating token for user: %s", username)
 
@@ -179,9 +678,12 @@ func (s *Server) GenerateToken(username string) (string, error) {
 	if err != nil {
 		return "", fmt.Errorf("user not found: %w", err)
 	}
+	if peer == nil {
+		return "", fmt.Errorf("user %s not found", username)
+	}
 
 	// Генеруємо токен
-	token, err := s.tokenMgr.GenerateToken(peer.ID, username, "user", &peer.ID, 24*time.Hour)
+	token, err := s.tokenMgr.GenerateToken(peer.ID, username, auth.RoleClient, &peer.ID, 24*time.Hour)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate token: %w", err)
 	}
@@ -190,6 +692,34 @@ func (s *Server) GenerateToken(username string) (string, error) {
 	return token, nil
 }
 
+// GenerateStaffToken генерує токен адміністратора або оператора з назвою name.
+// Такий токен не прив'язаний до peer'а і дає доступ до всіх peer'ів.
+func (s *Server) GenerateStaffToken(name, role string, ttl time.Duration) (string, error) {
+	if !auth.IsStaffRole(role) {
+		return "", fmt.Errorf("invalid role %q: must be %s or %s", role, auth.RoleAdmin, auth.RoleOperator)
+	}
+	if name == "" {
+		return "", fmt.Errorf("token name cannot be empty")
+	}
+	if ttl <= 0 {
+		return "", fmt.Errorf("invalid token lifetime %s", ttl)
+	}
+
+	// Після ротації ключа токен перевіряється ще лише overlap
+	if s.keyRing != nil && ttl > s.keyRing.Overlap() {
+		log.Printf("Warning: token lifetime %s exceeds signing key overlap %s, "+
+			"the token may stop validating earlier after a key rotation", ttl, s.keyRing.Overlap())
+	}
+
+	token, err := s.tokenMgr.GenerateToken(uuid.New(), name, role, nil, ttl)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	log.Printf("Generated %s token %s valid for %s", role, name, ttl)
+	return token, nil
+}
+
 // GenerateEnrollmentToken генерує enrollment токен для користувача
 func (s *Server) GenerateEnrollmentToken(username string) (string, error) {
 	log.Printf("Generating enrollment token for user: %s", username)
@@ -201,11 +731,57 @@ func (s *Server) GenerateEnrollmentToken(username string) (string, error) {
 	}
 
 	// Генеруємо enrollment токен
-	token, err := s.tokenMgr.GenerateEnrollmentToken(username, 1*time.Hour)
+	token, claims, err := s.tokenMgr.GenerateEnrollmentToken(username, 1*time.Hour)
 	if err != nil {
 		return "", fmt.Errorf("failed to generate enrollment token: %w", err)
 	}
 
+	// Реєструємо токен: без запису в базі даних enroll його не прийме
+	err = s.storage.SaveToken(&wg.Token{
+		ID:        claims.ID,
+		UserID:    claims.UserID,
+		Username:  username,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: claims.ExpiresAt.Time,
+		CreatedAt: claims.IssuedAt.Time,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to save enrollment token: %w", err)
+	}
+
 	log.Printf("Enrollment token generated for user %s", username)
 	return token, nil
 }
+
+// RevokeTokens відкликає токени: kind - auth.RevokeTokenID, auth.RevokeUser
+// або auth.RevokePeer. Peer'а можна вказати за ID або за назвою.
+// Запущений сервер застосовує відкликання після оновлення кешу відкликань.
+func (s *Server) RevokeTokens(kind, value string) (*wg.TokenRevocation, error) {
+	if kind == auth.RevokePeer {
+		if _, err := uuid.Parse(value); err != nil {
+			peer, err := s.storage.GetPeerByName(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load peer: %w", err)
+			}
+			if peer == nil {
+				return nil, fmt.Errorf("peer %s not found", value)
+			}
+			value = peer.ID.String()
+		}
+	}
+	if err := auth.ValidateRevocation(kind, value); err != nil {
+		return nil, err
+	}
+
+	revocation := &wg.TokenRevocation{
+		Kind:      kind,
+		Value:     value,
+		RevokedAt: time.Now(),
+	}
+	if err := s.storage.RevokeTokens(revocation); err != nil {
+		return nil, fmt.Errorf("failed to revoke tokens: %w", err)
+	}
+
+	log.Printf("Revoked tokens by %s %s", kind, value)
+	return revocation, nil
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/artem/wg-orbit/internal/storage"
+)
+
+func TestServer_Reinitialize(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage() error: %v", err)
+	}
+	defer store.Close()
+
+	backend := newFakeBackend()
+	srv, err := newServer(DefaultConfig(), store, backend)
+	if err != nil {
+		t.Fatalf("newServer() error: %v", err)
+	}
+
+	if err := srv.Initialize(""); err != nil {
+		t.Fatalf("Initialize() error: %v", err)
+	}
+	if err := srv.AddUser("", "alice", "", nil); err != nil {
+		t.Fatalf("AddUser() error: %v", err)
+	}
+	first, err := store.GetInterface("wg0")
+	if err != nil || first == nil {
+		t.Fatalf("GetInterface() = %v, %v", first, err)
+	}
+	created := strings.Join(backend.mutations(), "\n")
+
+	// Повторний init поверх живого інтерфейсу нічого не перестворює
+	backend.calls = nil
+	if err := srv.Initialize(""); err != nil {
+		t.Fatalf("Initialize() over existing link error: %v", err)
+	}
+	for _, call := range backend.mutations() {
+		if strings.HasPrefix(call, "CreateLink") || strings.HasPrefix(call, "Delete") || strings.HasPrefix(call, "ConfigurePeers") {
+			t.Errorf("unexpected call %q on re-init", call)
+		}
+	}
+
+	// Після перезавантаження інтерфейсу немає: init відтворює його таким самим
+	delete(backend.links, "wg0")
+	backend.calls = nil
+	if err := srv.Initialize(""); err != nil {
+		t.Fatalf("Initialize() after reboot error: %v", err)
+	}
+	if got := strings.Join(backend.mutations(), "\n"); got != created {
+		t.Errorf("calls after reboot = %q, want %q", got, created)
+	}
+
+	second, err := store.GetInterface("wg0")
+	if err != nil || second == nil {
+		t.Fatalf("GetInterface() = %v, %v", second, err)
+	}
+	if second.PublicKey != first.PublicKey || !second.CreatedAt.Equal(first.CreatedAt) {
+		t.Errorf("interface record changed on re-init: %+v, want %+v", second, first)
+	}
+	if peers := backend.links["wg0"].peers; len(peers) != 1 {
+		t.Errorf("device peers = %v, want alice", peers)
+	}
+}
+
+func TestServer_AddUserDuplicate(t *testing.T) {
+	store, err := storage.NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage() error: %v", err)
+	}
+	defer store.Close()
+
+	srv, err := newServer(DefaultConfig(), store, newFakeBackend())
+	if err != nil {
+		t.Fatalf("newServer() error: %v", err)
+	}
+	if err := srv.Initialize(""); err != nil {
+		t.Fatalf("Initialize() error: %v", err)
+	}
+	if err := srv.AddUser("", "alice", "", nil); err != nil {
+		t.Fatalf("AddUser() error: %v", err)
+	}
+	alice, err := store.GetPeerByName("alice")
+	if err != nil || alice == nil {
+		t.Fatalf("GetPeerByName() = %v, %v", alice, err)
+	}
+
+	if err := srv.AddUser("", "alice", "", nil); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("AddUser() duplicate error = %v, want already exists", err)
+	}
+	if got, err := store.GetPeerByName("alice"); err != nil || got == nil || got.ID != alice.ID {
+		t.Errorf("GetPeerByName() after duplicate = %v, %v, want original peer", got, err)
+	}
+	allocations, err := store.ListAllocations("wg0")
+	if err != nil || len(allocations) != 1 || allocations[0].PeerID != alice.ID {
+		t.Errorf("ListAllocations() = %v, %v, want only alice", allocations, err)
+	}
+}
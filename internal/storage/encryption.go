@@ -0,0 +1,331 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// MasterKeyEnv - змінна оточення з master-ключем у base64
+const MasterKeyEnv = "WG_ORBIT_MASTER_KEY"
+
+// encryptedPrefix позначає значення, зашифровані Cipher
+const encryptedPrefix = "enc:v1:"
+
+// ErrMasterKeyRequired повертається при читанні зашифрованих даних без master-ключа
+var ErrMasterKeyRequired = errors.New("value is encrypted but no master key is configured")
+
+// Cipher шифрує приватні ключі в БД методом envelope encryption.
+//
+// Кожне значення шифрується власним випадковим data key (AES-256-GCM),
+// а сам data key шифрується master-ключем і зберігається поруч.
+// Завдяки цьому ротація master-ключа переписує лише обгорнуті data key.
+//
+// Формат значення: enc:v1:<key id>:<wrapped data key>:<ciphertext>
+type Cipher struct {
+	aead  cipher.AEAD
+	keyID string
+}
+
+// NewCipher створює Cipher з 32-байтного master-ключа
+func NewCipher(masterKey []byte) (*Cipher, error) {
+	if len(masterKey) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, got %d", len(masterKey))
+	}
+
+	aead, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(masterKey)
+	return &Cipher{
+		aead:  aead,
+		keyID: hex.EncodeToString(sum[:4]),
+	}, nil
+}
+
+// ParseMasterKey декодує master-ключ у base64 (формат як у `wg genkey`)
+func ParseMasterKey(encoded string) (*Cipher, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("invalid master key encoding: %w", err)
+	}
+	return NewCipher(key)
+}
+
+// LoadMasterKey завантажує master-ключ із змінної оточення WG_ORBIT_MASTER_KEY
+// або з файлу. Повертає nil, якщо ключ не налаштовано.
+func LoadMasterKey(keyFile string) (*Cipher, error) {
+	if encoded := os.Getenv(MasterKeyEnv); encoded != "" {
+		return ParseMasterKey(encoded)
+	}
+
+	if keyFile == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read master key file: %w", err)
+	}
+	return ParseMasterKey(string(data))
+}
+
+// KeyID повертає короткий ідентифікатор master-ключа
+func (c *Cipher) KeyID() string {
+	return c.keyID
+}
+
+// Encrypt шифрує значення. Порожні значення не шифруються.
+func (c *Cipher) Encrypt(plaintext string) (string, error) {
+	if plaintext == "" {
+		return "", nil
+	}
+
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return "", fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	ciphertext, err := seal(dataAEAD, []byte(plaintext))
+	if err != nil {
+		return "", err
+	}
+
+	wrappedKey, err := seal(c.aead, dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedPrefix + c.keyID + ":" +
+		base64.RawStdEncoding.EncodeToString(wrappedKey) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// Decrypt розшифровує значення. Незашифровані значення повертаються як є,
+// тому бази, створені до ввімкнення шифрування, залишаються читабельними.
+func (c *Cipher) Decrypt(value string) (string, error) {
+	if !IsEncrypted(value) {
+		return value, nil
+	}
+
+	keyID, wrappedKey, ciphertext, err := parseEncrypted(value)
+	if err != nil {
+		return "", err
+	}
+
+	if c == nil {
+		return "", ErrMasterKeyRequired
+	}
+	if keyID != c.keyID {
+		return "", fmt.Errorf("value is encrypted with master key %s, configured key is %s", keyID, c.keyID)
+	}
+
+	dataKey, err := open(c.aead, wrappedKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := open(dataAEAD, ciphertext)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt value: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// Rewrap переобгортає data key значення новим master-ключем.
+// Незашифровані значення шифруються новим ключем.
+func (c *Cipher) Rewrap(value string, next *Cipher) (string, error) {
+	if !IsEncrypted(value) {
+		return next.Encrypt(value)
+	}
+
+	keyID, wrappedKey, ciphertext, err := parseEncrypted(value)
+	if err != nil {
+		return "", err
+	}
+	if keyID == next.keyID {
+		return value, nil
+	}
+	if c == nil {
+		return "", ErrMasterKeyRequired
+	}
+	if keyID != c.keyID {
+		return "", fmt.Errorf("value is encrypted with master key %s, configured key is %s", keyID, c.keyID)
+	}
+
+	dataKey, err := open(c.aead, wrappedKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	rewrapped, err := seal(next.aead, dataKey)
+	if err != nil {
+		return "", err
+	}
+
+	return encryptedPrefix + next.keyID + ":" +
+		base64.RawStdEncoding.EncodeToString(rewrapped) + ":" +
+		base64.RawStdEncoding.EncodeToString(ciphertext), nil
+}
+
+// IsEncrypted перевіряє, чи значення зашифроване Cipher
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, encryptedPrefix)
+}
+
+// parseEncrypted розбирає зашифроване значення на складові
+func parseEncrypted(value string) (keyID string, wrappedKey, ciphertext []byte, err error) {
+	parts := strings.Split(strings.TrimPrefix(value, encryptedPrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, fmt.Errorf("malformed encrypted value")
+	}
+
+	wrappedKey, err = base64.RawStdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("malformed wrapped key: %w", err)
+	}
+
+	ciphertext, err = base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("malformed ciphertext: %w", err)
+	}
+
+	return parts[0], wrappedKey, ciphertext, nil
+}
+
+// newAEAD створює AES-256-GCM з ключа
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal шифрує дані, додаючи випадковий nonce на початок
+func seal(aead cipher.AEAD, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// open розшифровує дані, створені seal
+func open(aead cipher.AEAD, data []byte) ([]byte, error) {
+	if len(data) < aead.NonceSize() {
+		return nil, fmt.Errorf("ciphertext too short")
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// encryptValue шифрує значення, якщо master-ключ налаштовано
+func encryptValue(c *Cipher, value string) (string, error) {
+	if c == nil {
+		return value, nil
+	}
+	return c.Encrypt(value)
+}
+
+// rekeySecrets переобгортає всі секретні колонки новим master-ключем
+// в одній транзакції і повертає кількість оновлених рядків
+func rekeySecrets(db *sql.DB, d dialect, current, next *Cipher) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin rekey: %w", err)
+	}
+	defer tx.Rollback()
+
+	tables := []struct {
+		name    string
+		key     string
+		columns []string
+	}{
+		{name: "interfaces", key: "name", columns: []string{"private_key"}},
+		{name: "peers", key: "id", columns: []string{"private_key", "preshared_key"}},
+		{name: "signing_keys", key: "kid", columns: []string{"private_key"}},
+	}
+
+	updated := 0
+	for _, table := range tables {
+		query := fmt.Sprintf(`SELECT %s, %s FROM %s`, table.key, strings.Join(table.columns, ", "), table.name)
+		rows, err := tx.Query(query)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read %s: %w", table.name, err)
+		}
+
+		type row struct {
+			key    string
+			values []sql.NullString
+		}
+		var pending []row
+		for rows.Next() {
+			r := row{values: make([]sql.NullString, len(table.columns))}
+			dest := []interface{}{&r.key}
+			for i := range r.values {
+				dest = append(dest, &r.values[i])
+			}
+			if err := rows.Scan(dest...); err != nil {
+				rows.Close()
+				return 0, fmt.Errorf("failed to scan %s: %w", table.name, err)
+			}
+			pending = append(pending, r)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+
+		assignments := make([]string, len(table.columns))
+		for i, column := range table.columns {
+			assignments[i] = column + " = ?"
+		}
+		update := d.rebind(fmt.Sprintf(`UPDATE %s SET %s WHERE %s = ?`,
+			table.name, strings.Join(assignments, ", "), table.key))
+
+		for _, r := range pending {
+			args := make([]interface{}, 0, len(r.values)+1)
+			for _, value := range r.values {
+				rewrapped, err := current.Rewrap(value.String, next)
+				if err != nil {
+					return 0, fmt.Errorf("failed to rekey %s %s: %w", table.name, r.key, err)
+				}
+				args = append(args, rewrapped)
+			}
+			args = append(args, r.key)
+
+			if _, err := tx.Exec(update, args...); err != nil {
+				return 0, fmt.Errorf("failed to update %s %s: %w", table.name, r.key, err)
+			}
+			updated++
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit rekey: %w", err)
+	}
+
+	return updated, nil
+}
@@ -0,0 +1,155 @@
+package storage
+
+import (
+	"crypto/rand"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestCipher створює Cipher з випадковим master-ключем
+func newTestCipher(t *testing.T) *Cipher {
+	t.Helper()
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	c, err := NewCipher(key)
+	if err != nil {
+		t.Fatalf("NewCipher() error: %v", err)
+	}
+	return c
+}
+
+func TestCipher_RoundTrip(t *testing.T) {
+	c := newTestCipher(t)
+
+	encrypted, err := c.Encrypt("secret-key")
+	if err != nil {
+		t.Fatalf("Encrypt() error: %v", err)
+	}
+	if !IsEncrypted(encrypted) || strings.Contains(encrypted, "secret-key") {
+		t.Fatalf("Encrypt() = %q, want opaque encrypted value", encrypted)
+	}
+
+	decrypted, err := c.Decrypt(encrypted)
+	if err != nil || decrypted != "secret-key" {
+		t.Errorf("Decrypt() = %q, %v, want secret-key", decrypted, err)
+	}
+
+	empty, err := c.Encrypt("")
+	if err != nil || empty != "" {
+		t.Errorf("Encrypt(\"\") = %q, %v, want empty", empty, err)
+	}
+
+	plain, err := c.Decrypt("legacy-plaintext")
+	if err != nil || plain != "legacy-plaintext" {
+		t.Errorf("Decrypt(plaintext) = %q, %v", plain, err)
+	}
+}
+
+func TestCipher_WrongKey(t *testing.T) {
+	encrypted, err := newTestCipher(t).Encrypt("secret-key")
+	if err != nil {
+		t.Fatalf("Encrypt() error: %v", err)
+	}
+
+	if _, err := newTestCipher(t).Decrypt(encrypted); err == nil {
+		t.Errorf("Decrypt() with another master key expected error")
+	}
+
+	var none *Cipher
+	if _, err := none.Decrypt(encrypted); !errors.Is(err, ErrMasterKeyRequired) {
+		t.Errorf("Decrypt() without master key error = %v, want ErrMasterKeyRequired", err)
+	}
+}
+
+func TestCipher_Rewrap(t *testing.T) {
+	oldKey, newKey := newTestCipher(t), newTestCipher(t)
+
+	encrypted, err := oldKey.Encrypt("secret-key")
+	if err != nil {
+		t.Fatalf("Encrypt() error: %v", err)
+	}
+
+	rewrapped, err := oldKey.Rewrap(encrypted, newKey)
+	if err != nil {
+		t.Fatalf("Rewrap() error: %v", err)
+	}
+
+	decrypted, err := newKey.Decrypt(rewrapped)
+	if err != nil || decrypted != "secret-key" {
+		t.Errorf("Decrypt() after rewrap = %q, %v", decrypted, err)
+	}
+	if _, err := oldKey.Decrypt(rewrapped); err == nil {
+		t.Errorf("old master key must not decrypt rewrapped value")
+	}
+}
+
+func TestSQLiteStorage_EncryptedKeys(t *testing.T) {
+	store, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "encrypted.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage() error: %v", err)
+	}
+	defer store.Close()
+
+	// Рядок, записаний до ввімкнення шифрування
+	legacy := newTestPeer(t, "legacy")
+	if err := store.SavePeer(legacy); err != nil {
+		t.Fatalf("SavePeer() error: %v", err)
+	}
+
+	store.cipher = newTestCipher(t)
+
+	peer := newTestPeer(t, "alice")
+	peer.PresharedKey = "psk"
+	if err := store.SavePeer(peer); err != nil {
+		t.Fatalf("SavePeer() error: %v", err)
+	}
+
+	var rawPrivate, rawPSK string
+	err = store.db.QueryRow(`SELECT private_key, preshared_key FROM peers WHERE id = ?`, peer.ID.String()).
+		Scan(&rawPrivate, &rawPSK)
+	if err != nil {
+		t.Fatalf("failed to read raw row: %v", err)
+	}
+	if !IsEncrypted(rawPrivate) || !IsEncrypted(rawPSK) {
+		t.Fatalf("keys stored in plaintext: %q, %q", rawPrivate, rawPSK)
+	}
+
+	got, err := store.GetPeer(peer.ID)
+	if err != nil || got.PrivateKey != peer.PrivateKey || got.PresharedKey != "psk" {
+		t.Fatalf("GetPeer() = %+v, %v", got, err)
+	}
+
+	next := newTestCipher(t)
+	updated, err := store.Rekey(next)
+	if err != nil {
+		t.Fatalf("Rekey() error: %v", err)
+	}
+	if updated != 2 {
+		t.Errorf("Rekey() updated %d rows, want 2", updated)
+	}
+
+	peers, err := store.ListPeers()
+	if err != nil || len(peers) != 2 {
+		t.Fatalf("ListPeers() after rekey = %v, %v", peers, err)
+	}
+	for _, p := range peers {
+		want := peer.PrivateKey
+		if p.ID == legacy.ID {
+			want = legacy.PrivateKey
+		}
+		if p.PrivateKey != want {
+			t.Errorf("peer %s PrivateKey not preserved by rekey", p.Name)
+		}
+	}
+
+	err = store.db.QueryRow(`SELECT private_key FROM peers WHERE id = ?`, legacy.ID.String()).Scan(&rawPrivate)
+	if err != nil || !strings.HasPrefix(rawPrivate, encryptedPrefix+next.KeyID()) {
+		t.Errorf("legacy row not encrypted with new key: %q, %v", rawPrivate, err)
+	}
+}
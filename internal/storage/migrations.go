@@ -0,0 +1,439 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrSchemaTooNew повертається, коли схема БД новіша за підтримувану бінарником
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary supports")
+
+// Migration описує одну пронумеровану зміну схеми бази даних.
+// Кожен backend має власний набір SQL-інструкцій для тієї ж версії.
+type Migration struct {
+	Version     int
+	Description string
+	SQLite      []string
+	Postgres    []string
+}
+
+// SchemaStatus описує поточний стан схеми бази даних
+type SchemaStatus struct {
+	Current int         `json:"current"`
+	Latest  int         `json:"latest"`
+	Pending []Migration `json:"-"`
+}
+
+// TooNew повертає true, якщо схема БД новіша за бінарник
+func (s *SchemaStatus) TooNew() bool {
+	return s.Current > s.Latest
+}
+
+// migrations - упорядкований список усіх міграцій схеми.
+// Нові міграції додаються лише в кінець, існуючі ніколи не змінюються.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "initial schema",
+		SQLite: []string{
+			`CREATE TABLE IF NOT EXISTS interfaces (
+				name TEXT PRIMARY KEY,
+				public_key TEXT NOT NULL,
+				private_key TEXT NOT NULL,
+				listen_port INTEGER NOT NULL,
+				address TEXT NOT NULL,
+				created_at DATETIME NOT NULL,
+				updated_at DATETIME NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS peers (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL UNIQUE,
+				public_key TEXT NOT NULL UNIQUE,
+				private_key TEXT NOT NULL,
+				allowed_ips TEXT NOT NULL,
+				endpoint TEXT,
+				preshared_key TEXT,
+				created_at DATETIME NOT NULL,
+				updated_at DATETIME NOT NULL,
+				last_seen DATETIME,
+				is_active BOOLEAN NOT NULL DEFAULT 1
+			)`,
+			`CREATE TABLE IF NOT EXISTS tokens (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL,
+				username TEXT NOT NULL,
+				token_hash TEXT NOT NULL,
+				expires_at DATETIME NOT NULL,
+				created_at DATETIME NOT NULL,
+				is_used BOOLEAN NOT NULL DEFAULT 0
+			)`,
+		},
+		Postgres: []string{
+			`CREATE TABLE IF NOT EXISTS interfaces (
+				name TEXT PRIMARY KEY,
+				public_key TEXT NOT NULL,
+				private_key TEXT NOT NULL,
+				listen_port INTEGER NOT NULL,
+				address TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS peers (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL UNIQUE,
+				public_key TEXT NOT NULL UNIQUE,
+				private_key TEXT NOT NULL,
+				allowed_ips TEXT NOT NULL,
+				endpoint TEXT NOT NULL DEFAULT '',
+				preshared_key TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMPTZ NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL,
+				last_seen TIMESTAMPTZ,
+				is_active BOOLEAN NOT NULL DEFAULT TRUE
+			)`,
+			`CREATE TABLE IF NOT EXISTS tokens (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL,
+				username TEXT NOT NULL,
+				token_hash TEXT NOT NULL,
+				expires_at TIMESTAMPTZ NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				is_used BOOLEAN NOT NULL DEFAULT FALSE
+			)`,
+		},
+	},
+	{
+		Version:     2,
+		Description: "persistent IP allocations",
+		SQLite: []string{
+			`CREATE TABLE ip_allocations (
+				interface_name TEXT NOT NULL,
+				address TEXT NOT NULL,
+				peer_id TEXT NOT NULL,
+				created_at DATETIME NOT NULL,
+				PRIMARY KEY (interface_name, address)
+			)`,
+			`CREATE INDEX idx_ip_allocations_peer_id ON ip_allocations (peer_id)`,
+		},
+		Postgres: []string{
+			`CREATE TABLE ip_allocations (
+				interface_name TEXT NOT NULL,
+				address TEXT NOT NULL,
+				peer_id TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (interface_name, address)
+			)`,
+			`CREATE INDEX idx_ip_allocations_peer_id ON ip_allocations (peer_id)`,
+		},
+	},
+	{
+		Version:     3,
+		Description: "peer traffic statistics",
+		SQLite: []string{
+			`CREATE TABLE peer_stats (
+				peer_id TEXT PRIMARY KEY,
+				rx_bytes INTEGER NOT NULL DEFAULT 0,
+				tx_bytes INTEGER NOT NULL DEFAULT 0,
+				rx_counter INTEGER NOT NULL DEFAULT 0,
+				tx_counter INTEGER NOT NULL DEFAULT 0,
+				updated_at DATETIME NOT NULL
+			)`,
+		},
+		Postgres: []string{
+			`CREATE TABLE peer_stats (
+				peer_id TEXT PRIMARY KEY,
+				rx_bytes BIGINT NOT NULL DEFAULT 0,
+				tx_bytes BIGINT NOT NULL DEFAULT 0,
+				rx_counter BIGINT NOT NULL DEFAULT 0,
+				tx_counter BIGINT NOT NULL DEFAULT 0,
+				updated_at TIMESTAMPTZ NOT NULL
+			)`,
+		},
+	},
+	{
+		Version:     4,
+		Description: "interface MTU, fwmark, routing table and peer keepalive",
+		SQLite: []string{
+			`ALTER TABLE interfaces ADD COLUMN mtu INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE interfaces ADD COLUMN fwmark INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE interfaces ADD COLUMN route_table TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE peers ADD COLUMN persistent_keepalive INTEGER NOT NULL DEFAULT 0`,
+		},
+		Postgres: []string{
+			`ALTER TABLE interfaces ADD COLUMN mtu INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE interfaces ADD COLUMN fwmark BIGINT NOT NULL DEFAULT 0`,
+			`ALTER TABLE interfaces ADD COLUMN route_table TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE peers ADD COLUMN persistent_keepalive INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		Version:     5,
+		Description: "peers linked to interfaces",
+		SQLite: []string{
+			`ALTER TABLE peers ADD COLUMN interface_name TEXT REFERENCES interfaces (name)`,
+			`CREATE INDEX idx_peers_interface_name ON peers (interface_name)`,
+			// Існуючі peer'и отримують інтерфейс своїх виділених адрес,
+			// а якщо адрес немає - єдиний збережений інтерфейс
+			`UPDATE peers SET interface_name = (
+				SELECT a.interface_name FROM ip_allocations a
+				JOIN interfaces i ON i.name = a.interface_name
+				WHERE a.peer_id = peers.id
+				LIMIT 1
+			)`,
+			`UPDATE peers SET interface_name = (SELECT name FROM interfaces)
+				WHERE interface_name IS NULL AND (SELECT COUNT(*) FROM interfaces) = 1`,
+		},
+		Postgres: []string{
+			`ALTER TABLE peers ADD COLUMN interface_name TEXT REFERENCES interfaces (name)`,
+			`CREATE INDEX idx_peers_interface_name ON peers (interface_name)`,
+			`UPDATE peers SET interface_name = (
+				SELECT a.interface_name FROM ip_allocations a
+				JOIN interfaces i ON i.name = a.interface_name
+				WHERE a.peer_id = peers.id
+				LIMIT 1
+			)`,
+			`UPDATE peers SET interface_name = (SELECT name FROM interfaces)
+				WHERE interface_name IS NULL AND (SELECT COUNT(*) FROM interfaces) = 1`,
+		},
+	},
+	{
+		Version:     6,
+		Description: "token revocations",
+		SQLite: []string{
+			`CREATE TABLE token_revocations (
+				kind TEXT NOT NULL,
+				value TEXT NOT NULL,
+				revoked_at DATETIME NOT NULL,
+				PRIMARY KEY (kind, value)
+			)`,
+		},
+		Postgres: []string{
+			`CREATE TABLE token_revocations (
+				kind TEXT NOT NULL,
+				value TEXT NOT NULL,
+				revoked_at TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (kind, value)
+			)`,
+		},
+	},
+	{
+		Version:     7,
+		Description: "refresh tokens",
+		SQLite: []string{
+			`CREATE TABLE refresh_tokens (
+				id TEXT PRIMARY KEY,
+				family_id TEXT NOT NULL,
+				peer_id TEXT NOT NULL,
+				user_id TEXT NOT NULL,
+				token_hash TEXT NOT NULL UNIQUE,
+				expires_at DATETIME NOT NULL,
+				created_at DATETIME NOT NULL,
+				used_at DATETIME,
+				revoked_at DATETIME
+			)`,
+			`CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens (family_id)`,
+			`CREATE INDEX idx_refresh_tokens_peer_id ON refresh_tokens (peer_id)`,
+		},
+		Postgres: []string{
+			`CREATE TABLE refresh_tokens (
+				id TEXT PRIMARY KEY,
+				family_id TEXT NOT NULL,
+				peer_id TEXT NOT NULL,
+				user_id TEXT NOT NULL,
+				token_hash TEXT NOT NULL UNIQUE,
+				expires_at TIMESTAMPTZ NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				used_at TIMESTAMPTZ,
+				revoked_at TIMESTAMPTZ
+			)`,
+			`CREATE INDEX idx_refresh_tokens_family_id ON refresh_tokens (family_id)`,
+			`CREATE INDEX idx_refresh_tokens_peer_id ON refresh_tokens (peer_id)`,
+		},
+	},
+	{
+		Version:     8,
+		Description: "JWT signing keys",
+		SQLite: []string{
+			`CREATE TABLE signing_keys (
+				kid TEXT PRIMARY KEY,
+				algorithm TEXT NOT NULL,
+				private_key TEXT NOT NULL,
+				public_key TEXT NOT NULL,
+				created_at DATETIME NOT NULL,
+				expires_at DATETIME
+			)`,
+		},
+		Postgres: []string{
+			`CREATE TABLE signing_keys (
+				kid TEXT PRIMARY KEY,
+				algorithm TEXT NOT NULL,
+				private_key TEXT NOT NULL,
+				public_key TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				expires_at TIMESTAMPTZ
+			)`,
+		},
+	},
+}
+
+// LatestSchemaVersion повертає версію схеми, яку підтримує бінарник
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// dialect визначає відмінності SQL між backend'ами
+type dialect int
+
+const (
+	dialectSQLite dialect = iota
+	dialectPostgres
+)
+
+// statements повертає SQL-інструкції міграції для діалекту
+func (d dialect) statements(m Migration) []string {
+	if d == dialectPostgres {
+		return m.Postgres
+	}
+	return m.SQLite
+}
+
+// rebind замінює плейсхолдери "?" на "$n" для PostgreSQL
+func (d dialect) rebind(query string) string {
+	if d != dialectPostgres {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// migrator застосовує міграції до бази даних
+type migrator struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// schemaVersionTable створює таблицю з історією застосованих міграцій
+const schemaVersionTable = `CREATE TABLE IF NOT EXISTS schema_version (
+	version INTEGER PRIMARY KEY,
+	description TEXT NOT NULL,
+	applied_at TIMESTAMP NOT NULL
+)`
+
+// migrationLockID - ключ advisory lock, що серіалізує міграції між репліками PostgreSQL
+const migrationLockID = 0x77676f72 // "wgor"
+
+// Migrate застосовує всі відсутні міграції в одній транзакції
+// і повертає список застосованих
+func (m *migrator) Migrate() ([]Migration, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin migration: %w", err)
+	}
+	defer tx.Rollback()
+
+	if m.dialect == dialectPostgres {
+		if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+			return nil, fmt.Errorf("failed to acquire migration lock: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(schemaVersionTable); err != nil {
+		return nil, fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+
+	current, err := currentSchemaVersion(tx)
+	if err != nil {
+		return nil, err
+	}
+	if current > LatestSchemaVersion() {
+		return nil, fmt.Errorf("%w: database is at version %d, binary supports up to %d",
+			ErrSchemaTooNew, current, LatestSchemaVersion())
+	}
+
+	var applied []Migration
+	for _, migration := range migrations {
+		if migration.Version <= current {
+			continue
+		}
+
+		for _, stmt := range m.dialect.statements(migration) {
+			if _, err := tx.Exec(stmt); err != nil {
+				return nil, fmt.Errorf("migration %d (%s) failed: %w",
+					migration.Version, migration.Description, err)
+			}
+		}
+
+		query := m.dialect.rebind(`INSERT INTO schema_version (version, description, applied_at) VALUES (?, ?, ?)`)
+		if _, err := tx.Exec(query, migration.Version, migration.Description, time.Now().UTC()); err != nil {
+			return nil, fmt.Errorf("failed to record migration %d: %w", migration.Version, err)
+		}
+
+		applied = append(applied, migration)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit migrations: %w", err)
+	}
+
+	return applied, nil
+}
+
+// Status повертає поточну та останню версії схеми без внесення змін
+func (m *migrator) Status() (*SchemaStatus, error) {
+	status := &SchemaStatus{Latest: LatestSchemaVersion()}
+
+	current, err := currentSchemaVersion(m.db)
+	if err != nil {
+		return nil, err
+	}
+	status.Current = current
+
+	for _, migration := range migrations {
+		if migration.Version > current {
+			status.Pending = append(status.Pending, migration)
+		}
+	}
+
+	return status, nil
+}
+
+// queryer узагальнює *sql.DB та *sql.Tx
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// currentSchemaVersion повертає максимальну застосовану версію схеми.
+// Відсутність таблиці schema_version означає версію 0.
+func currentSchemaVersion(q queryer) (int, error) {
+	var version sql.NullInt64
+	err := q.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&version)
+	if err != nil {
+		if isMissingTableError(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	return int(version.Int64), nil
+}
+
+// isMissingTableError перевіряє, чи помилка спричинена відсутністю таблиці
+func isMissingTableError(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "no such table") || // SQLite
+		strings.Contains(msg, "does not exist") // PostgreSQL
+}
@@ -0,0 +1,169 @@
+package storage
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMigrations_Ordered(t *testing.T) {
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			t.Errorf("migration #%d has version %d, want %d", i, migration.Version, i+1)
+		}
+		if len(migration.SQLite) == 0 || len(migration.Postgres) == 0 {
+			t.Errorf("migration %d must define statements for every backend", migration.Version)
+		}
+	}
+}
+
+func TestSQLiteStorage_Migrate(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "migrate.db")
+
+	store, err := OpenSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("OpenSQLiteStorage() error: %v", err)
+	}
+	defer store.Close()
+
+	status, err := store.SchemaStatus()
+	if err != nil {
+		t.Fatalf("SchemaStatus() error: %v", err)
+	}
+	if status.Current != 0 || len(status.Pending) != len(migrations) {
+		t.Errorf("SchemaStatus() on empty database = %+v", status)
+	}
+
+	applied, err := store.Migrate()
+	if err != nil {
+		t.Fatalf("Migrate() error: %v", err)
+	}
+	if len(applied) != len(migrations) {
+		t.Errorf("Migrate() applied %d migrations, want %d", len(applied), len(migrations))
+	}
+
+	applied, err = store.Migrate()
+	if err != nil || len(applied) != 0 {
+		t.Errorf("second Migrate() = %v, %v, want no migrations", applied, err)
+	}
+
+	status, err = store.SchemaStatus()
+	if err != nil {
+		t.Fatalf("SchemaStatus() error: %v", err)
+	}
+	if status.Current != LatestSchemaVersion() || len(status.Pending) != 0 || status.TooNew() {
+		t.Errorf("SchemaStatus() after migrate = %+v", status)
+	}
+}
+
+func TestSQLiteStorage_LegacyDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "legacy.db")
+
+	// База, створена до появи міграцій, містить таблиці без schema_version
+	legacy, err := OpenSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("OpenSQLiteStorage() error: %v", err)
+	}
+	for _, stmt := range migrations[0].SQLite {
+		if _, err := legacy.db.Exec(stmt); err != nil {
+			t.Fatalf("failed to create legacy schema: %v", err)
+		}
+	}
+	legacy.Close()
+
+	store, err := NewSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage() on legacy database error: %v", err)
+	}
+	defer store.Close()
+
+	status, err := store.SchemaStatus()
+	if err != nil || status.Current != LatestSchemaVersion() {
+		t.Errorf("SchemaStatus() = %+v, %v", status, err)
+	}
+}
+
+func TestSQLiteStorage_RefusesNewerSchema(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "newer.db")
+
+	store, err := NewSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage() error: %v", err)
+	}
+	_, err = store.db.Exec(`INSERT INTO schema_version (version, description, applied_at) VALUES (?, ?, ?)`,
+		LatestSchemaVersion()+1, "from the future", time.Now())
+	if err != nil {
+		t.Fatalf("failed to insert future version: %v", err)
+	}
+	store.Close()
+
+	_, err = NewSQLiteStorage(dbPath)
+	if !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("NewSQLiteStorage() error = %v, want ErrSchemaTooNew", err)
+	}
+}
+
+func TestSQLiteStorage_MigratePeerInterfaces(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "interfaces.db")
+
+	// База версії 4: peer'и ще не прив'язані до інтерфейсів
+	store, err := OpenSQLiteStorage(dbPath)
+	if err != nil {
+		t.Fatalf("OpenSQLiteStorage() error: %v", err)
+	}
+	defer store.Close()
+
+	if _, err := store.db.Exec(schemaVersionTable); err != nil {
+		t.Fatalf("failed to create schema_version: %v", err)
+	}
+	for _, migration := range migrations[:4] {
+		for _, stmt := range migration.SQLite {
+			if _, err := store.db.Exec(stmt); err != nil {
+				t.Fatalf("migration %d failed: %v", migration.Version, err)
+			}
+		}
+		_, err := store.db.Exec(`INSERT INTO schema_version (version, description, applied_at) VALUES (?, ?, ?)`,
+			migration.Version, migration.Description, time.Now())
+		if err != nil {
+			t.Fatalf("failed to record migration %d: %v", migration.Version, err)
+		}
+	}
+
+	now := time.Now()
+	fixtures := []string{
+		`INSERT INTO interfaces (name, public_key, private_key, listen_port, address, created_at, updated_at)
+			VALUES ('wg-staff', 'pub', 'priv', 51820, '10.0.0.1/24', ?, ?)`,
+		`INSERT INTO peers (id, name, public_key, private_key, allowed_ips, endpoint, preshared_key, created_at, updated_at)
+			VALUES ('11111111-1111-1111-1111-111111111111', 'alice', 'a', 'a', '10.0.0.2/32', '', '', ?, ?)`,
+		`INSERT INTO peers (id, name, public_key, private_key, allowed_ips, endpoint, preshared_key, created_at, updated_at)
+			VALUES ('22222222-2222-2222-2222-222222222222', 'bob', 'b', 'b', '', '', '', ?, ?)`,
+		`INSERT INTO ip_allocations (interface_name, address, peer_id, created_at)
+			VALUES ('wg-staff', '10.0.0.2', '11111111-1111-1111-1111-111111111111', ?)`,
+	}
+	for _, fixture := range fixtures {
+		args := []interface{}{now, now}
+		if strings.Count(fixture, "?") == 1 {
+			args = args[:1]
+		}
+		if _, err := store.db.Exec(fixture, args...); err != nil {
+			t.Fatalf("failed to insert fixture: %v", err)
+		}
+	}
+
+	if _, err := store.Migrate(); err != nil {
+		t.Fatalf("Migrate() error: %v", err)
+	}
+
+	// Обидва peer'и отримують єдиний інтерфейс: alice - через виділену адресу
+	peers, err := store.ListPeers()
+	if err != nil || len(peers) != 2 {
+		t.Fatalf("ListPeers() = %v, %v", peers, err)
+	}
+	for _, peer := range peers {
+		if peer.InterfaceName != "wg-staff" {
+			t.Errorf("peer %s interface = %q, want wg-staff", peer.Name, peer.InterfaceName)
+		}
+	}
+}
@@ -0,0 +1,601 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/artem/wg-orbit/internal/wg"
+)
+
+// PostgresStorage реалізує Storage інтерфейс для PostgreSQL.
+// Дозволяє кільком екземплярам wg-orbit-server працювати з однією базою.
+type PostgresStorage struct {
+	db     *sql.DB
+	cipher *Cipher
+}
+
+// NewPostgresStorage створює новий PostgreSQL storage і застосовує міграції схеми
+func NewPostgresStorage(config *Config) (*PostgresStorage, error) {
+	return newPostgresStorageDSN(config.postgresDSN())
+}
+
+// OpenPostgresStorage відкриває PostgreSQL storage без застосування міграцій
+func OpenPostgresStorage(config *Config) (*PostgresStorage, error) {
+	return openPostgresStorageDSN(config.postgresDSN())
+}
+
+// newPostgresStorageDSN створює PostgreSQL storage за готовим рядком підключення
+func newPostgresStorageDSN(dsn string) (*PostgresStorage, error) {
+	storage, err := openPostgresStorageDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := storage.Migrate(); err != nil {
+		storage.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	return storage, nil
+}
+
+// openPostgresStorageDSN відкриває з'єднання з PostgreSQL і перевіряє його
+func openPostgresStorageDSN(dsn string) (*PostgresStorage, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	return &PostgresStorage{db: db}, nil
+}
+
+// Migrate застосовує відсутні міграції схеми
+func (s *PostgresStorage) Migrate() ([]Migration, error) {
+	m := &migrator{db: s.db, dialect: dialectPostgres}
+	return m.Migrate()
+}
+
+// SchemaStatus повертає стан схеми бази даних
+func (s *PostgresStorage) SchemaStatus() (*SchemaStatus, error) {
+	m := &migrator{db: s.db, dialect: dialectPostgres}
+	return m.Status()
+}
+
+// SaveInterface зберігає інтерфейс
+func (s *PostgresStorage) SaveInterface(iface *wg.Interface) error {
+	query := `INSERT INTO interfaces
+			   (name, public_key, private_key, listen_port, address, mtu, fwmark, route_table,
+			    created_at, updated_at)
+			   VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			   ON CONFLICT (name) DO UPDATE SET
+			       public_key = EXCLUDED.public_key,
+			       private_key = EXCLUDED.private_key,
+			       listen_port = EXCLUDED.listen_port,
+			       address = EXCLUDED.address,
+			       mtu = EXCLUDED.mtu,
+			       fwmark = EXCLUDED.fwmark,
+			       route_table = EXCLUDED.route_table,
+			       created_at = EXCLUDED.created_at,
+			       updated_at = EXCLUDED.updated_at`
+
+	privateKey, err := encryptValue(s.cipher, iface.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt private key: %w", err)
+	}
+
+	_, err = s.db.Exec(query, iface.Name, iface.PublicKey, privateKey,
+		iface.ListenPort, iface.Address, iface.MTU, iface.FwMark, iface.Table,
+		iface.CreatedAt, iface.UpdatedAt)
+
+	return err
+}
+
+// GetInterface отримує інтерфейс за назвою
+func (s *PostgresStorage) GetInterface(name string) (*wg.Interface, error) {
+	query := `SELECT name, public_key, private_key, listen_port, address, mtu, fwmark, route_table,
+			          created_at, updated_at
+			   FROM interfaces WHERE name = $1`
+
+	row := s.db.QueryRow(query, name)
+
+	var iface wg.Interface
+	err := row.Scan(&iface.Name, &iface.PublicKey, &iface.PrivateKey,
+		&iface.ListenPort, &iface.Address, &iface.MTU, &iface.FwMark, &iface.Table,
+		&iface.CreatedAt, &iface.UpdatedAt)
+
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	iface.PrivateKey, err = s.cipher.Decrypt(iface.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+	}
+
+	return &iface, nil
+}
+
+// DeleteInterface видаляє запис інтерфейсу; відсутній запис не є помилкою.
+// Якщо до інтерфейсу прив'язані peer'и, повертається ErrInterfaceInUse.
+func (s *PostgresStorage) DeleteInterface(name string) error {
+	_, err := s.db.Exec(`DELETE FROM interfaces WHERE name = $1`, name)
+	if err != nil && isPostgresForeignKeyViolation(err) {
+		return fmt.Errorf("%w: %s", ErrInterfaceInUse, name)
+	}
+	return err
+}
+
+// AdoptPeers прив'язує до інтерфейсу peer'ів, що не мають інтерфейсу
+func (s *PostgresStorage) AdoptPeers(interfaceName string) (int, error) {
+	result, err := s.db.Exec(`UPDATE peers SET interface_name = $1 WHERE interface_name IS NULL`, interfaceName)
+	if err != nil {
+		return 0, err
+	}
+	adopted, err := result.RowsAffected()
+	return int(adopted), err
+}
+
+// SavePeer зберігає peer
+func (s *PostgresStorage) SavePeer(peer *wg.Peer) error {
+	return s.savePeer(s.db, peer)
+}
+
+// savePeer зберігає peer'а запитом db: з'єднанням або транзакцією
+func (s *PostgresStorage) savePeer(db execer, peer *wg.Peer) error {
+	allowedIPsStr := strings.Join(peer.AllowedIPs, ",")
+
+	privateKey, err := encryptValue(s.cipher, peer.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt private key: %w", err)
+	}
+	presharedKey, err := encryptValue(s.cipher, peer.PresharedKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt preshared key: %w", err)
+	}
+
+	query := `INSERT INTO peers
+			   (id, name, public_key, private_key, allowed_ips, endpoint, preshared_key,
+			    created_at, updated_at, last_seen, is_active, persistent_keepalive, interface_name)
+			   VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			   ON CONFLICT (id) DO UPDATE SET
+			       name = EXCLUDED.name,
+			       public_key = EXCLUDED.public_key,
+			       private_key = EXCLUDED.private_key,
+			       allowed_ips = EXCLUDED.allowed_ips,
+			       endpoint = EXCLUDED.endpoint,
+			       preshared_key = EXCLUDED.preshared_key,
+			       created_at = EXCLUDED.created_at,
+			       updated_at = EXCLUDED.updated_at,
+			       last_seen = EXCLUDED.last_seen,
+			       is_active = EXCLUDED.is_active,
+			       persistent_keepalive = EXCLUDED.persistent_keepalive,
+			       interface_name = EXCLUDED.interface_name`
+
+	_, err = db.Exec(query, peer.ID.String(), peer.Name, peer.PublicKey, privateKey,
+		allowedIPsStr, peer.Endpoint, presharedKey, peer.CreatedAt, peer.UpdatedAt,
+		peer.LastSeen, peer.IsActive, peer.PersistentKeepalive, nullString(peer.InterfaceName))
+	if err != nil && isPostgresForeignKeyViolation(err) {
+		return fmt.Errorf("%w: %s", ErrInterfaceNotFound, peer.InterfaceName)
+	}
+	if err != nil && isPostgresUniqueViolation(err) {
+		return fmt.Errorf("%w: %s", ErrPeerExists, peer.Name)
+	}
+
+	return err
+}
+
+// GetPeer отримує peer за ID
+func (s *PostgresStorage) GetPeer(id uuid.UUID) (*wg.Peer, error) {
+	query := `SELECT ` + peerColumns + `
+			   FROM peers WHERE id = $1`
+
+	peer, err := scanPeer(s.db.QueryRow(query, id.String()), s.cipher)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return peer, err
+}
+
+// GetPeerByName отримує peer за ім'ям
+func (s *PostgresStorage) GetPeerByName(name string) (*wg.Peer, error) {
+	query := `SELECT ` + peerColumns + `
+			   FROM peers WHERE name = $1`
+
+	peer, err := scanPeer(s.db.QueryRow(query, name), s.cipher)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return peer, err
+}
+
+// GetPeerByPublicKey отримує peer за публічним ключем
+func (s *PostgresStorage) GetPeerByPublicKey(publicKey string) (*wg.Peer, error) {
+	query := `SELECT ` + peerColumns + `
+			   FROM peers WHERE public_key = $1`
+
+	peer, err := scanPeer(s.db.QueryRow(query, publicKey), s.cipher)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return peer, err
+}
+
+// ListPeers повертає список всіх peer'ів
+func (s *PostgresStorage) ListPeers() ([]*wg.Peer, error) {
+	query := `SELECT ` + peerColumns + `
+			   FROM peers ORDER BY created_at DESC`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var peers []*wg.Peer
+	for rows.Next() {
+		peer, err := scanPeer(rows, s.cipher)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, peer)
+	}
+
+	return peers, rows.Err()
+}
+
+// DeletePeer видаляє peer разом з виділеними йому адресами
+func (s *PostgresStorage) DeletePeer(id uuid.UUID) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM ip_allocations WHERE peer_id = $1`, id.String()); err != nil {
+		return fmt.Errorf("failed to release addresses: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM peer_stats WHERE peer_id = $1`, id.String()); err != nil {
+		return fmt.Errorf("failed to delete peer stats: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM refresh_tokens WHERE peer_id = $1`, id.String()); err != nil {
+		return fmt.Errorf("failed to delete refresh tokens: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM peers WHERE id = $1`, id.String()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdatePeerLastSeen оновлює час останнього підключення peer'а
+func (s *PostgresStorage) UpdatePeerLastSeen(id uuid.UUID, lastSeen time.Time) error {
+	query := `UPDATE peers SET last_seen = $1, updated_at = $2 WHERE id = $3`
+	_, err := s.db.Exec(query, lastSeen, time.Now(), id.String())
+	return err
+}
+
+// SavePeerStats зберігає статистику трафіку peer'а
+func (s *PostgresStorage) SavePeerStats(stats *wg.PeerStats) error {
+	query := `INSERT INTO peer_stats (peer_id, rx_bytes, tx_bytes, rx_counter, tx_counter, updated_at)
+			   VALUES ($1, $2, $3, $4, $5, $6)
+			   ON CONFLICT (peer_id) DO UPDATE SET
+			   rx_bytes = EXCLUDED.rx_bytes, tx_bytes = EXCLUDED.tx_bytes,
+			   rx_counter = EXCLUDED.rx_counter, tx_counter = EXCLUDED.tx_counter,
+			   updated_at = EXCLUDED.updated_at`
+
+	_, err := s.db.Exec(query, stats.PeerID.String(), stats.RxBytes, stats.TxBytes,
+		stats.RxCounter, stats.TxCounter, stats.UpdatedAt)
+	return err
+}
+
+// GetPeerStats повертає статистику трафіку peer'а
+func (s *PostgresStorage) GetPeerStats(peerID uuid.UUID) (*wg.PeerStats, error) {
+	query := `SELECT ` + peerStatsColumns + ` FROM peer_stats WHERE peer_id = $1`
+
+	stats, err := scanPeerStats(s.db.QueryRow(query, peerID.String()))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return stats, err
+}
+
+// ListPeerStats повертає статистику трафіку всіх peer'ів
+func (s *PostgresStorage) ListPeerStats() ([]*wg.PeerStats, error) {
+	rows, err := s.db.Query(`SELECT ` + peerStatsColumns + ` FROM peer_stats`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*wg.PeerStats
+	for rows.Next() {
+		stats, err := scanPeerStats(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, stats)
+	}
+
+	return result, rows.Err()
+}
+
+// SaveToken зберігає виданий одноразовий токен
+func (s *PostgresStorage) SaveToken(token *wg.Token) error {
+	query := `INSERT INTO tokens (id, user_id, username, token_hash, expires_at, created_at, is_used)
+			   VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	_, err := s.db.Exec(query, token.ID, token.UserID.String(), token.Username, token.TokenHash,
+		token.ExpiresAt, token.CreatedAt, token.IsUsed)
+	return err
+}
+
+// GetToken отримує токен за ID
+func (s *PostgresStorage) GetToken(id string) (*wg.Token, error) {
+	query := `SELECT ` + tokenColumns + ` FROM tokens WHERE id = $1`
+
+	token, err := scanToken(s.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return token, err
+}
+
+// UseToken позначає токен використаним. Перевірка і позначка виконуються
+// одним UPDATE, тому з кількох конкурентних спроб успішною буде лише одна.
+// Повертає ErrTokenNotFound для невідомого токена і ErrTokenUsed для використаного.
+func (s *PostgresStorage) UseToken(id, tokenHash string) error {
+	query := `UPDATE tokens SET is_used = $1 WHERE id = $2 AND token_hash = $3 AND is_used = $4`
+
+	result, err := s.db.Exec(query, true, id, tokenHash, false)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		token, err := s.GetToken(id)
+		if err != nil {
+			return err
+		}
+		return tokenUseError(token, id, tokenHash)
+	}
+
+	return nil
+}
+
+// ReleaseToken знову робить токен дійсним, якщо операцію, для якої його
+// використали, не вдалося завершити
+func (s *PostgresStorage) ReleaseToken(id string) error {
+	query := `UPDATE tokens SET is_used = $1 WHERE id = $2`
+	_, err := s.db.Exec(query, false, id)
+	return err
+}
+
+// RevokeTokens зберігає відкликання токенів. Повторне відкликання того самого
+// користувача чи peer'а переносить RevokedAt, відкликаючи і новіші токени.
+func (s *PostgresStorage) RevokeTokens(revocation *wg.TokenRevocation) error {
+	query := `INSERT INTO token_revocations (kind, value, revoked_at) VALUES ($1, $2, $3)
+			   ON CONFLICT (kind, value) DO UPDATE SET revoked_at = EXCLUDED.revoked_at`
+
+	_, err := s.db.Exec(query, revocation.Kind, revocation.Value, revocation.RevokedAt)
+	return err
+}
+
+// ListRevocations повертає всі відкликання токенів
+func (s *PostgresStorage) ListRevocations() ([]*wg.TokenRevocation, error) {
+	rows, err := s.db.Query(`SELECT kind, value, revoked_at FROM token_revocations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []*wg.TokenRevocation
+	for rows.Next() {
+		revocation, err := scanRevocation(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, revocation)
+	}
+
+	return result, rows.Err()
+}
+
+// SaveRefreshToken зберігає виданий refresh токен
+func (s *PostgresStorage) SaveRefreshToken(token *wg.RefreshToken) error {
+	return insertRefreshToken(s.db, dialectPostgres, token)
+}
+
+// SavePeerWithRefreshToken зберігає нового peer'а разом з його першим
+// refresh токеном в одній транзакції
+func (s *PostgresStorage) SavePeerWithRefreshToken(peer *wg.Peer, token *wg.RefreshToken) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.savePeer(tx, peer); err != nil {
+		return err
+	}
+	if err := insertRefreshToken(tx, dialectPostgres, token); err != nil {
+		return fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// GetRefreshToken отримує refresh токен за хешем
+func (s *PostgresStorage) GetRefreshToken(tokenHash string) (*wg.RefreshToken, error) {
+	query := `SELECT ` + refreshTokenColumns + ` FROM refresh_tokens WHERE token_hash = $1`
+
+	token, err := scanRefreshToken(s.db.QueryRow(query, tokenHash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return token, err
+}
+
+// RotateRefreshToken позначає токен id використаним і зберігає next, що його
+// замінює. Позначка виконується одним UPDATE, тому з кількох конкурентних
+// ротацій успішною буде лише одна; для решти повертається ErrTokenUsed.
+func (s *PostgresStorage) RotateRefreshToken(id uuid.UUID, next *wg.RefreshToken) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE refresh_tokens SET used_at = $1 WHERE id = $2 AND used_at IS NULL AND revoked_at IS NULL`
+	result, err := tx.Exec(query, next.CreatedAt, id.String())
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: %s", ErrTokenUsed, id)
+	}
+
+	if err := insertRefreshToken(tx, dialectPostgres, next); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevokeRefreshTokens відкликає всі токени сім'ї familyID
+func (s *PostgresStorage) RevokeRefreshTokens(familyID uuid.UUID, revokedAt time.Time) error {
+	query := `UPDATE refresh_tokens SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL`
+	_, err := s.db.Exec(query, revokedAt, familyID.String())
+	return err
+}
+
+// ListSigningKeys повертає ключі підпису JWT, які ще не втратили чинності
+func (s *PostgresStorage) ListSigningKeys() ([]*wg.SigningKey, error) {
+	return listSigningKeys(s.db, dialectPostgres, s.cipher)
+}
+
+// RotateSigningKey робить next активним ключем підпису, а попередні активні
+// ключі залишає для перевірки токенів до retireAt
+func (s *PostgresStorage) RotateSigningKey(next *wg.SigningKey, retireAt time.Time) error {
+	return rotateSigningKey(s.db, dialectPostgres, s.cipher, next, retireAt)
+}
+
+// SaveAllocation зберігає виділену адресу.
+// Унікальність адреси в межах інтерфейсу гарантується на рівні БД,
+// тому конкурентні процеси не можуть отримати ту саму адресу.
+func (s *PostgresStorage) SaveAllocation(alloc *wg.IPAllocation) error {
+	query := `INSERT INTO ip_allocations (interface_name, address, peer_id, created_at)
+			   VALUES ($1, $2, $3, $4)`
+
+	_, err := s.db.Exec(query, alloc.InterfaceName, alloc.Address, alloc.PeerID.String(), alloc.CreatedAt)
+	if err != nil && isPostgresUniqueViolation(err) {
+		return fmt.Errorf("%w: %s", ErrAddressInUse, alloc.Address)
+	}
+
+	return err
+}
+
+// ListAllocations повертає всі виділені адреси інтерфейсу
+func (s *PostgresStorage) ListAllocations(interfaceName string) ([]*wg.IPAllocation, error) {
+	query := `SELECT interface_name, address, peer_id, created_at
+			   FROM ip_allocations WHERE interface_name = $1 ORDER BY created_at`
+
+	rows, err := s.db.Query(query, interfaceName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var allocations []*wg.IPAllocation
+	for rows.Next() {
+		alloc, err := scanAllocation(rows)
+		if err != nil {
+			return nil, err
+		}
+		allocations = append(allocations, alloc)
+	}
+
+	return allocations, rows.Err()
+}
+
+// MoveAllocation переносить виділену адресу from на адресу to.
+// Якщо to вже зайнята, повертається ErrAddressInUse і нічого не змінюється.
+func (s *PostgresStorage) MoveAllocation(interfaceName, from, to string) error {
+	query := `UPDATE ip_allocations SET address = $1 WHERE interface_name = $2 AND address = $3`
+
+	result, err := s.db.Exec(query, to, interfaceName, from)
+	if err != nil {
+		if isPostgresUniqueViolation(err) {
+			return fmt.Errorf("%w: %s", ErrAddressInUse, to)
+		}
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("address %s is not allocated on %s", from, interfaceName)
+	}
+
+	return nil
+}
+
+// DeleteAllocations звільняє всі адреси peer'а
+func (s *PostgresStorage) DeleteAllocations(peerID uuid.UUID) error {
+	query := `DELETE FROM ip_allocations WHERE peer_id = $1`
+	_, err := s.db.Exec(query, peerID.String())
+	return err
+}
+
+// Rekey переобгортає всі приватні ключі новим master-ключем
+func (s *PostgresStorage) Rekey(next *Cipher) (int, error) {
+	updated, err := rekeySecrets(s.db, dialectPostgres, s.cipher, next)
+	if err != nil {
+		return 0, err
+	}
+
+	s.cipher = next
+	return updated, nil
+}
+
+// isPostgresUniqueViolation перевіряє, чи помилка спричинена порушенням унікальності
+func isPostgresUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// isPostgresForeignKeyViolation перевіряє, чи помилка спричинена порушенням зовнішнього ключа
+func isPostgresForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
+// Close закриває з'єднання з базою даних
+func (s *PostgresStorage) Close() error {
+	return s.db.Close()
+}
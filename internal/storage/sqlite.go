@@ -14,12 +14,28 @@ import (
 
 // SQLiteStorage реалізує Storage інтерфейс для SQLite
 type SQLiteStorage struct {
-	db *sql.DB
+	db     *sql.DB
+	cipher *Cipher
 }
 
-// NewSQLiteStorage створює новий SQLite storage
+// NewSQLiteStorage створює новий SQLite storage і застосовує міграції схеми
 func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
-	db, err := sql.Open("sqlite", dbPath)
+	storage, err := OpenSQLiteStorage(dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := storage.Migrate(); err != nil {
+		storage.Close()
+		return nil, fmt.Errorf("failed to migrate database: %w", err)
+	}
+
+	return storage, nil
+}
+
+// OpenSQLiteStorage відкриває SQLite storage без застосування міграцій
+func OpenSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
+	db, err := sql.Open("sqlite", sqliteDSN(dbPath))
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
@@ -28,227 +44,537 @@ func NewSQLiteStorage(dbPath string) (*SQLiteStorage, error) {
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
-	storage := &SQLiteStorage{db: db}
-	if err := storage.createTables(); err != nil {
-		return nil, fmt.Errorf("failed to create tables: %w", err)
-	}
-
-	return storage, nil
+	return &SQLiteStorage{db: db}, nil
 }
 
-// createTables створює необхідні таблиці
-func (s *SQLiteStorage) createTables() error {
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS interfaces (
-			name TEXT PRIMARY KEY,
-			public_key TEXT NOT NULL,
-			private_key TEXT NOT NULL,
-			listen_port INTEGER NOT NULL,
-			address TEXT NOT NULL,
-			created_at DATETIME NOT NULL,
-			updated_at DATETIME NOT NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS peers (
-			id TEXT PRIMARY KEY,
-			name TEXT NOT NULL UNIQUE,
-			public_key TEXT NOT NULL UNIQUE,
-			private_key TEXT NOT NULL,
-			allowed_ips TEXT NOT NULL,
-			endpoint TEXT,
-			preshared_key TEXT,
-			created_at DATETIME NOT NULL,
-			updated_at DATETIME NOT NULL,
-			last_seen DATETIME,
-			is_active BOOLEAN NOT NULL DEFAULT 1
-		)`,
-		`CREATE TABLE IF NOT EXISTS tokens (
-			id TEXT PRIMARY KEY,
-			user_id TEXT NOT NULL,
-			username TEXT NOT NULL,
-			token_hash TEXT NOT NULL,
-			expires_at DATETIME NOT NULL,
-			created_at DATETIME NOT NULL,
-			is_used BOOLEAN NOT NULL DEFAULT 0
-		)`,
-	}
-
-	for _, query := range queries {
-		if _, err := s.db.Exec(query); err != nil {
-			return fmt.Errorf("failed to execute query: %w", err)
-		}
+// sqliteDSN вмикає перевірку зовнішніх ключів, яку SQLite
+// за замовчуванням не виконує, для кожного з'єднання пулу
+func sqliteDSN(dbPath string) string {
+	separator := "?"
+	if strings.Contains(dbPath, "?") {
+		separator = "&"
 	}
+	return dbPath + separator + "_pragma=foreign_keys(1)"
+}
 
-	return nil
+// Migrate застосовує відсутні міграції схеми
+func (s *SQLiteStorage) Migrate() ([]Migration, error) {
+	m := &migrator{db: s.db, dialect: dialectSQLite}
+	return m.Migrate()
+}
+
+// SchemaStatus повертає стан схеми бази даних
+func (s *SQLiteStorage) SchemaStatus() (*SchemaStatus, error) {
+	m := &migrator{db: s.db, dialect: dialectSQLite}
+	return m.Status()
 }
 
 // SaveInterface зберігає інтерфейс
 func (s *SQLiteStorage) SaveInterface(iface *wg.Interface) error {
 	query := `INSERT OR REPLACE INTO interfaces 
-			   (name, public_key, private_key, listen_port, address, created_at, updated_at)
-			   VALUES (?, ?, ?, ?, ?, ?, ?)`
+			   (name, public_key, private_key, listen_port, address, mtu, fwmark, route_table,
+			    created_at, updated_at)
+			   VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := s.db.Exec(query, iface.Name, iface.PublicKey, iface.PrivateKey,
-		iface.ListenPort, iface.Address, iface.CreatedAt, iface.UpdatedAt)
+	privateKey, err := encryptValue(s.cipher, iface.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt private key: %w", err)
+	}
+
+	_, err = s.db.Exec(query, iface.Name, iface.PublicKey, privateKey,
+		iface.ListenPort, iface.Address, iface.MTU, iface.FwMark, iface.Table,
+		iface.CreatedAt, iface.UpdatedAt)
 
 	return err
 }
 
 // GetInterface отримує інтерфейс за назвою
 func (s *SQLiteStorage) GetInterface(name string) (*wg.Interface, error) {
-	query := `SELECT name, public_key, private_key, listen_port, address, created_at, updated_at
+	query := `SELECT name, public_key, private_key, listen_port, address, mtu, fwmark, route_table,
+			          created_at, updated_at
 			   FROM interfaces WHERE name = ?`
 
 	row := s.db.QueryRow(query, name)
 
 	var iface wg.Interface
 	err := row.Scan(&iface.Name, &iface.PublicKey, &iface.PrivateKey,
-		&iface.ListenPort, &iface.Address, &iface.CreatedAt, &iface.UpdatedAt)
+		&iface.ListenPort, &iface.Address, &iface.MTU, &iface.FwMark, &iface.Table,
+		&iface.CreatedAt, &iface.UpdatedAt)
 
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	iface.PrivateKey, err = s.cipher.Decrypt(iface.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+	}
 
-	return &iface, err
+	return &iface, nil
+}
+
+// DeleteInterface видаляє запис інтерфейсу; відсутній запис не є помилкою.
+// Якщо до інтерфейсу прив'язані peer'и, повертається ErrInterfaceInUse.
+func (s *SQLiteStorage) DeleteInterface(name string) error {
+	_, err := s.db.Exec(`DELETE FROM interfaces WHERE name = ?`, name)
+	if err != nil && isSQLiteForeignKeyViolation(err) {
+		return fmt.Errorf("%w: %s", ErrInterfaceInUse, name)
+	}
+	return err
+}
+
+// AdoptPeers прив'язує до інтерфейсу peer'ів, що не мають інтерфейсу
+func (s *SQLiteStorage) AdoptPeers(interfaceName string) (int, error) {
+	result, err := s.db.Exec(`UPDATE peers SET interface_name = ? WHERE interface_name IS NULL`, interfaceName)
+	if err != nil {
+		return 0, err
+	}
+	adopted, err := result.RowsAffected()
+	return int(adopted), err
 }
 
 // SavePeer зберігає peer
 func (s *SQLiteStorage) SavePeer(peer *wg.Peer) error {
+	return s.savePeer(s.db, peer)
+}
+
+// savePeer зберігає peer'а запитом db: з'єднанням або транзакцією
+func (s *SQLiteStorage) savePeer(db execer, peer *wg.Peer) error {
 	allowedIPsStr := strings.Join(peer.AllowedIPs, ",")
 
-	query := `INSERT OR REPLACE INTO peers 
-			   (id, name, public_key, private_key, allowed_ips, endpoint, preshared_key, 
-			    created_at, updated_at, last_seen, is_active)
-			   VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	privateKey, err := encryptValue(s.cipher, peer.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt private key: %w", err)
+	}
+	presharedKey, err := encryptValue(s.cipher, peer.PresharedKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt preshared key: %w", err)
+	}
 
-	_, err := s.db.Exec(query, peer.ID.String(), peer.Name, peer.PublicKey, peer.PrivateKey,
-		allowedIPsStr, peer.Endpoint, peer.PresharedKey, peer.CreatedAt, peer.UpdatedAt,
-		peer.LastSeen, peer.IsActive)
+	// ON CONFLICT(id) замість INSERT OR REPLACE: REPLACE мовчки видаляв би
+	// іншого peer'а з тим самим ім'ям або публічним ключем
+	query := `INSERT INTO peers
+			   (id, name, public_key, private_key, allowed_ips, endpoint, preshared_key,
+			    created_at, updated_at, last_seen, is_active, persistent_keepalive, interface_name)
+			   VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			   ON CONFLICT(id) DO UPDATE SET
+			       name = excluded.name,
+			       public_key = excluded.public_key,
+			       private_key = excluded.private_key,
+			       allowed_ips = excluded.allowed_ips,
+			       endpoint = excluded.endpoint,
+			       preshared_key = excluded.preshared_key,
+			       created_at = excluded.created_at,
+			       updated_at = excluded.updated_at,
+			       last_seen = excluded.last_seen,
+			       is_active = excluded.is_active,
+			       persistent_keepalive = excluded.persistent_keepalive,
+			       interface_name = excluded.interface_name`
+
+	_, err = db.Exec(query, peer.ID.String(), peer.Name, peer.PublicKey, privateKey,
+		allowedIPsStr, peer.Endpoint, presharedKey, peer.CreatedAt, peer.UpdatedAt,
+		peer.LastSeen, peer.IsActive, peer.PersistentKeepalive, nullString(peer.InterfaceName))
+	if err != nil && isSQLiteForeignKeyViolation(err) {
+		return fmt.Errorf("%w: %s", ErrInterfaceNotFound, peer.InterfaceName)
+	}
+	if err != nil && isSQLiteUniqueViolation(err) {
+		return fmt.Errorf("%w: %s", ErrPeerExists, peer.Name)
+	}
 
 	return err
 }
 
 // GetPeer отримує peer за ID
 func (s *SQLiteStorage) GetPeer(id uuid.UUID) (*wg.Peer, error) {
-	query := `SELECT id, name, public_key, private_key, allowed_ips, endpoint, preshared_key,
-			         created_at, updated_at, last_seen, is_active
+	query := `SELECT ` + peerColumns + `
 			   FROM peers WHERE id = ?`
 
-	row := s.db.QueryRow(query, id.String())
+	peer, err := scanPeer(s.db.QueryRow(query, id.String()), s.cipher)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+
+	return peer, err
+}
+
+// GetPeerByName отримує peer за ім'ям
+func (s *SQLiteStorage) GetPeerByName(name string) (*wg.Peer, error) {
+	query := `SELECT ` + peerColumns + `
+			   FROM peers WHERE name = ?`
+
+	peer, err := scanPeer(s.db.QueryRow(query, name), s.cipher)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
 
-	var peer wg.Peer
-	var allowedIPsStr string
-	var idStr string
+	return peer, err
+}
 
-	err := row.Scan(&idStr, &peer.Name, &peer.PublicKey, &peer.PrivateKey,
-		&allowedIPsStr, &peer.Endpoint, &peer.PresharedKey, &peer.CreatedAt,
-		&peer.UpdatedAt, &peer.LastSeen, &peer.IsActive)
+// GetPeerByPublicKey отримує peer за публічним ключем
+func (s *SQLiteStorage) GetPeerByPublicKey(publicKey string) (*wg.Peer, error) {
+	query := `SELECT ` + peerColumns + `
+			   FROM peers WHERE public_key = ?`
 
+	peer, err := scanPeer(s.db.QueryRow(query, publicKey), s.cipher)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
+
+	return peer, err
+}
+
+// ListPeers повертає список всіх peer'ів
+func (s *SQLiteStorage) ListPeers() ([]*wg.Peer, error) {
+	query := `SELECT ` + peerColumns + `
+			   FROM peers ORDER BY created_at DESC`
+
+	rows, err := s.db.Query(query)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	peer.ID, err = uuid.Parse(idStr)
+	var peers []*wg.Peer
+	for rows.Next() {
+		peer, err := scanPeer(rows, s.cipher)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, peer)
+	}
+
+	return peers, rows.Err()
+}
+
+// DeletePeer видаляє peer разом з виділеними йому адресами
+func (s *SQLiteStorage) DeletePeer(id uuid.UUID) error {
+	tx, err := s.db.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse peer ID: %w", err)
+		return err
 	}
+	defer tx.Rollback()
 
-	if allowedIPsStr != "" {
-		peer.AllowedIPs = strings.Split(allowedIPsStr, ",")
+	if _, err := tx.Exec(`DELETE FROM ip_allocations WHERE peer_id = ?`, id.String()); err != nil {
+		return fmt.Errorf("failed to release addresses: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM peer_stats WHERE peer_id = ?`, id.String()); err != nil {
+		return fmt.Errorf("failed to delete peer stats: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM refresh_tokens WHERE peer_id = ?`, id.String()); err != nil {
+		return fmt.Errorf("failed to delete refresh tokens: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM peers WHERE id = ?`, id.String()); err != nil {
+		return err
 	}
 
-	return &peer, nil
+	return tx.Commit()
 }
 
-// GetPeerByName отримує peer за ім'ям
-func (s *SQLiteStorage) GetPeerByName(name string) (*wg.Peer, error) {
-	query := `SELECT id, name, public_key, private_key, allowed_ips, endpoint, preshared_key,
-			         created_at, updated_at, last_seen, is_active
-			   FROM peers WHERE name = ?`
+// UpdatePeerLastSeen оновлює час останнього підключення peer'а
+func (s *SQLiteStorage) UpdatePeerLastSeen(id uuid.UUID, lastSeen time.Time) error {
+	query := `UPDATE peers SET last_seen = ?, updated_at = ? WHERE id = ?`
+	_, err := s.db.Exec(query, lastSeen, time.Now(), id.String())
+	return err
+}
 
-	row := s.db.QueryRow(query, name)
+// SavePeerStats зберігає статистику трафіку peer'а
+func (s *SQLiteStorage) SavePeerStats(stats *wg.PeerStats) error {
+	query := `INSERT OR REPLACE INTO peer_stats (peer_id, rx_bytes, tx_bytes, rx_counter, tx_counter, updated_at)
+			   VALUES (?, ?, ?, ?, ?, ?)`
 
-	var peer wg.Peer
-	var allowedIPsStr string
-	var idStr string
+	_, err := s.db.Exec(query, stats.PeerID.String(), stats.RxBytes, stats.TxBytes,
+		stats.RxCounter, stats.TxCounter, stats.UpdatedAt)
+	return err
+}
 
-	err := row.Scan(&idStr, &peer.Name, &peer.PublicKey, &peer.PrivateKey,
-		&allowedIPsStr, &peer.Endpoint, &peer.PresharedKey, &peer.CreatedAt,
-		&peer.UpdatedAt, &peer.LastSeen, &peer.IsActive)
+// GetPeerStats повертає статистику трафіку peer'а
+func (s *SQLiteStorage) GetPeerStats(peerID uuid.UUID) (*wg.PeerStats, error) {
+	query := `SELECT ` + peerStatsColumns + ` FROM peer_stats WHERE peer_id = ?`
 
+	stats, err := scanPeerStats(s.db.QueryRow(query, peerID.String()))
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
+	return stats, err
+}
+
+// ListPeerStats повертає статистику трафіку всіх peer'ів
+func (s *SQLiteStorage) ListPeerStats() ([]*wg.PeerStats, error) {
+	rows, err := s.db.Query(`SELECT ` + peerStatsColumns + ` FROM peer_stats`)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	peer.ID, err = uuid.Parse(idStr)
+	var result []*wg.PeerStats
+	for rows.Next() {
+		stats, err := scanPeerStats(rows)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, stats)
+	}
+
+	return result, rows.Err()
+}
+
+// SaveToken зберігає виданий одноразовий токен
+func (s *SQLiteStorage) SaveToken(token *wg.Token) error {
+	query := `INSERT INTO tokens (id, user_id, username, token_hash, expires_at, created_at, is_used)
+			   VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	_, err := s.db.Exec(query, token.ID, token.UserID.String(), token.Username, token.TokenHash,
+		token.ExpiresAt, token.CreatedAt, token.IsUsed)
+	return err
+}
+
+// GetToken отримує токен за ID
+func (s *SQLiteStorage) GetToken(id string) (*wg.Token, error) {
+	query := `SELECT ` + tokenColumns + ` FROM tokens WHERE id = ?`
+
+	token, err := scanToken(s.db.QueryRow(query, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return token, err
+}
+
+// UseToken позначає токен використаним. Перевірка і позначка виконуються
+// одним UPDATE, тому з кількох конкурентних спроб успішною буде лише одна.
+// Повертає ErrTokenNotFound для невідомого токена і ErrTokenUsed для використаного.
+func (s *SQLiteStorage) UseToken(id, tokenHash string) error {
+	query := `UPDATE tokens SET is_used = ? WHERE id = ? AND token_hash = ? AND is_used = ?`
+
+	result, err := s.db.Exec(query, true, id, tokenHash, false)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse peer ID: %w", err)
+		return err
 	}
 
-	if allowedIPsStr != "" {
-		peer.AllowedIPs = strings.Split(allowedIPsStr, ",")
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		token, err := s.GetToken(id)
+		if err != nil {
+			return err
+		}
+		return tokenUseError(token, id, tokenHash)
 	}
 
-	return &peer, nil
+	return nil
 }
 
-// ListPeers повертає список всіх peer'ів
-func (s *SQLiteStorage) ListPeers() ([]*wg.Peer, error) {
-	query := `SELECT id, name, public_key, private_key, allowed_ips, endpoint, preshared_key,
-			         created_at, updated_at, last_seen, is_active
-			   FROM peers ORDER BY created_at DESC`
+// ReleaseToken знову робить токен дійсним, якщо операцію, для якої його
+// використали, не вдалося завершити
+func (s *SQLiteStorage) ReleaseToken(id string) error {
+	query := `UPDATE tokens SET is_used = ? WHERE id = ?`
+	_, err := s.db.Exec(query, false, id)
+	return err
+}
 
-	rows, err := s.db.Query(query)
+// RevokeTokens зберігає відкликання токенів. Повторне відкликання того самого
+// користувача чи peer'а переносить RevokedAt, відкликаючи і новіші токени.
+func (s *SQLiteStorage) RevokeTokens(revocation *wg.TokenRevocation) error {
+	query := `INSERT OR REPLACE INTO token_revocations (kind, value, revoked_at) VALUES (?, ?, ?)`
+
+	_, err := s.db.Exec(query, revocation.Kind, revocation.Value, revocation.RevokedAt)
+	return err
+}
+
+// ListRevocations повертає всі відкликання токенів
+func (s *SQLiteStorage) ListRevocations() ([]*wg.TokenRevocation, error) {
+	rows, err := s.db.Query(`SELECT kind, value, revoked_at FROM token_revocations`)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var peers []*wg.Peer
+	var result []*wg.TokenRevocation
 	for rows.Next() {
-		var peer wg.Peer
-		var allowedIPsStr string
-		var idStr string
-
-		err := rows.Scan(&idStr, &peer.Name, &peer.PublicKey, &peer.PrivateKey,
-			&allowedIPsStr, &peer.Endpoint, &peer.PresharedKey, &peer.CreatedAt,
-			&peer.UpdatedAt, &peer.LastSeen, &peer.IsActive)
+		revocation, err := scanRevocation(rows)
 		if err != nil {
 			return nil, err
 		}
+		result = append(result, revocation)
+	}
+
+	return result, rows.Err()
+}
+
+// SaveRefreshToken зберігає виданий refresh токен
+func (s *SQLiteStorage) SaveRefreshToken(token *wg.RefreshToken) error {
+	return insertRefreshToken(s.db, dialectSQLite, token)
+}
+
+// SavePeerWithRefreshToken зберігає нового peer'а разом з його першим
+// refresh токеном в одній транзакції
+func (s *SQLiteStorage) SavePeerWithRefreshToken(peer *wg.Peer, token *wg.RefreshToken) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := s.savePeer(tx, peer); err != nil {
+		return err
+	}
+	if err := insertRefreshToken(tx, dialectSQLite, token); err != nil {
+		return fmt.Errorf("failed to save refresh token: %w", err)
+	}
 
-		peer.ID, err = uuid.Parse(idStr)
+	return tx.Commit()
+}
+
+// GetRefreshToken отримує refresh токен за хешем
+func (s *SQLiteStorage) GetRefreshToken(tokenHash string) (*wg.RefreshToken, error) {
+	query := `SELECT ` + refreshTokenColumns + ` FROM refresh_tokens WHERE token_hash = ?`
+
+	token, err := scanRefreshToken(s.db.QueryRow(query, tokenHash))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return token, err
+}
+
+// RotateRefreshToken позначає токен id використаним і зберігає next, що його
+// замінює. Позначка виконується одним UPDATE, тому з кількох конкурентних
+// ротацій успішною буде лише одна; для решти повертається ErrTokenUsed.
+func (s *SQLiteStorage) RotateRefreshToken(id uuid.UUID, next *wg.RefreshToken) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE refresh_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL AND revoked_at IS NULL`
+	result, err := tx.Exec(query, next.CreatedAt, id.String())
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: %s", ErrTokenUsed, id)
+	}
+
+	if err := insertRefreshToken(tx, dialectSQLite, next); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RevokeRefreshTokens відкликає всі токени сім'ї familyID
+func (s *SQLiteStorage) RevokeRefreshTokens(familyID uuid.UUID, revokedAt time.Time) error {
+	query := `UPDATE refresh_tokens SET revoked_at = ? WHERE family_id = ? AND revoked_at IS NULL`
+	_, err := s.db.Exec(query, revokedAt, familyID.String())
+	return err
+}
+
+// ListSigningKeys повертає ключі підпису JWT, які ще не втратили чинності
+func (s *SQLiteStorage) ListSigningKeys() ([]*wg.SigningKey, error) {
+	return listSigningKeys(s.db, dialectSQLite, s.cipher)
+}
+
+// RotateSigningKey робить next активним ключем підпису, а попередні активні
+// ключі залишає для перевірки токенів до retireAt
+func (s *SQLiteStorage) RotateSigningKey(next *wg.SigningKey, retireAt time.Time) error {
+	return rotateSigningKey(s.db, dialectSQLite, s.cipher, next, retireAt)
+}
+
+// SaveAllocation зберігає виділену адресу.
+// Унікальність адреси в межах інтерфейсу гарантується на рівні БД,
+// тому конкурентні процеси не можуть отримати ту саму адресу.
+func (s *SQLiteStorage) SaveAllocation(alloc *wg.IPAllocation) error {
+	query := `INSERT INTO ip_allocations (interface_name, address, peer_id, created_at)
+			   VALUES (?, ?, ?, ?)`
+
+	_, err := s.db.Exec(query, alloc.InterfaceName, alloc.Address, alloc.PeerID.String(), alloc.CreatedAt)
+	if err != nil && isSQLiteUniqueViolation(err) {
+		return fmt.Errorf("%w: %s", ErrAddressInUse, alloc.Address)
+	}
+
+	return err
+}
+
+// ListAllocations повертає всі виділені адреси інтерфейсу
+func (s *SQLiteStorage) ListAllocations(interfaceName string) ([]*wg.IPAllocation, error) {
+	query := `SELECT interface_name, address, peer_id, created_at
+			   FROM ip_allocations WHERE interface_name = ? ORDER BY created_at`
+
+	rows, err := s.db.Query(query, interfaceName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var allocations []*wg.IPAllocation
+	for rows.Next() {
+		alloc, err := scanAllocation(rows)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse peer ID: %w", err)
+			return nil, err
 		}
+		allocations = append(allocations, alloc)
+	}
 
-		if allowedIPsStr != "" {
-			peer.AllowedIPs = strings.Split(allowedIPsStr, ",")
+	return allocations, rows.Err()
+}
+
+// MoveAllocation переносить виділену адресу from на адресу to.
+// Якщо to вже зайнята, повертається ErrAddressInUse і нічого не змінюється.
+func (s *SQLiteStorage) MoveAllocation(interfaceName, from, to string) error {
+	query := `UPDATE ip_allocations SET address = ? WHERE interface_name = ? AND address = ?`
+
+	result, err := s.db.Exec(query, to, interfaceName, from)
+	if err != nil {
+		if isSQLiteUniqueViolation(err) {
+			return fmt.Errorf("%w: %s", ErrAddressInUse, to)
 		}
+		return err
+	}
 
-		peers = append(peers, &peer)
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("address %s is not allocated on %s", from, interfaceName)
 	}
 
-	return peers, rows.Err()
+	return nil
 }
 
-// DeletePeer видаляє peer
-func (s *SQLiteStorage) DeletePeer(id uuid.UUID) error {
-	query := `DELETE FROM peers WHERE id = ?`
-	_, err := s.db.Exec(query, id.String())
+// DeleteAllocations звільняє всі адреси peer'а
+func (s *SQLiteStorage) DeleteAllocations(peerID uuid.UUID) error {
+	query := `DELETE FROM ip_allocations WHERE peer_id = ?`
+	_, err := s.db.Exec(query, peerID.String())
 	return err
 }
 
-// UpdatePeerLastSeen оновлює час останнього підключення peer'а
-func (s *SQLiteStorage) UpdatePeerLastSeen(id uuid.UUID, lastSeen time.Time) error {
-	query := `UPDATE peers SET last_seen = ?, updated_at = ? WHERE id = ?`
-	_, err := s.db.Exec(query, lastSeen, time.Now(), id.String())
-	return err
+// Rekey переобгортає всі приватні ключі новим master-ключем
+func (s *SQLiteStorage) Rekey(next *Cipher) (int, error) {
+	updated, err := rekeySecrets(s.db, dialectSQLite, s.cipher, next)
+	if err != nil {
+		return 0, err
+	}
+
+	s.cipher = next
+	return updated, nil
+}
+
+// isSQLiteUniqueViolation перевіряє, чи помилка спричинена порушенням унікальності
+func isSQLiteUniqueViolation(err error) bool {
+	return strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+// isSQLiteForeignKeyViolation перевіряє, чи помилка спричинена порушенням зовнішнього ключа
+func isSQLiteForeignKeyViolation(err error) bool {
+	return strings.Contains(err.Error(), "FOREIGN KEY constraint failed")
 }
 
 // Close закриває з'єднання з базою даних
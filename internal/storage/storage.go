@@ -1,7 +1,10 @@
 package storage
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -14,19 +17,81 @@ type Storage interface {
 	// Interface operations
 	SaveInterface(iface *wg.Interface) error
 	GetInterface(name string) (*wg.Interface, error)
+	DeleteInterface(name string) error
+	AdoptPeers(interfaceName string) (int, error)
 
 	// Peer operations
 	SavePeer(peer *wg.Peer) error
 	GetPeer(id uuid.UUID) (*wg.Peer, error)
 	GetPeerByName(name string) (*wg.Peer, error)
+	GetPeerByPublicKey(publicKey string) (*wg.Peer, error)
 	ListPeers() ([]*wg.Peer, error)
 	DeletePeer(id uuid.UUID) error
 	UpdatePeerLastSeen(id uuid.UUID, lastSeen time.Time) error
 
+	// Traffic statistics
+	SavePeerStats(stats *wg.PeerStats) error
+	GetPeerStats(peerID uuid.UUID) (*wg.PeerStats, error)
+	ListPeerStats() ([]*wg.PeerStats, error)
+
+	// One-time token operations
+	SaveToken(token *wg.Token) error
+	GetToken(id string) (*wg.Token, error)
+	UseToken(id, tokenHash string) error
+	ReleaseToken(id string) error
+
+	// Token revocation
+	RevokeTokens(revocation *wg.TokenRevocation) error
+	ListRevocations() ([]*wg.TokenRevocation, error)
+
+	// Refresh token operations
+	SaveRefreshToken(token *wg.RefreshToken) error
+	SavePeerWithRefreshToken(peer *wg.Peer, token *wg.RefreshToken) error
+	GetRefreshToken(tokenHash string) (*wg.RefreshToken, error)
+	RotateRefreshToken(id uuid.UUID, next *wg.RefreshToken) error
+	RevokeRefreshTokens(familyID uuid.UUID, revokedAt time.Time) error
+
+	// JWT signing keys
+	ListSigningKeys() ([]*wg.SigningKey, error)
+	RotateSigningKey(next *wg.SigningKey, retireAt time.Time) error
+
+	// IP allocation operations
+	SaveAllocation(alloc *wg.IPAllocation) error
+	ListAllocations(interfaceName string) ([]*wg.IPAllocation, error)
+	MoveAllocation(interfaceName, from, to string) error
+	DeleteAllocations(peerID uuid.UUID) error
+
+	// Encryption management
+	Rekey(next *Cipher) (int, error)
+
+	// Schema management
+	Migrate() ([]Migration, error)
+	SchemaStatus() (*SchemaStatus, error)
+
 	// Connection management
 	Close() error
 }
 
+// ErrAddressInUse повертається, коли IP адреса вже виділена іншому peer'у
+var ErrAddressInUse = errors.New("address is already allocated")
+
+// ErrPeerExists повертається, коли ім'я або публічний ключ peer'а вже
+// належить іншому peer'у
+var ErrPeerExists = errors.New("peer with this name or public key already exists")
+
+// ErrInterfaceNotFound повертається при збереженні peer'а для інтерфейсу,
+// запису якого немає в базі даних
+var ErrInterfaceNotFound = errors.New("interface is not initialized")
+
+// ErrInterfaceInUse повертається при видаленні інтерфейсу, до якого прив'язані peer'и
+var ErrInterfaceInUse = errors.New("interface still has peers")
+
+// ErrTokenNotFound повертається, коли токена з таким ID і хешем не видавали
+var ErrTokenNotFound = errors.New("token not found")
+
+// ErrTokenUsed повертається при повторному використанні одноразового токена
+var ErrTokenUsed = errors.New("token has already been used")
+
 // Config представляє конфігурацію для storage
 type Config struct {
 	Type     string `yaml:"type" json:"type"`         // sqlite, postgres
@@ -36,21 +101,344 @@ type Config struct {
 	Username string `yaml:"username" json:"username"` // для postgres
 	Password string `yaml:"password" json:"password"` // для postgres
 	SSLMode  string `yaml:"ssl_mode" json:"ssl_mode"` // для postgres
+
+	// MasterKeyFile - файл з master-ключем для шифрування приватних ключів.
+	// Змінна оточення WG_ORBIT_MASTER_KEY має пріоритет над файлом.
+	MasterKeyFile string `yaml:"master_key_file" json:"master_key_file"`
 }
 
-// NewStorage створює новий storage на основі конфігурації
+// NewStorage створює новий storage на основі конфігурації.
+// Відсутні міграції схеми застосовуються автоматично; якщо схема БД
+// новіша за бінарник, повертається ErrSchemaTooNew.
 func NewStorage(config *Config) (Storage, error) {
+	cipher, err := LoadMasterKey(config.MasterKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
 	switch config.Type {
 	case "sqlite", "":
-		return NewSQLiteStorage(config.Database)
-	case "postgres":
-		// TODO: Implement PostgreSQL storage
-		return nil, fmt.Errorf("PostgreSQL storage not implemented yet")
+		store, err := NewSQLiteStorage(config.Database)
+		if err != nil {
+			return nil, err
+		}
+		store.cipher = cipher
+		return store, nil
+	case "postgres", "postgresql":
+		store, err := NewPostgresStorage(config)
+		if err != nil {
+			return nil, err
+		}
+		store.cipher = cipher
+		return store, nil
 	default:
 		return nil, fmt.Errorf("unsupported storage type: %s", config.Type)
 	}
 }
 
+// OpenStorage відкриває storage без застосування міграцій.
+// Використовується командами обслуговування схеми.
+func OpenStorage(config *Config) (Storage, error) {
+	cipher, err := LoadMasterKey(config.MasterKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	switch config.Type {
+	case "sqlite", "":
+		store, err := OpenSQLiteStorage(config.Database)
+		if err != nil {
+			return nil, err
+		}
+		store.cipher = cipher
+		return store, nil
+	case "postgres", "postgresql":
+		store, err := OpenPostgresStorage(config)
+		if err != nil {
+			return nil, err
+		}
+		store.cipher = cipher
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unsupported storage type: %s", config.Type)
+	}
+}
+
+// postgresDSN формує рядок підключення до PostgreSQL з конфігурації
+func (c *Config) postgresDSN() string {
+	// Повний URL підключення можна передати напряму через database
+	if strings.HasPrefix(c.Database, "postgres://") || strings.HasPrefix(c.Database, "postgresql://") {
+		return c.Database
+	}
+
+	host := c.Host
+	if host == "" {
+		host = "localhost"
+	}
+	port := c.Port
+	if port == 0 {
+		port = 5432
+	}
+	sslMode := c.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+
+	parts := []string{
+		"host=" + quoteDSNValue(host),
+		fmt.Sprintf("port=%d", port),
+		"dbname=" + quoteDSNValue(c.Database),
+		"sslmode=" + quoteDSNValue(sslMode),
+	}
+	if c.Username != "" {
+		parts = append(parts, "user="+quoteDSNValue(c.Username))
+	}
+	if c.Password != "" {
+		parts = append(parts, "password="+quoteDSNValue(c.Password))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// quoteDSNValue екранує значення для key=value формату libpq
+func quoteDSNValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `'`, `\'`)
+	return "'" + value + "'"
+}
+
+// rowScanner узагальнює *sql.Row та *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPeer зчитує peer'а з рядка результату запиту та розшифровує ключі.
+// Порядок колонок має відповідати peerColumns.
+func scanPeer(row rowScanner, cipher *Cipher) (*wg.Peer, error) {
+	var peer wg.Peer
+	var allowedIPsStr string
+	var idStr string
+	var interfaceName sql.NullString
+
+	err := row.Scan(&idStr, &peer.Name, &peer.PublicKey, &peer.PrivateKey,
+		&allowedIPsStr, &peer.Endpoint, &peer.PresharedKey, &peer.CreatedAt,
+		&peer.UpdatedAt, &peer.LastSeen, &peer.IsActive, &peer.PersistentKeepalive,
+		&interfaceName)
+	if err != nil {
+		return nil, err
+	}
+	peer.InterfaceName = interfaceName.String
+
+	peer.ID, err = uuid.Parse(idStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse peer ID: %w", err)
+	}
+
+	if allowedIPsStr != "" {
+		peer.AllowedIPs = strings.Split(allowedIPsStr, ",")
+	}
+
+	peer.PrivateKey, err = cipher.Decrypt(peer.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+	}
+	peer.PresharedKey, err = cipher.Decrypt(peer.PresharedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt preshared key: %w", err)
+	}
+
+	return &peer, nil
+}
+
+// scanAllocation зчитує виділену адресу з рядка результату запиту
+func scanAllocation(row rowScanner) (*wg.IPAllocation, error) {
+	var alloc wg.IPAllocation
+	var peerIDStr string
+
+	err := row.Scan(&alloc.InterfaceName, &alloc.Address, &peerIDStr, &alloc.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	alloc.PeerID, err = uuid.Parse(peerIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse peer ID: %w", err)
+	}
+
+	return &alloc, nil
+}
+
+// peerStatsColumns - перелік колонок peer_stats у порядку, який очікує scanPeerStats
+const peerStatsColumns = `peer_id, rx_bytes, tx_bytes, rx_counter, tx_counter, updated_at`
+
+// scanPeerStats зчитує статистику трафіку з рядка результату запиту
+func scanPeerStats(row rowScanner) (*wg.PeerStats, error) {
+	var stats wg.PeerStats
+	var peerIDStr string
+
+	err := row.Scan(&peerIDStr, &stats.RxBytes, &stats.TxBytes, &stats.RxCounter, &stats.TxCounter, &stats.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	stats.PeerID, err = uuid.Parse(peerIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse peer ID: %w", err)
+	}
+
+	return &stats, nil
+}
+
+// tokenColumns - перелік колонок tokens у порядку, який очікує scanToken
+const tokenColumns = `id, user_id, username, token_hash, expires_at, created_at, is_used`
+
+// scanToken зчитує токен з рядка результату запиту
+func scanToken(row rowScanner) (*wg.Token, error) {
+	var token wg.Token
+	var userIDStr string
+
+	err := row.Scan(&token.ID, &userIDStr, &token.Username, &token.TokenHash,
+		&token.ExpiresAt, &token.CreatedAt, &token.IsUsed)
+	if err != nil {
+		return nil, err
+	}
+
+	token.UserID, err = uuid.Parse(userIDStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse user ID: %w", err)
+	}
+
+	return &token, nil
+}
+
+// scanRevocation зчитує відкликання токенів з рядка результату запиту
+func scanRevocation(row rowScanner) (*wg.TokenRevocation, error) {
+	var revocation wg.TokenRevocation
+	if err := row.Scan(&revocation.Kind, &revocation.Value, &revocation.RevokedAt); err != nil {
+		return nil, err
+	}
+	return &revocation, nil
+}
+
+// tokenUseError пояснює, чому UseToken не змінив жодного рядка:
+// token - збережений токен з тим самим ID або nil
+func tokenUseError(token *wg.Token, id, tokenHash string) error {
+	if token == nil || token.TokenHash != tokenHash {
+		return fmt.Errorf("%w: %s", ErrTokenNotFound, id)
+	}
+	return fmt.Errorf("%w: %s", ErrTokenUsed, id)
+}
+
+// execer узагальнює *sql.DB та *sql.Tx для запитів без результату
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// insertRefreshToken додає refresh токен у таблицю refresh_tokens
+func insertRefreshToken(db execer, d dialect, token *wg.RefreshToken) error {
+	query := d.rebind(`INSERT INTO refresh_tokens (id, family_id, peer_id, user_id, token_hash, expires_at, created_at)
+			   VALUES (?, ?, ?, ?, ?, ?, ?)`)
+
+	_, err := db.Exec(query, token.ID.String(), token.FamilyID.String(), token.PeerID.String(),
+		token.UserID.String(), token.TokenHash, token.ExpiresAt, token.CreatedAt)
+	return err
+}
+
+// refreshTokenColumns - перелік колонок refresh_tokens у порядку, який очікує scanRefreshToken
+const refreshTokenColumns = `id, family_id, peer_id, user_id, token_hash, expires_at, created_at, used_at, revoked_at`
+
+// scanRefreshToken зчитує refresh токен з рядка результату запиту
+func scanRefreshToken(row rowScanner) (*wg.RefreshToken, error) {
+	var token wg.RefreshToken
+	var idStr, familyIDStr, peerIDStr, userIDStr string
+
+	err := row.Scan(&idStr, &familyIDStr, &peerIDStr, &userIDStr, &token.TokenHash,
+		&token.ExpiresAt, &token.CreatedAt, &token.UsedAt, &token.RevokedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if token.ID, err = uuid.Parse(idStr); err != nil {
+		return nil, fmt.Errorf("failed to parse refresh token ID: %w", err)
+	}
+	if token.FamilyID, err = uuid.Parse(familyIDStr); err != nil {
+		return nil, fmt.Errorf("failed to parse refresh token family ID: %w", err)
+	}
+	if token.PeerID, err = uuid.Parse(peerIDStr); err != nil {
+		return nil, fmt.Errorf("failed to parse peer ID: %w", err)
+	}
+	if token.UserID, err = uuid.Parse(userIDStr); err != nil {
+		return nil, fmt.Errorf("failed to parse user ID: %w", err)
+	}
+
+	return &token, nil
+}
+
+// listSigningKeys повертає ключі підпису, які ще не втратили чинності, від найстаршого
+func listSigningKeys(db *sql.DB, d dialect, cipher *Cipher) ([]*wg.SigningKey, error) {
+	query := d.rebind(`SELECT kid, algorithm, private_key, public_key, created_at, expires_at
+			   FROM signing_keys WHERE expires_at IS NULL OR expires_at > ? ORDER BY created_at`)
+
+	rows, err := db.Query(query, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*wg.SigningKey
+	for rows.Next() {
+		var key wg.SigningKey
+		if err := rows.Scan(&key.ID, &key.Algorithm, &key.PrivateKey, &key.PublicKey, &key.CreatedAt, &key.ExpiresAt); err != nil {
+			return nil, err
+		}
+		if key.PrivateKey, err = cipher.Decrypt(key.PrivateKey); err != nil {
+			return nil, fmt.Errorf("failed to decrypt signing key %s: %w", key.ID, err)
+		}
+		keys = append(keys, &key)
+	}
+
+	return keys, rows.Err()
+}
+
+// rotateSigningKey зберігає новий активний ключ next. Попередні активні ключі
+// перевіряють токени до retireAt, ключі з минулим терміном видаляються.
+func rotateSigningKey(db *sql.DB, d dialect, cipher *Cipher, next *wg.SigningKey, retireAt time.Time) error {
+	privateKey, err := encryptValue(cipher, next.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt signing key: %w", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(d.rebind(`DELETE FROM signing_keys WHERE expires_at <= ?`), next.CreatedAt); err != nil {
+		return fmt.Errorf("failed to delete expired signing keys: %w", err)
+	}
+	if _, err := tx.Exec(d.rebind(`UPDATE signing_keys SET expires_at = ? WHERE expires_at IS NULL`), retireAt); err != nil {
+		return fmt.Errorf("failed to retire signing keys: %w", err)
+	}
+
+	query := d.rebind(`INSERT INTO signing_keys (kid, algorithm, private_key, public_key, created_at)
+			   VALUES (?, ?, ?, ?, ?)`)
+	if _, err := tx.Exec(query, next.ID, next.Algorithm, privateKey, next.PublicKey, next.CreatedAt); err != nil {
+		return fmt.Errorf("failed to save signing key: %w", err)
+	}
+
+	return tx.Commit()
+}
+
+// peerColumns - перелік колонок peers у порядку, який очікує scanPeer
+const peerColumns = `id, name, public_key, private_key, allowed_ips, endpoint, preshared_key,
+			         created_at, updated_at, last_seen, is_active, persistent_keepalive, interface_name`
+
+// nullString зберігає порожній рядок як NULL, щоб не порушувати зовнішні ключі
+func nullString(value string) sql.NullString {
+	return sql.NullString{String: value, Valid: value != ""}
+}
+
 // DefaultConfig повертає конфігурацію за замовчуванням
 func DefaultConfig() *Config {
 	return &Config{
@@ -0,0 +1,700 @@
+package storage
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/artem/wg-orbit/internal/wg"
+)
+
+// newTestSQLite створює SQLite storage у тимчасовій директорії
+func newTestSQLite(t *testing.T) Storage {
+	t.Helper()
+
+	store, err := NewSQLiteStorage(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatalf("NewSQLiteStorage() error: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	return store
+}
+
+// newTestPostgres підключається до PostgreSQL з DATABASE_URL або пропускає тест
+func newTestPostgres(t *testing.T) Storage {
+	t.Helper()
+
+	dsn := os.Getenv("DATABASE_URL")
+	if dsn == "" {
+		t.Skip("DATABASE_URL is not set, skipping PostgreSQL tests")
+	}
+
+	store, err := newPostgresStorageDSN(dsn)
+	if err != nil {
+		t.Fatalf("newPostgresStorageDSN() error: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	if _, err := store.db.Exec(`TRUNCATE interfaces, peers, tokens, token_revocations, refresh_tokens, signing_keys, ip_allocations, peer_stats`); err != nil {
+		t.Fatalf("failed to truncate tables: %v", err)
+	}
+
+	return store
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	runStorageSuite(t, newTestSQLite)
+}
+
+func TestPostgresStorage(t *testing.T) {
+	runStorageSuite(t, newTestPostgres)
+}
+
+// runStorageSuite перевіряє однакову поведінку всіх реалізацій Storage
+func runStorageSuite(t *testing.T, newStore func(t *testing.T) Storage) {
+	t.Run("interface round trip", func(t *testing.T) {
+		store := newStore(t)
+
+		missing, err := store.GetInterface("wg0")
+		if err != nil {
+			t.Fatalf("GetInterface() unexpected error: %v", err)
+		}
+		if missing != nil {
+			t.Fatalf("GetInterface() = %v, want nil for missing interface", missing)
+		}
+
+		now := time.Now().UTC().Truncate(time.Second)
+		iface := &wg.Interface{
+			Name:       "wg0",
+			PublicKey:  "server-public",
+			PrivateKey: "server-private",
+			ListenPort: 51820,
+			Address:    "10.0.0.1/24",
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+		if err := store.SaveInterface(iface); err != nil {
+			t.Fatalf("SaveInterface() error: %v", err)
+		}
+
+		iface.ListenPort = 51821
+		iface.MTU = 1380
+		iface.FwMark = 51820
+		iface.Table = "1234"
+		if err := store.SaveInterface(iface); err != nil {
+			t.Fatalf("SaveInterface() overwrite error: %v", err)
+		}
+
+		got, err := store.GetInterface("wg0")
+		if err != nil || got == nil {
+			t.Fatalf("GetInterface() = %v, %v", got, err)
+		}
+		if got.PrivateKey != "server-private" || got.ListenPort != 51821 || got.Address != "10.0.0.1/24" {
+			t.Errorf("GetInterface() = %+v, want saved values", got)
+		}
+		if got.MTU != 1380 || got.FwMark != 51820 || got.Table != "1234" {
+			t.Errorf("GetInterface() = %+v, want MTU/fwmark/table preserved", got)
+		}
+		if !got.CreatedAt.Equal(now) {
+			t.Errorf("GetInterface() CreatedAt = %v, want %v", got.CreatedAt, now)
+		}
+
+		// Повторне видалення відсутнього запису не є помилкою
+		for i := 0; i < 2; i++ {
+			if err := store.DeleteInterface("wg0"); err != nil {
+				t.Fatalf("DeleteInterface() error: %v", err)
+			}
+		}
+		if got, err := store.GetInterface("wg0"); err != nil || got != nil {
+			t.Errorf("GetInterface() after delete = %v, %v, want nil", got, err)
+		}
+	})
+
+	t.Run("peer round trip", func(t *testing.T) {
+		store := newStore(t)
+
+		peer := newTestPeer(t, "alice")
+		peer.AllowedIPs = []string{"10.0.0.2/32", "fd00::2/128"}
+		peer.Endpoint = "192.168.1.10:51820"
+		peer.PresharedKey = "psk"
+		peer.PersistentKeepalive = 25
+		if err := store.SavePeer(peer); err != nil {
+			t.Fatalf("SavePeer() error: %v", err)
+		}
+
+		got, err := store.GetPeer(peer.ID)
+		if err != nil || got == nil {
+			t.Fatalf("GetPeer() = %v, %v", got, err)
+		}
+		if got.ID != peer.ID || got.Name != "alice" || got.PrivateKey != peer.PrivateKey {
+			t.Errorf("GetPeer() = %+v, want %+v", got, peer)
+		}
+		if len(got.AllowedIPs) != 2 || got.AllowedIPs[0] != "10.0.0.2/32" || got.AllowedIPs[1] != "fd00::2/128" {
+			t.Errorf("GetPeer() AllowedIPs = %v, want %v", got.AllowedIPs, peer.AllowedIPs)
+		}
+		if got.Endpoint != peer.Endpoint || got.PresharedKey != "psk" || !got.IsActive || got.PersistentKeepalive != 25 {
+			t.Errorf("GetPeer() = %+v, want endpoint/psk/active/keepalive preserved", got)
+		}
+		if got.LastSeen != nil {
+			t.Errorf("GetPeer() LastSeen = %v, want nil", got.LastSeen)
+		}
+
+		byName, err := store.GetPeerByName("alice")
+		if err != nil || byName == nil || byName.ID != peer.ID {
+			t.Errorf("GetPeerByName() = %v, %v", byName, err)
+		}
+		byKey, err := store.GetPeerByPublicKey(peer.PublicKey)
+		if err != nil || byKey == nil || byKey.ID != peer.ID {
+			t.Errorf("GetPeerByPublicKey() = %v, %v", byKey, err)
+		}
+
+		got.IsActive = false
+		got.AllowedIPs = nil
+		if err := store.SavePeer(got); err != nil {
+			t.Fatalf("SavePeer() update error: %v", err)
+		}
+		updated, err := store.GetPeer(peer.ID)
+		if err != nil || updated == nil {
+			t.Fatalf("GetPeer() = %v, %v", updated, err)
+		}
+		if updated.IsActive || len(updated.AllowedIPs) != 0 {
+			t.Errorf("GetPeer() after update = %+v", updated)
+		}
+	})
+
+	t.Run("peer duplicates", func(t *testing.T) {
+		store := newStore(t)
+
+		alice := newTestPeer(t, "alice")
+		if err := store.SavePeer(alice); err != nil {
+			t.Fatalf("SavePeer() error: %v", err)
+		}
+
+		sameKey := newTestPeer(t, "bob")
+		sameKey.PublicKey = alice.PublicKey
+		if err := store.SavePeer(sameKey); !errors.Is(err, ErrPeerExists) {
+			t.Errorf("SavePeer() duplicate public key error = %v, want ErrPeerExists", err)
+		}
+		sameName := newTestPeer(t, "alice")
+		if err := store.SavePeer(sameName); !errors.Is(err, ErrPeerExists) {
+			t.Errorf("SavePeer() duplicate name error = %v, want ErrPeerExists", err)
+		}
+
+		got, err := store.GetPeer(alice.ID)
+		if err != nil || got == nil || got.PublicKey != alice.PublicKey {
+			t.Errorf("GetPeer() after duplicates = %v, %v, want original peer", got, err)
+		}
+		peers, err := store.ListPeers()
+		if err != nil || len(peers) != 1 {
+			t.Errorf("ListPeers() = %d peers, %v, want 1", len(peers), err)
+		}
+	})
+
+	t.Run("peer interface", func(t *testing.T) {
+		store := newStore(t)
+
+		peer := newTestPeer(t, "alice")
+		peer.InterfaceName = "wg-staff"
+		if err := store.SavePeer(peer); !errors.Is(err, ErrInterfaceNotFound) {
+			t.Fatalf("SavePeer() for missing interface error = %v, want ErrInterfaceNotFound", err)
+		}
+
+		iface := newTestInterface(t, "wg-staff")
+		if err := store.SaveInterface(iface); err != nil {
+			t.Fatalf("SaveInterface() error: %v", err)
+		}
+		if err := store.SavePeer(peer); err != nil {
+			t.Fatalf("SavePeer() error: %v", err)
+		}
+
+		// Оновлення інтерфейсу не зачіпає прив'язаних peer'ів
+		iface.ListenPort = 51821
+		if err := store.SaveInterface(iface); err != nil {
+			t.Fatalf("SaveInterface() update error: %v", err)
+		}
+		if err := store.DeleteInterface("wg-staff"); !errors.Is(err, ErrInterfaceInUse) {
+			t.Errorf("DeleteInterface() with peers error = %v, want ErrInterfaceInUse", err)
+		}
+
+		legacy := newTestPeer(t, "legacy")
+		if err := store.SavePeer(legacy); err != nil {
+			t.Fatalf("SavePeer() without interface error: %v", err)
+		}
+		adopted, err := store.AdoptPeers("wg-staff")
+		if err != nil || adopted != 1 {
+			t.Errorf("AdoptPeers() = %d, %v, want 1", adopted, err)
+		}
+
+		for _, id := range []uuid.UUID{peer.ID, legacy.ID} {
+			got, err := store.GetPeer(id)
+			if err != nil || got == nil || got.InterfaceName != "wg-staff" {
+				t.Errorf("GetPeer() = %+v, %v, want interface wg-staff", got, err)
+			}
+		}
+	})
+
+	t.Run("missing peer", func(t *testing.T) {
+		store := newStore(t)
+
+		peer, err := store.GetPeer(uuid.New())
+		if err != nil || peer != nil {
+			t.Errorf("GetPeer() = %v, %v, want nil, nil", peer, err)
+		}
+
+		peer, err = store.GetPeerByName("nobody")
+		if err != nil || peer != nil {
+			t.Errorf("GetPeerByName() = %v, %v, want nil, nil", peer, err)
+		}
+	})
+
+	t.Run("list and delete", func(t *testing.T) {
+		store := newStore(t)
+
+		first := newTestPeer(t, "first")
+		first.CreatedAt = first.CreatedAt.Add(-time.Minute)
+		second := newTestPeer(t, "second")
+		for _, peer := range []*wg.Peer{first, second} {
+			if err := store.SavePeer(peer); err != nil {
+				t.Fatalf("SavePeer() error: %v", err)
+			}
+		}
+
+		peers, err := store.ListPeers()
+		if err != nil {
+			t.Fatalf("ListPeers() error: %v", err)
+		}
+		if len(peers) != 2 || peers[0].Name != "second" || peers[1].Name != "first" {
+			t.Fatalf("ListPeers() = %v, want [second first]", peers)
+		}
+
+		if err := store.DeletePeer(first.ID); err != nil {
+			t.Fatalf("DeletePeer() error: %v", err)
+		}
+		peers, err = store.ListPeers()
+		if err != nil || len(peers) != 1 || peers[0].ID != second.ID {
+			t.Errorf("ListPeers() after delete = %v, %v", peers, err)
+		}
+	})
+
+	t.Run("ip allocations", func(t *testing.T) {
+		store := newStore(t)
+
+		peer := newTestPeer(t, "carol")
+		peer.AllowedIPs = []string{"10.0.0.2/32"}
+		if err := store.SavePeer(peer); err != nil {
+			t.Fatalf("SavePeer() error: %v", err)
+		}
+
+		now := time.Now().UTC().Truncate(time.Second)
+		alloc := &wg.IPAllocation{InterfaceName: "wg0", Address: "10.0.0.2", PeerID: peer.ID, CreatedAt: now}
+		if err := store.SaveAllocation(alloc); err != nil {
+			t.Fatalf("SaveAllocation() error: %v", err)
+		}
+
+		duplicate := &wg.IPAllocation{InterfaceName: "wg0", Address: "10.0.0.2", PeerID: uuid.New(), CreatedAt: now}
+		if err := store.SaveAllocation(duplicate); !errors.Is(err, ErrAddressInUse) {
+			t.Errorf("SaveAllocation() duplicate error = %v, want ErrAddressInUse", err)
+		}
+
+		other := &wg.IPAllocation{InterfaceName: "wg1", Address: "10.0.0.2", PeerID: uuid.New(), CreatedAt: now}
+		if err := store.SaveAllocation(other); err != nil {
+			t.Errorf("SaveAllocation() on another interface error: %v", err)
+		}
+
+		allocations, err := store.ListAllocations("wg0")
+		if err != nil || len(allocations) != 1 || allocations[0].PeerID != peer.ID {
+			t.Fatalf("ListAllocations() = %v, %v", allocations, err)
+		}
+
+		taken := &wg.IPAllocation{InterfaceName: "wg0", Address: "10.0.0.3", PeerID: uuid.New(), CreatedAt: now}
+		if err := store.SaveAllocation(taken); err != nil {
+			t.Fatalf("SaveAllocation() error: %v", err)
+		}
+		if err := store.MoveAllocation("wg0", "10.0.0.2", "10.0.0.3"); !errors.Is(err, ErrAddressInUse) {
+			t.Errorf("MoveAllocation() to taken address error = %v, want ErrAddressInUse", err)
+		}
+		if err := store.MoveAllocation("wg0", "10.0.0.2", "10.0.0.50"); err != nil {
+			t.Fatalf("MoveAllocation() error: %v", err)
+		}
+		if err := store.MoveAllocation("wg0", "10.0.0.2", "10.0.0.51"); err == nil {
+			t.Errorf("MoveAllocation() of unallocated address expected error")
+		}
+		if err := store.DeleteAllocations(taken.PeerID); err != nil {
+			t.Fatalf("DeleteAllocations() error: %v", err)
+		}
+
+		allocations, err = store.ListAllocations("wg0")
+		if err != nil || len(allocations) != 1 || allocations[0].Address != "10.0.0.50" || allocations[0].PeerID != peer.ID {
+			t.Fatalf("ListAllocations() after move = %v, %v", allocations, err)
+		}
+
+		if err := store.DeletePeer(peer.ID); err != nil {
+			t.Fatalf("DeletePeer() error: %v", err)
+		}
+		allocations, err = store.ListAllocations("wg0")
+		if err != nil || len(allocations) != 0 {
+			t.Errorf("ListAllocations() after DeletePeer = %v, %v, want empty", allocations, err)
+		}
+
+		if err := store.DeleteAllocations(other.PeerID); err != nil {
+			t.Fatalf("DeleteAllocations() error: %v", err)
+		}
+		allocations, err = store.ListAllocations("wg1")
+		if err != nil || len(allocations) != 0 {
+			t.Errorf("ListAllocations() after DeleteAllocations = %v, %v, want empty", allocations, err)
+		}
+	})
+
+	t.Run("peer stats", func(t *testing.T) {
+		store := newStore(t)
+
+		peer := newTestPeer(t, "dave")
+		if err := store.SavePeer(peer); err != nil {
+			t.Fatalf("SavePeer() error: %v", err)
+		}
+
+		missing, err := store.GetPeerStats(peer.ID)
+		if err != nil || missing != nil {
+			t.Fatalf("GetPeerStats() = %v, %v, want nil, nil", missing, err)
+		}
+
+		now := time.Now().UTC().Truncate(time.Second)
+		stats := &wg.PeerStats{PeerID: peer.ID, RxBytes: 1 << 40, TxBytes: 2048, RxCounter: 512, TxCounter: 1024, UpdatedAt: now}
+		if err := store.SavePeerStats(stats); err != nil {
+			t.Fatalf("SavePeerStats() error: %v", err)
+		}
+		stats.TxBytes = 4096
+		if err := store.SavePeerStats(stats); err != nil {
+			t.Fatalf("SavePeerStats() overwrite error: %v", err)
+		}
+
+		got, err := store.GetPeerStats(peer.ID)
+		if err != nil || got == nil {
+			t.Fatalf("GetPeerStats() = %v, %v", got, err)
+		}
+		if got.RxBytes != 1<<40 || got.TxBytes != 4096 || got.RxCounter != 512 || got.TxCounter != 1024 {
+			t.Errorf("GetPeerStats() = %+v, want saved values", got)
+		}
+
+		// Статистика не скидається при збереженні peer'а
+		if err := store.SavePeer(peer); err != nil {
+			t.Fatalf("SavePeer() error: %v", err)
+		}
+		all, err := store.ListPeerStats()
+		if err != nil || len(all) != 1 || all[0].PeerID != peer.ID {
+			t.Fatalf("ListPeerStats() = %v, %v", all, err)
+		}
+
+		if err := store.DeletePeer(peer.ID); err != nil {
+			t.Fatalf("DeletePeer() error: %v", err)
+		}
+		all, err = store.ListPeerStats()
+		if err != nil || len(all) != 0 {
+			t.Errorf("ListPeerStats() after DeletePeer = %v, %v, want empty", all, err)
+		}
+	})
+
+	t.Run("update last seen", func(t *testing.T) {
+		store := newStore(t)
+
+		peer := newTestPeer(t, "bob")
+		if err := store.SavePeer(peer); err != nil {
+			t.Fatalf("SavePeer() error: %v", err)
+		}
+
+		seen := time.Now().UTC().Truncate(time.Second)
+		if err := store.UpdatePeerLastSeen(peer.ID, seen); err != nil {
+			t.Fatalf("UpdatePeerLastSeen() error: %v", err)
+		}
+
+		got, err := store.GetPeer(peer.ID)
+		if err != nil || got == nil {
+			t.Fatalf("GetPeer() = %v, %v", got, err)
+		}
+		if got.LastSeen == nil || !got.LastSeen.Equal(seen) {
+			t.Errorf("GetPeer() LastSeen = %v, want %v", got.LastSeen, seen)
+		}
+	})
+
+	t.Run("one-time tokens", func(t *testing.T) {
+		store := newStore(t)
+
+		now := time.Now().UTC().Truncate(time.Second)
+		token := &wg.Token{
+			ID:        uuid.New().String(),
+			UserID:    uuid.New(),
+			Username:  "alice",
+			TokenHash: "hash-1",
+			ExpiresAt: now.Add(time.Hour),
+			CreatedAt: now,
+		}
+		if err := store.SaveToken(token); err != nil {
+			t.Fatalf("SaveToken() error: %v", err)
+		}
+
+		got, err := store.GetToken(token.ID)
+		if err != nil || got == nil || got.UserID != token.UserID || got.IsUsed || !got.ExpiresAt.Equal(token.ExpiresAt) {
+			t.Fatalf("GetToken() = %+v, %v, want %+v", got, err, token)
+		}
+		if missing, err := store.GetToken("missing"); err != nil || missing != nil {
+			t.Errorf("GetToken(missing) = %v, %v, want nil, nil", missing, err)
+		}
+
+		if err := store.UseToken(token.ID, "other-hash"); !errors.Is(err, ErrTokenNotFound) {
+			t.Errorf("UseToken() with wrong hash error = %v, want ErrTokenNotFound", err)
+		}
+		if err := store.UseToken(token.ID, token.TokenHash); err != nil {
+			t.Fatalf("UseToken() error: %v", err)
+		}
+		if err := store.UseToken(token.ID, token.TokenHash); !errors.Is(err, ErrTokenUsed) {
+			t.Errorf("repeated UseToken() error = %v, want ErrTokenUsed", err)
+		}
+
+		// Після невдалої операції токен можна використати ще раз
+		if err := store.ReleaseToken(token.ID); err != nil {
+			t.Fatalf("ReleaseToken() error: %v", err)
+		}
+		if err := store.UseToken(token.ID, token.TokenHash); err != nil {
+			t.Errorf("UseToken() after ReleaseToken error: %v", err)
+		}
+	})
+
+	t.Run("token revocations", func(t *testing.T) {
+		store := newStore(t)
+
+		now := time.Now().UTC().Truncate(time.Second)
+		jti := uuid.New().String()
+		for _, revocation := range []*wg.TokenRevocation{
+			{Kind: "jti", Value: jti, RevokedAt: now},
+			{Kind: "user", Value: "alice", RevokedAt: now},
+			// Повторне відкликання користувача переносить час
+			{Kind: "user", Value: "alice", RevokedAt: now.Add(time.Minute)},
+		} {
+			if err := store.RevokeTokens(revocation); err != nil {
+				t.Fatalf("RevokeTokens(%+v) error: %v", revocation, err)
+			}
+		}
+
+		revocations, err := store.ListRevocations()
+		if err != nil || len(revocations) != 2 {
+			t.Fatalf("ListRevocations() = %v, %v, want 2 entries", revocations, err)
+		}
+		for _, revocation := range revocations {
+			if revocation.Kind == "user" && !revocation.RevokedAt.Equal(now.Add(time.Minute)) {
+				t.Errorf("user revocation time = %v, want %v", revocation.RevokedAt, now.Add(time.Minute))
+			}
+			if revocation.Kind == "jti" && revocation.Value != jti {
+				t.Errorf("jti revocation = %+v, want %s", revocation, jti)
+			}
+		}
+	})
+
+	t.Run("refresh tokens", func(t *testing.T) {
+		store := newStore(t)
+
+		peer := newTestPeer(t, "alice")
+		if err := store.SavePeer(peer); err != nil {
+			t.Fatalf("SavePeer() error: %v", err)
+		}
+
+		now := time.Now().UTC().Truncate(time.Second)
+		newToken := func(hash string, familyID uuid.UUID) *wg.RefreshToken {
+			id := uuid.New()
+			if familyID == uuid.Nil {
+				familyID = id
+			}
+			return &wg.RefreshToken{
+				ID:        id,
+				FamilyID:  familyID,
+				PeerID:    peer.ID,
+				UserID:    uuid.New(),
+				TokenHash: hash,
+				ExpiresAt: now.Add(time.Hour),
+				CreatedAt: now,
+			}
+		}
+
+		first := newToken("hash-1", uuid.Nil)
+		if err := store.SaveRefreshToken(first); err != nil {
+			t.Fatalf("SaveRefreshToken() error: %v", err)
+		}
+		got, err := store.GetRefreshToken("hash-1")
+		if err != nil || got == nil || got.ID != first.ID || got.PeerID != peer.ID || got.UsedAt != nil || !got.ExpiresAt.Equal(first.ExpiresAt) {
+			t.Fatalf("GetRefreshToken() = %+v, %v, want %+v", got, err, first)
+		}
+		if missing, err := store.GetRefreshToken("missing"); err != nil || missing != nil {
+			t.Errorf("GetRefreshToken(missing) = %v, %v, want nil, nil", missing, err)
+		}
+
+		second := newToken("hash-2", first.FamilyID)
+		if err := store.RotateRefreshToken(first.ID, second); err != nil {
+			t.Fatalf("RotateRefreshToken() error: %v", err)
+		}
+		if got, _ := store.GetRefreshToken("hash-1"); got == nil || got.UsedAt == nil {
+			t.Errorf("rotated token = %+v, want used", got)
+		}
+
+		// Замінений токен не можна замінити вдруге
+		if err := store.RotateRefreshToken(first.ID, newToken("hash-3", first.FamilyID)); !errors.Is(err, ErrTokenUsed) {
+			t.Errorf("repeated RotateRefreshToken() error = %v, want ErrTokenUsed", err)
+		}
+		if got, _ := store.GetRefreshToken("hash-3"); got != nil {
+			t.Errorf("failed rotation saved token %+v", got)
+		}
+
+		if err := store.RevokeRefreshTokens(first.FamilyID, now); err != nil {
+			t.Fatalf("RevokeRefreshTokens() error: %v", err)
+		}
+		for _, hash := range []string{"hash-1", "hash-2"} {
+			if got, _ := store.GetRefreshToken(hash); got == nil || got.RevokedAt == nil {
+				t.Errorf("token %s = %+v, want revoked", hash, got)
+			}
+		}
+		if err := store.RotateRefreshToken(second.ID, newToken("hash-4", first.FamilyID)); !errors.Is(err, ErrTokenUsed) {
+			t.Errorf("RotateRefreshToken() of revoked token error = %v, want ErrTokenUsed", err)
+		}
+
+		// Токени видаляються разом з peer'ом
+		if err := store.DeletePeer(peer.ID); err != nil {
+			t.Fatalf("DeletePeer() error: %v", err)
+		}
+		if got, _ := store.GetRefreshToken("hash-2"); got != nil {
+			t.Errorf("refresh token of deleted peer = %+v", got)
+		}
+	})
+
+	t.Run("peer with refresh token", func(t *testing.T) {
+		store := newStore(t)
+
+		now := time.Now().UTC().Truncate(time.Second)
+		newToken := func(peer *wg.Peer) *wg.RefreshToken {
+			id := uuid.New()
+			return &wg.RefreshToken{
+				ID:        id,
+				FamilyID:  id,
+				PeerID:    peer.ID,
+				UserID:    uuid.New(),
+				TokenHash: "hash-1",
+				ExpiresAt: now.Add(time.Hour),
+				CreatedAt: now,
+			}
+		}
+
+		alice := newTestPeer(t, "alice")
+		if err := store.SavePeerWithRefreshToken(alice, newToken(alice)); err != nil {
+			t.Fatalf("SavePeerWithRefreshToken() error: %v", err)
+		}
+		if got, err := store.GetPeer(alice.ID); err != nil || got == nil {
+			t.Errorf("GetPeer() = %v, %v, want saved peer", got, err)
+		}
+		if got, err := store.GetRefreshToken("hash-1"); err != nil || got == nil || got.PeerID != alice.ID {
+			t.Errorf("GetRefreshToken() = %+v, %v, want token of alice", got, err)
+		}
+
+		// Якщо токен не зберігся, peer'а теж немає
+		bob := newTestPeer(t, "bob")
+		if err := store.SavePeerWithRefreshToken(bob, newToken(bob)); err == nil {
+			t.Fatal("SavePeerWithRefreshToken() with duplicate token hash succeeded")
+		}
+		if got, err := store.GetPeer(bob.ID); err != nil || got != nil {
+			t.Errorf("GetPeer() after failed save = %v, %v, want nil", got, err)
+		}
+	})
+
+	t.Run("signing keys", func(t *testing.T) {
+		store := newStore(t)
+
+		now := time.Now().UTC().Truncate(time.Second)
+		newKey := func(kid string, created time.Time) *wg.SigningKey {
+			return &wg.SigningKey{
+				ID:         kid,
+				Algorithm:  "EdDSA",
+				PrivateKey: "private-" + kid,
+				PublicKey:  "public-" + kid,
+				CreatedAt:  created,
+			}
+		}
+		kids := func() string {
+			keys, err := store.ListSigningKeys()
+			if err != nil {
+				t.Fatalf("ListSigningKeys() error: %v", err)
+			}
+			var result []string
+			for _, key := range keys {
+				state := "active"
+				if key.ExpiresAt != nil {
+					state = "retired"
+				}
+				result = append(result, key.ID+":"+state)
+			}
+			return strings.Join(result, ",")
+		}
+
+		if err := store.RotateSigningKey(newKey("a", now.Add(-2*time.Hour)), now); err != nil {
+			t.Fatalf("RotateSigningKey(a) error: %v", err)
+		}
+		keys, err := store.ListSigningKeys()
+		if err != nil || len(keys) != 1 || keys[0].PrivateKey != "private-a" || keys[0].ExpiresAt != nil {
+			t.Fatalf("ListSigningKeys() = %+v, %v, want active key a", keys, err)
+		}
+
+		// Попередній ключ перевіряє токени до retireAt
+		if err := store.RotateSigningKey(newKey("b", now.Add(-time.Hour)), now.Add(time.Hour)); err != nil {
+			t.Fatalf("RotateSigningKey(b) error: %v", err)
+		}
+		if got := kids(); got != "a:retired,b:active" {
+			t.Errorf("keys after rotation = %s, want a:retired,b:active", got)
+		}
+
+		// Ключ з минулим терміном більше не повертається
+		if err := store.RotateSigningKey(newKey("c", now), now.Add(-time.Minute)); err != nil {
+			t.Fatalf("RotateSigningKey(c) error: %v", err)
+		}
+		if got := kids(); got != "a:retired,c:active" {
+			t.Errorf("keys after second rotation = %s, want a:retired,c:active", got)
+		}
+	})
+}
+
+// newTestInterface створює інтерфейс з новими ключами
+func newTestInterface(t *testing.T, name string) *wg.Interface {
+	t.Helper()
+
+	privateKey, publicKey, err := wg.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	return &wg.Interface{
+		Name:       name,
+		PrivateKey: privateKey,
+		PublicKey:  publicKey,
+		ListenPort: 51820,
+		Address:    "10.0.0.1/24",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+}
+
+// newTestPeer створює peer'а з детермінованими часовими мітками
+func newTestPeer(t *testing.T, name string) *wg.Peer {
+	t.Helper()
+
+	peer, err := wg.NewPeer(name)
+	if err != nil {
+		t.Fatalf("NewPeer() error: %v", err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	peer.CreatedAt = now
+	peer.UpdatedAt = now
+
+	return peer
+}
@@ -0,0 +1,293 @@
+package wg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+)
+
+var (
+	// ErrPoolExhausted повертається, коли в пулі не залишилось вільних адрес
+	ErrPoolExhausted = errors.New("no available IP addresses in pool")
+	// ErrAddressOutOfPool повертається, коли запитана адреса не може бути видана пулом
+	ErrAddressOutOfPool = errors.New("address is outside of the pool")
+	// ErrAddressAllocated повертається, коли запитана адреса вже зайнята
+	ErrAddressAllocated = errors.New("address is already allocated")
+)
+
+// IPPoolOptions налаштовує діапазон адрес пулу
+type IPPoolOptions struct {
+	StartIP  string   // перша адреса, що видається peer'ам (включно)
+	EndIP    string   // остання адреса, що видається peer'ам (включно)
+	Gateway  string   // адреса сервера в мережі, ніколи не видається
+	Reserved []string // адреси, які не видаються автоматично
+}
+
+// IPPool представляє пул IP адрес
+type IPPool struct {
+	Network   *net.IPNet      `json:"network"`
+	Allocated map[string]bool `json:"allocated"`
+	Reserved  map[string]bool `json:"reserved"`
+	Start     net.IP          `json:"start"`
+	End       net.IP          `json:"end"`
+	NextIP    net.IP          `json:"next_ip"`
+	Gateway   net.IP          `json:"gateway,omitempty"`
+}
+
+// NewIPPool створює новий пул IP адрес.
+// Адреса мережі та broadcast адреса не видаються.
+func NewIPPool(cidr string) (*IPPool, error) {
+	return NewIPPoolWithOptions(cidr, IPPoolOptions{})
+}
+
+// NewIPPoolWithOptions створює пул з обмеженим діапазоном і зарезервованими адресами
+func NewIPPoolWithOptions(cidr string, opts IPPoolOptions) (*IPPool, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CIDR: %w", err)
+	}
+
+	start, end := usableRange(network)
+
+	if opts.StartIP != "" {
+		ip, err := parsePoolIP(network, opts.StartIP)
+		if err != nil {
+			return nil, fmt.Errorf("invalid start IP: %w", err)
+		}
+		if bytes.Compare(ip, start) > 0 {
+			start = ip
+		}
+	}
+	if opts.EndIP != "" {
+		ip, err := parsePoolIP(network, opts.EndIP)
+		if err != nil {
+			return nil, fmt.Errorf("invalid end IP: %w", err)
+		}
+		if bytes.Compare(ip, end) < 0 {
+			end = ip
+		}
+	}
+	if bytes.Compare(start, end) > 0 {
+		return nil, fmt.Errorf("start IP %s is after end IP %s", start, end)
+	}
+
+	pool := &IPPool{
+		Network:   network,
+		Allocated: make(map[string]bool),
+		Reserved:  make(map[string]bool),
+		Start:     start,
+		End:       end,
+		NextIP:    start,
+	}
+
+	if opts.Gateway != "" {
+		ip, err := parsePoolIP(network, opts.Gateway)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gateway: %w", err)
+		}
+		pool.Gateway = ip
+		pool.Reserved[ip.String()] = true
+	}
+
+	for _, reserved := range opts.Reserved {
+		ip, err := parsePoolIP(network, reserved)
+		if err != nil {
+			return nil, fmt.Errorf("invalid reserved address: %w", err)
+		}
+		pool.Reserved[ip.String()] = true
+	}
+
+	return pool, nil
+}
+
+// AllocateIP виділяє наступну доступну IP адресу.
+// Пошук починається з NextIP і після кінця діапазону продовжується з його початку,
+// тому звільнені адреси використовуються повторно.
+func (pool *IPPool) AllocateIP() (net.IP, error) {
+	if ip := pool.allocateBetween(pool.NextIP, nil); ip != nil {
+		return ip, nil
+	}
+	if ip := pool.allocateBetween(pool.rangeStart(), pool.NextIP); ip != nil {
+		return ip, nil
+	}
+	return nil, ErrPoolExhausted
+}
+
+// allocateBetween шукає вільну адресу від from до until (не включно)
+// або до кінця діапазону, якщо until дорівнює nil.
+//
+// Серед будь-яких N+1 послідовних адрес, де N - кількість зайнятих і
+// зарезервованих, хоча б одна вільна, тому перебір обмежено N+1 кроками.
+// Це дозволяє працювати з IPv6 /64 без обходу всієї мережі.
+func (pool *IPPool) allocateBetween(from, until net.IP) net.IP {
+	limit := len(pool.Allocated) + len(pool.Reserved) + 1
+	for ip := from; ip != nil && pool.inRange(ip) && limit > 0; ip = nextIP(ip) {
+		if until != nil && ip.Equal(until) {
+			break
+		}
+		limit--
+		ipStr := ip.String()
+		if !pool.Allocated[ipStr] && !pool.Reserved[ipStr] {
+			pool.Allocated[ipStr] = true
+			pool.NextIP = nextIP(ip)
+			return ip
+		}
+	}
+	return nil
+}
+
+// AllocateSpecific виділяє конкретну адресу для статичного призначення.
+// Адреса має належати мережі пулу, але може бути поза діапазоном Start-End
+// і серед зарезервованих: саме для статичних адрес їх зазвичай і резервують.
+// Адреса мережі, broadcast і адреса сервера не видаються ніколи.
+func (pool *IPPool) AllocateSpecific(ip net.IP) error {
+	if ip == nil || !pool.Network.Contains(ip) {
+		return fmt.Errorf("%w: %s is not in %s", ErrAddressOutOfPool, ip, pool.Network)
+	}
+
+	first, last := usableRange(pool.Network)
+	normalized := normalizeIP(ip, pool.Network)
+	if bytes.Compare(normalized, first) < 0 || bytes.Compare(normalized, last) > 0 ||
+		(pool.Gateway != nil && pool.Gateway.Equal(ip)) {
+		return fmt.Errorf("%w: %s cannot be assigned to a peer", ErrAddressOutOfPool, ip)
+	}
+
+	ipStr := ip.String()
+	if pool.Allocated[ipStr] {
+		return fmt.Errorf("%w: %s", ErrAddressAllocated, ip)
+	}
+
+	pool.Allocated[ipStr] = true
+	return nil
+}
+
+// MarkAllocated позначає адресу як зайняту, наприклад при відновленні
+// пулу з бази даних. Повертає false, якщо адреса не належить мережі пулу.
+func (pool *IPPool) MarkAllocated(ip net.IP) bool {
+	if ip == nil || !pool.Network.Contains(ip) {
+		return false
+	}
+	pool.Allocated[ip.String()] = true
+	return true
+}
+
+// ReleaseIP звільняє IP адресу
+func (pool *IPPool) ReleaseIP(ip net.IP) {
+	delete(pool.Allocated, ip.String())
+}
+
+// IsReserved перевіряє, чи адреса зарезервована і не видається автоматично
+func (pool *IPPool) IsReserved(ip net.IP) bool {
+	return pool.Reserved[ip.String()]
+}
+
+// rangeStart повертає першу адресу діапазону
+func (pool *IPPool) rangeStart() net.IP {
+	if pool.Start != nil {
+		return pool.Start
+	}
+	return pool.Network.IP
+}
+
+// inRange перевіряє, чи адреса входить у діапазон, що видається
+func (pool *IPPool) inRange(ip net.IP) bool {
+	if !pool.Network.Contains(ip) {
+		return false
+	}
+	normalized := normalizeIP(ip, pool.Network)
+	if pool.Start != nil && bytes.Compare(normalized, normalizeIP(pool.Start, pool.Network)) < 0 {
+		return false
+	}
+	if pool.End != nil && bytes.Compare(normalized, normalizeIP(pool.End, pool.Network)) > 0 {
+		return false
+	}
+	return true
+}
+
+// usableRange повертає першу і останню адреси мережі, придатні для peer'ів.
+// Для IPv4 мереж більших за /31 адреса мережі та broadcast виключаються,
+// для IPv6 - адреса мережі (Subnet-Router anycast).
+func usableRange(network *net.IPNet) (net.IP, net.IP) {
+	first := normalizeIP(network.IP, network)
+	last := make(net.IP, len(first))
+	for i := range first {
+		last[i] = first[i] | ^network.Mask[i]
+	}
+
+	ones, bits := network.Mask.Size()
+	switch {
+	case bits == 32 && bits-ones >= 2:
+		first = nextIP(first)
+		last = prevIP(last)
+	case bits == 128 && bits-ones >= 1:
+		first = nextIP(first)
+	}
+
+	return first, last
+}
+
+// IsIPv6 перевіряє, чи пул видає IPv6 адреси
+func (pool *IPPool) IsIPv6() bool {
+	return pool.Network.IP.To4() == nil
+}
+
+// HostPrefix повертає довжину префікса для адреси одного хоста (/32 або /128)
+func (pool *IPPool) HostPrefix() int {
+	_, bits := pool.Network.Mask.Size()
+	return bits
+}
+
+// parsePoolIP розбирає адресу і перевіряє, що вона належить мережі.
+// Допускається формат з префіксом (10.0.0.1/24).
+func parsePoolIP(network *net.IPNet, value string) (net.IP, error) {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		var err error
+		ip, _, err = net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address %q", value)
+		}
+	}
+	if !network.Contains(ip) {
+		return nil, fmt.Errorf("address %s is outside of %s", ip, network)
+	}
+	return normalizeIP(ip, network), nil
+}
+
+// normalizeIP приводить адресу до довжини адреси мережі
+// (4 байти для IPv4, 16 для IPv6), щоб їх можна було порівнювати побайтово
+func normalizeIP(ip net.IP, network *net.IPNet) net.IP {
+	if len(network.IP) == net.IPv4len {
+		if v4 := ip.To4(); v4 != nil {
+			return v4
+		}
+	}
+	return ip.To16()
+}
+
+// nextIP повертає наступну IP адресу
+func nextIP(ip net.IP) net.IP {
+	next := make(net.IP, len(ip))
+	copy(next, ip)
+	for i := len(next) - 1; i >= 0; i-- {
+		next[i]++
+		if next[i] != 0 {
+			break
+		}
+	}
+	return next
+}
+
+// prevIP повертає попередню IP адресу
+func prevIP(ip net.IP) net.IP {
+	prev := make(net.IP, len(ip))
+	copy(prev, ip)
+	for i := len(prev) - 1; i >= 0; i-- {
+		prev[i]--
+		if prev[i] != 0xff {
+			break
+		}
+	}
+	return prev
+}
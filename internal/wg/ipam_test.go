@@ -0,0 +1,151 @@
+package wg
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestIPPool_AllocateReusesReleased(t *testing.T) {
+	pool, err := NewIPPool("10.0.0.0/29")
+	if err != nil {
+		t.Fatalf("NewIPPool() error: %v", err)
+	}
+
+	var allocated []net.IP
+	for i := 0; i < 6; i++ {
+		ip, err := pool.AllocateIP()
+		if err != nil {
+			t.Fatalf("AllocateIP() #%d error: %v", i, err)
+		}
+		allocated = append(allocated, ip)
+	}
+
+	if _, err := pool.AllocateIP(); !errors.Is(err, ErrPoolExhausted) {
+		t.Fatalf("AllocateIP() on exhausted pool error = %v, want ErrPoolExhausted", err)
+	}
+
+	pool.ReleaseIP(allocated[1])
+	ip, err := pool.AllocateIP()
+	if err != nil {
+		t.Fatalf("AllocateIP() after release error: %v", err)
+	}
+	if !ip.Equal(allocated[1]) {
+		t.Errorf("AllocateIP() = %v, want released %v", ip, allocated[1])
+	}
+
+	if pool.MarkAllocated(net.ParseIP("192.168.1.1")) {
+		t.Errorf("MarkAllocated() accepted address outside the pool")
+	}
+}
+
+func TestIPPool_ExcludesSpecialAddresses(t *testing.T) {
+	pool, err := NewIPPoolWithOptions("10.0.0.0/29", IPPoolOptions{
+		Gateway:  "10.0.0.1/24",
+		Reserved: []string{"10.0.0.3"},
+	})
+	if err != nil {
+		t.Fatalf("NewIPPoolWithOptions() error: %v", err)
+	}
+
+	want := []string{"10.0.0.2", "10.0.0.4", "10.0.0.5", "10.0.0.6"}
+	for _, w := range want {
+		ip, err := pool.AllocateIP()
+		if err != nil {
+			t.Fatalf("AllocateIP() error: %v", err)
+		}
+		if ip.String() != w {
+			t.Errorf("AllocateIP() = %v, want %v", ip, w)
+		}
+	}
+
+	// 10.0.0.0 - адреса мережі, 10.0.0.7 - broadcast
+	if ip, err := pool.AllocateIP(); err == nil {
+		t.Errorf("AllocateIP() = %v, want pool exhausted", ip)
+	}
+}
+
+func TestIPPool_Range(t *testing.T) {
+	pool, err := NewIPPoolWithOptions("10.0.0.0/24", IPPoolOptions{
+		StartIP: "10.0.0.10",
+		EndIP:   "10.0.0.11",
+	})
+	if err != nil {
+		t.Fatalf("NewIPPoolWithOptions() error: %v", err)
+	}
+
+	for _, want := range []string{"10.0.0.10", "10.0.0.11"} {
+		ip, err := pool.AllocateIP()
+		if err != nil || ip.String() != want {
+			t.Errorf("AllocateIP() = %v, %v, want %v", ip, err, want)
+		}
+	}
+	if _, err := pool.AllocateIP(); !errors.Is(err, ErrPoolExhausted) {
+		t.Errorf("AllocateIP() outside range error = %v, want ErrPoolExhausted", err)
+	}
+
+	invalid := []IPPoolOptions{
+		{StartIP: "192.168.0.10"},
+		{StartIP: "10.0.0.20", EndIP: "10.0.0.10"},
+		{Reserved: []string{"not-an-ip"}},
+	}
+	for _, opts := range invalid {
+		if _, err := NewIPPoolWithOptions("10.0.0.0/24", opts); err == nil {
+			t.Errorf("NewIPPoolWithOptions(%+v) expected error", opts)
+		}
+	}
+}
+
+func TestIPPool_IPv6(t *testing.T) {
+	pool, err := NewIPPoolWithOptions("fd00:77::/64", IPPoolOptions{Gateway: "fd00:77::1/64"})
+	if err != nil {
+		t.Fatalf("NewIPPoolWithOptions() error: %v", err)
+	}
+	if !pool.IsIPv6() || pool.HostPrefix() != 128 {
+		t.Fatalf("IsIPv6() = %v, HostPrefix() = %d", pool.IsIPv6(), pool.HostPrefix())
+	}
+
+	for _, want := range []string{"fd00:77::2", "fd00:77::3"} {
+		ip, err := pool.AllocateIP()
+		if err != nil || ip.String() != want {
+			t.Errorf("AllocateIP() = %v, %v, want %v", ip, err, want)
+		}
+	}
+
+	// Після перезапуску NextIP скидається, а зайняті адреси відновлюються
+	pool.NextIP = pool.Start
+	pool.MarkAllocated(net.ParseIP("fd00:77::4"))
+	ip, err := pool.AllocateIP()
+	if err != nil || ip.String() != "fd00:77::5" {
+		t.Errorf("AllocateIP() = %v, %v, want fd00:77::5", ip, err)
+	}
+}
+
+func TestIPPool_AllocateSpecific(t *testing.T) {
+	pool, err := NewIPPoolWithOptions("10.0.0.0/24", IPPoolOptions{
+		StartIP:  "10.0.0.10",
+		EndIP:    "10.0.0.20",
+		Gateway:  "10.0.0.1/24",
+		Reserved: []string{"10.0.0.50"},
+	})
+	if err != nil {
+		t.Fatalf("NewIPPoolWithOptions() error: %v", err)
+	}
+
+	// Поза динамічним діапазоном і серед зарезервованих - дозволено
+	for _, addr := range []string{"10.0.0.50", "10.0.0.100"} {
+		if err := pool.AllocateSpecific(net.ParseIP(addr)); err != nil {
+			t.Errorf("AllocateSpecific(%s) error: %v", addr, err)
+		}
+	}
+
+	if err := pool.AllocateSpecific(net.ParseIP("10.0.0.50")); !errors.Is(err, ErrAddressAllocated) {
+		t.Errorf("AllocateSpecific() twice error = %v, want ErrAddressAllocated", err)
+	}
+
+	for _, addr := range []string{"10.0.0.0", "10.0.0.1", "10.0.0.255", "10.0.1.5"} {
+		if err := pool.AllocateSpecific(net.ParseIP(addr)); !errors.Is(err, ErrAddressOutOfPool) {
+			t.Errorf("AllocateSpecific(%s) error = %v, want ErrAddressOutOfPool", addr, err)
+		}
+	}
+}
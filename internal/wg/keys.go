@@ -34,6 +34,21 @@ func GenerateKeyPair() (privateKey, publicKey string, err error) {
 	return privateKey, publicKey, nil
 }
 
+// PublicKeyFromPrivate обчислює публічний ключ з приватного
+func PublicKeyFromPrivate(privateKey string) (string, error) {
+	if err := ValidatePrivateKey(privateKey); err != nil {
+		return "", err
+	}
+
+	privateKeyBytes, _ := base64.StdEncoding.DecodeString(privateKey)
+	publicKeyBytes, err := curve25519.X25519(privateKeyBytes, curve25519.Basepoint)
+	if err != nil {
+		return "", fmt.Errorf("failed to derive public key: %w", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(publicKeyBytes), nil
+}
+
 // ValidatePrivateKey перевіряє валідність приватного ключа
 func ValidatePrivateKey(key string) error {
 	keyBytes, err := base64.StdEncoding.DecodeString(key)
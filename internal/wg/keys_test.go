@@ -0,0 +1,22 @@
+package wg
+
+import "testing"
+
+func TestPublicKeyFromPrivate(t *testing.T) {
+	privateKey, publicKey, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("GenerateKeyPair() error: %v", err)
+	}
+
+	got, err := PublicKeyFromPrivate(privateKey)
+	if err != nil {
+		t.Fatalf("PublicKeyFromPrivate() error: %v", err)
+	}
+	if got != publicKey {
+		t.Errorf("PublicKeyFromPrivate() = %q, want %q", got, publicKey)
+	}
+
+	if _, err := PublicKeyFromPrivate("not-a-key"); err == nil {
+		t.Error("PublicKeyFromPrivate() with invalid key succeeded, want error")
+	}
+}
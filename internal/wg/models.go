@@ -3,6 +3,7 @@ package wg
 import (
 	"fmt"
 	"net"
+	"strconv"
 	"time"
 
 	"github.com/google/uuid"
@@ -21,6 +22,50 @@ type Peer struct {
 	UpdatedAt    time.Time  `json:"updated_at" db:"updated_at"`
 	LastSeen     *time.Time `json:"last_seen,omitempty" db:"last_seen"`
 	IsActive     bool       `json:"is_active" db:"is_active"`
+
+	// PersistentKeepalive - інтервал keepalive клієнта в секундах, 0 - вимкнено
+	PersistentKeepalive int `json:"persistent_keepalive" db:"persistent_keepalive"`
+
+	// InterfaceName - WireGuard інтерфейс, до якого підключається peer.
+	// Порожній лише для peer'ів, створених до появи кількох інтерфейсів.
+	InterfaceName string `json:"interface" db:"interface_name"`
+
+	// Обчислюються з peer_stats та last_seen, в таблиці peers не зберігаються
+	Online  bool  `json:"online" db:"-"`
+	RxBytes int64 `json:"rx_bytes" db:"-"`
+	TxBytes int64 `json:"tx_bytes" db:"-"`
+}
+
+// OnlineTimeout - максимальний вік handshake, за якого peer вважається онлайн.
+// WireGuard оновлює handshake щонайменше раз на 2 хвилини активного з'єднання.
+const OnlineTimeout = 3 * time.Minute
+
+// IsOnline перевіряє, чи peer онлайн на основі часу останнього handshake
+func (p *Peer) IsOnline(maxAge time.Duration) bool {
+	if p.LastSeen == nil {
+		return false
+	}
+	return time.Since(*p.LastSeen) <= maxAge
+}
+
+// ApplyStats заповнює обчислювані поля peer'а
+func (p *Peer) ApplyStats(stats *PeerStats) {
+	p.Online = p.IsOnline(OnlineTimeout)
+	if stats != nil {
+		p.RxBytes = stats.RxBytes
+		p.TxBytes = stats.TxBytes
+	}
+}
+
+// MaxPersistentKeepalive - найбільший інтервал keepalive, який приймає WireGuard
+const MaxPersistentKeepalive = 65535
+
+// ValidatePersistentKeepalive перевіряє інтервал keepalive в секундах
+func ValidatePersistentKeepalive(seconds int) error {
+	if seconds < 0 || seconds > MaxPersistentKeepalive {
+		return fmt.Errorf("invalid persistent keepalive %d: must be between 0 and %d seconds", seconds, MaxPersistentKeepalive)
+	}
+	return nil
 }
 
 // Interface представляє WireGuard інтерфейс
@@ -30,6 +75,9 @@ type Interface struct {
 	PrivateKey string    `json:"-" db:"private_key"`
 	ListenPort int       `json:"listen_port" db:"listen_port"`
 	Address    string    `json:"address" db:"address"`
+	MTU        int       `json:"mtu,omitempty" db:"mtu"`           // 0 - значення за замовчуванням
+	FwMark     int       `json:"fwmark,omitempty" db:"fwmark"`     // 0 - не встановлено
+	Table      string    `json:"table,omitempty" db:"route_table"` // таблиця маршрутів тунельних мереж
 	CreatedAt  time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
 }
@@ -51,6 +99,7 @@ type ClientInterface struct {
 	PrivateKey string   `json:"private_key"`
 	Address    []string `json:"address"`
 	DNS        []string `json:"dns,omitempty"`
+	MTU        int      `json:"mtu,omitempty"`
 }
 
 // ServerPeer представляє сервер як peer для клієнта
@@ -59,6 +108,8 @@ type ServerPeer struct {
 	Endpoint     string   `json:"endpoint"`
 	AllowedIPs   []string `json:"allowed_ips"`
 	PresharedKey string   `json:"preshared_key,omitempty"`
+
+	PersistentKeepalive int `json:"persistent_keepalive,omitempty"`
 }
 
 // HandshakeInfo представляє інформацію про handshake
@@ -77,56 +128,123 @@ func (h *HandshakeInfo) IsOnline(maxAge time.Duration) bool {
 	return time.Since(h.LastHandshake) <= maxAge
 }
 
-// IPPool представляє пул IP адрес
-type IPPool struct {
-	Network   *net.IPNet      `json:"network"`
-	Allocated map[string]bool `json:"allocated"`
-	NextIP    net.IP          `json:"next_ip"`
+// PeerStats представляє накопичену статистику трафіку peer'а.
+// Лічильники пристрою скидаються при перестворенні інтерфейсу або peer'а,
+// тому зберігаються і накопичені значення, і останні прочитані лічильники.
+type PeerStats struct {
+	PeerID    uuid.UUID `json:"peer_id" db:"peer_id"`
+	RxBytes   int64     `json:"rx_bytes" db:"rx_bytes"`
+	TxBytes   int64     `json:"tx_bytes" db:"tx_bytes"`
+	RxCounter int64     `json:"-" db:"rx_counter"`
+	TxCounter int64     `json:"-" db:"tx_counter"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
 }
 
-// NewIPPool створює новий пул IP адрес
-func NewIPPool(cidr string) (*IPPool, error) {
-	_, network, err := net.ParseCIDR(cidr)
-	if err != nil {
-		return nil, fmt.Errorf("invalid CIDR: %w", err)
+// Observe додає до накопиченого трафіку приріст лічильників з handshake.
+// Якщо лічильник зменшився, він був скинутий і весь його поточний обсяг новий.
+func (s *PeerStats) Observe(info *HandshakeInfo) {
+	s.RxBytes += counterDelta(s.RxCounter, info.RxBytes)
+	s.TxBytes += counterDelta(s.TxCounter, info.TxBytes)
+	s.RxCounter = info.RxBytes
+	s.TxCounter = info.TxBytes
+}
+
+// counterDelta повертає приріст лічильника з урахуванням скидання
+func counterDelta(previous, current int64) int64 {
+	if current < previous {
+		return current
 	}
+	return current - previous
+}
 
-	return &IPPool{
-		Network:   network,
-		Allocated: make(map[string]bool),
-		NextIP:    network.IP,
-	}, nil
+// IPAllocation представляє виділену peer'у IP адресу
+type IPAllocation struct {
+	InterfaceName string    `json:"interface_name" db:"interface_name"`
+	Address       string    `json:"address" db:"address"`
+	PeerID        uuid.UUID `json:"peer_id" db:"peer_id"`
+	CreatedAt     time.Time `json:"created_at" db:"created_at"`
 }
 
-// AllocateIP виділяє наступну доступну IP адресу
-func (pool *IPPool) AllocateIP() (net.IP, error) {
-	for ip := pool.NextIP; pool.Network.Contains(ip); ip = nextIP(ip) {
-		ipStr := ip.String()
-		if !pool.Allocated[ipStr] {
-			pool.Allocated[ipStr] = true
-			pool.NextIP = nextIP(ip)
-			return ip, nil
-		}
-	}
-	return nil, fmt.Errorf("no available IP addresses in pool")
+// Token представляє виданий одноразовий токен, напр. enrollment.
+// Сам токен не зберігається, лише його SHA-256 хеш.
+type Token struct {
+	ID        string    `json:"id" db:"id"` // jti токена
+	UserID    uuid.UUID `json:"user_id" db:"user_id"`
+	Username  string    `json:"username" db:"username"`
+	TokenHash string    `json:"-" db:"token_hash"`
+	ExpiresAt time.Time `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	IsUsed    bool      `json:"is_used" db:"is_used"`
 }
 
-// ReleaseIP звільняє IP адресу
-func (pool *IPPool) ReleaseIP(ip net.IP) {
-	delete(pool.Allocated, ip.String())
+// TokenRevocation - відкликання JWT токенів. Kind визначає, що означає Value:
+// "jti" - ID одного токена, "user" - ім'я користувача, "peer" - ID peer'а.
+// Для користувача і peer'а відкликаються токени, видані до RevokedAt.
+type TokenRevocation struct {
+	Kind      string    `json:"kind" db:"kind"`
+	Value     string    `json:"value" db:"value"`
+	RevokedAt time.Time `json:"revoked_at" db:"revoked_at"`
 }
 
-// nextIP повертає наступну IP адресу
-func nextIP(ip net.IP) net.IP {
-	next := make(net.IP, len(ip))
-	copy(next, ip)
-	for i := len(next) - 1; i >= 0; i-- {
-		next[i]++
-		if next[i] != 0 {
-			break
-		}
-	}
-	return next
+// RefreshToken - виданий клієнту непрозорий refresh токен. Зберігається лише
+// SHA-256 хеш. При кожному використанні токен замінюється новим з тим самим
+// FamilyID; повторне використання замінених токенів відкликає всю сім'ю.
+type RefreshToken struct {
+	ID        uuid.UUID  `json:"id" db:"id"`
+	FamilyID  uuid.UUID  `json:"family_id" db:"family_id"` // ID першого токена ланцюжка ротацій
+	PeerID    uuid.UUID  `json:"peer_id" db:"peer_id"`
+	UserID    uuid.UUID  `json:"user_id" db:"user_id"`
+	TokenHash string     `json:"-" db:"token_hash"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`       // коли токен замінено новим
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"` // коли відкликано сім'ю
+}
+
+// SigningKey - ключ підпису JWT. Ключі DER-кодовані (PKCS#8 і PKIX) в base64;
+// приватний ключ зберігається зашифрованим master-ключем, як і ключі WireGuard.
+// Ключ без ExpiresAt - активний, ним підписуються нові токени. Після ротації
+// старий ключ до ExpiresAt лише перевіряє вже видані токени.
+type SigningKey struct {
+	ID         string     `json:"kid" db:"kid"`
+	Algorithm  string     `json:"alg" db:"algorithm"`
+	PrivateKey string     `json:"-" db:"private_key"`
+	PublicKey  string     `json:"public_key" db:"public_key"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+}
+
+// TokenPair - токени клієнта: короткоживучий JWT для запитів до API і
+// довгоживучий refresh токен для отримання нової пари
+type TokenPair struct {
+	AccessToken        string    `json:"access_token"`
+	TokenExpiry        time.Time `json:"token_expiry"`
+	RefreshToken       string    `json:"refresh_token"`
+	RefreshTokenExpiry time.Time `json:"refresh_token_expiry"`
+}
+
+// RefreshRequest - запит на оновлення токенів (POST /api/v1/refresh)
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+	ClientName   string `json:"client_name,omitempty"` // лише для журналу
+}
+
+// RefreshResponse - відповідь на оновлення токенів
+type RefreshResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+	TokenPair
+}
+
+// EnrollResponse - відповідь на реєстрацію клієнта (POST /api/v1/enroll).
+// Приватного ключа клієнта сервер не знає, тому в ClientConfig він порожній.
+type EnrollResponse struct {
+	Success      bool          `json:"success"`
+	Message      string        `json:"message"`
+	PeerID       uuid.UUID     `json:"peer_id"`
+	AllowedIPs   []string      `json:"allowed_ips"`
+	ClientConfig *ClientConfig `json:"client_config,omitempty"`
+	TokenPair
 }
 
 // NewPeer створює новий peer з згенерованими ключами
@@ -151,6 +269,19 @@ func NewPeer(name string) (*Peer, error) {
 	}, nil
 }
 
+// DefaultRoutes повертає маршрути за замовчуванням для клієнта з адресами
+// addresses: 0.0.0.0/0 та, якщо клієнт має IPv6 адресу, ::/0
+func DefaultRoutes(addresses []string) []string {
+	routes := []string{"0.0.0.0/0"}
+	for _, address := range addresses {
+		ip, _, err := net.ParseCIDR(address)
+		if err == nil && ip.To4() == nil {
+			return append(routes, "::/0")
+		}
+	}
+	return routes
+}
+
 // ToWireGuardConfig генерує конфігурацію у форматі WireGuard
 func (c *ClientConfig) ToWireGuardConfig() string {
 	config := "[Interface]\n"
@@ -164,6 +295,10 @@ func (c *ClientConfig) ToWireGuardConfig() string {
 		config += "DNS = " + dns + "\n"
 	}
 
+	if c.Interface.MTU > 0 {
+		config += "MTU = " + strconv.Itoa(c.Interface.MTU) + "\n"
+	}
+
 	config += "\n[Peer]\n"
 	config += "PublicKey = " + c.Peer.PublicKey + "\n"
 	config += "Endpoint = " + c.Peer.Endpoint + "\n"
@@ -176,5 +311,9 @@ func (c *ClientConfig) ToWireGuardConfig() string {
 		config += "PresharedKey = " + c.Peer.PresharedKey + "\n"
 	}
 
+	if c.Peer.PersistentKeepalive > 0 {
+		config += "PersistentKeepalive = " + strconv.Itoa(c.Peer.PersistentKeepalive) + "\n"
+	}
+
 	return config
 }
@@ -2,6 +2,7 @@ package wg
 
 import (
 	"net"
+	"strings"
 	"testing"
 	"time"
 
@@ -226,3 +227,58 @@ func TestClientConfig_Basic(t *testing.T) {
 		})
 	}
 }
+
+func TestDefaultRoutes(t *testing.T) {
+	routes := DefaultRoutes([]string{"10.0.0.2/32"})
+	if len(routes) != 1 || routes[0] != "0.0.0.0/0" {
+		t.Errorf("DefaultRoutes(v4) = %v, want [0.0.0.0/0]", routes)
+	}
+
+	routes = DefaultRoutes([]string{"10.0.0.2/32", "fd00:77::2/128"})
+	if len(routes) != 2 || routes[1] != "::/0" {
+		t.Errorf("DefaultRoutes(dual-stack) = %v, want [0.0.0.0/0 ::/0]", routes)
+	}
+}
+
+func TestPeerStats_Observe(t *testing.T) {
+	stats := &PeerStats{}
+
+	stats.Observe(&HandshakeInfo{RxBytes: 100, TxBytes: 50})
+	stats.Observe(&HandshakeInfo{RxBytes: 150, TxBytes: 80})
+	if stats.RxBytes != 150 || stats.TxBytes != 80 {
+		t.Errorf("after growth = %d/%d, want 150/80", stats.RxBytes, stats.TxBytes)
+	}
+
+	// Лічильники скинуто (інтерфейс перестворено)
+	stats.Observe(&HandshakeInfo{RxBytes: 20, TxBytes: 10})
+	if stats.RxBytes != 170 || stats.TxBytes != 90 {
+		t.Errorf("after reset = %d/%d, want 170/90", stats.RxBytes, stats.TxBytes)
+	}
+}
+
+func TestClientConfig_ToWireGuardConfig(t *testing.T) {
+	config := &ClientConfig{
+		Interface: ClientInterface{PrivateKey: "client-private", Address: []string{"10.0.0.2/32"}, MTU: 1380},
+		Peer: ServerPeer{
+			PublicKey:           "server-public",
+			Endpoint:            "vpn.example.com:51821",
+			AllowedIPs:          []string{"0.0.0.0/0"},
+			PersistentKeepalive: 25,
+		},
+	}
+
+	got := config.ToWireGuardConfig()
+	for _, line := range []string{"MTU = 1380\n", "Endpoint = vpn.example.com:51821\n", "PersistentKeepalive = 25\n"} {
+		if !strings.Contains(got, line) {
+			t.Errorf("ToWireGuardConfig() missing %q in:\n%s", line, got)
+		}
+	}
+
+	// Нульові значення не потрапляють у конфігурацію
+	config.Interface.MTU = 0
+	config.Peer.PersistentKeepalive = 0
+	got = config.ToWireGuardConfig()
+	if strings.Contains(got, "MTU") || strings.Contains(got, "PersistentKeepalive") {
+		t.Errorf("ToWireGuardConfig() = %q, want no MTU and keepalive", got)
+	}
+}
@@ -0,0 +1,315 @@
+package wg
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// QuickConfig - конфігурація інтерфейсу у форматі wg-quick (/etc/wireguard/wg0.conf)
+type QuickConfig struct {
+	Interface QuickInterface
+	Peers     []QuickPeer
+}
+
+// QuickInterface - секція [Interface]
+type QuickInterface struct {
+	PrivateKey string
+	ListenPort int // 0 - не вказано
+	Address    []string
+	DNS        []string
+	MTU        int    // 0 - не вказано
+	FwMark     int    // 0 - не вказано або off
+	Table      string // порожній - не вказано
+
+	// Ignored - ключі wg-quick, які wg-orbit не переносить: PreUp, PostUp,
+	// PreDown, PostDown і SaveConfig, у форматі "Key = value"
+	Ignored []string
+}
+
+// QuickPeer - секція [Peer]
+type QuickPeer struct {
+	// Name - назва peer'а з коментаря; порожня, якщо коментаря немає
+	Name         string
+	PublicKey    string
+	PresharedKey string
+	Endpoint     string
+	AllowedIPs   []string
+
+	PersistentKeepalive int
+
+	// Line - номер рядка заголовка [Peer] для повідомлень
+	Line int
+}
+
+// nameCommentKeys - ключі коментарів, з яких береться назва peer'а,
+// напр. "# Name = alice" або "# friendly_name: alice"
+var nameCommentKeys = map[string]bool{
+	"name":          true,
+	"friendly_name": true,
+	"client":        true,
+}
+
+// ParseQuickConfig розбирає конфігурацію у форматі wg-quick.
+//
+// Як і wg-quick, назви секцій і ключів не залежать від регістру, а все після
+// # є коментарем. WireGuard не зберігає назв peer'ів, тому вони беруться з
+// коментарів: "# Name = alice" перед [Peer] або одразу після нього,
+// "### begin alice ###" (PiVPN) або звичайний коментар безпосередньо перед [Peer].
+func ParseQuickConfig(r io.Reader) (*QuickConfig, error) {
+	config := &QuickConfig{}
+	scanner := bufio.NewScanner(r)
+
+	var section string
+	var seenInterface bool
+	var peer *QuickPeer
+	var peerStarted bool // у секції [Peer] вже були ключі
+	var pendingName, pendingComment string
+
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" {
+			pendingName, pendingComment = "", ""
+			continue
+		}
+
+		if strings.HasPrefix(line, "#") {
+			// Явна назва на початку секції [Peer] належить їй,
+			// після ключів - наступному peer'у
+			name, explicit := parseNameComment(line)
+			switch {
+			case explicit && section == "peer" && !peerStarted:
+				peer.Name = name
+			case explicit:
+				pendingName = name
+			default:
+				pendingComment = name
+			}
+			continue
+		}
+
+		// Коментар у кінці рядка
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = strings.TrimSpace(line[:i])
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			switch strings.ToLower(strings.TrimSpace(line[1 : len(line)-1])) {
+			case "interface":
+				if seenInterface {
+					return nil, fmt.Errorf("line %d: duplicate [Interface] section", lineNo)
+				}
+				seenInterface = true
+				section = "interface"
+			case "peer":
+				if err := finishPeer(config, peer); err != nil {
+					return nil, err
+				}
+				name := pendingName
+				if name == "" {
+					name = pendingComment
+				}
+				peer = &QuickPeer{Name: name, Line: lineNo}
+				peerStarted = false
+				section = "peer"
+			default:
+				return nil, fmt.Errorf("line %d: unknown section %s", lineNo, line)
+			}
+			pendingName, pendingComment = "", ""
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key = value, got %q", lineNo, line)
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		var err error
+		switch section {
+		case "interface":
+			err = parseInterfaceKey(&config.Interface, key, value)
+		case "peer":
+			err = parsePeerKey(peer, key, value)
+			peerStarted = true
+		default:
+			err = fmt.Errorf("key %s outside of a section", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNo, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if err := finishPeer(config, peer); err != nil {
+		return nil, err
+	}
+	if !seenInterface {
+		return nil, fmt.Errorf("missing [Interface] section")
+	}
+	if config.Interface.PrivateKey == "" {
+		return nil, fmt.Errorf("missing PrivateKey in [Interface] section")
+	}
+
+	return config, nil
+}
+
+// parseNameComment повертає назву з рядка коментаря. explicit = true, якщо
+// назва задана явно ("# Name = alice", "### begin alice ###"); інакше
+// повертається весь текст коментаря.
+func parseNameComment(line string) (string, bool) {
+	text := strings.TrimSpace(strings.Trim(line, "#"))
+
+	if rest, ok := strings.CutPrefix(text, "begin "); ok {
+		return strings.TrimSpace(rest), true
+	}
+	if strings.HasPrefix(text, "end ") {
+		return "", false
+	}
+
+	for _, sep := range []string{"=", ":"} {
+		key, value, ok := strings.Cut(text, sep)
+		if ok && nameCommentKeys[strings.ToLower(strings.TrimSpace(key))] {
+			return strings.TrimSpace(value), true
+		}
+	}
+	return text, false
+}
+
+// finishPeer перевіряє і додає розібраного peer'а
+func finishPeer(config *QuickConfig, peer *QuickPeer) error {
+	if peer == nil {
+		return nil
+	}
+	if peer.PublicKey == "" {
+		return fmt.Errorf("line %d: [Peer] without PublicKey", peer.Line)
+	}
+	config.Peers = append(config.Peers, *peer)
+	return nil
+}
+
+// parseInterfaceKey застосовує ключ секції [Interface]
+func parseInterfaceKey(iface *QuickInterface, key, value string) error {
+	var err error
+	switch key {
+	case "privatekey":
+		iface.PrivateKey = value
+	case "listenport":
+		iface.ListenPort, err = parsePort(value)
+	case "address":
+		iface.Address = append(iface.Address, splitList(value)...)
+	case "dns":
+		iface.DNS = append(iface.DNS, splitList(value)...)
+	case "mtu":
+		iface.MTU, err = strconv.Atoi(value)
+	case "fwmark":
+		iface.FwMark, err = parseFwMark(value)
+	case "table":
+		iface.Table = value
+	case "preup", "postup", "predown", "postdown", "saveconfig":
+		iface.Ignored = append(iface.Ignored, canonicalKey(key)+" = "+value)
+	default:
+		return fmt.Errorf("unknown key %s in [Interface]", key)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", canonicalKey(key), err)
+	}
+	return nil
+}
+
+// parsePeerKey застосовує ключ секції [Peer]
+func parsePeerKey(peer *QuickPeer, key, value string) error {
+	var err error
+	switch key {
+	case "publickey":
+		peer.PublicKey = value
+	case "presharedkey":
+		peer.PresharedKey = value
+	case "endpoint":
+		peer.Endpoint = value
+	case "allowedips":
+		peer.AllowedIPs = append(peer.AllowedIPs, splitList(value)...)
+	case "persistentkeepalive":
+		if value != "off" {
+			peer.PersistentKeepalive, err = strconv.Atoi(value)
+			if err == nil {
+				err = ValidatePersistentKeepalive(peer.PersistentKeepalive)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown key %s in [Peer]", key)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", canonicalKey(key), err)
+	}
+	return nil
+}
+
+// parsePort розбирає UDP порт
+func parsePort(value string) (int, error) {
+	port, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, err
+	}
+	if port < 0 || port > 65535 {
+		return 0, fmt.Errorf("port %d is out of range", port)
+	}
+	return port, nil
+}
+
+// parseFwMark розбирає fwmark: десяткове або шістнадцяткове (0x...) число чи off
+func parseFwMark(value string) (int, error) {
+	if value == "off" {
+		return 0, nil
+	}
+	mark, err := strconv.ParseUint(value, 0, 32)
+	if err != nil {
+		return 0, err
+	}
+	return int(mark), nil
+}
+
+// splitList розбирає список значень через кому
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// canonicalKey повертає ключ у написанні wg-quick для повідомлень
+func canonicalKey(key string) string {
+	switch key {
+	case "privatekey":
+		return "PrivateKey"
+	case "listenport":
+		return "ListenPort"
+	case "fwmark":
+		return "FwMark"
+	case "mtu":
+		return "MTU"
+	case "preup":
+		return "PreUp"
+	case "postup":
+		return "PostUp"
+	case "predown":
+		return "PreDown"
+	case "postdown":
+		return "PostDown"
+	case "saveconfig":
+		return "SaveConfig"
+	case "persistentkeepalive":
+		return "PersistentKeepalive"
+	default:
+		return key
+	}
+}
@@ -0,0 +1,135 @@
+package wg
+
+import (
+	"strings"
+	"testing"
+)
+
+const testQuickConfig = `# Office VPN
+[Interface]
+PrivateKey = yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=
+ListenPort = 51820
+Address = 10.0.0.1/24, fd00:77::1/64
+DNS = 1.1.1.1
+FwMark = 0xca6c
+PostUp = iptables -A FORWARD -i %i -j ACCEPT # allow forwarding
+SaveConfig = false
+
+# Name = alice
+[Peer]
+PublicKey = xTIBA5rboUvnH4htodjb6e697QjLERt1NAB4mZqp8Dg=
+AllowedIPs = 10.0.0.2/32, fd00:77::2/128
+
+[peer]
+# friendly_name: bob
+publickey = TrMvSoP4jYQlY6RIzBgbssQqY3vxI2Pi+y71lOWWXX0=
+PresharedKey = FpCyhws9cxwWoV4xELtfJvjJN+zQVRPISllRWgeopVE=
+Endpoint = 203.0.113.7:51820
+AllowedIPs = 10.0.0.3/32
+AllowedIPs = 192.168.10.0/24
+PersistentKeepalive = 25
+
+### begin carol ###
+[Peer]
+PublicKey = gN65BkIKy1eCE9pP1wdc8ROUtkHLF2PfAqYdyYBz6EA=
+AllowedIPs = 10.0.0.4/32
+### end carol ###
+
+# dave's laptop
+[Peer]
+PublicKey = HIgo9xNzJMWLKASShiTqIybxZ0U3wGLiUeJ1PKf8ykw=
+AllowedIPs = 10.0.0.5/32
+
+[Peer]
+PublicKey = q7RkgNL3Ob3T4mDBk1WvGrbjXrTQTzGhF7Gb6uEP9Es=
+AllowedIPs = 10.0.0.6/32
+`
+
+func TestParseQuickConfig(t *testing.T) {
+	config, err := ParseQuickConfig(strings.NewReader(testQuickConfig))
+	if err != nil {
+		t.Fatalf("ParseQuickConfig() error: %v", err)
+	}
+
+	iface := config.Interface
+	if iface.PrivateKey != "yAnz5TF+lXXJte14tji3zlMNq+hd2rYUIgJBgB3fBmk=" || iface.ListenPort != 51820 || iface.FwMark != 0xca6c {
+		t.Errorf("interface = %+v", iface)
+	}
+	if strings.Join(iface.Address, ",") != "10.0.0.1/24,fd00:77::1/64" || strings.Join(iface.DNS, ",") != "1.1.1.1" {
+		t.Errorf("interface addresses = %v, DNS = %v", iface.Address, iface.DNS)
+	}
+	if len(iface.Ignored) != 2 || iface.Ignored[0] != "PostUp = iptables -A FORWARD -i %i -j ACCEPT" {
+		t.Errorf("ignored = %q, want PostUp and SaveConfig without the comment", iface.Ignored)
+	}
+
+	wantNames := []string{"alice", "bob", "carol", "dave's laptop", ""}
+	if len(config.Peers) != len(wantNames) {
+		t.Fatalf("parsed %d peers, want %d", len(config.Peers), len(wantNames))
+	}
+	for i, name := range wantNames {
+		if config.Peers[i].Name != name {
+			t.Errorf("peer %d name = %q, want %q", i, config.Peers[i].Name, name)
+		}
+	}
+
+	bob := config.Peers[1]
+	if bob.PresharedKey == "" || bob.Endpoint != "203.0.113.7:51820" || bob.PersistentKeepalive != 25 || bob.Line != 16 {
+		t.Errorf("bob = %+v", bob)
+	}
+	if strings.Join(bob.AllowedIPs, ",") != "10.0.0.3/32,192.168.10.0/24" {
+		t.Errorf("bob allowed IPs = %v", bob.AllowedIPs)
+	}
+}
+
+func TestParseQuickConfig_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  string
+		wantErr string
+	}{
+		{
+			name:    "no interface",
+			config:  "[Peer]\nPublicKey = key=\n",
+			wantErr: "missing [Interface]",
+		},
+		{
+			name:    "no private key",
+			config:  "[Interface]\nListenPort = 51820\n",
+			wantErr: "missing PrivateKey",
+		},
+		{
+			name:    "peer without public key",
+			config:  "[Interface]\nPrivateKey = key=\n[Peer]\nAllowedIPs = 10.0.0.2/32\n",
+			wantErr: "line 3: [Peer] without PublicKey",
+		},
+		{
+			name:    "unknown key",
+			config:  "[Interface]\nPrivateKey = key=\nListenPrt = 51820\n",
+			wantErr: "line 3: unknown key listenprt",
+		},
+		{
+			name:    "key outside section",
+			config:  "PrivateKey = key=\n",
+			wantErr: "outside of a section",
+		},
+		{
+			name:    "invalid port",
+			config:  "[Interface]\nPrivateKey = key=\nListenPort = 70000\n",
+			wantErr: "invalid ListenPort",
+		},
+		{
+			name:    "duplicate interface",
+			config:  "[Interface]\nPrivateKey = key=\n[Interface]\n",
+			wantErr: "duplicate [Interface]",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseQuickConfig(strings.NewReader(tt.config))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseQuickConfig() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}